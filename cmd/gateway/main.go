@@ -44,7 +44,7 @@ func gracefulShutdown(name string, server ports.Server, done chan bool) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	if err := server.App().ShutdownWithContext(ctx); err != nil {
+	if err := server.Shutdown(ctx); err != nil {
 		log.Printf("%s forced to shutdown with error: %v", name, err)
 	}
 
@@ -7,9 +7,15 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"slices"
+	"time"
 
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
 	"github.com/kasragay/backend/internal/ports"
 	"github.com/kasragay/backend/internal/repository"
+	"github.com/kasragay/backend/internal/services"
 	"github.com/kasragay/backend/internal/utils"
 
 	"syscall"
@@ -28,6 +34,8 @@ func CreateSuperUser() {
 	}
 	logger := utils.NewLogger()
 	relRepo := repository.NewRelationalRepo(logger)
+	mongo := repository.NewMongoRepo(logger)
+	defer func() { _ = mongo.Close() }()
 
 	reader := bufio.NewReader(os.Stdin)
 	if *username == "" {
@@ -63,6 +71,7 @@ func CreateSuperUser() {
 	if err != nil {
 		log.Fatalf("error creating superuser: %v", err)
 	}
+	RecordCommand(services.NewAuditService(logger, mongo), "createsuperuser", resp.Id, ports.AdminUserType)
 	fmt.Println("superuser created successfully.")
 	fmt.Println("Id:", resp.Id)
 }
@@ -76,6 +85,8 @@ func DeleteSuperUser() {
 
 	logger := utils.NewLogger()
 	relRepo := repository.NewRelationalRepo(logger)
+	mongo := repository.NewMongoRepo(logger)
+	defer func() { _ = mongo.Close() }()
 
 	reader := bufio.NewReader(os.Stdin)
 	if *username == "" {
@@ -94,14 +105,388 @@ func DeleteSuperUser() {
 	if err := relRepo.DeleteUserById(context.Background(), user.GetId(), ports.AdminUserType); err != nil {
 		log.Fatalf("error deleting superuser: %v", err)
 	}
+	RecordCommand(services.NewAuditService(logger, mongo), "deletesuperuser", user.GetId(), ports.AdminUserType)
 	fmt.Println("superuser deleted successfully.")
 	fmt.Println("Id:", user.GetId())
 }
 
+func VerifyAuditLog() {
+	cmd := flag.NewFlagSet("verify-audit-log", flag.ExitOnError)
+	if err := cmd.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("error parsing command line arguments: %v", err)
+	}
+	logger := utils.NewLogger()
+	mongo := repository.NewMongoRepo(logger)
+	defer func() { _ = mongo.Close() }()
+	audit := services.NewAuditService(logger, mongo)
+
+	resp, err := audit.Verify(context.Background())
+	if err != nil {
+		log.Fatalf("error verifying audit log: %v", err)
+	}
+	RecordCommand(audit, "verify-audit-log", uuid.Nil, "")
+	if !resp.Valid {
+		fmt.Printf("audit log is broken at entry %d: %s\n", resp.BrokenAt, resp.Reason)
+		os.Exit(1)
+	}
+	fmt.Printf("audit log is valid; %d entries checked.\n", resp.Checked)
+}
+
+func StorageGc() {
+	cmd := flag.NewFlagSet("storage-gc", flag.ExitOnError)
+	dryRun := cmd.Bool("dry-run", false, "only report what would be removed or fixed")
+	minAge := cmd.Duration("min-age", time.Hour, "leave objects written more recently than this alone")
+	uploadMaxAge := cmd.Duration("upload-max-age", 24*time.Hour, "remove uploads older than this")
+	if err := cmd.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("error parsing command line arguments: %v", err)
+	}
+	logger := utils.NewLogger()
+	mongo := repository.NewMongoRepo(logger)
+	defer func() { _ = mongo.Close() }()
+	gc := services.NewStorageGcService(
+		logger, repository.NewRelationalRepo(logger), mongo, repository.NewS3Repo(logger),
+	)
+
+	report, err := gc.Run(context.Background(), &ports.StorageGcOptions{
+		DryRun:       *dryRun,
+		MinAge:       *minAge,
+		UploadMaxAge: *uploadMaxAge,
+	})
+	if err != nil {
+		log.Fatalf("error collecting storage garbage: %v", err)
+	}
+	for _, action := range report.Actions {
+		status := "done"
+		switch {
+		case report.DryRun:
+			status = "would"
+		case action.Err != nil:
+			status = "FAILED"
+		}
+		fmt.Printf("%-6s %-18s %s (%s)\n", status, action.Kind, action.Target, action.Reason)
+		if action.Err != nil {
+			fmt.Printf("       %v\n", action.Err)
+		}
+	}
+	fmt.Printf("%d objects scanned, %d skipped, %d actions, %d failed.\n", report.Scanned, report.Skipped, len(report.Actions), report.Failed())
+	if report.DryRun {
+		return
+	}
+	RecordCommand(services.NewAuditService(logger, mongo), "storage-gc", uuid.Nil, "")
+	if report.Failed() > 0 {
+		os.Exit(1)
+	}
+}
+
+// Jobs lists the periodic jobs and their runs, and triggers, pauses or
+// resumes them. Triggered jobs are run by the scheduler of a running server.
+func Jobs() {
+	usage := "usage: settings jobs list | runs [-size n] [-status s] <name> | trigger <name> | pause <name> | resume <name>"
+	if len(os.Args) < 3 {
+		log.Fatal(usage)
+	}
+	action := os.Args[2]
+	cmd := flag.NewFlagSet("jobs "+action, flag.ExitOnError)
+	size := cmd.Int64("size", 20, "runs to list")
+	status := cmd.String("status", "", "only list runs in this status")
+	if err := cmd.Parse(os.Args[3:]); err != nil {
+		log.Fatalf("error parsing command line arguments: %v", err)
+	}
+	var name ports.JobName
+	if action != "list" {
+		if cmd.NArg() != 1 {
+			log.Fatal(usage)
+		}
+		name = ports.JobName(cmd.Arg(0))
+	}
+	logger := utils.NewLogger()
+	rel, mongo := repository.NewRelationalRepo(logger), repository.NewMongoRepo(logger)
+	defer func() { _ = mongo.Close() }()
+	audit := services.NewAuditService(logger, mongo)
+	jobs := services.NewJobService(
+		logger, repository.NewCacheRepo(logger), mongo, audit,
+		services.NewJobs(logger, rel, mongo, repository.NewS3Repo(logger), audit),
+	)
+
+	ctx := context.Background()
+	switch action {
+	case "list":
+		resp, err := jobs.Jobs(ctx)
+		if err != nil {
+			log.Fatalf("error listing jobs: %v", err)
+		}
+		for _, job := range resp.Jobs {
+			state := "active"
+			if job.Paused {
+				state = "paused"
+			}
+			next, last := "-", "-"
+			if job.NextRunAt != nil {
+				next = job.NextRunAt.Format(time.RFC3339)
+			}
+			if job.LastRunAt != nil {
+				last = fmt.Sprintf("%s %s", job.LastRunAt.Format(time.RFC3339), job.LastStatus)
+			}
+			fmt.Printf("%-20s %-14s %-7s next %-25s last %s\n", job.Name, job.Schedule, state, next, last)
+		}
+	case "runs":
+		resp, err := jobs.Runs(ctx, &ports.AdminJobRunsGetRequest{
+			Name:       name,
+			Status:     ports.JobRunStatus(*status),
+			Pagination: ports.Pagination{Page: 1, Size: *size},
+		})
+		if err != nil {
+			log.Fatalf("error listing runs of %s: %v", name, err)
+		}
+		for _, run := range resp.Runs {
+			fmt.Printf("%s %-9s %-8s %8dms %s %s\n",
+				run.StartedAt.Format(time.RFC3339), run.Status, run.Trigger, run.DurationMs, run.Owner, run.Summary)
+			if run.Error != "" {
+				fmt.Printf("       %s\n", run.Error)
+			}
+		}
+		fmt.Printf("%d of %d runs.\n", len(resp.Runs), resp.Total)
+	case "trigger", "pause", "resume":
+		run := map[string]func(context.Context, ports.JobName, uuid.UUID) error{
+			"trigger": jobs.Trigger,
+			"pause":   jobs.Pause,
+			"resume":  jobs.Resume,
+		}[action]
+		if err := run(ctx, name, uuid.Nil); err != nil {
+			log.Fatalf("error running %s on %s: %v", action, name, err)
+		}
+		RecordCommand(audit, "jobs "+action+" "+string(name), uuid.Nil, "")
+		fmt.Printf("job %s: %s done.\n", name, action)
+	default:
+		log.Fatal(usage)
+	}
+}
+
+// Migrate applies, reverts, lists or creates relational schema migrations.
+// Servers never migrate by themselves, so this runs before deploying them.
+func Migrate() {
+	usage := "usage: settings migrate up [-steps n] | down [-steps n] | status | create <name>"
+	if len(os.Args) < 3 {
+		log.Fatal(usage)
+	}
+	action := os.Args[2]
+	cmd := flag.NewFlagSet("migrate "+action, flag.ExitOnError)
+	steps := cmd.Int("steps", 0, "migrations to apply, all when 0; migrations to revert, 1 when 0")
+	dir := cmd.String("dir", repository.MigrationsDir, "directory create writes the migration to")
+	if err := cmd.Parse(os.Args[3:]); err != nil {
+		log.Fatalf("error parsing command line arguments: %v", err)
+	}
+	if action == "create" {
+		if cmd.NArg() != 1 {
+			log.Fatal(usage)
+		}
+		upPath, downPath, err := repository.CreateMigration(*dir, cmd.Arg(0))
+		if err != nil {
+			log.Fatalf("error creating migration: %v", err)
+		}
+		fmt.Printf("created %s and %s.\n", upPath, downPath)
+		return
+	}
+	logger := utils.NewLogger()
+	rel := repository.NewRelationalRepo(logger)
+	mongo := repository.NewMongoRepo(logger)
+	defer func() { _ = mongo.Close() }()
+	audit := services.NewAuditService(logger, mongo)
+
+	ctx := context.Background()
+	switch action {
+	case "status":
+		statuses, err := rel.MigrationStatus(ctx)
+		if err != nil {
+			log.Fatalf("error reading migration status: %v", err)
+		}
+		for _, status := range statuses {
+			appliedAt := "-"
+			if !status.AppliedAt.IsZero() {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d %-40s %-8s %s\n", status.Version, status.Name, status.State, appliedAt)
+		}
+	case "up":
+		applied, err := rel.MigrateUp(ctx, *steps)
+		for _, status := range applied {
+			fmt.Printf("applied  %04d_%s\n", status.Version, status.Name)
+		}
+		if len(applied) > 0 {
+			RecordCommand(audit, fmt.Sprintf("migrate up to %d", applied[len(applied)-1].Version), uuid.Nil, "")
+		}
+		if err != nil {
+			log.Fatalf("error migrating up: %v", err)
+		}
+		fmt.Printf("%d migrations applied.\n", len(applied))
+	case "down":
+		if *steps == 0 {
+			*steps = 1
+		}
+		reverted, err := rel.MigrateDown(ctx, *steps)
+		for _, status := range reverted {
+			fmt.Printf("reverted %04d_%s\n", status.Version, status.Name)
+		}
+		if len(reverted) > 0 {
+			RecordCommand(audit, fmt.Sprintf("migrate down from %d", reverted[0].Version), uuid.Nil, "")
+		}
+		if err != nil {
+			log.Fatalf("error migrating down: %v", err)
+		}
+		fmt.Printf("%d migrations reverted.\n", len(reverted))
+	default:
+		log.Fatal(usage)
+	}
+}
+
+// Seed loads seeds/{env}/seed.json, creating its users or bringing them
+// back to it, so it can run again after every reset of a dev or staging
+// database.
+func Seed() {
+	cmd := flag.NewFlagSet("seed", flag.ExitOnError)
+	env := cmd.String("env", "", "seed to load, e.g. dev or staging")
+	dir := cmd.String("dir", "seeds", "directory holding a directory per seed")
+	if err := cmd.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("error parsing command line arguments: %v", err)
+	}
+	if *env == "" {
+		log.Fatal("-env is required.")
+	}
+	path := filepath.Join(*dir, *env)
+	if _, err := os.Stat(filepath.Join(path, services.SeedFile)); err != nil {
+		log.Fatalf("error reading seed %s: %v", *env, err)
+	}
+	logger := utils.NewLogger()
+	mongo := repository.NewMongoRepo(logger)
+	defer func() { _ = mongo.Close() }()
+	seeder := services.NewSeedService(
+		logger, repository.NewRelationalRepo(logger), mongo, repository.NewS3Repo(logger),
+	)
+
+	report, err := seeder.Load(context.Background(), os.DirFS(path))
+	if report != nil {
+		for _, name := range report.Created {
+			fmt.Printf("created   %s\n", name)
+		}
+		for _, name := range report.Updated {
+			fmt.Printf("updated   %s\n", name)
+		}
+		for _, name := range report.Unchanged {
+			fmt.Printf("unchanged %s\n", name)
+		}
+		RecordCommand(services.NewAuditService(logger, mongo), "seed "+*env, uuid.Nil, "")
+	}
+	if err != nil {
+		log.Fatalf("error loading seed %s: %v", *env, err)
+	}
+	fmt.Printf("seed %s loaded: %d created, %d updated, %d unchanged, %d relations.\n",
+		*env, len(report.Created), len(report.Updated), len(report.Unchanged), report.Relations)
+}
+
+// RenderTemplate prints or writes message templates rendered with sample
+// data. With -out every selected part lands in {out}/{name}/{locale}.{part},
+// which CI can diff against committed snapshots. It has no side effects, so it
+// is not recorded in the audit log.
+func RenderTemplate() {
+	cmd := flag.NewFlagSet("render-template", flag.ExitOnError)
+	name := cmd.String("name", "", "template to render; all when empty")
+	locale := cmd.String("locale", "", "locale to render; all when empty")
+	part := cmd.String("part", "", "part to render: subject, text, html or sms; all when empty")
+	data := cmd.String("data", "", "JSON object overriding the sample data, e.g. {\"otp_type\":\"sign-up\"}")
+	out := cmd.String("out", "", "directory to write the parts to instead of stdout")
+	if err := cmd.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("error parsing command line arguments: %v", err)
+	}
+	overrides := &ports.MessageTemplateData{}
+	if *data != "" {
+		if err := sonic.UnmarshalString(*data, overrides); err != nil {
+			log.Fatalf("error parsing -data: %v", err)
+		}
+	}
+	parts := ports.MessageTemplateParts()
+	if *part != "" {
+		if !slices.Contains(parts, ports.MessageTemplatePart(*part)) {
+			log.Fatalf("unknown part '%s'", *part)
+		}
+		parts = []ports.MessageTemplatePart{ports.MessageTemplatePart(*part)}
+	}
+	templates := services.NewTemplateService(utils.NewLogger(), nil, nil)
+
+	rendered := 0
+	for _, template := range templates.Templates() {
+		if *name != "" && string(template.Name) != *name {
+			continue
+		}
+		for _, templateLocale := range template.Locales {
+			if *locale != "" && string(templateLocale) != *locale {
+				continue
+			}
+			message, err := templates.Render(
+				context.Background(), template.Name, templateLocale, ports.SampleMessageTemplateData(template.Name).Merge(overrides),
+			)
+			if err != nil {
+				log.Fatalf("error rendering %s in %s: %v", template.Name, templateLocale, err)
+			}
+			contents := map[ports.MessageTemplatePart]string{
+				ports.SubjectMessageTemplatePart: message.Subject,
+				ports.TextMessageTemplatePart:    message.Text,
+				ports.HtmlMessageTemplatePart:    message.Html,
+				ports.SmsMessageTemplatePart:     message.Sms,
+			}
+			extensions := map[ports.MessageTemplatePart]string{
+				ports.SubjectMessageTemplatePart: "subject.txt",
+				ports.TextMessageTemplatePart:    "txt",
+				ports.HtmlMessageTemplatePart:    "html",
+				ports.SmsMessageTemplatePart:     "sms.txt",
+			}
+			for _, p := range parts {
+				if *out == "" {
+					fmt.Printf("==> %s/%s.%s <==\n%s\n\n", template.Name, templateLocale, extensions[p], contents[p])
+					continue
+				}
+				path := filepath.Join(*out, string(template.Name), string(templateLocale)+"."+extensions[p])
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					log.Fatalf("error creating %s: %v", filepath.Dir(path), err)
+				}
+				if err := os.WriteFile(path, []byte(contents[p]+"\n"), 0o644); err != nil {
+					log.Fatalf("error writing %s: %v", path, err)
+				}
+			}
+			if *out != "" {
+				fmt.Printf("%s/%s: sms is %d %s segments\n", template.Name, templateLocale, message.SmsSegments, message.SmsEncoding)
+			}
+			rendered++
+		}
+	}
+	if rendered == 0 {
+		log.Fatalf("no template matches -name '%s' and -locale '%s'", *name, *locale)
+	}
+}
+
+// RecordCommand appends the executed settings command to the audit log,
+// through the Mongo connection the command opened. The command has no
+// authenticated actor, so the operating system user and host are kept
+// instead.
+func RecordCommand(audit ports.AuditService, command string, targetId uuid.UUID, targetType ports.UserType) {
+	hostname, _ := os.Hostname()
+	if err := audit.Record(
+		context.Background(), uuid.Nil, "", ports.SettingsCommandAuditAction, targetId, targetType,
+		map[string]string{"command": command, "os_user": os.Getenv("USER"), "hostname": hostname},
+	); err != nil {
+		log.Fatalf("error recording %s in audit log: %v", command, err)
+	}
+}
+
 func main() {
 	subcommands := map[string]func(){
-		"createsuperuser": CreateSuperUser,
-		"deletesuperuser": DeleteSuperUser,
+		"createsuperuser":  CreateSuperUser,
+		"deletesuperuser":  DeleteSuperUser,
+		"verify-audit-log": VerifyAuditLog,
+		"storage-gc":       StorageGc,
+		"render-template":  RenderTemplate,
+		"jobs":             Jobs,
+		"migrate":          Migrate,
+		"seed":             Seed,
 	}
 
 	if len(os.Args) < 2 {
@@ -0,0 +1,20 @@
+package clients
+
+// MailTlsMode is how a connection to a mail server, SMTP or POP3, is secured.
+type MailTlsMode string
+
+const (
+	// StartTlsMailTlsMode upgrades a plain connection and refuses servers that
+	// cannot, as on SMTP port 587.
+	StartTlsMailTlsMode MailTlsMode = "starttls"
+	// ImplicitMailTlsMode speaks TLS from the start, as on SMTP port 465 and
+	// POP3 port 995.
+	ImplicitMailTlsMode MailTlsMode = "tls"
+	// NoneMailTlsMode talks in the clear, for local stand-ins such as mailpit.
+	NoneMailTlsMode MailTlsMode = "none"
+)
+
+// MailTlsModes are the values accepted by the *_TLS settings.
+func MailTlsModes() []MailTlsMode {
+	return []MailTlsMode{StartTlsMailTlsMode, ImplicitMailTlsMode, NoneMailTlsMode}
+}
@@ -0,0 +1,146 @@
+package clients
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const pop3MailboxCaller = packageCaller + ".Pop3Mailbox"
+
+type Pop3Options struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Tls      MailTlsMode
+	// Timeout bounds dialing and every command.
+	Timeout time.Duration
+}
+
+// Pop3Mailbox reads a mailbox over POP3 (RFC 1939). A connection lasts for one
+// Drain, and deletions only take effect once it ends with QUIT, so a drain
+// that breaks off leaves every message in place for the next one.
+type Pop3Mailbox struct {
+	logger *utils.Logger
+	opts   Pop3Options
+	addr   string
+}
+
+func NewPop3Mailbox(logger *utils.Logger, opts Pop3Options) ports.Mailbox {
+	return &Pop3Mailbox{
+		logger: logger,
+		opts:   opts,
+		addr:   net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port)),
+	}
+}
+
+func (m *Pop3Mailbox) Drain(ctx context.Context, fn func(msg []byte) error) (err error) {
+	defer func() { err = utils.FuncPipe(pop3MailboxCaller+".Drain", err) }()
+	conn, text, err := m.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stat, err := m.cmd(conn, text, "STAT")
+	if err != nil {
+		return err
+	}
+	count, _, _ := strings.Cut(stat, " ")
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return errors.New("pop3 server answered STAT with " + stat)
+	}
+	for i := 1; i <= n && ctx.Err() == nil; i++ {
+		if _, err = m.cmd(conn, text, "RETR %d", i); err != nil {
+			return err
+		}
+		msg, err := text.ReadDotBytes()
+		if err != nil {
+			return err
+		}
+		if err := fn(msg); err != nil {
+			m.logger.Error(ctx, err, "bounce mailbox message "+strconv.Itoa(i)+" was kept")
+			continue
+		}
+		if _, err = m.cmd(conn, text, "DELE %d", i); err != nil {
+			return err
+		}
+	}
+	_, err = m.cmd(conn, text, "QUIT")
+	return err
+}
+
+// dial connects, secures and logs in.
+func (m *Pop3Mailbox) dial(ctx context.Context) (conn net.Conn, text *textproto.Conn, err error) {
+	dialer := &net.Dialer{Timeout: m.opts.Timeout}
+	tlsConfig := &tls.Config{ServerName: m.opts.Host}
+	if m.opts.Tls == ImplicitMailTlsMode {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", m.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", m.addr)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			_ = conn.Close()
+		}
+	}()
+	text = textproto.NewConn(conn)
+	_ = conn.SetDeadline(time.Now().Add(m.opts.Timeout))
+	if _, err = pop3Reply(text); err != nil {
+		return nil, nil, err
+	}
+	if m.opts.Tls == StartTlsMailTlsMode {
+		if _, err = m.cmd(conn, text, "STLS"); err != nil {
+			return nil, nil, err
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			return nil, nil, err
+		}
+		conn, text = tlsConn, textproto.NewConn(tlsConn)
+	}
+	if _, err = m.cmd(conn, text, "USER %s", m.opts.Username); err != nil {
+		return nil, nil, err
+	}
+	// The reply to PASS is reported rather than the command, which would
+	// carry the password.
+	if _, err = m.cmd(conn, text, "PASS %s", m.opts.Password); err != nil {
+		return nil, nil, errors.New("pop3 login failed: " + err.Error())
+	}
+	ok = true
+	return conn, text, nil
+}
+
+func (m *Pop3Mailbox) cmd(conn net.Conn, text *textproto.Conn, format string, args ...any) (reply string, err error) {
+	_ = conn.SetDeadline(time.Now().Add(m.opts.Timeout))
+	if err = text.PrintfLine(format, args...); err != nil {
+		return "", err
+	}
+	return pop3Reply(text)
+}
+
+// pop3Reply reads a status line and returns what follows +OK.
+func pop3Reply(text *textproto.Conn) (string, error) {
+	line, err := text.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	if rest, ok := strings.CutPrefix(line, "+OK"); ok {
+		return strings.TrimSpace(rest), nil
+	}
+	return "", fmt.Errorf("pop3 server answered %q", line)
+}
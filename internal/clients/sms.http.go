@@ -0,0 +1,94 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+	"github.com/valyala/fasthttp"
+)
+
+const httpSmsCaller = packageCaller + ".HttpSms"
+
+// HttpSms posts messages as JSON to a generic gateway, which is how most
+// regional SMS aggregators are integrated:
+//
+//	POST $SMS_HTTP_URL
+//	Authorization: $SMS_HTTP_AUTHORIZATION
+//	{"from": "+44...", "to": "+98...", "text": "..."}
+//
+// Any 2xx response counts as accepted. A JSON response with an "id" is kept as
+// the provider message id for delivery receipts.
+type HttpSms struct {
+	client        *fasthttp.Client
+	url           string
+	authorization string
+	timeout       time.Duration
+}
+
+type httpSmsResponse struct {
+	Id string `json:"id"`
+}
+
+type httpSmsRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Text string `json:"text"`
+}
+
+func NewHttpSmsProvider(logger *utils.Logger) ports.SmsProvider {
+	url := os.Getenv("SMS_HTTP_URL")
+	if url == "" {
+		logger.Fatal(context.Background(), "SMS_HTTP_URL is not set")
+	}
+	return &HttpSms{
+		client:        &fasthttp.Client{},
+		url:           url,
+		authorization: os.Getenv("SMS_HTTP_AUTHORIZATION"),
+		timeout:       10 * time.Second,
+	}
+}
+
+func (p *HttpSms) Name() ports.SmsProviderName {
+	return ports.HttpSmsProviderName
+}
+
+func (p *HttpSms) Send(ctx context.Context, src, dst, message string) (providerMessageId string, err error) {
+	defer func() { err = utils.FuncPipe(httpSmsCaller+".Send", err) }()
+	body, err := sonic.Marshal(httpSmsRequest{From: src, To: dst, Text: message})
+	if err != nil {
+		return "", err
+	}
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer func() {
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(resp)
+	}()
+	req.SetRequestURI(p.url)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetContentType("application/json")
+	if p.authorization != "" {
+		req.Header.Set(fasthttp.HeaderAuthorization, p.authorization)
+	}
+	req.SetBody(body)
+
+	timeout := p.timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+	if err = p.client.DoTimeout(req, resp, timeout); err != nil {
+		return "", err
+	}
+	if resp.StatusCode()/100 != 2 {
+		return "", fmt.Errorf("sms gateway returned %d: %s", resp.StatusCode(), string(resp.Body()))
+	}
+	var accepted httpSmsResponse
+	// Gateways that answer with anything but JSON just get no receipts.
+	_ = sonic.Unmarshal(resp.Body(), &accepted)
+	return accepted.Id, nil
+}
@@ -0,0 +1,143 @@
+package clients
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const sinkSmsCaller = packageCaller + ".SinkSms"
+
+// SinkSms keeps messages instead of delivering them. Without SMS_SINK_DIR
+// they live in memory; with it they are also appended to sms.jsonl in that
+// directory, so they survive restarts and can be tailed.
+type SinkSms struct {
+	logger *utils.Logger
+	mu     sync.RWMutex
+	// messages is ordered oldest first and capped at limit.
+	messages []ports.SmsMessage
+	limit    int
+	file     string
+}
+
+func NewSinkSmsProvider(logger *utils.Logger) ports.SmsSink {
+	limit := 1000
+	if limit_ := os.Getenv("SMS_SINK_LIMIT"); limit_ != "" {
+		var err error
+		if limit, err = strconv.Atoi(limit_); err != nil || limit < 1 {
+			logger.Fatal(context.Background(), "SMS_SINK_LIMIT is not a valid positive int")
+		}
+	}
+	p := &SinkSms{logger: logger, limit: limit}
+	if dir := os.Getenv("SMS_SINK_DIR"); dir != "" {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			logger.Fatalf(context.Background(), "Failed to create SMS_SINK_DIR: %v", err)
+		}
+		p.file = filepath.Join(dir, "sms.jsonl")
+		if err := p.load(); err != nil {
+			logger.Fatalf(context.Background(), "Failed to load %s: %v", p.file, err)
+		}
+	}
+	return p
+}
+
+func (p *SinkSms) Name() ports.SmsProviderName {
+	return ports.SinkSmsProviderName
+}
+
+func (p *SinkSms) Send(ctx context.Context, src, dst, message string) (providerMessageId string, err error) {
+	defer func() { err = utils.FuncPipe(sinkSmsCaller+".Send", err) }()
+	msg := ports.SmsMessage{
+		Id:        uuid.NewString(),
+		From:      src,
+		To:        dst,
+		Body:      message,
+		CreatedAt: time.Now().UTC(),
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.file != "" {
+		if err = p.append(msg); err != nil {
+			return "", err
+		}
+	}
+	p.push(msg)
+	p.logger.Infof(ctx, "sms to %s kept in sink", utils.MaskPhone(dst))
+	return msg.Id, nil
+}
+
+func (p *SinkSms) Messages(ctx context.Context, dst string, pagination *ports.Pagination) (messages []ports.SmsMessage, total int64, err error) {
+	defer func() { err = utils.FuncPipe(sinkSmsCaller+".Messages", err) }()
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	// Newest first, which is what someone waiting for an OTP wants.
+	matched := make([]ports.SmsMessage, 0, len(p.messages))
+	for _, msg := range slices.Backward(p.messages) {
+		if dst == "" || msg.To == dst {
+			matched = append(matched, msg)
+		}
+	}
+	total = int64(len(matched))
+	start := min(pagination.Skip(), total)
+	end := min(start+pagination.Size, total)
+	return matched[start:end], total, nil
+}
+
+func (p *SinkSms) push(msg ports.SmsMessage) {
+	p.messages = append(p.messages, msg)
+	if over := len(p.messages) - p.limit; over > 0 {
+		p.messages = slices.Delete(p.messages, 0, over)
+	}
+}
+
+func (p *SinkSms) append(msg ports.SmsMessage) (err error) {
+	line, err := sonic.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// load restores the newest messages of a previous run.
+func (p *SinkSms) load() (err error) {
+	f, err := os.Open(p.file)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var msg ports.SmsMessage
+		if err := sonic.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		p.push(msg)
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,79 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+	"github.com/twilio/twilio-go"
+	twilioApi "github.com/twilio/twilio-go/rest/api/v2010"
+)
+
+const twilioSmsCaller = packageCaller + ".TwilioSms"
+
+type TwilioSms struct {
+	client *twilio.RestClient
+	// statusCallback is where twilio posts delivery receipts, when set.
+	statusCallback string
+}
+
+func NewTwilioSmsProvider(logger *utils.Logger) ports.SmsProvider {
+	twilioAccountSID := os.Getenv("TWILIO_ACCOUNT_SID")
+	if twilioAccountSID == "" {
+		logger.Fatal(context.Background(), "TWILIO_ACCOUNT_SID is not set")
+	}
+	twilioAuthToken := os.Getenv("TWILIO_AUTH_TOKEN")
+	if twilioAuthToken == "" {
+		logger.Fatal(context.Background(), "TWILIO_AUTH_TOKEN is not set")
+	}
+	return &TwilioSms{
+		client: twilio.NewRestClientWithParams(twilio.ClientParams{
+			Username: twilioAccountSID,
+			Password: twilioAuthToken,
+		}),
+		statusCallback: os.Getenv("TWILIO_STATUS_CALLBACK_URL"),
+	}
+}
+
+func (p *TwilioSms) Name() ports.SmsProviderName {
+	return ports.TwilioSmsProviderName
+}
+
+func (p *TwilioSms) Send(ctx context.Context, src, dst, message string) (providerMessageId string, err error) {
+	defer func() { err = utils.FuncPipe(twilioSmsCaller+".Send", err) }()
+	params := &twilioApi.CreateMessageParams{}
+	params.SetTo(dst)
+	params.SetFrom(src)
+	params.SetBody(message)
+	if p.statusCallback != "" {
+		params.SetStatusCallback(p.statusCallback)
+	}
+
+	type result struct {
+		sid string
+		err error
+	}
+	// The twilio client takes no context, so the call is raced against it.
+	results := make(chan result, 1)
+	go func() {
+		defer close(results)
+		resp, err := p.client.Api.CreateMessage(params)
+		if err != nil {
+			results <- result{err: fmt.Errorf("failed to send message: %v", err)}
+			return
+		}
+		sid := ""
+		if resp.Sid != nil {
+			sid = *resp.Sid
+		}
+		results <- result{sid: sid}
+	}()
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case r := <-results:
+		return r.sid, r.err
+	}
+}
@@ -0,0 +1,326 @@
+package clients
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const smtpPoolCaller = packageCaller + ".SmtpPool"
+
+type SmtpPoolOptions struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Tls      MailTlsMode
+	// Size caps the open connections, and so the concurrent sends.
+	Size int
+	// Timeout bounds dialing and every send on a connection.
+	Timeout time.Duration
+	// HealthCheck is how long a connection may sit idle before it is probed
+	// with NOOP on reuse.
+	HealthCheck time.Duration
+	// IdleTimeout closes connections unused for longer, before the server
+	// drops them on its own.
+	IdleTimeout time.Duration
+}
+
+type smtpConn struct {
+	conn     net.Conn
+	client   *smtp.Client
+	lastUsed time.Time
+}
+
+// SmtpPool keeps up to Size authenticated SMTP connections open and sends
+// every message over one of them, so bursts of email do not dial the server
+// once each. A connection that fails its health check or breaks mid-send is
+// closed and replaced.
+type SmtpPool struct {
+	logger *utils.Logger
+	opts   SmtpPoolOptions
+	addr   string
+	slots  chan struct{}
+	idle   chan *smtpConn
+	open   atomic.Int64
+
+	sent         atomic.Int64
+	failed       atomic.Int64
+	dials        atomic.Int64
+	reconnects   atomic.Int64
+	sendNanos    atomic.Int64
+	since        time.Time
+	recentMu     sync.Mutex
+	recent       [60]int64
+	recentSecond int64
+}
+
+func NewSmtpPool(logger *utils.Logger, opts SmtpPoolOptions) ports.SmtpClient {
+	p := &SmtpPool{
+		logger: logger,
+		opts:   opts,
+		addr:   net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port)),
+		slots:  make(chan struct{}, opts.Size),
+		idle:   make(chan *smtpConn, opts.Size),
+		since:  time.Now().UTC(),
+	}
+	go p.reaper()
+	return p
+}
+
+func (p *SmtpPool) Send(ctx context.Context, from string, to []string, msg []byte) (err error) {
+	defer func() { err = utils.FuncPipe(smtpPoolCaller+".Send", err) }()
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-p.slots }()
+
+	start := time.Now()
+	conn, reused, err := p.get(ctx)
+	if err != nil {
+		p.failed.Add(1)
+		return err
+	}
+	err = p.send(ctx, conn, from, to, msg)
+	// A reused connection can have been dropped by the server since its last
+	// check. Nothing was accepted if MAIL already failed, so one retry on a
+	// fresh connection cannot send twice.
+	var mailErr *smtpMailError
+	if reused && errors.As(err, &mailErr) && !isSmtpReply(err) {
+		p.discard(conn)
+		p.reconnects.Add(1)
+		if conn, err = p.dial(ctx); err == nil {
+			err = p.send(ctx, conn, from, to, msg)
+		}
+	}
+	if err != nil {
+		p.failed.Add(1)
+		// A reply error leaves the connection usable once the transaction is
+		// reset; anything else means it is broken.
+		if conn != nil && isSmtpReply(err) && conn.client.Reset() == nil {
+			p.put(conn)
+		} else if conn != nil {
+			p.discard(conn)
+		}
+		return err
+	}
+	p.put(conn)
+	p.sent.Add(1)
+	p.sendNanos.Add(int64(time.Since(start)))
+	p.countRecent(time.Now())
+	return nil
+}
+
+func (p *SmtpPool) Stats() *ports.SmtpStats {
+	stats := &ports.SmtpStats{
+		Sent:            p.sent.Load(),
+		Failed:          p.failed.Load(),
+		Dials:           p.dials.Load(),
+		Reconnects:      p.reconnects.Load(),
+		OpenConnections: p.open.Load(),
+		IdleConnections: len(p.idle),
+		PoolSize:        p.opts.Size,
+		SentLastMinute:  p.sentLastMinute(time.Now()),
+		Since:           p.since,
+	}
+	if stats.Sent > 0 {
+		stats.AvgSendMillis = float64(p.sendNanos.Load()) / float64(stats.Sent) / float64(time.Millisecond)
+	}
+	return stats
+}
+
+// get returns an idle connection that still answers, or dials a new one.
+func (p *SmtpPool) get(ctx context.Context) (conn *smtpConn, reused bool, err error) {
+	for {
+		select {
+		case conn = <-p.idle:
+		default:
+			conn, err = p.dial(ctx)
+			return conn, false, err
+		}
+		idle := time.Since(conn.lastUsed)
+		if idle >= p.opts.IdleTimeout {
+			p.discard(conn)
+			continue
+		}
+		if idle >= p.opts.HealthCheck {
+			_ = conn.conn.SetDeadline(time.Now().Add(p.opts.Timeout))
+			if err := conn.client.Noop(); err != nil {
+				p.logger.Error(ctx, err, "smtp connection failed its health check, reconnecting")
+				p.discard(conn)
+				p.reconnects.Add(1)
+				continue
+			}
+		}
+		return conn, true, nil
+	}
+}
+
+func (p *SmtpPool) dial(ctx context.Context) (conn *smtpConn, err error) {
+	defer func() { err = utils.FuncPipe(smtpPoolCaller+".dial", err) }()
+	p.dials.Add(1)
+	dialer := &net.Dialer{Timeout: p.opts.Timeout}
+	var raw net.Conn
+	if p.opts.Tls == ImplicitMailTlsMode {
+		raw, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: p.opts.Host}}).DialContext(ctx, "tcp", p.addr)
+	} else {
+		raw, err = dialer.DialContext(ctx, "tcp", p.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_ = raw.SetDeadline(time.Now().Add(p.opts.Timeout))
+	client, err := smtp.NewClient(raw, p.opts.Host)
+	if err != nil {
+		_ = raw.Close()
+		return nil, err
+	}
+	if err = p.handshake(client); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	p.open.Add(1)
+	return &smtpConn{conn: raw, client: client, lastUsed: time.Now()}, nil
+}
+
+func (p *SmtpPool) handshake(client *smtp.Client) (err error) {
+	if p.opts.Tls == StartTlsMailTlsMode {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server " + p.addr + " does not support STARTTLS")
+		}
+		if err = client.StartTLS(&tls.Config{ServerName: p.opts.Host}); err != nil {
+			return err
+		}
+	}
+	// Stand-ins usually accept any sender without authentication.
+	if ok, _ := client.Extension("AUTH"); ok && p.opts.Password != "" {
+		if err = client.Auth(smtp.PlainAuth("", p.opts.Username, p.opts.Password, p.opts.Host)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// smtpMailError marks a failure of the MAIL command, before the server has
+// accepted anything.
+type smtpMailError struct {
+	err error
+}
+
+func (e *smtpMailError) Error() string {
+	return e.err.Error()
+}
+
+func (e *smtpMailError) Unwrap() error {
+	return e.err
+}
+
+func (p *SmtpPool) send(ctx context.Context, conn *smtpConn, from string, to []string, msg []byte) (err error) {
+	deadline := time.Now().Add(p.opts.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.conn.SetDeadline(deadline)
+	if err = conn.client.Mail(from); err != nil {
+		return &smtpMailError{err: err}
+	}
+	for _, rcpt := range to {
+		if err = conn.client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := conn.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (p *SmtpPool) put(conn *smtpConn) {
+	conn.lastUsed = time.Now()
+	select {
+	case p.idle <- conn:
+	default:
+		p.discard(conn)
+	}
+}
+
+func (p *SmtpPool) discard(conn *smtpConn) {
+	_ = conn.conn.SetDeadline(time.Now().Add(time.Second))
+	_ = conn.client.Quit()
+	_ = conn.conn.Close()
+	p.open.Add(-1)
+}
+
+// reaper closes connections that sat idle for IdleTimeout, so a quiet
+// service does not hold sockets the server is about to drop.
+func (p *SmtpPool) reaper() {
+	ticker := time.NewTicker(p.opts.IdleTimeout / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		for range len(p.idle) {
+			select {
+			case conn := <-p.idle:
+				if time.Since(conn.lastUsed) >= p.opts.IdleTimeout {
+					p.discard(conn)
+					continue
+				}
+				select {
+				case p.idle <- conn:
+				default:
+					// Senders refilled the idle list meanwhile.
+					p.discard(conn)
+				}
+			default:
+			}
+		}
+	}
+}
+
+func (p *SmtpPool) countRecent(now time.Time) {
+	p.recentMu.Lock()
+	defer p.recentMu.Unlock()
+	p.advanceRecent(now.Unix())
+	p.recent[now.Unix()%int64(len(p.recent))]++
+}
+
+func (p *SmtpPool) sentLastMinute(now time.Time) int64 {
+	p.recentMu.Lock()
+	defer p.recentMu.Unlock()
+	p.advanceRecent(now.Unix())
+	var total int64
+	for _, n := range p.recent {
+		total += n
+	}
+	return total
+}
+
+// advanceRecent clears the per-second buckets that fell out of the window
+// since the last call.
+func (p *SmtpPool) advanceRecent(second int64) {
+	for s := max(p.recentSecond+1, second-int64(len(p.recent))+1); s <= second; s++ {
+		p.recent[s%int64(len(p.recent))] = 0
+	}
+	p.recentSecond = max(p.recentSecond, second)
+}
+
+func isSmtpReply(err error) bool {
+	var reply *textproto.Error
+	return errors.As(err, &reply)
+}
@@ -0,0 +1,245 @@
+package clients
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kasragay/backend/internal/utils"
+)
+
+// smtpTestServer is a minimal in-process SMTP server. It accepts every
+// message, except for recipients starting with "reject", and can drop its
+// connections to stand in for a server timing them out.
+type smtpTestServer struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	conns    []net.Conn
+	accepted int
+	messages []string
+}
+
+func newSmtpTestServer(t *testing.T) *smtpTestServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpTestServer{listener: listener}
+	t.Cleanup(func() {
+		_ = listener.Close()
+		s.drop()
+	})
+	go s.serve()
+	return s
+}
+
+func (s *smtpTestServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.accepted++
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpTestServer) handle(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	text := textproto.NewConn(conn)
+	reply := func(lines ...string) bool {
+		for _, line := range lines {
+			if text.PrintfLine("%s", line) != nil {
+				return false
+			}
+		}
+		return true
+	}
+	reply("220 localhost ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			reply("250-localhost", "250 8BITMIME")
+		case "MAIL", "NOOP", "RSET":
+			reply("250 OK")
+		case "RCPT":
+			if strings.HasPrefix(strings.TrimPrefix(strings.ToLower(arg), "to:<"), "reject") {
+				reply("550 no such user")
+				continue
+			}
+			reply("250 OK")
+		case "DATA":
+			reply("354 go ahead")
+			msg, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, string(msg))
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+// drop closes every open connection from the server side.
+func (s *smtpTestServer) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *smtpTestServer) stats() (accepted int, messages []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted, append([]string(nil), s.messages...)
+}
+
+func newTestSmtpPool(t *testing.T, addr string, healthCheck time.Duration) *SmtpPool {
+	t.Helper()
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := SmtpPoolOptions{
+		Host:        host,
+		Tls:         NoneMailTlsMode,
+		Size:        2,
+		Timeout:     5 * time.Second,
+		HealthCheck: healthCheck,
+		IdleTimeout: time.Minute,
+	}
+	if opts.Port, err = net.LookupPort("tcp", port); err != nil {
+		t.Fatal(err)
+	}
+	return NewSmtpPool(utils.NewLogger(), opts).(*SmtpPool)
+}
+
+const smtpTestMessage = "From: no-reply@example.com\r\nTo: user@example.org\r\nSubject: hi\r\n\r\nhello\r\n"
+
+func TestSmtpPoolReusesConnections(t *testing.T) {
+	server := newSmtpTestServer(t)
+	pool := newTestSmtpPool(t, server.listener.Addr().String(), time.Hour)
+	for range 3 {
+		if err := pool.Send(t.Context(), "no-reply@example.com", []string{"user@example.org"}, []byte(smtpTestMessage)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	accepted, messages := server.stats()
+	if accepted != 1 {
+		t.Fatalf("server accepted %d connections, want 1", accepted)
+	}
+	if len(messages) != 3 || !strings.Contains(messages[0], "hello") {
+		t.Fatalf("server received %q", messages)
+	}
+	stats := pool.Stats()
+	if stats.Sent != 3 || stats.Dials != 1 || stats.OpenConnections != 1 || stats.IdleConnections != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestSmtpPoolReconnectsDroppedConnection(t *testing.T) {
+	for name, healthCheck := range map[string]time.Duration{
+		// The idle connection is probed with NOOP before reuse.
+		"health check": 0,
+		// The idle connection is reused unprobed and MAIL is retried.
+		"mail retry": time.Hour,
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := newSmtpTestServer(t)
+			pool := newTestSmtpPool(t, server.listener.Addr().String(), healthCheck)
+			if err := pool.Send(t.Context(), "no-reply@example.com", []string{"user@example.org"}, []byte(smtpTestMessage)); err != nil {
+				t.Fatal(err)
+			}
+			server.drop()
+			if err := pool.Send(t.Context(), "no-reply@example.com", []string{"user@example.org"}, []byte(smtpTestMessage)); err != nil {
+				t.Fatalf("send after the server dropped the connection: %v", err)
+			}
+			accepted, messages := server.stats()
+			if accepted != 2 || len(messages) != 2 {
+				t.Fatalf("server accepted %d connections and %d messages, want 2 and 2", accepted, len(messages))
+			}
+			stats := pool.Stats()
+			if stats.Sent != 2 || stats.Failed != 0 || stats.Dials != 2 || stats.Reconnects != 1 || stats.OpenConnections != 1 {
+				t.Fatalf("unexpected stats %+v", stats)
+			}
+		})
+	}
+}
+
+func TestSmtpPoolKeepsConnectionAfterRejection(t *testing.T) {
+	server := newSmtpTestServer(t)
+	pool := newTestSmtpPool(t, server.listener.Addr().String(), time.Hour)
+	err := pool.Send(t.Context(), "no-reply@example.com", []string{"reject@example.org"}, []byte(smtpTestMessage))
+	// Errors leave the pool as utils errors, which keep only the message.
+	if err == nil || !strings.Contains(err.Error(), "no such user") {
+		t.Fatalf("got %v, want the 550 reply", err)
+	}
+	if err = pool.Send(t.Context(), "no-reply@example.com", []string{"user@example.org"}, []byte(smtpTestMessage)); err != nil {
+		t.Fatal(err)
+	}
+	accepted, messages := server.stats()
+	if accepted != 1 || len(messages) != 1 {
+		t.Fatalf("server accepted %d connections and %d messages, want 1 and 1", accepted, len(messages))
+	}
+	stats := pool.Stats()
+	if stats.Sent != 1 || stats.Failed != 1 || stats.Dials != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestSmtpPoolFailsWhenServerIsDown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+	pool := newTestSmtpPool(t, addr, time.Hour)
+	if err = pool.Send(t.Context(), "no-reply@example.com", []string{"user@example.org"}, []byte(smtpTestMessage)); err == nil {
+		t.Fatal("sent without a server")
+	}
+	stats := pool.Stats()
+	if stats.Failed != 1 || stats.OpenConnections != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestSmtpPoolHonoursContextWhenFull(t *testing.T) {
+	server := newSmtpTestServer(t)
+	pool := newTestSmtpPool(t, server.listener.Addr().String(), time.Hour)
+	for range pool.opts.Size {
+		pool.slots <- struct{}{}
+	}
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	err := pool.Send(ctx, "no-reply@example.com", []string{"user@example.org"}, []byte(smtpTestMessage))
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Fatalf("got %v, want the context deadline", err)
+	}
+	if accepted, _ := server.stats(); accepted != 0 {
+		t.Fatalf("server accepted %d connections while the pool was full", accepted)
+	}
+}
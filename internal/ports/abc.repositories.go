@@ -3,10 +3,11 @@ package ports
 import (
 	"context"
 	"image"
+	"io"
+	"net/url"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/minio/minio-go/v7"
 )
 
 type RelationalRepo interface {
@@ -18,18 +19,35 @@ type RelationalRepo interface {
 	GetUserByUsername(ctx context.Context, username string, userType UserType) (user UserModel, isDeleted bool, err error)
 	UpdateUserPasswordById(ctx context.Context, id uuid.UUID, userType UserType, password string) (err error)
 	UpdateUserPasswordByUsername(ctx context.Context, username string, userType UserType, password string) (err error)
-	UpdateUserProfileById(ctx context.Context, id uuid.UUID, username, name, avatar string, userType UserType) (err error)
+	UpdateUserProfileById(ctx context.Context, id uuid.UUID, username, name, avatarHash string, locale Locale, userType UserType) (err error)
+	UpdateUserAvatarById(ctx context.Context, id uuid.UUID, userType UserType, avatarHash string) (err error)
+	GetAvatarRecords(ctx context.Context, ids []uuid.UUID, userType UserType) (records map[uuid.UUID]AvatarRecord, err error)
+	GetAvatarRecordsWithAvatar(ctx context.Context, userType UserType, afterId uuid.UUID, limit int) (records []AvatarRecord, err error)
 	DeleteUserById(ctx context.Context, id uuid.UUID, userType UserType) (err error)
 	UpdateUserPhoneById(ctx context.Context, id uuid.UUID, userType UserType, phoneNumber string) (err error)
 	UpdateUserEmailById(ctx context.Context, id uuid.UUID, userType UserType, email string) (err error)
 	CheckUserEmailLimit(ctx context.Context, email string) (err error)
 	CheckUserPhoneLimit(ctx context.Context, phoneNumber string) (err error)
+	GetUsernameRedirect(ctx context.Context, username string, userType UserType) (user UserModel, err error)
+	GetUsernameDenylist(ctx context.Context) (denylist []UsernameDenylistModel, err error)
+	AddUsernameToDenylist(ctx context.Context, username, reason string, createdBy uuid.UUID) (err error)
+	RemoveUsernameFromDenylist(ctx context.Context, username string) (err error)
+	GetUsersByIds(ctx context.Context, ids []uuid.UUID, userType UserType) (users []UserModel, err error)
+
+	RelayDomainEvents(ctx context.Context, limit int, publish func(events []*DomainEvent) error) (relayed int, err error)
+	DeletePublishedDomainEvents(ctx context.Context, before time.Time) (deleted int64, err error)
 
 	Close() error
 
-	DropTables() error
-	AddFirstUsers() error // TODO_DEL
-	AutoMigrate() error
+	// MigrationStatus lists the shipped and the applied migrations, ordered
+	// by version.
+	MigrationStatus(ctx context.Context) (statuses []*MigrationStatus, err error)
+	// MigrateUp applies up to steps pending migrations, all of them when
+	// steps is 0, each in its own transaction. MigrateDown reverts the last
+	// steps applied ones. Both hold an advisory lock while migrating and
+	// refuse to when an applied migration was modified or is missing.
+	MigrateUp(ctx context.Context, steps int) (applied []*MigrationStatus, err error)
+	MigrateDown(ctx context.Context, steps int) (reverted []*MigrationStatus, err error)
 }
 
 type CacheRepo interface {
@@ -44,15 +62,150 @@ type CacheRepo interface {
 	GetOtpKey(ctx context.Context, identity string, userType UserType) (key string, err error)
 	DeleteOtpKey(ctx context.Context, identity string, userType UserType) (err error)
 
+	SetUploadSession(ctx context.Context, session *UploadSessionModel, expire time.Duration) (err error)
+	GetUploadSession(ctx context.Context, id uuid.UUID) (session *UploadSessionModel, err error)
+	DeleteUploadSession(ctx context.Context, id uuid.UUID) (err error)
+
+	PublishEvent(ctx context.Context, event *UserEvent) (err error)
+	// SubscribeEvents calls fn with every event published until ctx is done.
+	// Events published while it is not subscribed are lost.
+	SubscribeEvents(ctx context.Context, fn func(event *UserEvent)) (err error)
+
+	AppendDomainEvents(ctx context.Context, events []*DomainEvent) (err error)
+	// ConsumeDomainEvents calls fn with the domain events of the consumer
+	// group, creating it at the end of the stream if it does not exist, until
+	// ctx is done. An event is acked once fn returns nil; an error from fn is
+	// returned and the event is handed out again on the next call. Events
+	// another consumer of the group left unacked for a while are claimed and
+	// handed to fn too, so handling one twice must be harmless.
+	ConsumeDomainEvents(ctx context.Context, group, consumer string, fn func(event *DomainEvent) error) (err error)
+
+	// AcquireJobLease takes the lease on a job for ttl unless another owner
+	// holds it. RenewJobLease extends it and ReleaseJobLease drops it, both
+	// only while owner still holds it.
+	AcquireJobLease(ctx context.Context, name JobName, owner string, ttl time.Duration) (acquired bool, err error)
+	RenewJobLease(ctx context.Context, name JobName, owner string, ttl time.Duration) (renewed bool, err error)
+	ReleaseJobLease(ctx context.Context, name JobName, owner string) (err error)
+
 	Close() error
 }
 
+// S3Object is a stored object opened for reading.
+type S3Object interface {
+	io.ReadSeekCloser
+	Info() S3ObjectInfo
+}
+
 type S3Repo interface {
-	GetAvatar(ctx context.Context, userId uuid.UUID, userType UserType) (avatar *minio.Object, err error)
-	UploadAvatar(ctx context.Context, userId uuid.UUID, userType UserType, img *image.Image) (err error)
+	GetAvatar(ctx context.Context, userId uuid.UUID, userType UserType, size int, format AvatarFormat) (avatar S3Object, err error)
+	UploadAvatar(ctx context.Context, userId uuid.UUID, userType UserType, img *image.Image) (hash string, err error)
 	DeleteAvatar(ctx context.Context, userId uuid.UUID, userType UserType) (err error)
+	DeleteAvatarObject(ctx context.Context, objectName string) (err error)
+	IterateAvatarObjects(ctx context.Context, fn func(objectName string, info S3ObjectInfo) error) (err error)
+
+	PresignUpload(ctx context.Context, objectName, contentType string, size int64, expire time.Duration) (url string, headers map[string]string, err error)
+	GetUpload(ctx context.Context, objectName string, maxSize int64) (data []byte, contentType string, err error)
+	DeleteUpload(ctx context.Context, objectName string) (err error)
+	PeekUpload(ctx context.Context, objectName string, n int64) (head []byte, size int64, err error)
+	IterateUploadObjects(ctx context.Context, fn func(objectName string, info S3ObjectInfo) error) (err error)
+
+	EnsureMediaBuckets(ctx context.Context) (err error)
+	PromoteUpload(ctx context.Context, objectName string, purpose MediaPurpose, dstObjectName, contentType string) (err error)
+	PresignMediaDownload(ctx context.Context, purpose MediaPurpose, objectName string, expire time.Duration) (url string, err error)
+	DeleteMedia(ctx context.Context, purpose MediaPurpose, objectName string) (err error)
+	IterateMediaObjects(ctx context.Context, purpose MediaPurpose, fn func(objectName string, info S3ObjectInfo) error) (err error)
+}
+
+// SignedObjectStore is implemented by S3Repo backends that have no storage
+// server of their own. Their presigned urls point at the gateway, which
+// hands the signed requests back to the backend through these methods.
+type SignedObjectStore interface {
+	PutSignedObject(ctx context.Context, bucket, objectName string, query url.Values, contentType string, data []byte) (err error)
+	GetSignedObject(ctx context.Context, bucket, objectName string, query url.Values) (object S3Object, err error)
 }
 
 type MongoRepo interface {
+	AddRelation(ctx context.Context, fromId, toId uuid.UUID, relationType RelationType) (err error)
+	RemoveRelation(ctx context.Context, fromId, toId uuid.UUID, relationType RelationType) (err error)
+	HasRelation(ctx context.Context, fromId, toId uuid.UUID, relationType RelationType) (has bool, err error)
+	GetRelationTargets(ctx context.Context, fromId uuid.UUID, relationType RelationType, pagination *Pagination) (ids []uuid.UUID, total int64, err error)
+	GetRelationSources(ctx context.Context, toId uuid.UUID, relationType RelationType, pagination *Pagination) (ids []uuid.UUID, total int64, err error)
+	CountRelations(ctx context.Context, id uuid.UUID, relationType RelationType) (targets int64, sources int64, err error)
+	BlockUser(ctx context.Context, fromId, toId uuid.UUID) (err error)
+	DeleteRelationsOf(ctx context.Context, id uuid.UUID) (err error)
+	AddActivity(ctx context.Context, activity *ActivityModel) (err error)
+	GetActivities(ctx context.Context, userId uuid.UUID, userType UserType, pagination *Pagination) (activities []ActivityModel, total int64, err error)
+	AppendAudit(ctx context.Context, entry *AuditModel) (err error)
+	GetAudits(ctx context.Context, filter *AuditFilter, pagination *Pagination) (entries []AuditModel, total int64, err error)
+	IterateAudits(ctx context.Context, filter *AuditFilter, fn func(entry *AuditModel) error) (err error)
+	AddMedia(ctx context.Context, media *MediaModel) (err error)
+	GetMedia(ctx context.Context, id uuid.UUID) (media *MediaModel, err error)
+	GetMediaByOwner(ctx context.Context, ownerId uuid.UUID, ownerType UserType, pagination *Pagination) (media []MediaModel, total int64, err error)
+	GetMediaUsage(ctx context.Context, ownerId uuid.UUID, ownerType UserType) (usage int64, err error)
+	UpdateMediaAcl(ctx context.Context, id uuid.UUID, acl MediaAcl) (err error)
+	DeleteMedia(ctx context.Context, id uuid.UUID) (err error)
+	// EnqueueMessage inserts message, or returns the message already holding
+	// its idempotency key.
+	EnqueueMessage(ctx context.Context, message *MessageModel) (existing *MessageModel, err error)
+	// ClaimMessage leases the next due message to the caller, including ones
+	// whose previous lease ran out mid attempt. It returns nil when none is due.
+	ClaimMessage(ctx context.Context, lease time.Duration) (message *MessageModel, err error)
+	// CompleteMessageAttempt records the outcome of the attempt that claimed
+	// the message. It is a no-op when the lease was lost to another worker.
+	CompleteMessageAttempt(ctx context.Context, message *MessageModel) (err error)
+	GetMessage(ctx context.Context, id string) (message *MessageModel, err error)
+	GetMessages(ctx context.Context, filter *MessageFilter, pagination *Pagination) (messages []MessageModel, total int64, err error)
+	RequeueMessage(ctx context.Context, id string) (err error)
+	// RecordMessageReceipt appends the receipt to the message the provider
+	// sent and applies its status if the message is still only sent.
+	RecordMessageReceipt(ctx context.Context, receipt *DeliveryReceipt) (found bool, err error)
+	GetMessageStats(ctx context.Context, channel MessageChannel, from, to time.Time) (buckets []MessageStatsBucket, err error)
+	// AddSuppression lists the address of bounce, or counts it again when it
+	// is already listed.
+	AddSuppression(ctx context.Context, bounce *EmailBounce) (err error)
+	GetSuppression(ctx context.Context, email string) (suppression *SuppressionModel, err error)
+	GetSuppressions(ctx context.Context, filter *SuppressionFilter, pagination *Pagination) (suppressions []SuppressionModel, total int64, err error)
+	DeleteSuppression(ctx context.Context, email string) (deleted bool, err error)
+	AddWebhook(ctx context.Context, webhook *WebhookModel) (err error)
+	GetWebhook(ctx context.Context, id string) (webhook *WebhookModel, err error)
+	GetWebhooks(ctx context.Context, pagination *Pagination) (webhooks []WebhookModel, total int64, err error)
+	// GetWebhooksForEvent returns the active webhooks subscribed to eventType.
+	GetWebhooksForEvent(ctx context.Context, eventType DomainEventType) (webhooks []WebhookModel, err error)
+	UpdateWebhook(ctx context.Context, webhook *WebhookModel) (found bool, err error)
+	DeleteWebhook(ctx context.Context, id string) (deleted bool, err error)
+	// AddWebhookDelivery reports false, without an error, when the webhook
+	// already has a delivery of the event.
+	AddWebhookDelivery(ctx context.Context, delivery *WebhookDeliveryModel) (added bool, err error)
+	ClaimWebhookDelivery(ctx context.Context, lease time.Duration) (delivery *WebhookDeliveryModel, err error)
+	CompleteWebhookDeliveryAttempt(ctx context.Context, delivery *WebhookDeliveryModel, attempt *WebhookAttemptModel) (err error)
+	GetWebhookDelivery(ctx context.Context, webhookId, id string) (delivery *WebhookDeliveryModel, err error)
+	GetWebhookDeliveries(ctx context.Context, webhookId string, status WebhookDeliveryStatus, pagination *Pagination) (deliveries []WebhookDeliveryModel, total int64, err error)
+	// ReplayWebhookDelivery queues a finished delivery again with a fresh set
+	// of attempts.
+	ReplayWebhookDelivery(ctx context.Context, webhookId, id string) (err error)
+
+	// InitJobState creates the state of a job unless it exists.
+	InitJobState(ctx context.Context, name JobName, nextRunAt time.Time) (err error)
+	GetJobState(ctx context.Context, name JobName) (state *JobStateModel, err error)
+	GetJobStates(ctx context.Context) (states []JobStateModel, err error)
+	SetJobPaused(ctx context.Context, name JobName, paused bool) (found bool, err error)
+	TriggerJob(ctx context.Context, name JobName) (found bool, err error)
+	// StartJobRun records run as started and moves the job on to nextRunAt,
+	// unless the state changed since it was read; started is false then.
+	// Runs of the job left running are marked abandoned.
+	StartJobRun(ctx context.Context, state *JobStateModel, run *JobRunModel, nextRunAt time.Time) (started bool, err error)
+	FinishJobRun(ctx context.Context, run *JobRunModel) (err error)
+	GetJobRuns(ctx context.Context, name JobName, status JobRunStatus, pagination *Pagination) (runs []JobRunModel, total int64, err error)
+	AddNotification(ctx context.Context, notification *NotificationModel) (err error)
+	GetNotifications(ctx context.Context, userId uuid.UUID, userType UserType, unreadOnly bool, pagination *Pagination) (notifications []NotificationModel, total int64, err error)
+	CountUnreadNotifications(ctx context.Context, userId uuid.UUID, userType UserType) (unread int64, err error)
+	// MarkNotificationsRead marks the unread notifications of ids read, or all
+	// of them when ids is empty.
+	MarkNotificationsRead(ctx context.Context, userId uuid.UUID, userType UserType, ids []string) (updated int64, err error)
+	// GetNotificationPreferences returns nil for users who never set any.
+	GetNotificationPreferences(ctx context.Context, userId uuid.UUID, userType UserType) (preferences *NotificationPreferencesModel, err error)
+	// SetNotificationPreferences replaces the channels of the types listed.
+	SetNotificationPreferences(ctx context.Context, userId uuid.UUID, userType UserType, channels map[NotificationType][]NotificationChannel) (err error)
+
 	Close() error
 }
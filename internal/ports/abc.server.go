@@ -1,6 +1,8 @@
 package ports
 
 import (
+	"context"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/kasragay/backend/internal/utils"
@@ -11,6 +13,7 @@ type ServiceName string
 const (
 	GatewayServiceName ServiceName = "gateway"
 	UserServiceName    ServiceName = "user"
+	MediaServiceName   ServiceName = "media"
 )
 
 type Version string
@@ -32,11 +35,15 @@ type Server interface {
 	Relational() RelationalRepo
 	S3() S3Repo
 	Mongo() MongoRepo
+	Audit() AuditService
+	Jobs() JobService
 	Domain() string
 	Version() Version
 	FrontUrl() string
 	BackUrl() string
 	CanPass(c *fiber.Ctx, targetId uuid.UUID, targetPhone ...string) (err error)
+	Context() context.Context
+	Shutdown(ctx context.Context) error
 
 	// Developer have to implement
 	RegisterRoutes()
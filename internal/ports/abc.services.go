@@ -2,6 +2,8 @@ package ports
 
 import (
 	"context"
+	"io"
+	"io/fs"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -11,14 +13,97 @@ import (
 type UserService interface {
 	UserGet(ctx context.Context, req *UserUserGetRequest) (resp *User, err error)
 	UserPut(ctx context.Context, req *UserUserPutRequest) (resp *UserUserPutResponse, err error)
-	UserDelete(ctx context.Context, req *UserUserDeleteRequest, tokenCheck bool) (err error)
+	UserDelete(ctx context.Context, req *UserUserDeleteRequest, tokenCheck bool, actorId uuid.UUID) (err error)
+	AvatarUploadPost(ctx context.Context, req *UserAvatarUploadPostRequest) (resp *UploadSession, err error)
+	AvatarUploadCompletePost(ctx context.Context, req *UserAvatarUploadCompletePostRequest) (resp *UserUserPutResponse, err error)
+	UsernameDenylistGet(ctx context.Context) (resp []*UsernameDenylistEntry, err error)
+	UsernameDenylistPost(ctx context.Context, req *AdminUsernameDenylistPostRequest, adminId uuid.UUID) (err error)
+	UsernameDenylistDelete(ctx context.Context, req *AdminUsernameDenylistDeleteRequest, adminId uuid.UUID) (err error)
+}
+
+type ClientService interface {
+	ProfileGet(ctx context.Context, sourceId uuid.UUID, req *ClientUserRequest) (resp *ClientProfileGetResponse, err error)
+	RelationGet(ctx context.Context, sourceId uuid.UUID, req *ClientUserRequest) (resp *ClientRelation, err error)
+	FollowersGet(ctx context.Context, sourceId uuid.UUID, req *ClientUserListGetRequest) (resp *ClientUserListGetResponse, err error)
+	FollowingGet(ctx context.Context, sourceId uuid.UUID, req *ClientUserListGetRequest) (resp *ClientUserListGetResponse, err error)
+	FollowPost(ctx context.Context, sourceId uuid.UUID, req *ClientUserRequest) (err error)
+	FollowDelete(ctx context.Context, sourceId uuid.UUID, req *ClientUserRequest) (err error)
+	BlockPost(ctx context.Context, sourceId uuid.UUID, req *ClientUserRequest) (err error)
+	BlockDelete(ctx context.Context, sourceId uuid.UUID, req *ClientUserRequest) (err error)
+	BlocksGet(ctx context.Context, sourceId uuid.UUID, pagination *Pagination) (resp *ClientUserListGetResponse, err error)
+}
+
+type MediaService interface {
+	UploadPost(ctx context.Context, ownerId uuid.UUID, ownerType UserType, req *MediaUploadPostRequest) (resp *UploadSession, err error)
+	UploadCompletePost(ctx context.Context, ownerId uuid.UUID, ownerType UserType, req *MediaUploadCompletePostRequest) (resp *Media, err error)
+	MediaListGet(ctx context.Context, ownerId uuid.UUID, ownerType UserType, pagination *Pagination) (resp *MediaListGetResponse, err error)
+	MediaGet(ctx context.Context, userId uuid.UUID, userType UserType, req *MediaRequest) (resp *Media, err error)
+	DownloadGet(ctx context.Context, userId uuid.UUID, userType UserType, req *MediaRequest) (resp *MediaDownloadGetResponse, err error)
+	AclPut(ctx context.Context, userId uuid.UUID, userType UserType, req *MediaAclPutRequest) (err error)
+	MediaDelete(ctx context.Context, userId uuid.UUID, userType UserType, req *MediaRequest) (err error)
+}
+
+type ActivityService interface {
+	Record(ctx context.Context, userId uuid.UUID, userType UserType, activityType ActivityType, method ActivityMethod, cause error)
+	ActivitiesGet(ctx context.Context, req *UserActivityGetRequest) (resp *UserActivityGetResponse, err error)
+}
+
+// NotificationService tells users about events on their account, on the
+// channels they chose for each notification type.
+type NotificationService interface {
+	Notify(ctx context.Context, userId uuid.UUID, userType UserType, notificationType NotificationType, data map[string]string) (err error)
+	NotificationsGet(ctx context.Context, req *UserNotificationsGetRequest) (resp *UserNotificationsGetResponse, err error)
+	NotificationsReadPost(ctx context.Context, req *UserNotificationsReadPostRequest) (resp *UserNotificationsReadPostResponse, err error)
+	PreferencesGet(ctx context.Context, req *UserNotificationPreferencesGetRequest) (resp *UserNotificationPreferencesGetResponse, err error)
+	PreferencesPut(ctx context.Context, req *UserNotificationPreferencesPutRequest) (resp *UserNotificationPreferencesGetResponse, err error)
+}
+
+// DomainEventRelayService moves the domain events written to the outbox onto
+// the domain_events stream, where CacheRepo.ConsumeDomainEvents reads them.
+type DomainEventRelayService interface {
+	// Run blocks and relays events until ctx is done. Several gateways may
+	// run it at once, as the rows being relayed stay locked.
+	Run(ctx context.Context)
+}
+
+// RealtimeService pushes events to the connected sessions of users. Events
+// are relayed between gateways over the cache, so a session receives them
+// whichever gateway it is connected to.
+type RealtimeService interface {
+	Publish(ctx context.Context, event *UserEvent)
+	// Subscribe registers a session connected to this server. The channel is
+	// closed by cancel, or when the session falls too far behind.
+	Subscribe(userId uuid.UUID, userType UserType, session string) (events <-chan *Event, cancel func())
+	// Run blocks and delivers published events to the sessions subscribed
+	// here until ctx is done.
+	Run(ctx context.Context)
+}
+
+// SeedService loads seeds, the declarative users and relations of dev and
+// staging deployments, which integration tests use as fixtures as well.
+type SeedService interface {
+	// Load creates the users of the seed in fsys that do not exist and updates
+	// the ones that differ from it, then adds its relations.
+	Load(ctx context.Context, fsys fs.FS) (report *SeedReport, err error)
+}
+
+type StorageGcService interface {
+	Run(ctx context.Context, opts *StorageGcOptions) (report *StorageGcReport, err error)
+}
+
+type AuditService interface {
+	Record(ctx context.Context, actorId uuid.UUID, actorType UserType, action AuditAction, targetId uuid.UUID, targetType UserType, data map[string]string) (err error)
+	AuditsGet(ctx context.Context, req *AdminAuditGetRequest) (resp *AdminAuditGetResponse, err error)
+	Export(ctx context.Context, filter *AuditFilter, w io.Writer) (err error)
+	Verify(ctx context.Context) (resp *AuditVerifyResponse, err error)
 }
 
 type AuthService interface {
 	CheckPost(ctx context.Context, req *AuthCheckPostRequest) (resp *AuthCheckPostResponse, err error)
 	CheckById(ctx context.Context, id uuid.UUID, userType UserType) (exists bool, isDeleted bool, err error)
-	TmpSignupKeyGet(ctx context.Context, req *AuthSignupKeyGetRequest) (resp *TmpAuthSignupKeyGetResponse, err error)
-	SignupKeyGet(ctx context.Context, req *AuthSignupKeyGetRequest) (err error)
+	UsernameRedirectGet(ctx context.Context, req *AuthUsernameRedirectGetRequest) (resp *AuthUsernameRedirectGetResponse, err error)
+	TmpSignupKeyGet(ctx context.Context, req *AuthSignupKeyGetRequest, adminId uuid.UUID) (resp *TmpAuthSignupKeyGetResponse, err error)
+	SignupKeyGet(ctx context.Context, req *AuthSignupKeyGetRequest, adminId uuid.UUID) (err error)
 	TmpMethodOtpGet(ctx context.Context, req *AuthMethodOtpGetRequest) (resp *TmpAuthMethodOtpGetResponse, err error)
 	MethodOtpGet(ctx context.Context, req *AuthMethodOtpGetRequest) (resp *AuthMethodOtpGetResponse, err error)
 	SignupPost(ctx context.Context, req *AuthSignupPostRequest) (resp *Login, err error)
@@ -38,12 +123,136 @@ type AuthService interface {
 	ParseToken(token string, jwtType JwtType) (login *Login, err error)
 }
 
+// MessageSender makes a single delivery attempt. The outbox calls it from its
+// workers and decides whether a failure is retried.
+type MessageSender interface {
+	// Deliver returns the provider that accepted the message and the id it
+	// assigned, which delivery receipts refer to. Senders that cannot carry
+	// html ignore it.
+	Deliver(ctx context.Context, dst, subject, text, html string) (provider, providerMessageId string, err error)
+}
+
+// TemplateService renders the messages the services send. Templates are kept
+// per locale and fall back to DefaultLocale when a locale lacks one.
+type TemplateService interface {
+	Templates() []*MessageTemplate
+	// Render renders the given parts of a template, all of them when none
+	// are given. The parts left out are empty in message.
+	Render(ctx context.Context, name MessageTemplateName, locale Locale, data *MessageTemplateData, parts ...MessageTemplatePart) (message *RenderedMessage, err error)
+	// SendTest emails a template rendered with sample data, overridden by the
+	// request's, straight through the mail service rather than the outbox.
+	SendTest(ctx context.Context, req *AdminTemplateTestPostRequest, actorId uuid.UUID) (resp *AdminTemplateTestPostResponse, err error)
+}
+
 type TelecomService interface {
-	NoReplySend(ctx context.Context, dst []string, message string) (success []string, err error)
+	MessageSender
+	// Sink returns the sink provider when one is configured, otherwise nil.
+	Sink() SmsSink
+}
+
+// SmsProvider delivers a single text message. TelecomService routes between
+// the configured providers and fails over when one of them errors.
+type SmsProvider interface {
+	Name() SmsProviderName
+	Send(ctx context.Context, src, dst, message string) (providerMessageId string, err error)
+}
+
+// SmsSink is a provider that keeps messages instead of delivering them, so
+// that local and test environments can read the OTPs they send.
+type SmsSink interface {
+	SmsProvider
+	Messages(ctx context.Context, dst string, pagination *Pagination) (messages []SmsMessage, total int64, err error)
 }
 
 type MailcomService interface {
-	NoReplySend(ctx context.Context, dst []string, subject, message string) (success []string, err error)
+	MessageSender
+	Stats() *AdminMailStatsGetResponse
+}
+
+// SmtpClient hands raw messages to an SMTP server.
+type SmtpClient interface {
+	Send(ctx context.Context, from string, to []string, msg []byte) (err error)
+	Stats() *SmtpStats
+}
+
+// Mailbox reads a mailbox that only the service receives mail in, such as the
+// one bounces are returned to.
+type Mailbox interface {
+	// Drain hands every message to fn and deletes the ones fn accepts.
+	Drain(ctx context.Context, fn func(msg []byte) error) (err error)
+}
+
+// SuppressionService keeps the addresses that bounced hard or complained,
+// which are no longer emailed. Reports come from the bounce mailbox and the
+// bounce webhook, and are also recorded on the message they are about.
+type SuppressionService interface {
+	// Check returns EmailSuppressed when email is on the list.
+	Check(ctx context.Context, email string) (err error)
+	Record(ctx context.Context, bounce *EmailBounce) (suppressed bool, err error)
+	// IngestReport records every recipient of a raw delivery status
+	// notification or feedback report.
+	IngestReport(ctx context.Context, raw []byte, source SuppressionSource) (resp *BounceWebhookResponse, err error)
+	BounceWebhook(ctx context.Context, req *BounceWebhookRequest) (resp *BounceWebhookResponse, err error)
+	Suppressions(ctx context.Context, req *AdminSuppressionsGetRequest) (resp *AdminSuppressionsGetResponse, err error)
+	Remove(ctx context.Context, email string, actorId uuid.UUID) (err error)
+	// Run polls the bounce mailbox, when one is configured, until ctx is done.
+	Run(ctx context.Context)
+}
+
+// DeliveryService takes in delivery receipts for messages the outbox sent and
+// reports on them. Receipts must pass the Verify methods before they are
+// recorded.
+type DeliveryService interface {
+	VerifyTwilioSignature(signature string, params map[string]string) (err error)
+	VerifyWebhookSignature(timestamp, signature string, body []byte) (err error)
+	TwilioStatusCallback(ctx context.Context, req *TwilioStatusCallbackRequest) (err error)
+	DeliveryWebhook(ctx context.Context, req *DeliveryWebhookRequest) (err error)
+	Stats(ctx context.Context, req *AdminMessageStatsGetRequest) (resp *AdminMessageStatsGetResponse, err error)
+}
+
+// WebhookService manages the webhooks admins subscribe to domain events, and
+// delivers the events to them from a pool of workers with retries.
+type WebhookService interface {
+	Webhooks(ctx context.Context, req *AdminWebhooksGetRequest) (resp *AdminWebhooksGetResponse, err error)
+	Create(ctx context.Context, req *AdminWebhooksPostRequest, actorId uuid.UUID) (resp *AdminWebhooksPostResponse, err error)
+	Webhook(ctx context.Context, id string) (webhook *Webhook, err error)
+	Update(ctx context.Context, req *AdminWebhookPutRequest, actorId uuid.UUID) (webhook *Webhook, err error)
+	Delete(ctx context.Context, id string, actorId uuid.UUID) (err error)
+	Deliveries(ctx context.Context, req *AdminWebhookDeliveriesGetRequest) (resp *AdminWebhookDeliveriesGetResponse, err error)
+	Delivery(ctx context.Context, webhookId, id string) (delivery *WebhookDelivery, err error)
+	// Replay sends a succeeded or dead delivery again, body and all.
+	Replay(ctx context.Context, webhookId, id string, actorId uuid.UUID) (err error)
+	// Run blocks, turning domain events into deliveries and sending them,
+	// until ctx is done.
+	Run(ctx context.Context)
+}
+
+// JobService runs periodic jobs on their schedules. Every server runs the
+// scheduler, and a lease in the cache lets one replica at a time run a job.
+// Runs missed while no replica was up, or while the job was paused, happen
+// once as soon as they can.
+type JobService interface {
+	Jobs(ctx context.Context) (resp *AdminJobsGetResponse, err error)
+	Runs(ctx context.Context, req *AdminJobRunsGetRequest) (resp *AdminJobRunsGetResponse, err error)
+	// Trigger has the job run on the next poll of a scheduler, even if it is
+	// paused, without moving its schedule.
+	Trigger(ctx context.Context, name JobName, actorId uuid.UUID) (err error)
+	Pause(ctx context.Context, name JobName, actorId uuid.UUID) (err error)
+	Resume(ctx context.Context, name JobName, actorId uuid.UUID) (err error)
+	// Run blocks and runs the jobs that are due until ctx is done.
+	Run(ctx context.Context)
+}
+
+// OutboxService persists outbound messages and delivers them from a pool of
+// workers, retrying with backoff until they are sent, expire or go dead.
+type OutboxService interface {
+	Enqueue(ctx context.Context, msg *OutboundMessage) (message *MessageModel, err error)
+	Message(ctx context.Context, id string) (message *MessageModel, err error)
+	Messages(ctx context.Context, filter *MessageFilter, pagination *Pagination) (messages []MessageModel, total int64, err error)
+	// Requeue gives a dead message a fresh set of attempts.
+	Requeue(ctx context.Context, id string, actorId uuid.UUID) (err error)
+	// Run blocks and delivers messages until ctx is done.
+	Run(ctx context.Context)
 }
 
 type RatelimiterService interface {
@@ -0,0 +1,46 @@
+package ports
+
+import (
+	"time"
+)
+
+type AuditFilter struct {
+	ActorId string      `json:"actor_id" validate:"omitempty,uuid4"`
+	Action  AuditAction `json:"action"`
+	From    time.Time   `json:"from"`
+	To      time.Time   `json:"to"`
+}
+
+type AdminAuditGetRequest struct {
+	AuditFilter `json:",inline"`
+	Pagination  `json:",inline"`
+}
+
+type AdminAuditGetResponse struct {
+	Entries []*AuditEntry `json:"entries"`
+	Page    int64         `json:"page"`
+	Size    int64         `json:"size"`
+	Total   int64         `json:"total"`
+}
+
+type AuditEntry struct {
+	Sequence   int64             `json:"sequence"`
+	ActorId    string            `json:"actor_id"`
+	ActorType  UserType          `json:"actor_type"`
+	Action     AuditAction       `json:"action"`
+	TargetId   string            `json:"target_id"`
+	TargetType UserType          `json:"target_type"`
+	Data       map[string]string `json:"data"`
+	Ip         string            `json:"ip"`
+	UserAgent  string            `json:"user_agent"`
+	CreatedAt  time.Time         `json:"created_at"`
+	PrevHash   string            `json:"prev_hash"`
+	Hash       string            `json:"hash"`
+}
+
+type AuditVerifyResponse struct {
+	Checked  int64  `json:"checked"`
+	Valid    bool   `json:"valid"`
+	BrokenAt int64  `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
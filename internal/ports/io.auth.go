@@ -1,6 +1,8 @@
 package ports
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 )
 
@@ -30,11 +32,22 @@ type AuthCheckPostRequest struct {
 type AuthCheckPostResponse struct {
 	Exists         bool `json:"exists"`
 	Deleted        bool `json:"deleted"`
+	Reserved       bool `json:"reserved"`
 	HasEmail       bool `json:"has_email"`
 	HasPhoneNumber bool `json:"has_phone_number"`
 	HasPassword    bool `json:"has_password"`
 }
 
+type AuthUsernameRedirectGetRequest struct {
+	Username string   `json:"username" validate:"required,min=3,max=64"`
+	UserType UserType `json:"user_type" validate:"required,userTypeValidator"`
+}
+
+type AuthUsernameRedirectGetResponse struct {
+	Username   string `json:"username"`
+	Redirected bool   `json:"redirected"`
+}
+
 type OtpType string
 
 const (
@@ -70,6 +83,8 @@ type AuthMethodOtpGetRequest struct {
 type AuthMethodOtpGetResponse struct {
 	MaskedPhone string `json:"masked_phone"`
 	MaskedEmail string `json:"masked_email"`
+	// MessageId can be polled for the delivery state of the code.
+	MessageId string `json:"message_id"`
 }
 
 type TmpAuthMethodOtpGetResponse struct {
@@ -87,7 +102,7 @@ type TmpAuthSignupKeyGetResponse struct {
 }
 
 type AuthSignupPostRequest struct {
-	Username    string   `json:"username" validate:"required,usernameValidator"`
+	Username    string   `json:"username" validate:"required,claimableUsernameValidator"`
 	Name        string   `json:"name" validate:"required,nameValidator"`
 	Avatar      string   `json:"avatar,omitempty" validate:"avatarValidator"`
 	PhoneNumber string   `json:"phone_number" validate:"phoneValidator"`
@@ -138,6 +153,7 @@ type AuthResetEmailPostRequest struct {
 type S3AvatarsGetRequest struct {
 	UserType   UserType `json:"user_type" validate:"required,userTypeValidator"`
 	ObjectName string   `json:"object_name" validate:"required,avatarObjectNameValidator"`
+	Size       int      `json:"size" validate:"min=0,max=4096"`
 }
 
 type Jwt struct {
@@ -145,6 +161,8 @@ type Jwt struct {
 	RefreshToken   string `json:"refresh_token" validate:"required,jwt"`
 	AccessExpires  int    `json:"access_expires" validate:"required"`
 	RefreshExpires int    `json:"refresh_expires" validate:"required"`
+	// ExpiresAt is when the token a Login was parsed from runs out.
+	ExpiresAt time.Time `json:"-"`
 }
 
 type Login struct {
@@ -0,0 +1,44 @@
+package ports
+
+import (
+	"github.com/google/uuid"
+)
+
+type Pagination struct {
+	Page int64 `json:"page" validate:"required,min=1"`
+	Size int64 `json:"size" validate:"required,min=1,max=100"`
+}
+
+func (p Pagination) Skip() int64 {
+	return (p.Page - 1) * p.Size
+}
+
+type ClientUserRequest struct {
+	Id uuid.UUID `json:"id" validate:"required,uuid4"`
+}
+
+type ClientUserListGetRequest struct {
+	Id         uuid.UUID `json:"id" validate:"required,uuid4"`
+	Pagination `json:",inline"`
+}
+
+type ClientUserListGetResponse struct {
+	Users []*User `json:"users"`
+	Page  int64   `json:"page"`
+	Size  int64   `json:"size"`
+	Total int64   `json:"total"`
+}
+
+type ClientRelation struct {
+	Following  bool `json:"following"`
+	FollowedBy bool `json:"followed_by"`
+	Mutual     bool `json:"mutual"`
+	Blocking   bool `json:"blocking"`
+}
+
+type ClientProfileGetResponse struct {
+	User      *User           `json:"user"`
+	Followers int64           `json:"followers"`
+	Following int64           `json:"following"`
+	Relation  *ClientRelation `json:"relation"`
+}
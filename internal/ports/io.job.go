@@ -0,0 +1,51 @@
+package ports
+
+import "time"
+
+type AdminJobsGetResponse struct {
+	Jobs []*JobInfo `json:"jobs"`
+}
+
+type AdminJobRunsGetRequest struct {
+	Name       JobName      `json:"name" validate:"required,oneof=storage_gc domain_events_prune audit_log_verify"`
+	Status     JobRunStatus `json:"status" validate:"omitempty,oneof=running succeeded failed abandoned"`
+	Pagination `json:",inline"`
+}
+
+type AdminJobRunsGetResponse struct {
+	Runs  []*JobRun `json:"runs"`
+	Page  int64     `json:"page"`
+	Size  int64     `json:"size"`
+	Total int64     `json:"total"`
+}
+
+// AdminJobPostRequest names the job to trigger, pause or resume.
+type AdminJobPostRequest struct {
+	Name JobName `json:"name" validate:"required,oneof=storage_gc domain_events_prune audit_log_verify"`
+}
+
+type JobInfo struct {
+	Name            JobName      `json:"name"`
+	Description     string       `json:"description"`
+	Schedule        string       `json:"schedule"`
+	TimeoutSeconds  int64        `json:"timeout_seconds"`
+	Paused          bool         `json:"paused"`
+	NextRunAt       *time.Time   `json:"next_run_at,omitempty"`
+	TriggeredAt     *time.Time   `json:"triggered_at,omitempty"`
+	LastStatus      JobRunStatus `json:"last_status,omitempty"`
+	LastRunAt       *time.Time   `json:"last_run_at,omitempty"`
+	LastSucceededAt *time.Time   `json:"last_succeeded_at,omitempty"`
+}
+
+type JobRun struct {
+	Id         string       `json:"id"`
+	Name       JobName      `json:"name"`
+	Trigger    JobTrigger   `json:"trigger"`
+	Status     JobRunStatus `json:"status"`
+	Owner      string       `json:"owner"`
+	Summary    string       `json:"summary,omitempty"`
+	Error      string       `json:"error,omitempty"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+	DurationMs int64        `json:"duration_ms,omitempty"`
+}
@@ -0,0 +1,52 @@
+package ports
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type MediaUploadPostRequest struct {
+	Purpose     MediaPurpose `json:"purpose" validate:"required,oneof=attachment document"`
+	Acl         MediaAcl     `json:"acl" validate:"required,oneof=owner public admin"`
+	ContentType string       `json:"content_type" validate:"required,max=100"`
+	Size        int64        `json:"size" validate:"required,min=1"`
+}
+
+type MediaUploadCompletePostRequest struct {
+	SessionId uuid.UUID `json:"session_id" validate:"required,uuid4"`
+}
+
+type MediaRequest struct {
+	Id uuid.UUID `json:"id" validate:"required,uuid4"`
+}
+
+type MediaAclPutRequest struct {
+	Id  uuid.UUID `json:"id" validate:"required,uuid4"`
+	Acl MediaAcl  `json:"acl" validate:"required,oneof=owner public admin"`
+}
+
+type MediaListGetResponse struct {
+	Media []*Media `json:"media"`
+	Page  int64    `json:"page"`
+	Size  int64    `json:"size"`
+	Total int64    `json:"total"`
+	Usage int64    `json:"usage"`
+	Quota int64    `json:"quota"`
+}
+
+type MediaDownloadGetResponse struct {
+	Url       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type Media struct {
+	Id          uuid.UUID    `json:"id"`
+	OwnerId     uuid.UUID    `json:"owner_id"`
+	OwnerType   UserType     `json:"owner_type"`
+	Purpose     MediaPurpose `json:"purpose"`
+	Acl         MediaAcl     `json:"acl"`
+	ContentType string       `json:"content_type"`
+	Size        int64        `json:"size"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
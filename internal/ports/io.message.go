@@ -0,0 +1,112 @@
+package ports
+
+import "time"
+
+type MessageStatusGetRequest struct {
+	Id string `json:"id" validate:"required,uuid4"`
+}
+
+// MessageStatusGetResponse is what a client polling its OTP may see, so it
+// carries neither the recipient nor provider errors.
+type MessageStatusGetResponse struct {
+	Id        string         `json:"id"`
+	Channel   MessageChannel `json:"channel"`
+	Status    MessageStatus  `json:"status"`
+	Attempts  int            `json:"attempts"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+type MessageFilter struct {
+	Channel MessageChannel `json:"channel" validate:"omitempty,oneof=sms email"`
+	Status  MessageStatus  `json:"status" validate:"omitempty,oneof=queued sending sent dead expired delivered undelivered"`
+}
+
+type AdminMessagesGetRequest struct {
+	MessageFilter `json:",inline"`
+	Pagination    `json:",inline"`
+}
+
+type AdminMessagesGetResponse struct {
+	Messages []*Message `json:"messages"`
+	Page     int64      `json:"page"`
+	Size     int64      `json:"size"`
+	Total    int64      `json:"total"`
+}
+
+type AdminMessageRequeuePostRequest struct {
+	Id string `json:"id" validate:"required,uuid4"`
+}
+
+type AdminMessageGetRequest struct {
+	Id string `json:"id" validate:"required,uuid4"`
+}
+
+type AdminMessageStatsGetRequest struct {
+	Channel MessageChannel `json:"channel" validate:"omitempty,oneof=sms email"`
+	From    time.Time      `json:"from"`
+	To      time.Time      `json:"to"`
+}
+
+type AdminMessageStatsGetResponse struct {
+	Total     int64                   `json:"total"`
+	ByStatus  map[MessageStatus]int64 `json:"by_status"`
+	Providers []*MessageProviderStats `json:"providers"`
+}
+
+// MessageProviderStats aggregates the messages a provider accepted. The
+// delivery rate only counts messages with a final receipt, so providers that
+// send none report zero.
+type MessageProviderStats struct {
+	Channel            MessageChannel `json:"channel"`
+	Provider           string         `json:"provider"`
+	Accepted           int64          `json:"accepted"`
+	Delivered          int64          `json:"delivered"`
+	Undelivered        int64          `json:"undelivered"`
+	DeliveryRate       float64        `json:"delivery_rate"`
+	AvgDeliverySeconds float64        `json:"avg_delivery_seconds"`
+}
+
+// TwilioStatusCallbackRequest is the part of a twilio status callback the
+// receipt needs. The signature covers every posted field, not just these.
+type TwilioStatusCallbackRequest struct {
+	MessageSid    string `json:"MessageSid" validate:"required"`
+	MessageStatus string `json:"MessageStatus" validate:"required"`
+	ErrorCode     string `json:"ErrorCode"`
+}
+
+// DeliveryWebhookRequest is the generic receipt format for providers without
+// one of their own, including bounce processors reporting on emails.
+type DeliveryWebhookRequest struct {
+	Provider          string    `json:"provider" validate:"required"`
+	ProviderMessageId string    `json:"provider_message_id" validate:"required"`
+	Status            string    `json:"status" validate:"required,oneof=accepted sent delivered undelivered failed bounced"`
+	ErrorCode         string    `json:"error_code"`
+	ErrorMessage      string    `json:"error_message"`
+	OccurredAt        time.Time `json:"occurred_at"`
+}
+
+type Message struct {
+	Id                string         `json:"id"`
+	Channel           MessageChannel `json:"channel"`
+	To                string         `json:"to"`
+	Status            MessageStatus  `json:"status"`
+	Attempts          int            `json:"attempts"`
+	Provider          string         `json:"provider,omitempty"`
+	ProviderMessageId string         `json:"provider_message_id,omitempty"`
+	LastError         string         `json:"last_error,omitempty"`
+	Events            []MessageEvent `json:"events"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	SentAt            *time.Time     `json:"sent_at,omitempty"`
+	DeliveredAt       *time.Time     `json:"delivered_at,omitempty"`
+	ExpiresAt         *time.Time     `json:"expires_at,omitempty"`
+}
+
+type MessageEvent struct {
+	ProviderStatus string        `json:"provider_status"`
+	Status         MessageStatus `json:"status,omitempty"`
+	ErrorCode      string        `json:"error_code,omitempty"`
+	ErrorMessage   string        `json:"error_message,omitempty"`
+	OccurredAt     time.Time     `json:"occurred_at"`
+	ReceivedAt     time.Time     `json:"received_at"`
+}
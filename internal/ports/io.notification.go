@@ -0,0 +1,71 @@
+package ports
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type UserNotificationsGetRequest struct {
+	Id       uuid.UUID `json:"id" validate:"required,uuid4"`
+	UserType UserType  `json:"user_type" validate:"required,userTypeValidator"`
+	// Unread leaves out the notifications already read.
+	Unread     bool `json:"unread"`
+	Pagination `json:",inline"`
+}
+
+type UserNotificationsGetResponse struct {
+	Notifications []*Notification `json:"notifications"`
+	Unread        int64           `json:"unread"`
+	Page          int64           `json:"page"`
+	Size          int64           `json:"size"`
+	Total         int64           `json:"total"`
+}
+
+// UserNotificationsReadPostRequest marks notifications read, every unread one
+// when Ids is empty.
+type UserNotificationsReadPostRequest struct {
+	Id       uuid.UUID `json:"-" validate:"required,uuid4"`
+	UserType UserType  `json:"-" validate:"required,userTypeValidator"`
+	Ids      []string  `json:"ids" validate:"omitempty,max=100,dive,uuid4"`
+}
+
+type UserNotificationsReadPostResponse struct {
+	Updated int64 `json:"updated"`
+	Unread  int64 `json:"unread"`
+}
+
+type UserNotificationPreferencesGetRequest struct {
+	Id       uuid.UUID `json:"id" validate:"required,uuid4"`
+	UserType UserType  `json:"user_type" validate:"required,userTypeValidator"`
+}
+
+type UserNotificationPreferencesGetResponse struct {
+	Preferences []NotificationPreference `json:"preferences"`
+}
+
+// UserNotificationPreferencesPutRequest changes the types it lists and leaves
+// the others as they are.
+type UserNotificationPreferencesPutRequest struct {
+	Id          uuid.UUID                `json:"-" validate:"required,uuid4"`
+	UserType    UserType                 `json:"-" validate:"required,userTypeValidator"`
+	Preferences []NotificationPreference `json:"preferences" validate:"required,min=1,dive"`
+}
+
+// NotificationPreference is where notifications of a type are sent. No
+// channels means none at all.
+type NotificationPreference struct {
+	Type     NotificationType      `json:"type" validate:"required,oneof=new_signin password_changed email_changed"`
+	Channels []NotificationChannel `json:"channels" validate:"max=3,unique,dive,oneof=email sms in_app"`
+}
+
+type Notification struct {
+	Id        string            `json:"id"`
+	Type      NotificationType  `json:"type"`
+	Title     string            `json:"title"`
+	Body      string            `json:"body"`
+	Data      map[string]string `json:"data,omitempty"`
+	Read      bool              `json:"read"`
+	ReadAt    *time.Time        `json:"read_at,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package ports
+
+type AdminSmsSinkGetRequest struct {
+	PhoneNumber string `json:"phone_number" validate:"omitempty,phoneValidator"`
+	Pagination  `json:",inline"`
+}
+
+type AdminSmsSinkGetResponse struct {
+	Messages []*SmsMessage `json:"messages"`
+	Page     int64         `json:"page"`
+	Size     int64         `json:"size"`
+	Total    int64         `json:"total"`
+}
@@ -0,0 +1,57 @@
+package ports
+
+import "time"
+
+// BounceWebhookRequest is a bounce or complaint already parsed by the
+// provider that received it. Raw reports are posted as they are instead.
+type BounceWebhookRequest struct {
+	Type              BounceType `json:"type" validate:"required,oneof=hard_bounce soft_bounce complaint"`
+	Email             string     `json:"email" validate:"required,emailValidator"`
+	Provider          string     `json:"provider"`
+	ProviderMessageId string     `json:"provider_message_id"`
+	Status            string     `json:"status"`
+	Diagnostic        string     `json:"diagnostic"`
+	OccurredAt        time.Time  `json:"occurred_at"`
+}
+
+// BounceWebhookResponse counts the addresses a report put on the list and
+// the ones it only recorded, such as soft bounces.
+type BounceWebhookResponse struct {
+	Suppressed int `json:"suppressed"`
+	Ignored    int `json:"ignored"`
+}
+
+type SuppressionFilter struct {
+	Reason BounceType `json:"reason" validate:"omitempty,oneof=hard_bounce complaint"`
+	// Email matches listed addresses that contain it.
+	Email string `json:"email" validate:"omitempty,max=254"`
+}
+
+type AdminSuppressionsGetRequest struct {
+	SuppressionFilter `json:",inline"`
+	Pagination        `json:",inline"`
+}
+
+type AdminSuppressionsGetResponse struct {
+	Suppressions []*Suppression `json:"suppressions"`
+	Page         int64          `json:"page"`
+	Size         int64          `json:"size"`
+	Total        int64          `json:"total"`
+}
+
+type AdminSuppressionDeleteRequest struct {
+	Email string `json:"email" validate:"required,emailValidator"`
+}
+
+type Suppression struct {
+	Email             string            `json:"email"`
+	Reason            BounceType        `json:"reason"`
+	Source            SuppressionSource `json:"source"`
+	Status            string            `json:"status,omitempty"`
+	Diagnostic        string            `json:"diagnostic,omitempty"`
+	Provider          string            `json:"provider,omitempty"`
+	ProviderMessageId string            `json:"provider_message_id,omitempty"`
+	Count             int64             `json:"count"`
+	CreatedAt         time.Time         `json:"created_at"`
+	UpdatedAt         time.Time         `json:"updated_at"`
+}
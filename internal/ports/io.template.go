@@ -0,0 +1,24 @@
+package ports
+
+type AdminTemplatesGetResponse struct {
+	Templates     []*MessageTemplate `json:"templates"`
+	DefaultLocale Locale             `json:"default_locale"`
+}
+
+type AdminTemplateRenderPostRequest struct {
+	Name   MessageTemplateName `json:"name" validate:"required,oneof=otp signup_key new_signin password_changed email_changed"`
+	Locale Locale              `json:"locale" validate:"localeValidator"`
+	// Data overrides the sample data field by field.
+	Data *MessageTemplateData `json:"data"`
+}
+
+type AdminTemplateTestPostRequest struct {
+	AdminTemplateRenderPostRequest `json:",inline"`
+	Email                          string `json:"email" validate:"required,emailValidator"`
+}
+
+type AdminTemplateTestPostResponse struct {
+	Subject string `json:"subject"`
+	// MessageId is the Message-ID header of the test email.
+	MessageId string `json:"message_id"`
+}
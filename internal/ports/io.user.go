@@ -1,6 +1,8 @@
 package ports
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 )
 
@@ -14,11 +16,34 @@ type UserUserPutRequest struct {
 	Username string    `json:"username" validate:"required,usernameValidator"`
 	Name     string    `json:"name" validate:"required,nameValidator"`
 	Avatar   string    `json:"avatar" validate:"avatarValidator"`
+	Locale   Locale    `json:"locale" validate:"localeValidator"`
 	UserType UserType  `json:"user_type" validate:"required,userTypeValidator"`
 }
 
 type UserUserPutResponse struct {
-	Avatar string `json:"avatar"`
+	Avatar  string           `json:"avatar"`
+	Avatars []*AvatarVariant `json:"avatars"`
+}
+
+type UserAvatarUploadPostRequest struct {
+	Id          uuid.UUID `json:"id" validate:"required,uuid4"`
+	UserType    UserType  `json:"user_type" validate:"required,userTypeValidator"`
+	ContentType string    `json:"content_type" validate:"required,oneof=image/png image/jpeg"`
+	Size        int64     `json:"size" validate:"required,min=1,max=10485760"`
+}
+
+type UserAvatarUploadCompletePostRequest struct {
+	Id        uuid.UUID `json:"id" validate:"required,uuid4"`
+	UserType  UserType  `json:"user_type" validate:"required,userTypeValidator"`
+	SessionId uuid.UUID `json:"session_id" validate:"required,uuid4"`
+}
+
+type UploadSession struct {
+	SessionId uuid.UUID         `json:"session_id"`
+	Method    string            `json:"method"`
+	Url       string            `json:"url"`
+	Headers   map[string]string `json:"headers"`
+	ExpiresAt time.Time         `json:"expires_at"`
 }
 
 type UserUserDeleteRequest struct {
@@ -28,9 +53,56 @@ type UserUserDeleteRequest struct {
 }
 
 type User struct {
-	Id       uuid.UUID `json:"id" validate:"required,uuid4"`
-	Username string    `json:"username" validate:"required,usernameValidator"`
-	Name     string    `json:"name" validate:"required,nameValidator"`
-	Avatar   string    `json:"avatar"`
-	UserType UserType  `json:"user_type" validate:"required,userTypeValidator"`
+	Id       uuid.UUID        `json:"id" validate:"required,uuid4"`
+	Username string           `json:"username" validate:"required,usernameValidator"`
+	Name     string           `json:"name" validate:"required,nameValidator"`
+	Avatar   string           `json:"avatar"`
+	Avatars  []*AvatarVariant `json:"avatars,omitempty"`
+	UserType UserType         `json:"user_type" validate:"required,userTypeValidator"`
+}
+
+type AvatarVariant struct {
+	Size   int          `json:"size"`
+	Format AvatarFormat `json:"format"`
+	Url    string       `json:"url"`
+}
+
+type AdminUsernameDenylistPostRequest struct {
+	Username string `json:"username" validate:"required,min=3,max=64"`
+	Reason   string `json:"reason" validate:"max=250"`
+}
+
+type AdminUsernameDenylistDeleteRequest struct {
+	Username string `json:"username" validate:"required,min=3,max=64"`
+}
+
+type UsernameDenylistEntry struct {
+	Username  string    `json:"username"`
+	Reason    string    `json:"reason"`
+	CreatedBy uuid.UUID `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type UserActivityGetRequest struct {
+	Id         uuid.UUID `json:"id" validate:"required,uuid4"`
+	UserType   UserType  `json:"user_type" validate:"required,userTypeValidator"`
+	Pagination `json:",inline"`
+}
+
+type UserActivityGetResponse struct {
+	Activities []*Activity `json:"activities"`
+	Page       int64       `json:"page"`
+	Size       int64       `json:"size"`
+	Total      int64       `json:"total"`
+}
+
+type Activity struct {
+	Id        string         `json:"id"`
+	Type      ActivityType   `json:"type"`
+	Method    ActivityMethod `json:"method"`
+	Success   bool           `json:"success"`
+	Reason    string         `json:"reason,omitempty"`
+	Ip        string         `json:"ip"`
+	UserAgent string         `json:"user_agent"`
+	CreatedAt time.Time      `json:"created_at"`
 }
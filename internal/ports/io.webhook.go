@@ -0,0 +1,105 @@
+package ports
+
+import "time"
+
+type AdminWebhooksGetRequest struct {
+	Pagination `json:",inline"`
+}
+
+type AdminWebhooksGetResponse struct {
+	Webhooks []*Webhook `json:"webhooks"`
+	Page     int64      `json:"page"`
+	Size     int64      `json:"size"`
+	Total    int64      `json:"total"`
+}
+
+// AdminWebhooksPostRequest subscribes url to events. A secret is generated
+// when none is given.
+type AdminWebhooksPostRequest struct {
+	Url         string            `json:"url" validate:"required,url,max=2048"`
+	Events      []DomainEventType `json:"events" validate:"required,min=1,max=8,unique,dive,oneof=user_created user_deleted password_changed profile_updated username_changed avatar_changed email_changed phone_changed"`
+	Secret      string            `json:"secret" validate:"omitempty,min=16,max=256"`
+	Description string            `json:"description" validate:"max=256"`
+}
+
+// AdminWebhooksPostResponse is the only response that carries the secret.
+type AdminWebhooksPostResponse struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+type AdminWebhookGetRequest struct {
+	Id string `json:"id" validate:"required,uuid4"`
+}
+
+// AdminWebhookPutRequest replaces the subscription. The secret is kept when
+// none is given.
+type AdminWebhookPutRequest struct {
+	Id          string            `json:"-" validate:"required,uuid4"`
+	Url         string            `json:"url" validate:"required,url,max=2048"`
+	Events      []DomainEventType `json:"events" validate:"required,min=1,max=8,unique,dive,oneof=user_created user_deleted password_changed profile_updated username_changed avatar_changed email_changed phone_changed"`
+	Secret      string            `json:"secret" validate:"omitempty,min=16,max=256"`
+	Description string            `json:"description" validate:"max=256"`
+	Active      bool              `json:"active"`
+}
+
+type AdminWebhookDeleteRequest struct {
+	Id string `json:"id" validate:"required,uuid4"`
+}
+
+type AdminWebhookDeliveriesGetRequest struct {
+	WebhookId  string                `json:"webhook_id" validate:"required,uuid4"`
+	Status     WebhookDeliveryStatus `json:"status" validate:"omitempty,oneof=queued sending succeeded dead"`
+	Pagination `json:",inline"`
+}
+
+type AdminWebhookDeliveriesGetResponse struct {
+	Deliveries []*WebhookDelivery `json:"deliveries"`
+	Page       int64              `json:"page"`
+	Size       int64              `json:"size"`
+	Total      int64              `json:"total"`
+}
+
+type AdminWebhookDeliveryGetRequest struct {
+	WebhookId string `json:"webhook_id" validate:"required,uuid4"`
+	Id        string `json:"id" validate:"required,uuid4"`
+}
+
+type AdminWebhookDeliveryReplayPostRequest struct {
+	WebhookId string `json:"webhook_id" validate:"required,uuid4"`
+	Id        string `json:"id" validate:"required,uuid4"`
+}
+
+type Webhook struct {
+	Id          string            `json:"id"`
+	Url         string            `json:"url"`
+	Events      []DomainEventType `json:"events"`
+	Description string            `json:"description,omitempty"`
+	Active      bool              `json:"active"`
+	CreatedBy   string            `json:"created_by"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+type WebhookDelivery struct {
+	Id            string                `json:"id"`
+	WebhookId     string                `json:"webhook_id"`
+	EventId       string                `json:"event_id"`
+	EventType     DomainEventType       `json:"event_type"`
+	Body          string                `json:"body"`
+	Status        WebhookDeliveryStatus `json:"status"`
+	Attempts      int                   `json:"attempts"`
+	Log           []WebhookAttempt      `json:"log"`
+	LastError     string                `json:"last_error,omitempty"`
+	NextAttemptAt *time.Time            `json:"next_attempt_at,omitempty"`
+	CreatedAt     time.Time             `json:"created_at"`
+	UpdatedAt     time.Time             `json:"updated_at"`
+	SucceededAt   *time.Time            `json:"succeeded_at,omitempty"`
+}
+
+type WebhookAttempt struct {
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
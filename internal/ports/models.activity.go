@@ -0,0 +1,80 @@
+package ports
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type ActivityType string
+
+const (
+	SignupActivityType          ActivityType = "signup"
+	SigninActivityType          ActivityType = "signin"
+	OtpSentActivityType         ActivityType = "otp_sent"
+	PasswordChangedActivityType ActivityType = "password_changed"
+	PhoneChangedActivityType    ActivityType = "phone_changed"
+	EmailChangedActivityType    ActivityType = "email_changed"
+	LogoutActivityType          ActivityType = "logout"
+	TokenRefreshActivityType    ActivityType = "token_refresh"
+	AccountDeletedActivityType  ActivityType = "account_deleted"
+)
+
+type ActivityMethod string
+
+const (
+	OtpSmsActivityMethod       ActivityMethod = "otp_sms"
+	OtpEmailActivityMethod     ActivityMethod = "otp_email"
+	PasswordActivityMethod     ActivityMethod = "password"
+	AccessTokenActivityMethod  ActivityMethod = "access_token"
+	RefreshTokenActivityMethod ActivityMethod = "refresh_token"
+	AdminActivityMethod        ActivityMethod = "admin"
+)
+
+func OtpActivityMethod(sentToEmail bool) ActivityMethod {
+	if sentToEmail {
+		return OtpEmailActivityMethod
+	}
+	return OtpSmsActivityMethod
+}
+
+type ActivityModel struct {
+	Id        bson.ObjectID  `bson:"_id,omitempty"`
+	UserId    string         `bson:"user_id"`
+	UserType  UserType       `bson:"user_type"`
+	Type      ActivityType   `bson:"type"`
+	Method    ActivityMethod `bson:"method"`
+	Success   bool           `bson:"success"`
+	Reason    string         `bson:"reason,omitempty"`
+	Ip        string         `bson:"ip"`
+	UserAgent string         `bson:"user_agent"`
+	CreatedAt time.Time      `bson:"created_at"`
+}
+
+func NewActivityModel(userId uuid.UUID, userType UserType, activityType ActivityType, method ActivityMethod, success bool, reason, ip, userAgent string) *ActivityModel {
+	return &ActivityModel{
+		UserId:    userId.String(),
+		UserType:  userType,
+		Type:      activityType,
+		Method:    method,
+		Success:   success,
+		Reason:    reason,
+		Ip:        ip,
+		UserAgent: userAgent,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+func (m ActivityModel) ToActivity() *Activity {
+	return &Activity{
+		Id:        m.Id.Hex(),
+		Type:      m.Type,
+		Method:    m.Method,
+		Success:   m.Success,
+		Reason:    m.Reason,
+		Ip:        m.Ip,
+		UserAgent: m.UserAgent,
+		CreatedAt: m.CreatedAt,
+	}
+}
@@ -0,0 +1,129 @@
+package ports
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuditAction string
+
+const (
+	UserDeletedAuditAction        AuditAction = "user_deleted"
+	AdminOverrideAuditAction      AuditAction = "admin_override"
+	SignupKeyIssuedAuditAction    AuditAction = "signup_key_issued"
+	SignupKeyViewedAuditAction    AuditAction = "signup_key_viewed"
+	UsernameDeniedAuditAction     AuditAction = "username_denied"
+	UsernameAllowedAuditAction    AuditAction = "username_allowed"
+	AuditExportedAuditAction      AuditAction = "audit_exported"
+	SettingsCommandAuditAction    AuditAction = "settings_command"
+	MediaDeletedAuditAction       AuditAction = "media_deleted"
+	MediaAclChangedAuditAction    AuditAction = "media_acl_changed"
+	MessageRequeuedAuditAction    AuditAction = "message_requeued"
+	TemplateTestSentAuditAction   AuditAction = "template_test_sent"
+	SuppressionRemovedAuditAction AuditAction = "suppression_removed"
+	WebhookCreatedAuditAction     AuditAction = "webhook_created"
+	WebhookUpdatedAuditAction     AuditAction = "webhook_updated"
+	WebhookDeletedAuditAction     AuditAction = "webhook_deleted"
+	WebhookReplayedAuditAction    AuditAction = "webhook_replayed"
+	JobTriggeredAuditAction       AuditAction = "job_triggered"
+	JobPausedAuditAction          AuditAction = "job_paused"
+	JobResumedAuditAction         AuditAction = "job_resumed"
+)
+
+// AuditGenesisHash is the previous hash of the first entry of the chain.
+var AuditGenesisHash = strings.Repeat("0", sha256.Size*2)
+
+type AuditModel struct {
+	Sequence   int64             `bson:"_id"`
+	ActorId    string            `bson:"actor_id"`
+	ActorType  UserType          `bson:"actor_type"`
+	Action     AuditAction       `bson:"action"`
+	TargetId   string            `bson:"target_id"`
+	TargetType UserType          `bson:"target_type"`
+	Data       map[string]string `bson:"data"`
+	Ip         string            `bson:"ip"`
+	UserAgent  string            `bson:"user_agent"`
+	CreatedAt  time.Time         `bson:"created_at"`
+	PrevHash   string            `bson:"prev_hash"`
+	Hash       string            `bson:"hash"`
+}
+
+func NewAuditModel(actorId uuid.UUID, actorType UserType, action AuditAction, targetId uuid.UUID, targetType UserType, data map[string]string, ip, userAgent string) *AuditModel {
+	if data == nil {
+		data = map[string]string{}
+	}
+	var target string
+	if targetId != uuid.Nil {
+		target = targetId.String()
+	}
+	return &AuditModel{
+		ActorId:    actorId.String(),
+		ActorType:  actorType,
+		Action:     action,
+		TargetId:   target,
+		TargetType: targetType,
+		Data:       data,
+		Ip:         ip,
+		UserAgent:  userAgent,
+		// Mongo keeps milliseconds only; truncate so the hash survives a round trip.
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+}
+
+// ComputeHash returns the hex encoded sha256 of the entry's canonical JSON
+// form, which covers every field but Hash itself, including PrevHash.
+func (m AuditModel) ComputeHash() string {
+	data := m.Data
+	if data == nil {
+		data = map[string]string{}
+	}
+	payload, _ := json.Marshal(struct {
+		Sequence   int64             `json:"sequence"`
+		ActorId    string            `json:"actor_id"`
+		ActorType  UserType          `json:"actor_type"`
+		Action     AuditAction       `json:"action"`
+		TargetId   string            `json:"target_id"`
+		TargetType UserType          `json:"target_type"`
+		Data       map[string]string `json:"data"`
+		Ip         string            `json:"ip"`
+		UserAgent  string            `json:"user_agent"`
+		CreatedAt  string            `json:"created_at"`
+		PrevHash   string            `json:"prev_hash"`
+	}{
+		Sequence:   m.Sequence,
+		ActorId:    m.ActorId,
+		ActorType:  m.ActorType,
+		Action:     m.Action,
+		TargetId:   m.TargetId,
+		TargetType: m.TargetType,
+		Data:       data,
+		Ip:         m.Ip,
+		UserAgent:  m.UserAgent,
+		CreatedAt:  m.CreatedAt.UTC().Format(time.RFC3339Nano),
+		PrevHash:   m.PrevHash,
+	})
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+func (m AuditModel) ToAuditEntry() *AuditEntry {
+	return &AuditEntry{
+		Sequence:   m.Sequence,
+		ActorId:    m.ActorId,
+		ActorType:  m.ActorType,
+		Action:     m.Action,
+		TargetId:   m.TargetId,
+		TargetType: m.TargetType,
+		Data:       m.Data,
+		Ip:         m.Ip,
+		UserAgent:  m.UserAgent,
+		CreatedAt:  m.CreatedAt,
+		PrevHash:   m.PrevHash,
+		Hash:       m.Hash,
+	}
+}
@@ -0,0 +1,119 @@
+package ports
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DomainEventType string
+
+const (
+	UserCreatedDomainEventType     DomainEventType = "user_created"
+	UserDeletedDomainEventType     DomainEventType = "user_deleted"
+	PasswordChangedDomainEventType DomainEventType = "password_changed"
+	ProfileUpdatedDomainEventType  DomainEventType = "profile_updated"
+	UsernameChangedDomainEventType DomainEventType = "username_changed"
+	AvatarChangedDomainEventType   DomainEventType = "avatar_changed"
+	EmailChangedDomainEventType    DomainEventType = "email_changed"
+	PhoneChangedDomainEventType    DomainEventType = "phone_changed"
+)
+
+// DomainEventPayload is the typed body of a domain event.
+type DomainEventPayload interface {
+	DomainEventType() DomainEventType
+}
+
+type UserCreated struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+}
+
+type UserDeleted struct{}
+
+type PasswordChanged struct{}
+
+type ProfileUpdated struct {
+	Username  string `json:"username"`
+	Name      string `json:"name"`
+	HasAvatar bool   `json:"has_avatar"`
+	Locale    Locale `json:"locale"`
+}
+
+type UsernameChanged struct {
+	OldUsername string `json:"old_username"`
+	NewUsername string `json:"new_username"`
+}
+
+type AvatarChanged struct {
+	HasAvatar  bool   `json:"has_avatar"`
+	AvatarHash string `json:"avatar_hash"`
+}
+
+type EmailChanged struct {
+	Email string `json:"email"`
+}
+
+type PhoneChanged struct {
+	PhoneNumber string `json:"phone_number"`
+}
+
+func (UserCreated) DomainEventType() DomainEventType     { return UserCreatedDomainEventType }
+func (UserDeleted) DomainEventType() DomainEventType     { return UserDeletedDomainEventType }
+func (PasswordChanged) DomainEventType() DomainEventType { return PasswordChangedDomainEventType }
+func (ProfileUpdated) DomainEventType() DomainEventType  { return ProfileUpdatedDomainEventType }
+func (UsernameChanged) DomainEventType() DomainEventType { return UsernameChangedDomainEventType }
+func (AvatarChanged) DomainEventType() DomainEventType   { return AvatarChangedDomainEventType }
+func (EmailChanged) DomainEventType() DomainEventType    { return EmailChangedDomainEventType }
+func (PhoneChanged) DomainEventType() DomainEventType    { return PhoneChangedDomainEventType }
+
+// DomainEventModel is a row of the outbox table. It is written in the same
+// transaction as the change it describes, and PublishedAt is set once the
+// relay has put it on the broker.
+type DomainEventModel struct {
+	Id          uuid.UUID       `json:"id" gorm:"type:uuid;primary_key;"`
+	Type        DomainEventType `json:"type" gorm:"not null"`
+	UserId      uuid.UUID       `json:"user_id" gorm:"type:uuid;not null"`
+	UserType    UserType        `json:"user_type" gorm:"not null"`
+	Payload     string          `json:"payload" gorm:"type:jsonb;not null"`
+	CreatedAt   time.Time       `json:"created_at" gorm:"not null;index"`
+	PublishedAt *time.Time      `json:"published_at" gorm:"index"`
+}
+
+func NewDomainEventModel(userId uuid.UUID, userType UserType, payload DomainEventPayload) (*DomainEventModel, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &DomainEventModel{
+		Id:        uuid.New(),
+		Type:      payload.DomainEventType(),
+		UserId:    userId,
+		UserType:  userType,
+		Payload:   string(data),
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+func (m DomainEventModel) ToDomainEvent() *DomainEvent {
+	return &DomainEvent{
+		Id:        m.Id,
+		Type:      m.Type,
+		UserId:    m.UserId,
+		UserType:  m.UserType,
+		Payload:   json.RawMessage(m.Payload),
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+// DomainEvent is what subscribers read from the broker. Delivery is at least
+// once, so subscribers should skip ids they have already handled.
+type DomainEvent struct {
+	Id        uuid.UUID       `json:"id"`
+	Type      DomainEventType `json:"type"`
+	UserId    uuid.UUID       `json:"user_id"`
+	UserType  UserType        `json:"user_type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
@@ -0,0 +1,56 @@
+package ports
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EventType string
+
+const (
+	// LogoutEventType ends the sessions it is sent to; the connection is
+	// closed right after it.
+	LogoutEventType         EventType = "logout"
+	ProfileUpdatedEventType EventType = "profile_updated"
+	NotificationEventType   EventType = "notification"
+)
+
+// Event is what a connected session receives.
+type Event struct {
+	Type      EventType `json:"type"`
+	Data      any       `json:"data,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserEvent addresses an event to the sessions of a user, on whichever
+// gateway they are connected to.
+type UserEvent struct {
+	UserId   uuid.UUID `json:"user_id"`
+	UserType UserType  `json:"user_type"`
+	// Session narrows the event to the sessions opened with one access
+	// token, by its SessionKey. Empty means every session of the user.
+	Session string `json:"session,omitempty"`
+	Event   Event  `json:"event"`
+}
+
+func NewUserEvent(userId uuid.UUID, userType UserType, eventType EventType, data any) *UserEvent {
+	return &UserEvent{
+		UserId:   userId,
+		UserType: userType,
+		Event: Event{
+			Type:      eventType,
+			Data:      data,
+			CreatedAt: time.Now().UTC(),
+		},
+	}
+}
+
+// SessionKey identifies the sessions opened with an access token without
+// passing the token itself around.
+func SessionKey(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return hex.EncodeToString(sum[:16])
+}
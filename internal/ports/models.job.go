@@ -0,0 +1,118 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type JobName string
+
+const (
+	StorageGcJobName         JobName = "storage_gc"
+	DomainEventsPruneJobName JobName = "domain_events_prune"
+	AuditLogVerifyJobName    JobName = "audit_log_verify"
+)
+
+type JobRunStatus string
+
+const (
+	RunningJobRunStatus   JobRunStatus = "running"
+	SucceededJobRunStatus JobRunStatus = "succeeded"
+	FailedJobRunStatus    JobRunStatus = "failed"
+	// AbandonedJobRunStatus is set on a run that never finished, as when the
+	// replica running it died, once the job runs again.
+	AbandonedJobRunStatus JobRunStatus = "abandoned"
+)
+
+// JobTrigger is what started a run.
+type JobTrigger string
+
+const (
+	ScheduleJobTrigger JobTrigger = "schedule"
+	ManualJobTrigger   JobTrigger = "manual"
+)
+
+// Job is a periodic task. Schedule is the default, which
+// JOB_<NAME>_SCHEDULE overrides. Run reports a one line summary of what it
+// did; the run is cancelled once Timeout is up.
+type Job struct {
+	Name        JobName
+	Description string
+	Schedule    string
+	Timeout     time.Duration
+	Run         func(ctx context.Context) (summary string, err error)
+}
+
+// JobStateModel is the state replicas share about a job. Several schedulers
+// read it, and the one holding the lease of the job runs it.
+type JobStateModel struct {
+	Name      JobName   `bson:"_id"`
+	Paused    bool      `bson:"paused"`
+	NextRunAt time.Time `bson:"next_run_at"`
+	// TriggeredAt is set by a manual trigger until the run it asked for
+	// starts. A triggered job runs even when paused.
+	TriggeredAt   time.Time    `bson:"triggered_at,omitempty"`
+	LastRunId     string       `bson:"last_run_id,omitempty"`
+	LastStatus    JobRunStatus `bson:"last_status,omitempty"`
+	LastRunAt     time.Time    `bson:"last_run_at,omitempty"`
+	LastSucceeded time.Time    `bson:"last_succeeded_at,omitempty"`
+	UpdatedAt     time.Time    `bson:"updated_at"`
+}
+
+func (m JobStateModel) ToJobInfo(description, schedule string, timeout time.Duration) *JobInfo {
+	return &JobInfo{
+		Name:            m.Name,
+		Description:     description,
+		Schedule:        schedule,
+		TimeoutSeconds:  int64(timeout / time.Second),
+		Paused:          m.Paused,
+		NextRunAt:       timeOrNil(m.NextRunAt),
+		TriggeredAt:     timeOrNil(m.TriggeredAt),
+		LastStatus:      m.LastStatus,
+		LastRunAt:       timeOrNil(m.LastRunAt),
+		LastSucceededAt: timeOrNil(m.LastSucceeded),
+	}
+}
+
+type JobRunModel struct {
+	Id         string       `bson:"_id"`
+	Name       JobName      `bson:"name"`
+	Trigger    JobTrigger   `bson:"trigger"`
+	Status     JobRunStatus `bson:"status"`
+	Owner      string       `bson:"owner"`
+	Summary    string       `bson:"summary,omitempty"`
+	Error      string       `bson:"error,omitempty"`
+	StartedAt  time.Time    `bson:"started_at"`
+	FinishedAt time.Time    `bson:"finished_at,omitempty"`
+}
+
+func NewJobRunModel(name JobName, trigger JobTrigger, owner string) *JobRunModel {
+	return &JobRunModel{
+		Id:        uuid.NewString(),
+		Name:      name,
+		Trigger:   trigger,
+		Status:    RunningJobRunStatus,
+		Owner:     owner,
+		StartedAt: time.Now().UTC(),
+	}
+}
+
+func (m JobRunModel) ToJobRun() *JobRun {
+	run := &JobRun{
+		Id:         m.Id,
+		Name:       m.Name,
+		Trigger:    m.Trigger,
+		Status:     m.Status,
+		Owner:      m.Owner,
+		Summary:    m.Summary,
+		Error:      m.Error,
+		StartedAt:  m.StartedAt,
+		FinishedAt: timeOrNil(m.FinishedAt),
+	}
+	if !m.FinishedAt.IsZero() {
+		run.DurationMs = m.FinishedAt.Sub(m.StartedAt).Milliseconds()
+	}
+	return run
+}
@@ -0,0 +1,26 @@
+package ports
+
+import "time"
+
+// SmtpStats are counters of the SMTP connection pool since the service
+// started.
+type SmtpStats struct {
+	Sent            int64     `json:"sent"`
+	Failed          int64     `json:"failed"`
+	SentLastMinute  int64     `json:"sent_last_minute"`
+	AvgSendMillis   float64   `json:"avg_send_ms"`
+	Dials           int64     `json:"dials"`
+	Reconnects      int64     `json:"reconnects"`
+	OpenConnections int64     `json:"open_connections"`
+	IdleConnections int       `json:"idle_connections"`
+	PoolSize        int       `json:"pool_size"`
+	Since           time.Time `json:"since"`
+}
+
+type AdminMailStatsGetResponse struct {
+	Smtp *SmtpStats `json:"smtp"`
+	// DkimSelector is empty when messages are sent unsigned.
+	DkimDomain   string `json:"dkim_domain"`
+	DkimSelector string `json:"dkim_selector"`
+	DkimSigned   int64  `json:"dkim_signed"`
+}
@@ -0,0 +1,104 @@
+package ports
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MediaPurpose decides which bucket an object lives in and which content
+// types and sizes it may have.
+type MediaPurpose string
+
+const (
+	AttachmentMediaPurpose MediaPurpose = "attachment"
+	DocumentMediaPurpose   MediaPurpose = "document"
+)
+
+type MediaPurposeSpec struct {
+	ContentTypes []string
+	MaxSize      int64
+}
+
+var MediaPurposeSpecs = map[MediaPurpose]MediaPurposeSpec{
+	AttachmentMediaPurpose: {
+		ContentTypes: []string{"image/png", "image/jpeg", "image/gif", "image/webp", "video/mp4", "audio/mpeg", "application/pdf"},
+		MaxSize:      50 * 1024 * 1024,
+	},
+	DocumentMediaPurpose: {
+		ContentTypes: []string{"application/pdf", "text/plain", "application/zip"},
+		MaxSize:      20 * 1024 * 1024,
+	},
+}
+
+func MediaPurposes() []MediaPurpose {
+	return []MediaPurpose{AttachmentMediaPurpose, DocumentMediaPurpose}
+}
+
+// MediaAcl controls who may read an object. Owners and admins may always
+// manage it.
+type MediaAcl string
+
+const (
+	OwnerMediaAcl  MediaAcl = "owner"
+	PublicMediaAcl MediaAcl = "public"
+	AdminMediaAcl  MediaAcl = "admin"
+)
+
+type MediaModel struct {
+	Id          string       `bson:"_id"`
+	OwnerId     string       `bson:"owner_id"`
+	OwnerType   UserType     `bson:"owner_type"`
+	Purpose     MediaPurpose `bson:"purpose"`
+	Acl         MediaAcl     `bson:"acl"`
+	ObjectName  string       `bson:"object_name"`
+	ContentType string       `bson:"content_type"`
+	Size        int64        `bson:"size"`
+	CreatedAt   time.Time    `bson:"created_at"`
+}
+
+func NewMediaModel(id, ownerId uuid.UUID, ownerType UserType, purpose MediaPurpose, acl MediaAcl, contentType string, size int64) *MediaModel {
+	return &MediaModel{
+		Id:          id.String(),
+		OwnerId:     ownerId.String(),
+		OwnerType:   ownerType,
+		Purpose:     purpose,
+		Acl:         acl,
+		ObjectName:  string(ownerType) + "/" + ownerId.String() + "/" + id.String(),
+		ContentType: contentType,
+		Size:        size,
+		CreatedAt:   time.Now().UTC(),
+	}
+}
+
+func (m MediaModel) IsOwnedBy(userId uuid.UUID, userType UserType) bool {
+	return m.OwnerId == userId.String() && m.OwnerType == userType
+}
+
+func (m MediaModel) CanManage(userId uuid.UUID, userType UserType) bool {
+	return userType == AdminUserType || m.IsOwnedBy(userId, userType)
+}
+
+func (m MediaModel) CanRead(userId uuid.UUID, userType UserType) bool {
+	switch m.Acl {
+	case PublicMediaAcl:
+		return true
+	case AdminMediaAcl:
+		return userType == AdminUserType
+	default:
+		return m.CanManage(userId, userType)
+	}
+}
+
+func (m MediaModel) ToMedia() *Media {
+	return &Media{
+		Id:          uuid.MustParse(m.Id),
+		OwnerId:     uuid.MustParse(m.OwnerId),
+		OwnerType:   m.OwnerType,
+		Purpose:     m.Purpose,
+		Acl:         m.Acl,
+		ContentType: m.ContentType,
+		Size:        m.Size,
+		CreatedAt:   m.CreatedAt,
+	}
+}
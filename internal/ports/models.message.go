@@ -0,0 +1,213 @@
+package ports
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+type MessageChannel string
+
+const (
+	SmsMessageChannel   MessageChannel = "sms"
+	EmailMessageChannel MessageChannel = "email"
+)
+
+// MessageStatus is the delivery state of an outbound message. Queued messages
+// are picked up by the outbox workers, which move them to sending while an
+// attempt is in flight and back to queued when it fails and may be retried.
+type MessageStatus string
+
+const (
+	QueuedMessageStatus  MessageStatus = "queued"
+	SendingMessageStatus MessageStatus = "sending"
+	SentMessageStatus    MessageStatus = "sent"
+	// DeadMessageStatus is set once every attempt has failed. Dead messages
+	// stay in the outbox until an admin requeues them.
+	DeadMessageStatus MessageStatus = "dead"
+	// ExpiredMessageStatus is set when a message outlived its ttl before it
+	// could be sent, as an OTP does once the code itself has expired.
+	ExpiredMessageStatus MessageStatus = "expired"
+	// DeliveredMessageStatus and UndeliveredMessageStatus come from delivery
+	// receipts and only ever follow sent.
+	DeliveredMessageStatus   MessageStatus = "delivered"
+	UndeliveredMessageStatus MessageStatus = "undelivered"
+)
+
+func MessageStatuses() []MessageStatus {
+	return []MessageStatus{
+		QueuedMessageStatus, SendingMessageStatus, SentMessageStatus, DeadMessageStatus,
+		ExpiredMessageStatus, DeliveredMessageStatus, UndeliveredMessageStatus,
+	}
+}
+
+// MessageEventsLimit caps the receipts kept per message; providers resend
+// them freely.
+const MessageEventsLimit = 20
+
+// DeliveryReceipt is a provider report about a message it accepted, reduced
+// to what the outbox understands. Status is empty for intermediate reports
+// such as "queued at the carrier".
+type DeliveryReceipt struct {
+	Provider          string
+	ProviderMessageId string
+	Status            MessageStatus
+	ProviderStatus    string
+	ErrorCode         string
+	ErrorMessage      string
+	OccurredAt        time.Time
+}
+
+// MessageStatsBucket counts the messages of one channel, provider and status.
+// DeliverySeconds sums the time from sent to delivered.
+type MessageStatsBucket struct {
+	Channel         MessageChannel `bson:"channel"`
+	Provider        string         `bson:"provider"`
+	Status          MessageStatus  `bson:"status"`
+	Count           int64          `bson:"count"`
+	DeliverySeconds float64        `bson:"delivery_seconds"`
+}
+
+type MessageEventModel struct {
+	ProviderStatus string    `bson:"provider_status"`
+	Status         string    `bson:"status,omitempty"`
+	ErrorCode      string    `bson:"error_code,omitempty"`
+	ErrorMessage   string    `bson:"error_message,omitempty"`
+	OccurredAt     time.Time `bson:"occurred_at"`
+	ReceivedAt     time.Time `bson:"received_at"`
+}
+
+func NewMessageEventModel(receipt *DeliveryReceipt) *MessageEventModel {
+	now := time.Now().UTC()
+	occurredAt := receipt.OccurredAt
+	if occurredAt.IsZero() {
+		occurredAt = now
+	}
+	return &MessageEventModel{
+		ProviderStatus: receipt.ProviderStatus,
+		Status:         string(receipt.Status),
+		ErrorCode:      receipt.ErrorCode,
+		ErrorMessage:   receipt.ErrorMessage,
+		OccurredAt:     occurredAt.UTC(),
+		ReceivedAt:     now,
+	}
+}
+
+// OutboundMessage is what callers hand to the outbox.
+type OutboundMessage struct {
+	Channel MessageChannel
+	To      string
+	Subject string
+	Body    string
+	// Html is sent as an alternative to Body. Only email uses it.
+	Html string
+	// IdempotencyKey makes enqueueing the same message twice return the first
+	// one instead of sending it again.
+	IdempotencyKey string
+	// Ttl is how long the message is worth sending for; zero means forever.
+	Ttl time.Duration
+}
+
+type MessageModel struct {
+	Id             string         `bson:"_id"`
+	Channel        MessageChannel `bson:"channel"`
+	To             string         `bson:"to"`
+	Subject        string         `bson:"subject,omitempty"`
+	Body           string         `bson:"body"`
+	Html           string         `bson:"html,omitempty"`
+	IdempotencyKey string         `bson:"idempotency_key,omitempty"`
+	Status         MessageStatus  `bson:"status"`
+	Attempts       int            `bson:"attempts"`
+	Provider       string         `bson:"provider,omitempty"`
+	// ProviderMessageId is what the provider calls the message in receipts.
+	ProviderMessageId string              `bson:"provider_message_id,omitempty"`
+	Events            []MessageEventModel `bson:"events,omitempty"`
+	LastError         string              `bson:"last_error,omitempty"`
+	NextAttemptAt     time.Time           `bson:"next_attempt_at"`
+	LockedUntil       time.Time           `bson:"locked_until"`
+	ExpiresAt         time.Time           `bson:"expires_at,omitempty"`
+	CreatedAt         time.Time           `bson:"created_at"`
+	UpdatedAt         time.Time           `bson:"updated_at"`
+	SentAt            time.Time           `bson:"sent_at,omitempty"`
+	DeliveredAt       time.Time           `bson:"delivered_at,omitempty"`
+}
+
+func NewMessageModel(msg *OutboundMessage) *MessageModel {
+	now := time.Now().UTC()
+	m := &MessageModel{
+		Id:             uuid.NewString(),
+		Channel:        msg.Channel,
+		To:             msg.To,
+		Subject:        msg.Subject,
+		Body:           msg.Body,
+		Html:           msg.Html,
+		IdempotencyKey: msg.IdempotencyKey,
+		Status:         QueuedMessageStatus,
+		NextAttemptAt:  now,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if msg.Ttl > 0 {
+		m.ExpiresAt = now.Add(msg.Ttl)
+	}
+	return m
+}
+
+func (m MessageModel) IsExpired(now time.Time) bool {
+	return !m.ExpiresAt.IsZero() && now.After(m.ExpiresAt)
+}
+
+func (m MessageModel) MaskedTo() string {
+	if m.Channel == EmailMessageChannel {
+		return utils.MaskEmail(m.To)
+	}
+	return utils.MaskPhone(m.To)
+}
+
+func (m MessageModel) ToMessage() *Message {
+	events := make([]MessageEvent, 0, len(m.Events))
+	for _, event := range m.Events {
+		events = append(events, MessageEvent{
+			ProviderStatus: event.ProviderStatus,
+			Status:         MessageStatus(event.Status),
+			ErrorCode:      event.ErrorCode,
+			ErrorMessage:   event.ErrorMessage,
+			OccurredAt:     event.OccurredAt,
+			ReceivedAt:     event.ReceivedAt,
+		})
+	}
+	return &Message{
+		Id:                m.Id,
+		Channel:           m.Channel,
+		To:                m.MaskedTo(),
+		Status:            m.Status,
+		Attempts:          m.Attempts,
+		Provider:          m.Provider,
+		ProviderMessageId: m.ProviderMessageId,
+		LastError:         m.LastError,
+		Events:            events,
+		CreatedAt:         m.CreatedAt,
+		UpdatedAt:         m.UpdatedAt,
+		SentAt:            timeOrNil(m.SentAt),
+		DeliveredAt:       timeOrNil(m.DeliveredAt),
+		ExpiresAt:         timeOrNil(m.ExpiresAt),
+	}
+}
+
+func (m MessageModel) ToMessageStatus() *MessageStatusGetResponse {
+	return &MessageStatusGetResponse{
+		Id:        m.Id,
+		Channel:   m.Channel,
+		Status:    m.Status,
+		Attempts:  m.Attempts,
+		UpdatedAt: m.UpdatedAt,
+	}
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
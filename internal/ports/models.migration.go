@@ -0,0 +1,46 @@
+package ports
+
+import "time"
+
+type MigrationState string
+
+const (
+	AppliedMigrationState MigrationState = "applied"
+	PendingMigrationState MigrationState = "pending"
+	// ModifiedMigrationState is an applied migration whose up script changed
+	// since, so the schema may not be what the script now says.
+	ModifiedMigrationState MigrationState = "modified"
+	// MissingMigrationState is an applied migration no longer shipped.
+	MissingMigrationState MigrationState = "missing"
+)
+
+// Migration is a versioned change to the relational schema, read from a
+// {version}_{name}.up.sql and an optional {version}_{name}.down.sql file.
+// Checksum is the hex SHA-256 of the up script.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// SchemaMigrationModel is a row of schema_migrations, one per applied
+// migration.
+type SchemaMigrationModel struct {
+	Version   int64     `gorm:"primary_key;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	Checksum  string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (SchemaMigrationModel) TableName() string {
+	return "schema_migrations"
+}
+
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	State     MigrationState
+	AppliedAt time.Time
+}
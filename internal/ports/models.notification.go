@@ -0,0 +1,118 @@
+package ports
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NotificationType is an event users are told about. Each type is rendered
+// from the message template of the same name; the in-app entry takes its
+// subject as the title and its text as the body.
+type NotificationType string
+
+const (
+	NewSigninNotificationType       NotificationType = "new_signin"
+	PasswordChangedNotificationType NotificationType = "password_changed"
+	EmailChangedNotificationType    NotificationType = "email_changed"
+)
+
+func NotificationTypes() []NotificationType {
+	return []NotificationType{NewSigninNotificationType, PasswordChangedNotificationType, EmailChangedNotificationType}
+}
+
+func (t NotificationType) Template() MessageTemplateName {
+	return MessageTemplateName(t)
+}
+
+// DefaultChannels are used for users who never chose channels for the type.
+// An email change is not sent to the new address, which the user already
+// knows about.
+func (t NotificationType) DefaultChannels() []NotificationChannel {
+	switch t {
+	case EmailChangedNotificationType:
+		return []NotificationChannel{InAppNotificationChannel, SmsNotificationChannel}
+	default:
+		return []NotificationChannel{InAppNotificationChannel, EmailNotificationChannel}
+	}
+}
+
+type NotificationChannel string
+
+const (
+	EmailNotificationChannel NotificationChannel = "email"
+	SmsNotificationChannel   NotificationChannel = "sms"
+	InAppNotificationChannel NotificationChannel = "in_app"
+)
+
+func NotificationChannels() []NotificationChannel {
+	return []NotificationChannel{EmailNotificationChannel, SmsNotificationChannel, InAppNotificationChannel}
+}
+
+// NotificationModel is an entry of a user's in-app inbox.
+type NotificationModel struct {
+	Id        string            `bson:"_id"`
+	UserId    string            `bson:"user_id"`
+	UserType  UserType          `bson:"user_type"`
+	Type      NotificationType  `bson:"type"`
+	Title     string            `bson:"title"`
+	Body      string            `bson:"body"`
+	Data      map[string]string `bson:"data,omitempty"`
+	ReadAt    time.Time         `bson:"read_at,omitempty"`
+	CreatedAt time.Time         `bson:"created_at"`
+}
+
+func NewNotificationModel(userId uuid.UUID, userType UserType, notificationType NotificationType, title, body string, data map[string]string) *NotificationModel {
+	return &NotificationModel{
+		Id:        uuid.NewString(),
+		UserId:    userId.String(),
+		UserType:  userType,
+		Type:      notificationType,
+		Title:     title,
+		Body:      body,
+		Data:      data,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+func (m NotificationModel) ToNotification() *Notification {
+	return &Notification{
+		Id:        m.Id,
+		Type:      m.Type,
+		Title:     m.Title,
+		Body:      m.Body,
+		Data:      m.Data,
+		Read:      !m.ReadAt.IsZero(),
+		ReadAt:    timeOrNil(m.ReadAt),
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+// NotificationPreferencesModel holds the channels a user chose per type. A
+// type missing from Channels uses its defaults; an empty list turns it off.
+type NotificationPreferencesModel struct {
+	UserId    string                                     `bson:"user_id"`
+	UserType  UserType                                   `bson:"user_type"`
+	Channels  map[NotificationType][]NotificationChannel `bson:"channels"`
+	UpdatedAt time.Time                                  `bson:"updated_at"`
+}
+
+// ChannelsFor returns the channels to notify of t on. It may be called on a
+// nil model, for users who never set preferences.
+func (m *NotificationPreferencesModel) ChannelsFor(t NotificationType) []NotificationChannel {
+	if m != nil {
+		if channels, ok := m.Channels[t]; ok {
+			return slices.Clone(channels)
+		}
+	}
+	return t.DefaultChannels()
+}
+
+func (m *NotificationPreferencesModel) ToNotificationPreferences() []NotificationPreference {
+	preferences := make([]NotificationPreference, 0, len(NotificationTypes()))
+	for _, t := range NotificationTypes() {
+		preferences = append(preferences, NotificationPreference{Type: t, Channels: m.ChannelsFor(t)})
+	}
+	return preferences
+}
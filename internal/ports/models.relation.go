@@ -0,0 +1,30 @@
+package ports
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RelationType string
+
+const (
+	FollowRelationType RelationType = "follow"
+	BlockRelationType  RelationType = "block"
+)
+
+type RelationModel struct {
+	FromId    string       `bson:"from_id"`
+	ToId      string       `bson:"to_id"`
+	Type      RelationType `bson:"type"`
+	CreatedAt time.Time    `bson:"created_at"`
+}
+
+func NewRelationModel(fromId, toId uuid.UUID, relationType RelationType) *RelationModel {
+	return &RelationModel{
+		FromId:    fromId.String(),
+		ToId:      toId.String(),
+		Type:      relationType,
+		CreatedAt: time.Now().UTC(),
+	}
+}
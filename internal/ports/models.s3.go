@@ -0,0 +1,86 @@
+package ports
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type StorageBackend string
+
+const (
+	MinioStorageBackend  StorageBackend = "minio"
+	FsStorageBackend     StorageBackend = "fs"
+	MemoryStorageBackend StorageBackend = "memory"
+)
+
+var StorageBackends = []StorageBackend{MinioStorageBackend, FsStorageBackend, MemoryStorageBackend}
+
+// S3ObjectInfo describes a stored object independently of the backend that
+// holds it. Metadata keys are compared case-insensitively by callers since
+// backends normalise them differently.
+type S3ObjectInfo struct {
+	Size         int64             `json:"size"`
+	ContentType  string            `json:"content_type"`
+	ETag         string            `json:"etag"`
+	LastModified time.Time         `json:"last_modified"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+// MaxUploadSize is the largest body a presigned upload may carry.
+func MaxUploadSize() int64 {
+	size := int64(MaxAvatarUploadSize)
+	for _, spec := range MediaPurposeSpecs {
+		size = max(size, spec.MaxSize)
+	}
+	return size
+}
+
+type StorageGcActionKind string
+
+const (
+	DeleteAvatarStorageGcAction     StorageGcActionKind = "delete_avatar"
+	ClearAvatarFlagStorageGcAction  StorageGcActionKind = "clear_avatar_flag"
+	UpdateAvatarHashStorageGcAction StorageGcActionKind = "update_avatar_hash"
+	DeleteUploadStorageGcAction     StorageGcActionKind = "delete_upload"
+	DeleteMediaStorageGcAction      StorageGcActionKind = "delete_media"
+	// MigrateAvatarStorageGcAction re-encodes a legacy avatar into variants.
+	MigrateAvatarStorageGcAction StorageGcActionKind = "migrate_avatar"
+)
+
+type StorageGcOptions struct {
+	// DryRun only reports what would be done.
+	DryRun bool
+	// MinAge protects objects written this recently, which may belong to a
+	// request whose database write has not happened yet.
+	MinAge time.Duration
+	// UploadMaxAge is how long an upload may wait for its completion call.
+	UploadMaxAge time.Duration
+}
+
+// StorageGcAction is one repair the storage garbage collector made, or would
+// make in a dry run. Target is an object name, or a user id for flag fixes.
+type StorageGcAction struct {
+	Kind     StorageGcActionKind
+	UserId   uuid.UUID
+	UserType UserType
+	Target   string
+	Reason   string
+	Err      error
+}
+
+type StorageGcReport struct {
+	DryRun  bool
+	Scanned int64
+	Skipped int64
+	Actions []StorageGcAction
+}
+
+func (r *StorageGcReport) Failed() (failed int) {
+	for _, action := range r.Actions {
+		if action.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
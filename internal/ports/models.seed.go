@@ -0,0 +1,40 @@
+package ports
+
+import "github.com/google/uuid"
+
+// Seed is the data loaded into a dev or staging deployment, read from
+// seeds/{env}/seed.json. Users are matched by username, so loading a seed
+// again brings them back to it instead of duplicating them.
+type Seed struct {
+	Admins    []*SeedUser     `json:"admins" validate:"dive"`
+	Clients   []*SeedUser     `json:"clients" validate:"dive"`
+	Relations []*SeedRelation `json:"relations" validate:"dive"`
+}
+
+type SeedUser struct {
+	// Id is the id given to the user when it is created, for fixtures that
+	// need to know it; a user that exists keeps its own.
+	Id          uuid.UUID `json:"id"`
+	Username    string    `json:"username" validate:"required,usernameValidator"`
+	Name        string    `json:"name" validate:"required,nameValidator"`
+	PhoneNumber string    `json:"phone_number" validate:"phoneValidator"`
+	Email       string    `json:"email" validate:"emailValidator"`
+	Password    string    `json:"password" validate:"passwordValidator"`
+	Locale      Locale    `json:"locale" validate:"localeValidator"`
+	// Avatar is the path of a png or jpeg image relative to the seed.
+	Avatar string `json:"avatar"`
+}
+
+// SeedRelation is a relation between two clients, named by username.
+type SeedRelation struct {
+	From string       `json:"from" validate:"required"`
+	To   string       `json:"to" validate:"required"`
+	Type RelationType `json:"type" validate:"required,oneof=follow block"`
+}
+
+type SeedReport struct {
+	Created   []string
+	Updated   []string
+	Unchanged []string
+	Relations int
+}
@@ -0,0 +1,20 @@
+package ports
+
+import "time"
+
+type SmsProviderName string
+
+const (
+	TwilioSmsProviderName SmsProviderName = "twilio"
+	HttpSmsProviderName   SmsProviderName = "http"
+	SinkSmsProviderName   SmsProviderName = "sink"
+)
+
+// SmsMessage is a message kept by the sink provider instead of being sent.
+type SmsMessage struct {
+	Id        string    `json:"id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
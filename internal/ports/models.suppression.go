@@ -0,0 +1,77 @@
+package ports
+
+import (
+	"strings"
+	"time"
+)
+
+// BounceType is what a bounce processor reported about an address. Hard
+// bounces and complaints put the address on the suppression list; soft
+// bounces are only recorded on the message.
+type BounceType string
+
+const (
+	HardBounceType      BounceType = "hard_bounce"
+	SoftBounceType      BounceType = "soft_bounce"
+	ComplaintBounceType BounceType = "complaint"
+)
+
+// SuppressionSource is how a bounce reached the service.
+type SuppressionSource string
+
+const (
+	// MailboxSuppressionSource is a report read from the bounce mailbox.
+	MailboxSuppressionSource SuppressionSource = "mailbox"
+	// WebhookSuppressionSource is a report or bounce posted to the webhook.
+	WebhookSuppressionSource SuppressionSource = "webhook"
+)
+
+// EmailBounce is one bounce or complaint about one address, whichever way it
+// was reported.
+type EmailBounce struct {
+	Email  string
+	Type   BounceType
+	Source SuppressionSource
+	// Status is the enhanced status code, such as 5.1.1.
+	Status            string
+	Diagnostic        string
+	Provider          string
+	ProviderMessageId string
+	OccurredAt        time.Time
+}
+
+// NormalizeSuppressedEmail is the form addresses are listed under. Local parts
+// are case-insensitive in practice, so the whole address is lowercased.
+func NormalizeSuppressedEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+type SuppressionModel struct {
+	Email             string            `bson:"_id"`
+	Reason            BounceType        `bson:"reason"`
+	Source            SuppressionSource `bson:"source"`
+	Status            string            `bson:"status,omitempty"`
+	Diagnostic        string            `bson:"diagnostic,omitempty"`
+	Provider          string            `bson:"provider,omitempty"`
+	ProviderMessageId string            `bson:"provider_message_id,omitempty"`
+	// Count is how many bounces and complaints were reported for the address
+	// while it was listed.
+	Count     int64     `bson:"count"`
+	CreatedAt time.Time `bson:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+func (m SuppressionModel) ToSuppression() *Suppression {
+	return &Suppression{
+		Email:             m.Email,
+		Reason:            m.Reason,
+		Source:            m.Source,
+		Status:            m.Status,
+		Diagnostic:        m.Diagnostic,
+		Provider:          m.Provider,
+		ProviderMessageId: m.ProviderMessageId,
+		Count:             m.Count,
+		CreatedAt:         m.CreatedAt,
+		UpdatedAt:         m.UpdatedAt,
+	}
+}
@@ -0,0 +1,188 @@
+package ports
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Locale string
+
+const (
+	EnLocale Locale = "en"
+	FaLocale Locale = "fa"
+)
+
+// DefaultLocale is rendered when a template has no variant in the requested
+// locale, so every template must exist in it.
+const DefaultLocale = EnLocale
+
+func Locales() []Locale {
+	return []Locale{EnLocale, FaLocale}
+}
+
+func LocaleValidator(locale string) bool {
+	return slices.Contains(Locales(), Locale(locale))
+}
+
+func (l Locale) IsRtl() bool {
+	return l == FaLocale
+}
+
+// Dir is the value of the html dir attribute for text in the locale.
+func (l Locale) Dir() string {
+	if l.IsRtl() {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// NegotiateLocale picks the supported locale the Accept-Language header
+// prefers most, matching on the primary subtag so that fa-IR selects fa. It
+// returns "" when nothing in the header is supported.
+func NegotiateLocale(acceptLanguage string) Locale {
+	best, bestQ := Locale(""), 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if !LocaleValidator(primary) || q <= bestQ {
+			continue
+		}
+		best, bestQ = Locale(primary), q
+	}
+	return best
+}
+
+type MessageTemplateName string
+
+const (
+	OtpMessageTemplateName       MessageTemplateName = "otp"
+	SignupKeyMessageTemplateName MessageTemplateName = "signup_key"
+)
+
+// MessageTemplateNames lists every template, including one per notification
+// type.
+func MessageTemplateNames() []MessageTemplateName {
+	names := []MessageTemplateName{OtpMessageTemplateName, SignupKeyMessageTemplateName}
+	for _, t := range NotificationTypes() {
+		names = append(names, t.Template())
+	}
+	return names
+}
+
+// MessageTemplateData is what the message templates are executed with. The
+// registry fills in the locale fields.
+type MessageTemplateData struct {
+	Token        string  `json:"token"`
+	OtpType      OtpType `json:"otp_type"`
+	Domain       string  `json:"domain"`
+	Version      string  `json:"version"`
+	SupportEmail string  `json:"support_email"`
+	// Data holds what notification templates show, such as the ip and
+	// user_agent of a sign in.
+	Data map[string]string `json:"data,omitempty"`
+
+	Locale Locale `json:"-"`
+	Dir    string `json:"-"`
+	Align  string `json:"-"`
+}
+
+// SampleMessageTemplateData returns fixed data to preview a template with,
+// so renders of it can be compared across runs.
+func SampleMessageTemplateData(name MessageTemplateName) *MessageTemplateData {
+	data := &MessageTemplateData{
+		Token:        "12345",
+		OtpType:      SigninOtpType,
+		Domain:       "example.com",
+		Version:      "v1",
+		SupportEmail: "support@example.com",
+	}
+	switch name {
+	case SignupKeyMessageTemplateName:
+		data.Token = "aB3$kZ9q"
+		data.OtpType = AdminSignupKeyOtpType
+	case NewSigninNotificationType.Template(), PasswordChangedNotificationType.Template(), EmailChangedNotificationType.Template():
+		data.Data = map[string]string{
+			"time":       "2025-01-02 15:04 UTC",
+			"ip":         "203.0.113.7",
+			"user_agent": "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0",
+		}
+		if name == EmailChangedNotificationType.Template() {
+			data.Data["email"] = "j***@example.com"
+		}
+	}
+	return data
+}
+
+// Merge overrides the fields of d that are set in other.
+func (d *MessageTemplateData) Merge(other *MessageTemplateData) *MessageTemplateData {
+	merged := *d
+	if other == nil {
+		return &merged
+	}
+	if other.Token != "" {
+		merged.Token = other.Token
+	}
+	if other.OtpType != "" {
+		merged.OtpType = other.OtpType
+	}
+	if other.Domain != "" {
+		merged.Domain = other.Domain
+	}
+	if other.Version != "" {
+		merged.Version = other.Version
+	}
+	if other.SupportEmail != "" {
+		merged.SupportEmail = other.SupportEmail
+	}
+	if len(other.Data) > 0 {
+		merged.Data = make(map[string]string, len(d.Data)+len(other.Data))
+		maps.Copy(merged.Data, d.Data)
+		maps.Copy(merged.Data, other.Data)
+	}
+	return &merged
+}
+
+// MessageTemplate describes a template and the locales it is written in.
+type MessageTemplate struct {
+	Name    MessageTemplateName `json:"name"`
+	Locales []Locale            `json:"locales"`
+}
+
+// MessageTemplatePart is one part of a template. Channels render only the
+// parts they send.
+type MessageTemplatePart string
+
+const (
+	SubjectMessageTemplatePart MessageTemplatePart = "subject"
+	TextMessageTemplatePart    MessageTemplatePart = "text"
+	HtmlMessageTemplatePart    MessageTemplatePart = "html"
+	SmsMessageTemplatePart     MessageTemplatePart = "sms"
+)
+
+func MessageTemplateParts() []MessageTemplatePart {
+	return []MessageTemplatePart{SubjectMessageTemplatePart, TextMessageTemplatePart, HtmlMessageTemplatePart, SmsMessageTemplatePart}
+}
+
+// RenderedMessage holds the parts of a template rendered in one locale.
+// Email uses the subject with the text and html bodies as alternatives, SMS
+// uses Sms alone.
+type RenderedMessage struct {
+	Template    MessageTemplateName `json:"template"`
+	Locale      Locale              `json:"locale"`
+	Subject     string              `json:"subject"`
+	Text        string              `json:"text"`
+	Html        string              `json:"html"`
+	Sms         string              `json:"sms"`
+	SmsEncoding string              `json:"sms_encoding"`
+	SmsSegments int                 `json:"sms_segments"`
+}
@@ -0,0 +1,54 @@
+package ports
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type UploadPurpose string
+
+const (
+	AvatarUploadPurpose UploadPurpose = "avatar"
+	MediaUploadPurpose  UploadPurpose = "media"
+)
+
+// MaxAvatarUploadSize matches the input limit enforced by utils.ImageReader.
+const MaxAvatarUploadSize = 10 * 1024 * 1024
+
+var AvatarUploadContentTypes = []string{"image/png", "image/jpeg"}
+
+// UploadSessionModel is kept in the cache until the upload is completed or
+// the presigned url expires.
+type UploadSessionModel struct {
+	Id          uuid.UUID     `json:"id"`
+	UserId      uuid.UUID     `json:"user_id"`
+	UserType    UserType      `json:"user_type"`
+	Purpose     UploadPurpose `json:"purpose"`
+	ObjectName  string        `json:"object_name"`
+	ContentType string        `json:"content_type"`
+	Size        int64         `json:"size"`
+	ExpiresAt   time.Time     `json:"expires_at"`
+
+	// Only set for media uploads.
+	MediaPurpose MediaPurpose `json:"media_purpose,omitempty"`
+	MediaAcl     MediaAcl     `json:"media_acl,omitempty"`
+}
+
+func NewUploadSessionModel(userId uuid.UUID, userType UserType, purpose UploadPurpose, contentType string, size int64, expire time.Duration) *UploadSessionModel {
+	id := uuid.New()
+	return &UploadSessionModel{
+		Id:          id,
+		UserId:      userId,
+		UserType:    userType,
+		Purpose:     purpose,
+		ObjectName:  string(purpose) + "/" + string(userType) + "/" + userId.String() + "/" + id.String(),
+		ContentType: contentType,
+		Size:        size,
+		ExpiresAt:   time.Now().UTC().Add(expire),
+	}
+}
+
+func (m *UploadSessionModel) IsOwnedBy(userId uuid.UUID, userType UserType) bool {
+	return m.UserId == userId && m.UserType == userType
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -25,8 +28,116 @@ func init() {
 	s3Prefix = "https://api." + domain + "/" + version + "/s3/avatars/"
 }
 
-func GetAvatarUrl(id uuid.UUID, userType UserType) string {
-	return s3Prefix + string(userType) + "/" + id.String() + ".png"
+type AvatarFormat string
+
+const (
+	PngAvatarFormat  AvatarFormat = "png"
+	WebpAvatarFormat AvatarFormat = "webp"
+)
+
+var AvatarFormats = []AvatarFormat{WebpAvatarFormat, PngAvatarFormat}
+
+// AvatarHashLength is the number of hex characters of the variants digest
+// kept as the avatar version.
+const AvatarHashLength = 16
+
+// AvatarHashMetadataKey is the object metadata holding the avatar version.
+const AvatarHashMetadataKey = "Avatar-Hash"
+
+// AvatarSizes lists the square variant edges generated on upload, ascending.
+var AvatarSizes = []int{64, 128, 512}
+
+func (f AvatarFormat) ContentType() string {
+	return "image/" + string(f)
+}
+
+func AvatarObjectName(id uuid.UUID, userType UserType, size int, format AvatarFormat) string {
+	return string(userType) + "/" + id.String() + "/" + strconv.Itoa(size) + "." + string(format)
+}
+
+// LegacyAvatarObjectName is the single png an avatar was stored as before
+// variants. It is served until the storage gc re-encodes it into variants.
+func LegacyAvatarObjectName(id uuid.UUID, userType UserType) string {
+	return string(userType) + "/" + id.String() + ".png"
+}
+
+// ParseAvatarObjectPath recovers the owner of an avatar object. Besides the
+// names built by AvatarObjectName it accepts LegacyAvatarObjectName.
+func ParseAvatarObjectPath(objectName string) (id uuid.UUID, userType UserType, ok bool) {
+	parts := strings.Split(objectName, "/")
+	if len(parts) < 2 || len(parts) > 3 || !slices.Contains(AllUserTypes, UserType(parts[0])) {
+		return uuid.Nil, "", false
+	}
+	idPart := parts[1]
+	if len(parts) == 2 {
+		idPart = strings.TrimSuffix(idPart, ".png")
+	}
+	id, err := uuid.Parse(idPart)
+	if err != nil {
+		return uuid.Nil, "", false
+	}
+	return id, UserType(parts[0]), true
+}
+
+// AvatarRecord is what the relational store holds about a user's avatar.
+type AvatarRecord struct {
+	Id         uuid.UUID
+	IsDeleted  bool
+	HasAvatar  bool
+	AvatarHash string
+	UpdatedAt  time.Time
+}
+
+// GetAvatarUrl returns the content-negotiated avatar url, which serves the
+// largest variant in the best format the client accepts. A non-empty hash
+// pins the url to one upload so it can be cached immutably.
+func GetAvatarUrl(id uuid.UUID, userType UserType, hash string) string {
+	url := s3Prefix + string(userType) + "/" + id.String()
+	if hash != "" {
+		url += "?v=" + hash
+	}
+	return url
+}
+
+func GetAvatarVariants(id uuid.UUID, userType UserType, hash string) []*AvatarVariant {
+	variants := make([]*AvatarVariant, 0, len(AvatarSizes)*len(AvatarFormats))
+	for _, size := range AvatarSizes {
+		for _, format := range AvatarFormats {
+			url := s3Prefix + string(userType) + "/" + id.String() + "." + string(format) + "?size=" + strconv.Itoa(size)
+			if hash != "" {
+				url += "&v=" + hash
+			}
+			variants = append(variants, &AvatarVariant{
+				Size:   size,
+				Format: format,
+				Url:    url,
+			})
+		}
+	}
+	return variants
+}
+
+// BestAvatarSize returns the smallest variant that is at least requested
+// pixels wide, falling back to the largest one.
+func BestAvatarSize(requested int) int {
+	for _, size := range AvatarSizes {
+		if size >= requested && requested > 0 {
+			return size
+		}
+	}
+	return AvatarSizes[len(AvatarSizes)-1]
+}
+
+// NegotiateAvatarFormat honours an explicit extension first and otherwise
+// serves webp to clients that list it in their Accept header.
+func NegotiateAvatarFormat(ext, accept string) AvatarFormat {
+	if ext != "" {
+		return AvatarFormat(ext)
+	}
+	if strings.Contains(accept, WebpAvatarFormat.ContentType()) {
+		return WebpAvatarFormat
+	}
+	return PngAvatarFormat
 }
 
 func UserModelFromUserType(userType UserType) UserModel {
@@ -51,6 +162,8 @@ type UserModel interface {
 	GetEmail() string
 	GetPassword() string
 	GetHasAvatar() bool
+	GetAvatarHash() string
+	GetLocale() Locale
 	GetUpdatedAt() time.Time
 	GetCreatedAt() time.Time
 	GetIsDeleted() bool
@@ -63,6 +176,8 @@ type BaseUserModel struct {
 	Username    string    `json:"username" gorm:"unique"`
 	Name        string    `json:"name" gorm:"not null"`
 	HasAvatar   bool      `json:"has_avatar" gorm:"not null"`
+	AvatarHash  string    `json:"avatar_hash" gorm:"not null;default:''"`
+	Locale      Locale    `json:"locale" gorm:"not null;default:''"`
 	PhoneNumber *string   `json:"phone_number"`
 	Email       *string   `json:"email"`
 	Password    *string   `json:"password"`
@@ -114,6 +229,14 @@ func (u BaseUserModel) GetHasAvatar() bool {
 	return u.HasAvatar
 }
 
+func (u BaseUserModel) GetAvatarHash() string {
+	return u.AvatarHash
+}
+
+func (u BaseUserModel) GetLocale() Locale {
+	return u.Locale
+}
+
 func (u BaseUserModel) GetCreatedAt() time.Time {
 	return u.CreatedAt
 }
@@ -138,14 +261,17 @@ func (u AdminUserModel) New(id uuid.UUID, username, name, phoneNumber, email, pa
 
 func (u AdminUserModel) ToUser() *User {
 	var avatar string
+	var avatars []*AvatarVariant
 	if u.HasAvatar {
-		avatar = GetAvatarUrl(u.Id, AdminUserType)
+		avatar = GetAvatarUrl(u.Id, AdminUserType, u.AvatarHash)
+		avatars = GetAvatarVariants(u.Id, AdminUserType, u.AvatarHash)
 	}
 	return &User{
 		Id:       u.Id,
 		Username: u.Username,
 		Name:     u.Name,
 		Avatar:   avatar,
+		Avatars:  avatars,
 		UserType: AdminUserType,
 	}
 }
@@ -190,13 +316,16 @@ func (u ClientUserModel) New(id uuid.UUID, username, name, phoneNumber, email, p
 
 func (u ClientUserModel) ToUser() *User {
 	var avatar string
+	var avatars []*AvatarVariant
 	if u.HasAvatar {
-		avatar = GetAvatarUrl(u.Id, ClientUserType)
+		avatar = GetAvatarUrl(u.Id, ClientUserType, u.AvatarHash)
+		avatars = GetAvatarVariants(u.Id, ClientUserType, u.AvatarHash)
 	}
 	return &User{
 		Id:       u.Id,
 		Name:     u.Name,
 		Avatar:   avatar,
+		Avatars:  avatars,
 		UserType: ClientUserType,
 	}
 }
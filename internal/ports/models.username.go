@@ -0,0 +1,46 @@
+package ports
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type UsernameHistoryModel struct {
+	Id            uuid.UUID `json:"id" gorm:"type:uuid;primary_key;"`
+	UserId        uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	UserType      UserType  `json:"user_type" gorm:"not null;index"`
+	OldUsername   string    `json:"old_username" gorm:"not null;index"`
+	NewUsername   string    `json:"new_username" gorm:"not null"`
+	ReservedUntil time.Time `json:"reserved_until" gorm:"not null"`
+	CreatedAt     time.Time `json:"created_at" gorm:"not null"`
+}
+
+func NewUsernameHistoryModel(userId uuid.UUID, userType UserType, oldUsername, newUsername string, reservation time.Duration) *UsernameHistoryModel {
+	now := time.Now().UTC()
+	return &UsernameHistoryModel{
+		Id:            uuid.New(),
+		UserId:        userId,
+		UserType:      userType,
+		OldUsername:   oldUsername,
+		NewUsername:   newUsername,
+		ReservedUntil: now.Add(reservation),
+		CreatedAt:     now,
+	}
+}
+
+type UsernameDenylistModel struct {
+	Username  string    `json:"username" gorm:"primary_key"`
+	Reason    string    `json:"reason"`
+	CreatedBy uuid.UUID `json:"created_by" gorm:"type:uuid"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+}
+
+func (m UsernameDenylistModel) ToUsernameDenylistEntry() *UsernameDenylistEntry {
+	return &UsernameDenylistEntry{
+		Username:  m.Username,
+		Reason:    m.Reason,
+		CreatedBy: m.CreatedBy,
+		CreatedAt: m.CreatedAt,
+	}
+}
@@ -0,0 +1,137 @@
+package ports
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebhookDeliveryStatus is the state of one event sent to one webhook. It
+// moves like an outbox message: queued, sending while an attempt is in
+// flight, then back to queued for a retry or on to succeeded or dead.
+type WebhookDeliveryStatus string
+
+const (
+	QueuedWebhookDeliveryStatus    WebhookDeliveryStatus = "queued"
+	SendingWebhookDeliveryStatus   WebhookDeliveryStatus = "sending"
+	SucceededWebhookDeliveryStatus WebhookDeliveryStatus = "succeeded"
+	DeadWebhookDeliveryStatus      WebhookDeliveryStatus = "dead"
+)
+
+// WebhookAttemptsLimit caps the attempts kept in the log of a delivery.
+const WebhookAttemptsLimit = 20
+
+type WebhookModel struct {
+	Id     string            `bson:"_id"`
+	Url    string            `bson:"url"`
+	Events []DomainEventType `bson:"events"`
+	// Secret signs every delivery. It is only shown when the webhook is
+	// created.
+	Secret      string    `bson:"secret"`
+	Description string    `bson:"description,omitempty"`
+	Active      bool      `bson:"active"`
+	CreatedBy   string    `bson:"created_by"`
+	CreatedAt   time.Time `bson:"created_at"`
+	UpdatedAt   time.Time `bson:"updated_at"`
+}
+
+func NewWebhookModel(url string, events []DomainEventType, secret, description string, createdBy uuid.UUID) *WebhookModel {
+	now := time.Now().UTC()
+	return &WebhookModel{
+		Id:          uuid.NewString(),
+		Url:         url,
+		Events:      events,
+		Secret:      secret,
+		Description: description,
+		Active:      true,
+		CreatedBy:   createdBy.String(),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+func (m WebhookModel) ToWebhook() *Webhook {
+	return &Webhook{
+		Id:          m.Id,
+		Url:         m.Url,
+		Events:      m.Events,
+		Description: m.Description,
+		Active:      m.Active,
+		CreatedBy:   m.CreatedBy,
+		CreatedAt:   m.CreatedAt,
+		UpdatedAt:   m.UpdatedAt,
+	}
+}
+
+type WebhookAttemptModel struct {
+	StatusCode  int       `bson:"status_code,omitempty"`
+	Error       string    `bson:"error,omitempty"`
+	DurationMs  int64     `bson:"duration_ms"`
+	AttemptedAt time.Time `bson:"attempted_at"`
+}
+
+type WebhookDeliveryModel struct {
+	Id        string          `bson:"_id"`
+	WebhookId string          `bson:"webhook_id"`
+	EventId   string          `bson:"event_id"`
+	EventType DomainEventType `bson:"event_type"`
+	// Body is sent as is on every attempt, so a replay delivers exactly what
+	// the first attempt did.
+	Body          string                `bson:"body"`
+	Status        WebhookDeliveryStatus `bson:"status"`
+	Attempts      int                   `bson:"attempts"`
+	Log           []WebhookAttemptModel `bson:"log,omitempty"`
+	LastError     string                `bson:"last_error,omitempty"`
+	NextAttemptAt time.Time             `bson:"next_attempt_at"`
+	LockedUntil   time.Time             `bson:"locked_until"`
+	CreatedAt     time.Time             `bson:"created_at"`
+	UpdatedAt     time.Time             `bson:"updated_at"`
+	SucceededAt   time.Time             `bson:"succeeded_at,omitempty"`
+}
+
+func NewWebhookDeliveryModel(webhookId string, event *DomainEvent, body string) *WebhookDeliveryModel {
+	now := time.Now().UTC()
+	return &WebhookDeliveryModel{
+		Id:            uuid.NewString(),
+		WebhookId:     webhookId,
+		EventId:       event.Id.String(),
+		EventType:     event.Type,
+		Body:          body,
+		Status:        QueuedWebhookDeliveryStatus,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+func (m WebhookDeliveryModel) ToWebhookDelivery() *WebhookDelivery {
+	log := make([]WebhookAttempt, 0, len(m.Log))
+	for _, attempt := range m.Log {
+		log = append(log, WebhookAttempt{
+			StatusCode:  attempt.StatusCode,
+			Error:       attempt.Error,
+			DurationMs:  attempt.DurationMs,
+			AttemptedAt: attempt.AttemptedAt,
+		})
+	}
+	// Only a queued delivery is waiting for its next attempt.
+	var nextAttemptAt *time.Time
+	if m.Status == QueuedWebhookDeliveryStatus {
+		nextAttemptAt = &m.NextAttemptAt
+	}
+	return &WebhookDelivery{
+		Id:            m.Id,
+		WebhookId:     m.WebhookId,
+		EventId:       m.EventId,
+		EventType:     m.EventType,
+		Body:          m.Body,
+		Status:        m.Status,
+		Attempts:      m.Attempts,
+		Log:           log,
+		LastError:     m.LastError,
+		NextAttemptAt: nextAttemptAt,
+		CreatedAt:     m.CreatedAt,
+		UpdatedAt:     m.UpdatedAt,
+		SucceededAt:   timeOrNil(m.SucceededAt),
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/dlclark/regexp2"
 	"github.com/go-playground/validator/v10"
@@ -17,6 +18,42 @@ import (
 
 var inValidator = validator.New()
 
+var (
+	deniedUsernamesMu sync.RWMutex
+	deniedUsernames   = utils.NewSet[string]()
+)
+
+// SetDeniedUsernames replaces the in-memory username denylist consulted by
+// claimableUsernameValidator. The relational repository stays the source of
+// truth.
+func SetDeniedUsernames(usernames ...string) {
+	set := utils.NewSet[string]()
+	for _, username := range usernames {
+		set.Add(strings.ToLower(username))
+	}
+	deniedUsernamesMu.Lock()
+	deniedUsernames = set
+	deniedUsernamesMu.Unlock()
+}
+
+func AddDeniedUsername(username string) {
+	deniedUsernamesMu.Lock()
+	deniedUsernames.Add(strings.ToLower(username))
+	deniedUsernamesMu.Unlock()
+}
+
+func RemoveDeniedUsername(username string) {
+	deniedUsernamesMu.Lock()
+	deniedUsernames.Remove(strings.ToLower(username))
+	deniedUsernamesMu.Unlock()
+}
+
+func IsUsernameDenied(username string) bool {
+	deniedUsernamesMu.RLock()
+	defer deniedUsernamesMu.RUnlock()
+	return deniedUsernames.Contains(strings.ToLower(username))
+}
+
 func Validate(ctx context.Context, logger *utils.Logger, data any) (err error) {
 	defer func() {
 		const caller = packageCaller + ".Validate"
@@ -49,6 +86,7 @@ func Validate(ctx context.Context, logger *utils.Logger, data any) (err error) {
 func init() {
 	_ = inValidator.RegisterValidation("nameValidator", nameValidator)
 	_ = inValidator.RegisterValidation("usernameValidator", usernameValidator)
+	_ = inValidator.RegisterValidation("claimableUsernameValidator", claimableUsernameValidator)
 	_ = inValidator.RegisterValidation("phoneValidator", phoneValidator)
 	_ = inValidator.RegisterValidation("userTypeValidator", userTypeValidator)
 	_ = inValidator.RegisterValidation("nonClientUserTypeValidator", nonClientUserTypeValidator)
@@ -60,6 +98,7 @@ func init() {
 	_ = inValidator.RegisterValidation("avatarValidator", avatarValidator)
 	_ = inValidator.RegisterValidation("avatarObjectNameValidator", avatarObjectNameValidator)
 	_ = inValidator.RegisterValidation("emailValidator", emailValidator)
+	_ = inValidator.RegisterValidation("localeValidator", localeValidator)
 
 	inValidator.RegisterStructValidation(authMethodOtpGetRequestValidator, AuthMethodOtpGetRequest{})
 	inValidator.RegisterStructValidation(authSignupKeyGetRequestValidator, AuthSignupKeyGetRequest{})
@@ -102,6 +141,14 @@ func usernameValidator(fl validator.FieldLevel) bool {
 	return matched
 }
 
+// claimableUsernameValidator is usernameValidator for a username being
+// claimed, which must not be denylisted either. Users keep their username
+// when it is denylisted later, so only signup uses it; changing a username
+// is checked by the relational repository.
+func claimableUsernameValidator(fl validator.FieldLevel) bool {
+	return usernameValidator(fl) && !IsUsernameDenied(fl.Field().String())
+}
+
 func PhoneValidator(phone string) bool {
 	pattern := `^\+[1-9]\d{10,14}$`
 	matched, err := regexp.MatchString(pattern, phone)
@@ -220,19 +267,40 @@ func AvatarValidator(avatar string) (img *image.Image, err error) {
 	if err != nil {
 		return nil, utils.BadRequestResponse.Clone()
 	}
-	return utils.ImageReader(imgData, "png", [2]int{250, 250}, []string{"png", "jpg", "jpeg"})
+	return AvatarImageReader(imgData)
+}
+
+// AvatarImageReader decodes raw avatar bytes into an upright square image the
+// size of the largest variant.
+func AvatarImageReader(imgData []byte) (img *image.Image, err error) {
+	largest := AvatarSizes[len(AvatarSizes)-1]
+	return utils.ImageReader(imgData, "png", [2]int{largest, largest}, []string{"png", "jpg", "jpeg"})
 }
 
 func avatarObjectNameValidator(fl validator.FieldLevel) bool {
-	avatarObjectName := fl.Field().String()
-	if !strings.HasSuffix(avatarObjectName, ".png") {
-		return false
-	}
-	avatarObjectId := strings.TrimSuffix(avatarObjectName, ".png")
-	_, err := uuid.Parse(avatarObjectId)
+	_, _, err := ParseAvatarObjectName(fl.Field().String())
 	return err == nil
 }
 
+// ParseAvatarObjectName splits "<uuid>", "<uuid>.png" or "<uuid>.webp" into
+// the user id and the requested extension, which is empty when omitted.
+func ParseAvatarObjectName(objectName string) (id uuid.UUID, ext string, err error) {
+	name := objectName
+	if dot := strings.LastIndexByte(objectName, '.'); dot != -1 {
+		name, ext = objectName[:dot], objectName[dot+1:]
+		if !slices.Contains(AvatarFormats, AvatarFormat(ext)) {
+			return uuid.Nil, "", utils.BadRequestResponse.Clone().
+				WithReason("object_name", objectName)
+		}
+	}
+	id, err = uuid.Parse(name)
+	if err != nil {
+		return uuid.Nil, "", utils.BadRequestResponse.Clone().
+			WithReason("object_name", objectName)
+	}
+	return id, ext, nil
+}
+
 func EmailValidator(email string) bool {
 	pattern := `^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`
 	matched, err := regexp.MatchString(pattern, email)
@@ -249,6 +317,13 @@ func emailValidator(fl validator.FieldLevel) bool {
 	return EmailValidator(fl.Field().String())
 }
 
+func localeValidator(fl validator.FieldLevel) bool {
+	if fl.Field().String() == "" {
+		return true
+	}
+	return LocaleValidator(fl.Field().String())
+}
+
 func authMethodOtpGetRequestValidator(sl validator.StructLevel) {
 	req := sl.Current().Interface().(AuthMethodOtpGetRequest)
 
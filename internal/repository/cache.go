@@ -2,9 +2,13 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
 	"github.com/kasragay/backend/internal/ports"
 	"github.com/kasragay/backend/internal/utils"
 	"github.com/redis/go-redis/v9"
@@ -117,6 +121,251 @@ func (c *Cache) DeleteOtpKey(ctx context.Context, identity string, userType port
 	return
 }
 
+func (c *Cache) SetUploadSession(ctx context.Context, session *ports.UploadSessionModel, expire time.Duration) (err error) {
+	defer func() { err = utils.FuncPipe(cacheCaller+".SetUploadSession", err) }()
+	data, err := sonic.Marshal(session)
+	if err != nil {
+		return err
+	}
+	if err := c.client.Set(ctx, uploadSessionKey(session.Id), data, expire).Err(); err != nil {
+		return err
+	}
+	return
+}
+
+func (c *Cache) GetUploadSession(ctx context.Context, id uuid.UUID) (session *ports.UploadSessionModel, err error) {
+	defer func() { err = utils.FuncPipe(cacheCaller+".GetUploadSession", err) }()
+	data, err := c.client.Get(ctx, uploadSessionKey(id)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	session = &ports.UploadSessionModel{}
+	if err := sonic.Unmarshal(data, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (c *Cache) DeleteUploadSession(ctx context.Context, id uuid.UUID) (err error) {
+	defer func() { err = utils.FuncPipe(cacheCaller+".DeleteUploadSession", err) }()
+	if err := c.client.Del(ctx, uploadSessionKey(id)).Err(); err != nil {
+		return err
+	}
+	return
+}
+
+func uploadSessionKey(id uuid.UUID) string {
+	return "upload:" + id.String()
+}
+
+// eventsChannel carries the events of every user; each gateway picks out the
+// ones for the sessions connected to it.
+const eventsChannel = "events"
+
+func (c *Cache) PublishEvent(ctx context.Context, event *ports.UserEvent) (err error) {
+	defer func() { err = utils.FuncPipe(cacheCaller+".PublishEvent", err) }()
+	data, err := sonic.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return c.client.Publish(ctx, eventsChannel, data).Err()
+}
+
+func (c *Cache) SubscribeEvents(ctx context.Context, fn func(event *ports.UserEvent)) (err error) {
+	defer func() { err = utils.FuncPipe(cacheCaller+".SubscribeEvents", err) }()
+	pubsub := c.client.Subscribe(ctx, eventsChannel)
+	defer pubsub.Close()
+	if _, err = pubsub.Receive(ctx); err != nil {
+		return err
+	}
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return errors.New("events subscription was closed")
+			}
+			event := &ports.UserEvent{}
+			// Skipping what does not decode keeps one bad publisher from
+			// cutting every session off.
+			if err := sonic.UnmarshalString(msg.Payload, event); err != nil {
+				continue
+			}
+			fn(event)
+		}
+	}
+}
+
+// domainEventsStream holds the domain events relayed from the outbox. It is
+// trimmed to about domainEventsStreamMaxLen entries, so a consumer group that
+// falls further behind than that misses events. Entries left unacked for
+// domainEventsClaimIdle are taken over by another consumer of the group.
+const (
+	domainEventsStream       = "domain_events"
+	domainEventsStreamMaxLen = 100_000
+	domainEventsReadCount    = 100
+	domainEventsReadBlock    = 5 * time.Second
+	domainEventsClaimIdle    = time.Minute
+)
+
+func (c *Cache) AppendDomainEvents(ctx context.Context, events []*ports.DomainEvent) (err error) {
+	defer func() { err = utils.FuncPipe(cacheCaller+".AppendDomainEvents", err) }()
+	pipe := c.client.Pipeline()
+	for _, event := range events {
+		data, err := sonic.Marshal(event)
+		if err != nil {
+			return err
+		}
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: domainEventsStream,
+			MaxLen: domainEventsStreamMaxLen,
+			Approx: true,
+			Values: map[string]any{"type": string(event.Type), "event": data},
+		})
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (c *Cache) ConsumeDomainEvents(ctx context.Context, group, consumer string, fn func(event *ports.DomainEvent) error) (err error) {
+	defer func() { err = utils.FuncPipe(cacheCaller+".ConsumeDomainEvents", err) }()
+	if err := c.client.XGroupCreateMkStream(ctx, domainEventsStream, group, "$").Err(); err != nil &&
+		!strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	handle := func(msgs []redis.XMessage) error {
+		for _, msg := range msgs {
+			event := &ports.DomainEvent{}
+			data, _ := msg.Values["event"].(string)
+			// An entry that does not decode can never be handled, so it is
+			// acked rather than read again forever.
+			if err := sonic.UnmarshalString(data, event); err == nil {
+				if err := fn(event); err != nil {
+					return err
+				}
+			}
+			if err := c.client.XAck(ctx, domainEventsStream, group, msg.ID).Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// Entries delivered to this consumer before a restart and never acked
+	// are read again first, starting from 0, before new ones are read with >.
+	// Consumers are named after their host, which changes when a container
+	// is recreated, so entries other consumers left pending are claimed
+	// every domainEventsClaimIdle as well.
+	start := "0"
+	var claimedAt time.Time
+	for ctx.Err() == nil {
+		if start == ">" && time.Since(claimedAt) >= domainEventsClaimIdle {
+			if err := c.claimDomainEvents(ctx, group, consumer, handle); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+			claimedAt = time.Now()
+		}
+		streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: consumer,
+			Streams:  []string{domainEventsStream, start},
+			Count:    domainEventsReadCount,
+			Block:    domainEventsReadBlock,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if start != ">" && (len(streams) == 0 || len(streams[0].Messages) == 0) {
+			start = ">"
+			continue
+		}
+		for _, stream := range streams {
+			if err := handle(stream.Messages); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// claimDomainEvents takes over the entries of the group that have been
+// pending for at least domainEventsClaimIdle and hands them to handle.
+func (c *Cache) claimDomainEvents(ctx context.Context, group, consumer string, handle func(msgs []redis.XMessage) error) error {
+	start := "0-0"
+	for {
+		msgs, next, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   domainEventsStream,
+			Group:    group,
+			Consumer: consumer,
+			MinIdle:  domainEventsClaimIdle,
+			Start:    start,
+			Count:    domainEventsReadCount,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		if err := handle(msgs); err != nil {
+			return err
+		}
+		if next == "0-0" {
+			return nil
+		}
+		start = next
+	}
+}
+
+// jobLeaseKey holds the owner of the lease on a job. Only the owner renews
+// or releases it, so a replica whose lease expired mid-run cannot take over
+// the lease of the one that ran the job next.
+func jobLeaseKey(name ports.JobName) string {
+	return "jobs:" + string(name)
+}
+
+var (
+	renewJobLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	releaseJobLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+func (c *Cache) AcquireJobLease(ctx context.Context, name ports.JobName, owner string, ttl time.Duration) (acquired bool, err error) {
+	defer func() { err = utils.FuncPipe(cacheCaller+".AcquireJobLease", err) }()
+	return c.client.SetNX(ctx, jobLeaseKey(name), owner, ttl).Result()
+}
+
+func (c *Cache) RenewJobLease(ctx context.Context, name ports.JobName, owner string, ttl time.Duration) (renewed bool, err error) {
+	defer func() { err = utils.FuncPipe(cacheCaller+".RenewJobLease", err) }()
+	n, err := renewJobLeaseScript.Run(ctx, c.client, []string{jobLeaseKey(name)}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (c *Cache) ReleaseJobLease(ctx context.Context, name ports.JobName, owner string) (err error) {
+	defer func() { err = utils.FuncPipe(cacheCaller+".ReleaseJobLease", err) }()
+	return releaseJobLeaseScript.Run(ctx, c.client, []string{jobLeaseKey(name)}, owner).Err()
+}
+
 func (c *Cache) Close() error {
 	return c.client.Close()
 }
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS client_user_models;
+DROP TABLE IF EXISTS admin_user_models;
@@ -0,0 +1,33 @@
+-- The schema as AutoMigrate created it, so databases created before
+-- migrations existed adopt this one without changes. Everything added since
+-- goes in later migrations.
+
+CREATE TABLE IF NOT EXISTS admin_user_models (
+    id uuid NOT NULL,
+    username text,
+    name text NOT NULL,
+    has_avatar boolean NOT NULL,
+    phone_number text,
+    email text,
+    password text,
+    updated_at timestamptz NOT NULL,
+    created_at timestamptz NOT NULL,
+    is_deleted boolean NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT uni_admin_user_models_username UNIQUE (username)
+);
+
+CREATE TABLE IF NOT EXISTS client_user_models (
+    id uuid NOT NULL,
+    username text,
+    name text NOT NULL,
+    has_avatar boolean NOT NULL,
+    phone_number text,
+    email text,
+    password text,
+    updated_at timestamptz NOT NULL,
+    created_at timestamptz NOT NULL,
+    is_deleted boolean NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT uni_client_user_models_username UNIQUE (username)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS username_denylist_models;
+DROP TABLE IF EXISTS username_history_models;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS username_history_models (
+    id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    user_type text NOT NULL,
+    old_username text NOT NULL,
+    new_username text NOT NULL,
+    reserved_until timestamptz NOT NULL,
+    created_at timestamptz NOT NULL,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_username_history_models_user_id ON username_history_models (user_id);
+CREATE INDEX IF NOT EXISTS idx_username_history_models_user_type ON username_history_models (user_type);
+CREATE INDEX IF NOT EXISTS idx_username_history_models_old_username ON username_history_models (old_username);
+
+CREATE TABLE IF NOT EXISTS username_denylist_models (
+    username text NOT NULL,
+    reason text,
+    created_by uuid,
+    created_at timestamptz NOT NULL,
+    PRIMARY KEY (username)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE admin_user_models ADD COLUMN IF NOT EXISTS avatar_hash text NOT NULL DEFAULT '';
+ALTER TABLE client_user_models ADD COLUMN IF NOT EXISTS avatar_hash text NOT NULL DEFAULT '';
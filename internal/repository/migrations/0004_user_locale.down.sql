@@ -0,0 +1,2 @@
+ALTER TABLE client_user_models DROP COLUMN IF EXISTS locale;
+ALTER TABLE admin_user_models DROP COLUMN IF EXISTS locale;
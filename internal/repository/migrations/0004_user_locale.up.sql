@@ -0,0 +1,2 @@
+ALTER TABLE admin_user_models ADD COLUMN IF NOT EXISTS locale text NOT NULL DEFAULT '';
+ALTER TABLE client_user_models ADD COLUMN IF NOT EXISTS locale text NOT NULL DEFAULT '';
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS domain_event_models (
+    id uuid NOT NULL,
+    type text NOT NULL,
+    user_id uuid NOT NULL,
+    user_type text NOT NULL,
+    payload jsonb NOT NULL,
+    created_at timestamptz NOT NULL,
+    published_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_domain_event_models_created_at ON domain_event_models (created_at);
+CREATE INDEX IF NOT EXISTS idx_domain_event_models_published_at ON domain_event_models (published_at);
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const activityTtlIndexName = "created_at_ttl"
+
+var activityRetention time.Duration
+
+func init() {
+	var err error
+	activityRetention, err = utils.GetenvAsMinuteDuration("ACTIVITY_RETENTION", 180*24*time.Hour, false)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (r *Mongo) createActivityIndexes(ctx context.Context) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".createActivityIndexes", err) }()
+	_, err = r.activities.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "user_type", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+	ttl := int32(activityRetention / time.Second)
+	_, err = r.activities.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetName(activityTtlIndexName).SetExpireAfterSeconds(ttl),
+	})
+	var cErr mongo.CommandError
+	if errors.As(err, &cErr) && cErr.Name == "IndexOptionsConflict" {
+		// The retention was changed since the index was created.
+		return r.db.RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: r.activities.Name()},
+			{Key: "index", Value: bson.D{
+				{Key: "name", Value: activityTtlIndexName},
+				{Key: "expireAfterSeconds", Value: ttl},
+			}},
+		}).Err()
+	}
+	return err
+}
+
+func (r *Mongo) AddActivity(ctx context.Context, activity *ports.ActivityModel) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".AddActivity", err) }()
+	_, err = r.activities.InsertOne(ctx, activity)
+	return err
+}
+
+func (r *Mongo) GetActivities(ctx context.Context, userId uuid.UUID, userType ports.UserType, pagination *ports.Pagination) (activities []ports.ActivityModel, total int64, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetActivities", err) }()
+	filter := bson.D{{Key: "user_id", Value: userId.String()}, {Key: "user_type", Value: userType}}
+	total, err = r.activities.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := r.activities.Find(
+		ctx,
+		filter,
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}}).
+			SetSkip(pagination.Skip()).
+			SetLimit(pagination.Size),
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	activities = []ports.ActivityModel{}
+	if err := cursor.All(ctx, &activities); err != nil {
+		return nil, 0, err
+	}
+	return activities, total, nil
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const auditAppendAttempts = 10
+
+func (r *Mongo) createAuditIndexes(ctx context.Context) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".createAuditIndexes", err) }()
+	_, err = r.audits.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+	})
+	return err
+}
+
+// AppendAudit links the entry to the current head of the chain and inserts it.
+// The sequence number is the document id, so concurrent writers racing for the
+// same position fail with a duplicate key and retry on top of the new head.
+func (r *Mongo) AppendAudit(ctx context.Context, entry *ports.AuditModel) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".AppendAudit", err) }()
+	for range auditAppendAttempts {
+		head := &ports.AuditModel{}
+		err = r.audits.FindOne(ctx, bson.D{}, options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})).Decode(head)
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			entry.Sequence = 1
+			entry.PrevHash = ports.AuditGenesisHash
+		case err != nil:
+			return err
+		default:
+			entry.Sequence = head.Sequence + 1
+			entry.PrevHash = head.Hash
+		}
+		entry.Hash = entry.ComputeHash()
+		_, err = r.audits.InsertOne(ctx, entry)
+		if err == nil {
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func (r *Mongo) GetAudits(ctx context.Context, filter *ports.AuditFilter, pagination *ports.Pagination) (entries []ports.AuditModel, total int64, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetAudits", err) }()
+	query := auditQuery(filter)
+	total, err = r.audits.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := r.audits.Find(
+		ctx,
+		query,
+		options.Find().
+			SetSort(bson.D{{Key: "_id", Value: -1}}).
+			SetSkip(pagination.Skip()).
+			SetLimit(pagination.Size),
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	entries = []ports.AuditModel{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+func (r *Mongo) IterateAudits(ctx context.Context, filter *ports.AuditFilter, fn func(entry *ports.AuditModel) error) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".IterateAudits", err) }()
+	cursor, err := r.audits.Find(ctx, auditQuery(filter), options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+	for cursor.Next(ctx) {
+		entry := &ports.AuditModel{}
+		if err := cursor.Decode(entry); err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func auditQuery(filter *ports.AuditFilter) bson.D {
+	query := bson.D{}
+	if filter == nil {
+		return query
+	}
+	if filter.ActorId != "" {
+		query = append(query, bson.E{Key: "actor_id", Value: filter.ActorId})
+	}
+	if filter.Action != "" {
+		query = append(query, bson.E{Key: "action", Value: filter.Action})
+	}
+	createdAt := bson.D{}
+	if !filter.From.IsZero() {
+		createdAt = append(createdAt, bson.E{Key: "$gte", Value: filter.From})
+	}
+	if !filter.To.IsZero() {
+		createdAt = append(createdAt, bson.E{Key: "$lt", Value: filter.To})
+	}
+	if len(createdAt) > 0 {
+		query = append(query, bson.E{Key: "created_at", Value: createdAt})
+	}
+	return query
+}
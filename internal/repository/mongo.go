@@ -13,11 +13,23 @@ import (
 )
 
 const mongoCaller = packageCaller + ".Mongo"
-const _ = mongoCaller
 
 type Mongo struct {
-	logger *utils.Logger
-	client *mongo.Client
+	logger                  *utils.Logger
+	client                  *mongo.Client
+	db                      *mongo.Database
+	relations               *mongo.Collection
+	activities              *mongo.Collection
+	audits                  *mongo.Collection
+	media                   *mongo.Collection
+	messages                *mongo.Collection
+	suppressions            *mongo.Collection
+	notifications           *mongo.Collection
+	notificationPreferences *mongo.Collection
+	webhooks                *mongo.Collection
+	webhookDeliveries       *mongo.Collection
+	jobs                    *mongo.Collection
+	jobRuns                 *mongo.Collection
 }
 
 func NewMongoRepo(logger *utils.Logger) ports.MongoRepo {
@@ -29,6 +41,10 @@ func NewMongoRepo(logger *utils.Logger) ports.MongoRepo {
 	if port == "" {
 		logger.Fatal(context.Background(), "MONGO_PORT is not set")
 	}
+	database := os.Getenv("MONGO_DATABASE")
+	if database == "" {
+		logger.Fatal(context.Background(), "MONGO_DATABASE is not set")
+	}
 
 	client, err := mongo.Connect(
 		options.Client().ApplyURI("mongodb://" + host + ":" + port + "/?replicaSet=rs0"),
@@ -40,10 +56,60 @@ func NewMongoRepo(logger *utils.Logger) ports.MongoRepo {
 	if err != nil {
 		logger.Fatalf(context.Background(), "Failed to ping MongoDB: %v", err)
 	}
-	return &Mongo{
-		logger: logger,
-		client: client,
+	db := client.Database(database)
+	r := &Mongo{
+		logger:                  logger,
+		client:                  client,
+		db:                      db,
+		relations:               db.Collection("relations"),
+		activities:              db.Collection("activities"),
+		audits:                  db.Collection("audits"),
+		media:                   db.Collection("media"),
+		messages:                db.Collection("messages"),
+		suppressions:            db.Collection("suppressions"),
+		notifications:           db.Collection("notifications"),
+		notificationPreferences: db.Collection("notification_preferences"),
+		webhooks:                db.Collection("webhooks"),
+		webhookDeliveries:       db.Collection("webhook_deliveries"),
+		jobs:                    db.Collection("jobs"),
+		jobRuns:                 db.Collection("job_runs"),
+	}
+	if err := r.createIndexes(context.Background()); err != nil {
+		logger.Fatalf(context.Background(), "Failed to create MongoDB indexes: %v", err)
+	}
+	return r
+}
+
+func (r *Mongo) createIndexes(ctx context.Context) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".createIndexes", err) }()
+	if err = r.createRelationIndexes(ctx); err != nil {
+		return err
+	}
+	if err = r.createActivityIndexes(ctx); err != nil {
+		return err
+	}
+	if err = r.createAuditIndexes(ctx); err != nil {
+		return err
+	}
+	if err = r.createMediaIndexes(ctx); err != nil {
+		return err
 	}
+	if err = r.createMessageIndexes(ctx); err != nil {
+		return err
+	}
+	if err = r.createSuppressionIndexes(ctx); err != nil {
+		return err
+	}
+	if err = r.createNotificationIndexes(ctx); err != nil {
+		return err
+	}
+	if err = r.createWebhookIndexes(ctx); err != nil {
+		return err
+	}
+	if err = r.createJobIndexes(ctx); err != nil {
+		return err
+	}
+	return nil
 }
 
 func (r *Mongo) Close() error {
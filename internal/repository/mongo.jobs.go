@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+// jobRunRetention is how long the history of job runs is kept.
+const jobRunRetention = 30 * 24 * time.Hour
+
+func (r *Mongo) createJobIndexes(ctx context.Context) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".createJobIndexes", err) }()
+	_, err = r.jobRuns.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "name", Value: 1}, {Key: "started_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "name", Value: 1}, {Key: "status", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "started_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(jobRunRetention / time.Second)),
+		},
+	})
+	return err
+}
+
+func (r *Mongo) InitJobState(ctx context.Context, name ports.JobName, nextRunAt time.Time) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".InitJobState", err) }()
+	_, err = r.jobs.UpdateOne(
+		ctx,
+		bson.D{{Key: "_id", Value: name}},
+		bson.D{{Key: "$setOnInsert", Value: bson.D{
+			{Key: "paused", Value: false},
+			{Key: "next_run_at", Value: nextRunAt},
+			{Key: "updated_at", Value: time.Now().UTC()},
+		}}},
+		options.UpdateOne().SetUpsert(true),
+	)
+	return err
+}
+
+func (r *Mongo) GetJobState(ctx context.Context, name ports.JobName) (state *ports.JobStateModel, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetJobState", err) }()
+	state = &ports.JobStateModel{}
+	if err = r.jobs.FindOne(ctx, bson.D{{Key: "_id", Value: name}}).Decode(state); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return state, nil
+}
+
+func (r *Mongo) GetJobStates(ctx context.Context) (states []ports.JobStateModel, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetJobStates", err) }()
+	cursor, err := r.jobs.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	states = []ports.JobStateModel{}
+	if err := cursor.All(ctx, &states); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+func (r *Mongo) SetJobPaused(ctx context.Context, name ports.JobName, paused bool) (found bool, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".SetJobPaused", err) }()
+	result, err := r.jobs.UpdateOne(
+		ctx,
+		bson.D{{Key: "_id", Value: name}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "paused", Value: paused},
+			{Key: "updated_at", Value: time.Now().UTC()},
+		}}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (r *Mongo) TriggerJob(ctx context.Context, name ports.JobName) (found bool, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".TriggerJob", err) }()
+	now := time.Now().UTC()
+	result, err := r.jobs.UpdateOne(
+		ctx,
+		bson.D{{Key: "_id", Value: name}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "triggered_at", Value: now},
+			{Key: "updated_at", Value: now},
+		}}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (r *Mongo) StartJobRun(ctx context.Context, state *ports.JobStateModel, run *ports.JobRunModel, nextRunAt time.Time) (started bool, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".StartJobRun", err) }()
+	// The state must still be the one the run was decided on; a replica that
+	// held the lease just before may have run the job in between.
+	filter := bson.D{
+		{Key: "_id", Value: state.Name},
+		{Key: "next_run_at", Value: state.NextRunAt},
+	}
+	if state.TriggeredAt.IsZero() {
+		filter = append(filter, bson.E{Key: "triggered_at", Value: bson.D{{Key: "$exists", Value: false}}})
+	} else {
+		filter = append(filter, bson.E{Key: "triggered_at", Value: state.TriggeredAt})
+	}
+	result, err := r.jobs.UpdateOne(
+		ctx,
+		filter,
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "next_run_at", Value: nextRunAt},
+				{Key: "last_run_id", Value: run.Id},
+				{Key: "last_status", Value: run.Status},
+				{Key: "last_run_at", Value: run.StartedAt},
+				{Key: "updated_at", Value: run.StartedAt},
+			}},
+			{Key: "$unset", Value: bson.D{{Key: "triggered_at", Value: ""}}},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount == 0 {
+		return false, nil
+	}
+	// Only the lease holder starts runs, so a run still marked running is
+	// one whose replica died before finishing it.
+	if _, err = r.jobRuns.UpdateMany(
+		ctx,
+		bson.D{
+			{Key: "name", Value: run.Name},
+			{Key: "status", Value: ports.RunningJobRunStatus},
+		},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: ports.AbandonedJobRunStatus},
+			{Key: "finished_at", Value: run.StartedAt},
+		}}},
+	); err != nil {
+		return true, err
+	}
+	if _, err = r.jobRuns.InsertOne(ctx, run); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+func (r *Mongo) FinishJobRun(ctx context.Context, run *ports.JobRunModel) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".FinishJobRun", err) }()
+	if _, err = r.jobRuns.UpdateOne(
+		ctx,
+		bson.D{{Key: "_id", Value: run.Id}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: run.Status},
+			{Key: "summary", Value: run.Summary},
+			{Key: "error", Value: run.Error},
+			{Key: "finished_at", Value: run.FinishedAt},
+		}}},
+	); err != nil {
+		return err
+	}
+	set := bson.D{
+		{Key: "last_status", Value: run.Status},
+		{Key: "updated_at", Value: run.FinishedAt},
+	}
+	if run.Status == ports.SucceededJobRunStatus {
+		set = append(set, bson.E{Key: "last_succeeded_at", Value: run.FinishedAt})
+	}
+	_, err = r.jobs.UpdateOne(
+		ctx,
+		bson.D{{Key: "_id", Value: run.Name}, {Key: "last_run_id", Value: run.Id}},
+		bson.D{{Key: "$set", Value: set}},
+	)
+	return err
+}
+
+func (r *Mongo) GetJobRuns(ctx context.Context, name ports.JobName, status ports.JobRunStatus, pagination *ports.Pagination) (runs []ports.JobRunModel, total int64, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetJobRuns", err) }()
+	query := bson.D{{Key: "name", Value: name}}
+	if status != "" {
+		query = append(query, bson.E{Key: "status", Value: status})
+	}
+	total, err = r.jobRuns.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := r.jobRuns.Find(
+		ctx,
+		query,
+		options.Find().
+			SetSort(bson.D{{Key: "started_at", Value: -1}}).
+			SetSkip(pagination.Skip()).
+			SetLimit(pagination.Size),
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	runs = []ports.JobRunModel{}
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+func (r *Mongo) createMediaIndexes(ctx context.Context) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".createMediaIndexes", err) }()
+	_, err = r.media.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "owner_type", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	return err
+}
+
+func (r *Mongo) AddMedia(ctx context.Context, media *ports.MediaModel) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".AddMedia", err) }()
+	_, err = r.media.InsertOne(ctx, media)
+	return err
+}
+
+func (r *Mongo) GetMedia(ctx context.Context, id uuid.UUID) (media *ports.MediaModel, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetMedia", err) }()
+	media = &ports.MediaModel{}
+	if err = r.media.FindOne(ctx, bson.D{{Key: "_id", Value: id.String()}}).Decode(media); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return media, nil
+}
+
+func (r *Mongo) GetMediaByOwner(ctx context.Context, ownerId uuid.UUID, ownerType ports.UserType, pagination *ports.Pagination) (media []ports.MediaModel, total int64, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetMediaByOwner", err) }()
+	filter := bson.D{{Key: "owner_id", Value: ownerId.String()}, {Key: "owner_type", Value: ownerType}}
+	total, err = r.media.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := r.media.Find(
+		ctx,
+		filter,
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}}).
+			SetSkip(pagination.Skip()).
+			SetLimit(pagination.Size),
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	media = []ports.MediaModel{}
+	if err := cursor.All(ctx, &media); err != nil {
+		return nil, 0, err
+	}
+	return media, total, nil
+}
+
+func (r *Mongo) GetMediaUsage(ctx context.Context, ownerId uuid.UUID, ownerType ports.UserType) (usage int64, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetMediaUsage", err) }()
+	cursor, err := r.media.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "owner_id", Value: ownerId.String()}, {Key: "owner_type", Value: ownerType}}}},
+		{{Key: "$group", Value: bson.D{{Key: "_id", Value: nil}, {Key: "usage", Value: bson.D{{Key: "$sum", Value: "$size"}}}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var result []struct {
+		Usage int64 `bson:"usage"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return 0, err
+	}
+	if len(result) == 0 {
+		return 0, nil
+	}
+	return result[0].Usage, nil
+}
+
+func (r *Mongo) UpdateMediaAcl(ctx context.Context, id uuid.UUID, acl ports.MediaAcl) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".UpdateMediaAcl", err) }()
+	result, err := r.media.UpdateOne(
+		ctx,
+		bson.D{{Key: "_id", Value: id.String()}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "acl", Value: acl}}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return utils.MediaNotFoundResponse.Clone().
+			WithReason("id", id.String())
+	}
+	return nil
+}
+
+func (r *Mongo) DeleteMedia(ctx context.Context, id uuid.UUID) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".DeleteMedia", err) }()
+	_, err = r.media.DeleteOne(ctx, bson.D{{Key: "_id", Value: id.String()}})
+	return err
+}
@@ -0,0 +1,297 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+// messageRetention is how long outbox messages are kept after creation,
+// whatever their state.
+const messageRetention = 30 * 24 * time.Hour
+
+func (r *Mongo) createMessageIndexes(ctx context.Context) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".createMessageIndexes", err) }()
+	_, err = r.messages.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "idempotency_key", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.D{{Key: "idempotency_key", Value: bson.D{{Key: "$type", Value: "string"}}}}),
+		},
+		{
+			Keys: bson.D{{Key: "provider", Value: 1}, {Key: "provider_message_id", Value: 1}},
+			Options: options.Index().
+				SetPartialFilterExpression(bson.D{{Key: "provider_message_id", Value: bson.D{{Key: "$type", Value: "string"}}}}),
+		},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(messageRetention / time.Second)),
+		},
+	})
+	return err
+}
+
+func (r *Mongo) EnqueueMessage(ctx context.Context, message *ports.MessageModel) (existing *ports.MessageModel, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".EnqueueMessage", err) }()
+	_, err = r.messages.InsertOne(ctx, message)
+	if err == nil {
+		return message, nil
+	}
+	if message.IdempotencyKey == "" || !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+	existing = &ports.MessageModel{}
+	err = r.messages.FindOne(ctx, bson.D{{Key: "idempotency_key", Value: message.IdempotencyKey}}).Decode(existing)
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func (r *Mongo) ClaimMessage(ctx context.Context, lease time.Duration) (message *ports.MessageModel, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".ClaimMessage", err) }()
+	now := time.Now().UTC()
+	message = &ports.MessageModel{}
+	err = r.messages.FindOneAndUpdate(
+		ctx,
+		bson.D{{Key: "$or", Value: bson.A{
+			bson.D{
+				{Key: "status", Value: ports.QueuedMessageStatus},
+				{Key: "next_attempt_at", Value: bson.D{{Key: "$lte", Value: now}}},
+			},
+			bson.D{
+				{Key: "status", Value: ports.SendingMessageStatus},
+				{Key: "locked_until", Value: bson.D{{Key: "$lte", Value: now}}},
+			},
+		}}},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "status", Value: ports.SendingMessageStatus},
+				{Key: "locked_until", Value: now.Add(lease)},
+				{Key: "updated_at", Value: now},
+			}},
+			{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+		},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(message)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return message, nil
+}
+
+func (r *Mongo) CompleteMessageAttempt(ctx context.Context, message *ports.MessageModel) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".CompleteMessageAttempt", err) }()
+	set := bson.D{
+		{Key: "status", Value: message.Status},
+		{Key: "provider", Value: message.Provider},
+		{Key: "provider_message_id", Value: message.ProviderMessageId},
+		{Key: "last_error", Value: message.LastError},
+		{Key: "next_attempt_at", Value: message.NextAttemptAt},
+		{Key: "locked_until", Value: time.Time{}},
+		{Key: "updated_at", Value: message.UpdatedAt},
+	}
+	if !message.SentAt.IsZero() {
+		set = append(set, bson.E{Key: "sent_at", Value: message.SentAt})
+	}
+	// Bodies carry OTPs, so they are dropped as soon as nobody can send them
+	// again. Dead messages keep theirs for a requeue.
+	if message.Status == ports.SentMessageStatus || message.Status == ports.ExpiredMessageStatus {
+		set = append(set, bson.E{Key: "body", Value: ""}, bson.E{Key: "html", Value: ""})
+	}
+	_, err = r.messages.UpdateOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: message.Id},
+			{Key: "status", Value: ports.SendingMessageStatus},
+			{Key: "attempts", Value: message.Attempts},
+		},
+		bson.D{{Key: "$set", Value: set}},
+	)
+	return err
+}
+
+func (r *Mongo) GetMessage(ctx context.Context, id string) (message *ports.MessageModel, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetMessage", err) }()
+	message = &ports.MessageModel{}
+	if err = r.messages.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(message); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return message, nil
+}
+
+func (r *Mongo) GetMessages(ctx context.Context, filter *ports.MessageFilter, pagination *ports.Pagination) (messages []ports.MessageModel, total int64, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetMessages", err) }()
+	query := bson.D{}
+	if filter.Channel != "" {
+		query = append(query, bson.E{Key: "channel", Value: filter.Channel})
+	}
+	if filter.Status != "" {
+		query = append(query, bson.E{Key: "status", Value: filter.Status})
+	}
+	total, err = r.messages.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := r.messages.Find(
+		ctx,
+		query,
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}}).
+			SetSkip(pagination.Skip()).
+			SetLimit(pagination.Size),
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	messages = []ports.MessageModel{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, 0, err
+	}
+	return messages, total, nil
+}
+
+func (r *Mongo) RequeueMessage(ctx context.Context, id string) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".RequeueMessage", err) }()
+	now := time.Now().UTC()
+	result, err := r.messages.UpdateOne(
+		ctx,
+		bson.D{{Key: "_id", Value: id}, {Key: "status", Value: ports.DeadMessageStatus}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: ports.QueuedMessageStatus},
+			{Key: "attempts", Value: 0},
+			{Key: "next_attempt_at", Value: now},
+			{Key: "updated_at", Value: now},
+		}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+	exists, err := r.messages.CountDocuments(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return utils.MessageNotFoundResponse.Clone().
+			WithReason("id", id)
+	}
+	return utils.MessageNotDeadResponse.Clone().
+		WithReason("id", id)
+}
+
+func (r *Mongo) RecordMessageReceipt(ctx context.Context, receipt *ports.DeliveryReceipt) (found bool, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".RecordMessageReceipt", err) }()
+	event := ports.NewMessageEventModel(receipt)
+	filter := bson.D{
+		{Key: "provider", Value: receipt.Provider},
+		{Key: "provider_message_id", Value: receipt.ProviderMessageId},
+	}
+	result, err := r.messages.UpdateOne(
+		ctx,
+		filter,
+		bson.D{
+			{Key: "$push", Value: bson.D{{Key: "events", Value: bson.D{
+				{Key: "$each", Value: bson.A{event}},
+				{Key: "$slice", Value: -ports.MessageEventsLimit},
+			}}}},
+			{Key: "$set", Value: bson.D{{Key: "updated_at", Value: event.ReceivedAt}}},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount == 0 {
+		return false, nil
+	}
+	if receipt.Status == "" {
+		return true, nil
+	}
+	// Receipts may arrive out of order, so only the first final one counts.
+	set := bson.D{{Key: "status", Value: receipt.Status}}
+	if receipt.Status == ports.DeliveredMessageStatus {
+		set = append(set, bson.E{Key: "delivered_at", Value: event.OccurredAt})
+	}
+	if receipt.ErrorCode != "" || receipt.ErrorMessage != "" {
+		set = append(set, bson.E{Key: "last_error", Value: strings.TrimSpace(receipt.ErrorCode + " " + receipt.ErrorMessage)})
+	}
+	_, err = r.messages.UpdateOne(
+		ctx,
+		append(filter, bson.E{Key: "status", Value: ports.SentMessageStatus}),
+		bson.D{{Key: "$set", Value: set}},
+	)
+	return true, err
+}
+
+func (r *Mongo) GetMessageStats(ctx context.Context, channel ports.MessageChannel, from, to time.Time) (buckets []ports.MessageStatsBucket, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetMessageStats", err) }()
+	match := bson.D{}
+	if channel != "" {
+		match = append(match, bson.E{Key: "channel", Value: channel})
+	}
+	createdAt := bson.D{}
+	if !from.IsZero() {
+		createdAt = append(createdAt, bson.E{Key: "$gte", Value: from})
+	}
+	if !to.IsZero() {
+		createdAt = append(createdAt, bson.E{Key: "$lt", Value: to})
+	}
+	if len(createdAt) > 0 {
+		match = append(match, bson.E{Key: "created_at", Value: createdAt})
+	}
+	cursor, err := r.messages.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "channel", Value: "$channel"},
+				{Key: "provider", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$provider", ""}}}},
+				{Key: "status", Value: "$status"},
+			}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "delivery_ms", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$eq", Value: bson.A{"$status", ports.DeliveredMessageStatus}}},
+				bson.D{{Key: "$max", Value: bson.A{0, bson.D{{Key: "$subtract", Value: bson.A{"$delivered_at", "$sent_at"}}}}}},
+				0,
+			}}}}}},
+		}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "channel", Value: "$_id.channel"},
+			{Key: "provider", Value: "$_id.provider"},
+			{Key: "status", Value: "$_id.status"},
+			{Key: "count", Value: 1},
+			{Key: "delivery_seconds", Value: bson.D{{Key: "$divide", Value: bson.A{"$delivery_ms", 1000}}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "channel", Value: 1}, {Key: "provider", Value: 1}, {Key: "status", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	buckets = []ports.MessageStatsBucket{}
+	if err := cursor.All(ctx, &buckets); err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+// notificationRetention is how long inbox entries are kept, read or not.
+const notificationRetention = 90 * 24 * time.Hour
+
+func (r *Mongo) createNotificationIndexes(ctx context.Context) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".createNotificationIndexes", err) }()
+	_, err = r.notifications.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "user_type", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(notificationRetention / time.Second)),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.notificationPreferences.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "user_type", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func notificationsFilter(userId uuid.UUID, userType ports.UserType, unreadOnly bool) bson.D {
+	filter := bson.D{{Key: "user_id", Value: userId.String()}, {Key: "user_type", Value: userType}}
+	if unreadOnly {
+		filter = append(filter, bson.E{Key: "read_at", Value: bson.D{{Key: "$exists", Value: false}}})
+	}
+	return filter
+}
+
+func (r *Mongo) AddNotification(ctx context.Context, notification *ports.NotificationModel) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".AddNotification", err) }()
+	_, err = r.notifications.InsertOne(ctx, notification)
+	return err
+}
+
+func (r *Mongo) GetNotifications(ctx context.Context, userId uuid.UUID, userType ports.UserType, unreadOnly bool, pagination *ports.Pagination) (notifications []ports.NotificationModel, total int64, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetNotifications", err) }()
+	filter := notificationsFilter(userId, userType, unreadOnly)
+	total, err = r.notifications.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := r.notifications.Find(
+		ctx,
+		filter,
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}}).
+			SetSkip(pagination.Skip()).
+			SetLimit(pagination.Size),
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	notifications = []ports.NotificationModel{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, 0, err
+	}
+	return notifications, total, nil
+}
+
+func (r *Mongo) CountUnreadNotifications(ctx context.Context, userId uuid.UUID, userType ports.UserType) (unread int64, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".CountUnreadNotifications", err) }()
+	return r.notifications.CountDocuments(ctx, notificationsFilter(userId, userType, true))
+}
+
+func (r *Mongo) MarkNotificationsRead(ctx context.Context, userId uuid.UUID, userType ports.UserType, ids []string) (updated int64, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".MarkNotificationsRead", err) }()
+	filter := notificationsFilter(userId, userType, true)
+	if len(ids) > 0 {
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}})
+	}
+	result, err := r.notifications.UpdateMany(ctx, filter, bson.D{
+		{Key: "$set", Value: bson.D{{Key: "read_at", Value: time.Now().UTC()}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (r *Mongo) GetNotificationPreferences(ctx context.Context, userId uuid.UUID, userType ports.UserType) (preferences *ports.NotificationPreferencesModel, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetNotificationPreferences", err) }()
+	preferences = &ports.NotificationPreferencesModel{}
+	err = r.notificationPreferences.FindOne(
+		ctx,
+		bson.D{{Key: "user_id", Value: userId.String()}, {Key: "user_type", Value: userType}},
+	).Decode(preferences)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return preferences, nil
+}
+
+func (r *Mongo) SetNotificationPreferences(ctx context.Context, userId uuid.UUID, userType ports.UserType, channels map[ports.NotificationType][]ports.NotificationChannel) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".SetNotificationPreferences", err) }()
+	// Only the listed types are set, so concurrent changes to other types
+	// are kept.
+	set := bson.D{{Key: "updated_at", Value: time.Now().UTC()}}
+	for t, list := range channels {
+		if list == nil {
+			list = []ports.NotificationChannel{}
+		}
+		set = append(set, bson.E{Key: "channels." + string(t), Value: list})
+	}
+	_, err = r.notificationPreferences.UpdateOne(
+		ctx,
+		bson.D{{Key: "user_id", Value: userId.String()}, {Key: "user_type", Value: userType}},
+		bson.D{{Key: "$set", Value: set}},
+		options.UpdateOne().SetUpsert(true),
+	)
+	return err
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+func (r *Mongo) createRelationIndexes(ctx context.Context) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".createRelationIndexes", err) }()
+	_, err = r.relations.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "from_id", Value: 1}, {Key: "to_id", Value: 1}, {Key: "type", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "from_id", Value: 1}, {Key: "type", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "to_id", Value: 1}, {Key: "type", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+	})
+	return err
+}
+
+func (r *Mongo) AddRelation(ctx context.Context, fromId, toId uuid.UUID, relationType ports.RelationType) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".AddRelation", err) }()
+	return r.addRelation(ctx, ports.NewRelationModel(fromId, toId, relationType))
+}
+
+func (r *Mongo) RemoveRelation(ctx context.Context, fromId, toId uuid.UUID, relationType ports.RelationType) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".RemoveRelation", err) }()
+	_, err = r.relations.DeleteOne(ctx, relationFilter(fromId, toId, relationType))
+	return err
+}
+
+func (r *Mongo) HasRelation(ctx context.Context, fromId, toId uuid.UUID, relationType ports.RelationType) (has bool, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".HasRelation", err) }()
+	count, err := r.relations.CountDocuments(ctx, relationFilter(fromId, toId, relationType), options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *Mongo) GetRelationTargets(ctx context.Context, fromId uuid.UUID, relationType ports.RelationType, pagination *ports.Pagination) (ids []uuid.UUID, total int64, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetRelationTargets", err) }()
+	return r.getRelationIds(ctx, bson.D{{Key: "from_id", Value: fromId.String()}, {Key: "type", Value: relationType}}, "to_id", pagination)
+}
+
+func (r *Mongo) GetRelationSources(ctx context.Context, toId uuid.UUID, relationType ports.RelationType, pagination *ports.Pagination) (ids []uuid.UUID, total int64, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetRelationSources", err) }()
+	return r.getRelationIds(ctx, bson.D{{Key: "to_id", Value: toId.String()}, {Key: "type", Value: relationType}}, "from_id", pagination)
+}
+
+func (r *Mongo) CountRelations(ctx context.Context, id uuid.UUID, relationType ports.RelationType) (targets int64, sources int64, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".CountRelations", err) }()
+	targets, err = r.relations.CountDocuments(ctx, bson.D{{Key: "from_id", Value: id.String()}, {Key: "type", Value: relationType}})
+	if err != nil {
+		return 0, 0, err
+	}
+	sources, err = r.relations.CountDocuments(ctx, bson.D{{Key: "to_id", Value: id.String()}, {Key: "type", Value: relationType}})
+	if err != nil {
+		return 0, 0, err
+	}
+	return targets, sources, nil
+}
+
+// BlockUser stores the block and drops the follow relations in both
+// directions within a single transaction, so a block never leaves a
+// dangling follow behind.
+func (r *Mongo) BlockUser(ctx context.Context, fromId, toId uuid.UUID) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".BlockUser", err) }()
+	session, err := r.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		if _, err := r.relations.DeleteOne(ctx, relationFilter(fromId, toId, ports.FollowRelationType)); err != nil {
+			return nil, err
+		}
+		if _, err := r.relations.DeleteOne(ctx, relationFilter(toId, fromId, ports.FollowRelationType)); err != nil {
+			return nil, err
+		}
+		return nil, r.addRelation(ctx, ports.NewRelationModel(fromId, toId, ports.BlockRelationType))
+	})
+	return err
+}
+
+func (r *Mongo) DeleteRelationsOf(ctx context.Context, id uuid.UUID) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".DeleteRelationsOf", err) }()
+	_, err = r.relations.DeleteMany(ctx, bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "from_id", Value: id.String()}},
+		bson.D{{Key: "to_id", Value: id.String()}},
+	}}})
+	return err
+}
+
+func (r *Mongo) addRelation(ctx context.Context, relation *ports.RelationModel) (err error) {
+	_, err = r.relations.UpdateOne(
+		ctx,
+		bson.D{{Key: "from_id", Value: relation.FromId}, {Key: "to_id", Value: relation.ToId}, {Key: "type", Value: relation.Type}},
+		bson.D{{Key: "$setOnInsert", Value: relation}},
+		options.UpdateOne().SetUpsert(true),
+	)
+	return err
+}
+
+func (r *Mongo) getRelationIds(ctx context.Context, filter bson.D, field string, pagination *ports.Pagination) (ids []uuid.UUID, total int64, err error) {
+	total, err = r.relations.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := r.relations.Find(
+		ctx,
+		filter,
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}}).
+			SetSkip(pagination.Skip()).
+			SetLimit(pagination.Size),
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	var relations []ports.RelationModel
+	if err := cursor.All(ctx, &relations); err != nil {
+		return nil, 0, err
+	}
+	ids = make([]uuid.UUID, 0, len(relations))
+	for _, relation := range relations {
+		id := relation.ToId
+		if field == "from_id" {
+			id = relation.FromId
+		}
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			return nil, 0, err
+		}
+		ids = append(ids, parsed)
+	}
+	return ids, total, nil
+}
+
+func relationFilter(fromId, toId uuid.UUID, relationType ports.RelationType) bson.D {
+	return bson.D{
+		{Key: "from_id", Value: fromId.String()},
+		{Key: "to_id", Value: toId.String()},
+		{Key: "type", Value: relationType},
+	}
+}
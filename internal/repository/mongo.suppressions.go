@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+func (r *Mongo) createSuppressionIndexes(ctx context.Context) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".createSuppressionIndexes", err) }()
+	_, err = r.suppressions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "reason", Value: 1}, {Key: "updated_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "updated_at", Value: -1}},
+		},
+	})
+	return err
+}
+
+func (r *Mongo) AddSuppression(ctx context.Context, bounce *ports.EmailBounce) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".AddSuppression", err) }()
+	now := time.Now().UTC()
+	// The latest report describes the address; earlier ones only count.
+	_, err = r.suppressions.UpdateOne(
+		ctx,
+		bson.D{{Key: "_id", Value: ports.NormalizeSuppressedEmail(bounce.Email)}},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "reason", Value: bounce.Type},
+				{Key: "source", Value: bounce.Source},
+				{Key: "status", Value: bounce.Status},
+				{Key: "diagnostic", Value: bounce.Diagnostic},
+				{Key: "provider", Value: bounce.Provider},
+				{Key: "provider_message_id", Value: bounce.ProviderMessageId},
+				{Key: "updated_at", Value: now},
+			}},
+			{Key: "$setOnInsert", Value: bson.D{{Key: "created_at", Value: now}}},
+			{Key: "$inc", Value: bson.D{{Key: "count", Value: 1}}},
+		},
+		options.UpdateOne().SetUpsert(true),
+	)
+	return err
+}
+
+func (r *Mongo) GetSuppression(ctx context.Context, email string) (suppression *ports.SuppressionModel, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetSuppression", err) }()
+	suppression = &ports.SuppressionModel{}
+	err = r.suppressions.FindOne(ctx, bson.D{{Key: "_id", Value: ports.NormalizeSuppressedEmail(email)}}).Decode(suppression)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return suppression, nil
+}
+
+func (r *Mongo) GetSuppressions(ctx context.Context, filter *ports.SuppressionFilter, pagination *ports.Pagination) (suppressions []ports.SuppressionModel, total int64, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetSuppressions", err) }()
+	query := bson.D{}
+	if filter.Reason != "" {
+		query = append(query, bson.E{Key: "reason", Value: filter.Reason})
+	}
+	if filter.Email != "" {
+		query = append(query, bson.E{Key: "_id", Value: bson.D{
+			{Key: "$regex", Value: regexp.QuoteMeta(ports.NormalizeSuppressedEmail(filter.Email))},
+		}})
+	}
+	total, err = r.suppressions.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := r.suppressions.Find(
+		ctx,
+		query,
+		options.Find().
+			SetSort(bson.D{{Key: "updated_at", Value: -1}}).
+			SetSkip(pagination.Skip()).
+			SetLimit(pagination.Size),
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	suppressions = []ports.SuppressionModel{}
+	if err := cursor.All(ctx, &suppressions); err != nil {
+		return nil, 0, err
+	}
+	return suppressions, total, nil
+}
+
+func (r *Mongo) DeleteSuppression(ctx context.Context, email string) (deleted bool, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".DeleteSuppression", err) }()
+	result, err := r.suppressions.DeleteOne(ctx, bson.D{{Key: "_id", Value: ports.NormalizeSuppressedEmail(email)}})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
@@ -0,0 +1,300 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+// webhookDeliveryRetention is how long deliveries are kept after creation,
+// whatever their state.
+const webhookDeliveryRetention = 30 * 24 * time.Hour
+
+func (r *Mongo) createWebhookIndexes(ctx context.Context) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".createWebhookIndexes", err) }()
+	_, err = r.webhooks.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "events", Value: 1}, {Key: "active", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "created_at", Value: -1}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.webhookDeliveries.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+		},
+		{
+			// An event read twice from the stream is only delivered once.
+			Keys:    bson.D{{Key: "webhook_id", Value: 1}, {Key: "event_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(webhookDeliveryRetention / time.Second)),
+		},
+	})
+	return err
+}
+
+func (r *Mongo) AddWebhook(ctx context.Context, webhook *ports.WebhookModel) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".AddWebhook", err) }()
+	_, err = r.webhooks.InsertOne(ctx, webhook)
+	return err
+}
+
+func (r *Mongo) GetWebhook(ctx context.Context, id string) (webhook *ports.WebhookModel, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetWebhook", err) }()
+	webhook = &ports.WebhookModel{}
+	if err = r.webhooks.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(webhook); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (r *Mongo) GetWebhooks(ctx context.Context, pagination *ports.Pagination) (webhooks []ports.WebhookModel, total int64, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetWebhooks", err) }()
+	total, err = r.webhooks.CountDocuments(ctx, bson.D{})
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := r.webhooks.Find(
+		ctx,
+		bson.D{},
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}}).
+			SetSkip(pagination.Skip()).
+			SetLimit(pagination.Size),
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	webhooks = []ports.WebhookModel{}
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, 0, err
+	}
+	return webhooks, total, nil
+}
+
+func (r *Mongo) GetWebhooksForEvent(ctx context.Context, eventType ports.DomainEventType) (webhooks []ports.WebhookModel, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetWebhooksForEvent", err) }()
+	cursor, err := r.webhooks.Find(ctx, bson.D{
+		{Key: "events", Value: eventType},
+		{Key: "active", Value: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	webhooks = []ports.WebhookModel{}
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (r *Mongo) UpdateWebhook(ctx context.Context, webhook *ports.WebhookModel) (found bool, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".UpdateWebhook", err) }()
+	result, err := r.webhooks.UpdateOne(
+		ctx,
+		bson.D{{Key: "_id", Value: webhook.Id}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "url", Value: webhook.Url},
+			{Key: "events", Value: webhook.Events},
+			{Key: "secret", Value: webhook.Secret},
+			{Key: "description", Value: webhook.Description},
+			{Key: "active", Value: webhook.Active},
+			{Key: "updated_at", Value: webhook.UpdatedAt},
+		}}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// DeleteWebhook deletes the webhook along with its delivery log.
+func (r *Mongo) DeleteWebhook(ctx context.Context, id string) (deleted bool, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".DeleteWebhook", err) }()
+	result, err := r.webhooks.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return false, err
+	}
+	if result.DeletedCount == 0 {
+		return false, nil
+	}
+	if _, err = r.webhookDeliveries.DeleteMany(ctx, bson.D{{Key: "webhook_id", Value: id}}); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+func (r *Mongo) AddWebhookDelivery(ctx context.Context, delivery *ports.WebhookDeliveryModel) (added bool, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".AddWebhookDelivery", err) }()
+	if _, err = r.webhookDeliveries.InsertOne(ctx, delivery); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *Mongo) ClaimWebhookDelivery(ctx context.Context, lease time.Duration) (delivery *ports.WebhookDeliveryModel, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".ClaimWebhookDelivery", err) }()
+	now := time.Now().UTC()
+	delivery = &ports.WebhookDeliveryModel{}
+	err = r.webhookDeliveries.FindOneAndUpdate(
+		ctx,
+		bson.D{{Key: "$or", Value: bson.A{
+			bson.D{
+				{Key: "status", Value: ports.QueuedWebhookDeliveryStatus},
+				{Key: "next_attempt_at", Value: bson.D{{Key: "$lte", Value: now}}},
+			},
+			bson.D{
+				{Key: "status", Value: ports.SendingWebhookDeliveryStatus},
+				{Key: "locked_until", Value: bson.D{{Key: "$lte", Value: now}}},
+			},
+		}}},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "status", Value: ports.SendingWebhookDeliveryStatus},
+				{Key: "locked_until", Value: now.Add(lease)},
+				{Key: "updated_at", Value: now},
+			}},
+			{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+		},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(delivery)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return delivery, nil
+}
+
+func (r *Mongo) CompleteWebhookDeliveryAttempt(ctx context.Context, delivery *ports.WebhookDeliveryModel, attempt *ports.WebhookAttemptModel) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".CompleteWebhookDeliveryAttempt", err) }()
+	set := bson.D{
+		{Key: "status", Value: delivery.Status},
+		{Key: "last_error", Value: delivery.LastError},
+		{Key: "next_attempt_at", Value: delivery.NextAttemptAt},
+		{Key: "locked_until", Value: time.Time{}},
+		{Key: "updated_at", Value: delivery.UpdatedAt},
+	}
+	if !delivery.SucceededAt.IsZero() {
+		set = append(set, bson.E{Key: "succeeded_at", Value: delivery.SucceededAt})
+	}
+	_, err = r.webhookDeliveries.UpdateOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: delivery.Id},
+			{Key: "status", Value: ports.SendingWebhookDeliveryStatus},
+			{Key: "attempts", Value: delivery.Attempts},
+		},
+		bson.D{
+			{Key: "$set", Value: set},
+			{Key: "$push", Value: bson.D{{Key: "log", Value: bson.D{
+				{Key: "$each", Value: bson.A{attempt}},
+				{Key: "$slice", Value: -ports.WebhookAttemptsLimit},
+			}}}},
+		},
+	)
+	return err
+}
+
+func (r *Mongo) GetWebhookDelivery(ctx context.Context, webhookId, id string) (delivery *ports.WebhookDeliveryModel, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetWebhookDelivery", err) }()
+	delivery = &ports.WebhookDeliveryModel{}
+	if err = r.webhookDeliveries.FindOne(ctx, bson.D{
+		{Key: "_id", Value: id},
+		{Key: "webhook_id", Value: webhookId},
+	}).Decode(delivery); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return delivery, nil
+}
+
+func (r *Mongo) GetWebhookDeliveries(ctx context.Context, webhookId string, status ports.WebhookDeliveryStatus, pagination *ports.Pagination) (deliveries []ports.WebhookDeliveryModel, total int64, err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".GetWebhookDeliveries", err) }()
+	query := bson.D{{Key: "webhook_id", Value: webhookId}}
+	if status != "" {
+		query = append(query, bson.E{Key: "status", Value: status})
+	}
+	total, err = r.webhookDeliveries.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := r.webhookDeliveries.Find(
+		ctx,
+		query,
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}}).
+			SetSkip(pagination.Skip()).
+			SetLimit(pagination.Size),
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	deliveries = []ports.WebhookDeliveryModel{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, 0, err
+	}
+	return deliveries, total, nil
+}
+
+func (r *Mongo) ReplayWebhookDelivery(ctx context.Context, webhookId, id string) (err error) {
+	defer func() { err = utils.FuncPipe(mongoCaller+".ReplayWebhookDelivery", err) }()
+	now := time.Now().UTC()
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "webhook_id", Value: webhookId}}
+	result, err := r.webhookDeliveries.UpdateOne(
+		ctx,
+		append(filter, bson.E{Key: "status", Value: bson.D{{Key: "$in", Value: bson.A{
+			ports.SucceededWebhookDeliveryStatus, ports.DeadWebhookDeliveryStatus,
+		}}}}),
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: ports.QueuedWebhookDeliveryStatus},
+			{Key: "attempts", Value: 0},
+			{Key: "next_attempt_at", Value: now},
+			{Key: "updated_at", Value: now},
+		}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+	exists, err := r.webhookDeliveries.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return utils.WebhookDeliveryNotFoundResponse.Clone().
+			WithReason("id", id)
+	}
+	return utils.WebhookDeliveryPendingResponse.Clone().
+		WithReason("id", id)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"os"
@@ -16,6 +18,7 @@ import (
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	gLogger "gorm.io/gorm/logger"
 )
 
@@ -23,6 +26,11 @@ const relationalCaller = packageCaller + ".Relational"
 
 var user_back_maximum_reference int64
 
+var (
+	usernameReservationPeriod time.Duration
+	usernameChangeCooldown    time.Duration
+)
+
 func init() {
 	user_back_maximum_reference_ := os.Getenv("USER_BACK_MAXIMUM_REFERENCE")
 	if user_back_maximum_reference_ == "" {
@@ -34,11 +42,26 @@ func init() {
 			panic(fmt.Sprintf("failed to parse USER_BACK_MAXIMUM_REFERENCE: %s", err))
 		}
 	}
+	var err error
+	usernameReservationPeriod, err = utils.GetenvAsMinuteDuration("USERNAME_RESERVATION_PERIOD", 90*24*time.Hour, false)
+	if err != nil {
+		panic(err)
+	}
+	usernameChangeCooldown, err = utils.GetenvAsMinuteDuration("USERNAME_CHANGE_COOLDOWN", 30*24*time.Hour, false)
+	if err != nil {
+		panic(err)
+	}
 }
 
 type Relational struct {
 	logger *utils.Logger
 	client *gorm.DB
+	// replicas serve the reads that may lag behind the primary by up to
+	// replicaMaxLag.
+	replicas      []*relationalReplica
+	replicaMaxLag time.Duration
+	nextReplica   atomic.Uint64
+	closed        chan struct{}
 }
 
 func NewRelationalRepo(logger *utils.Logger) ports.RelationalRepo {
@@ -75,58 +98,38 @@ func NewRelationalRepo(logger *utils.Logger) ports.RelationalRepo {
 	if err := instance.Ping(); err != nil {
 		logger.Fatalf(context.Background(), "Failed to ping database: %v", err)
 	}
-	return &Relational{
-		logger: logger,
-		client: db,
+	s := &Relational{
+		logger:        logger,
+		client:        db,
+		replicas:      openReplicas(logger, port, username, password, database),
+		replicaMaxLag: getenvAsReplicaDuration(logger, "POSTGRES_DB_REPLICA_MAX_LAG", 5*time.Second),
+		closed:        make(chan struct{}),
 	}
-}
-
-func (s *Relational) DropTables() error {
-	return s.client.Migrator().DropTable(
-		&ports.AdminUserModel{},
-		&ports.ClientUserModel{},
-	)
-}
-
-func (s *Relational) AddFirstUsers() error {
-	_, err := s.CreateUser(
-		context.Background(),
-		&ports.AuthSignupPostRequest{
-			Name:        "Amir Hossein Pakdaman",
-			PhoneNumber: "+989202400120",
-			UserType:    ports.AdminUserType,
-			Password:    "P@ssw0rdUnhackable",
-		}, uuid.MustParse("89950e97-6b0f-4ef4-977a-8378b14bc4a7"),
-	)
-	if err != nil {
-		return err
+	if len(s.replicas) > 0 {
+		interval := getenvAsReplicaDuration(logger, "POSTGRES_DB_REPLICA_CHECK_INTERVAL", 5*time.Second)
+		s.checkReplicasOnce(interval)
+		go s.checkReplicas(interval)
 	}
-	_, err = s.CreateUser(
-		context.Background(),
-		&ports.AuthSignupPostRequest{
-			Name:        "Amir Hossein Pakdaman",
-			PhoneNumber: "+989202400120",
-			UserType:    ports.ClientUserType,
-			Password:    "P@ssw0rdUnhackable",
-		}, uuid.MustParse("779033a2-4eaa-4817-aa81-24e24bd419f5"),
-	)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func (s *Relational) AutoMigrate() error {
-	return s.client.AutoMigrate(
-		&ports.AdminUserModel{},
-		&ports.ClientUserModel{},
-	)
+	return s
 }
 
 func (s *Relational) UserExists(ctx context.Context, req *ports.AuthCheckPostRequest) (resp *ports.AuthCheckPostResponse, isDeleted bool, err error) {
 	defer func() { err = utils.FuncPipe(relationalCaller+".UserExists", err) }()
 	user := ports.UserModelFromUserType(req.UserType)
-	if err := s.client.WithContext(ctx).Where("username = ?", req.Username).First(user).Error; err == nil {
+	var exists, reserved bool
+	if err := s.read(ctx, func(db *gorm.DB) (err error) {
+		if err = db.Where("username = ?", req.Username).First(user).Error; err == nil {
+			exists = true
+			return nil
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		reserved, err = s.isUsernameReserved(ctx, db, req.Username, req.UserType, uuid.Nil)
+		return err
+	}); err != nil {
+		return nil, false, err
+	}
+	if exists {
 		if user.GetIsDeleted() {
 			return &ports.AuthCheckPostResponse{
 				Exists:         true,
@@ -143,11 +146,10 @@ func (s *Relational) UserExists(ctx context.Context, req *ports.AuthCheckPostReq
 			HasPhoneNumber: user.GetPhoneNumber() != "",
 			HasPassword:    user.GetPassword() != "",
 		}, false, nil
-	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, false, err
 	}
 	return &ports.AuthCheckPostResponse{
 		Exists:         false,
+		Reserved:       reserved,
 		Deleted:        false,
 		HasEmail:       false,
 		HasPhoneNumber: false,
@@ -158,7 +160,9 @@ func (s *Relational) UserExists(ctx context.Context, req *ports.AuthCheckPostReq
 func (s *Relational) UserExistsById(ctx context.Context, id uuid.UUID, userType ports.UserType) (exists bool, isDeleted bool, err error) {
 	defer func() { err = utils.FuncPipe(relationalCaller+".UserExistsById", err) }()
 	user := ports.UserModelFromUserType(userType)
-	if err := s.client.WithContext(ctx).Where("id = ?", id).First(user).Error; err != nil {
+	if err := s.read(ctx, func(db *gorm.DB) error {
+		return db.Where("id = ?", id).First(user).Error
+	}); err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return false, false, nil
 		}
@@ -173,7 +177,7 @@ func (s *Relational) UserExistsById(ctx context.Context, id uuid.UUID, userType
 func (s *Relational) CreateUser(ctx context.Context, req *ports.AuthSignupPostRequest, forceId ...uuid.UUID) (resp *ports.User, err error) {
 	defer func() { err = utils.FuncPipe(relationalCaller+".CreateUser", err) }()
 	user := ports.UserModelFromUserType(req.UserType)
-	err = s.client.WithContext(ctx).Transaction(
+	err = s.writer(ctx).Transaction(
 		func(tx *gorm.DB) error {
 			existsUser := ports.UserModelFromUserType(req.UserType)
 			if err := tx.WithContext(ctx).Where("username = ?", req.Username).First(existsUser).Error; err != nil {
@@ -184,6 +188,9 @@ func (s *Relational) CreateUser(ctx context.Context, req *ports.AuthSignupPostRe
 				return utils.UsernameAlreadyExistsResponse.Clone().
 					WithReason("username", req.Username)
 			}
+			if err := s.checkUsernameClaimable(ctx, tx, req.Username, req.UserType, uuid.Nil); err != nil {
+				return err
+			}
 			hashedPass, err := utils.HashPassword(req.Password)
 			if err != nil {
 				return err
@@ -196,7 +203,10 @@ func (s *Relational) CreateUser(ctx context.Context, req *ports.AuthSignupPostRe
 			if err := tx.WithContext(ctx).Create(user).Error; err != nil {
 				return err
 			}
-			return nil
+			return s.addDomainEvent(ctx, tx, userId, req.UserType, ports.UserCreated{
+				Username: req.Username,
+				Name:     req.Name,
+			})
 		},
 	)
 	if err != nil {
@@ -224,7 +234,9 @@ func (s *Relational) AuthUserPassword(ctx context.Context, req *ports.AuthSignin
 func (s *Relational) GetUserById(ctx context.Context, id uuid.UUID, userType ports.UserType) (user ports.UserModel, isDeleted bool, err error) {
 	defer func() { err = utils.FuncPipe(relationalCaller+".GetUserById", err) }()
 	user = ports.UserModelFromUserType(userType)
-	if err := s.client.WithContext(ctx).Where("id = ?", id).First(user).Error; err != nil {
+	if err := s.read(ctx, func(db *gorm.DB) error {
+		return db.Where("id = ?", id).First(user).Error
+	}); err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, false, nil
 		}
@@ -239,7 +251,9 @@ func (s *Relational) GetUserById(ctx context.Context, id uuid.UUID, userType por
 func (s *Relational) GetUserByUsername(ctx context.Context, username string, userType ports.UserType) (user ports.UserModel, isDeleted bool, err error) {
 	defer func() { err = utils.FuncPipe(relationalCaller+".GetUserByUsername", err) }()
 	user = ports.UserModelFromUserType(userType)
-	if err := s.client.WithContext(ctx).Where("username = ?", username).First(user).Error; err != nil {
+	if err := s.read(ctx, func(db *gorm.DB) error {
+		return db.Where("username = ?", username).First(user).Error
+	}); err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, false, nil
 		}
@@ -257,7 +271,7 @@ func (s *Relational) UpdateUserPasswordById(ctx context.Context, id uuid.UUID, u
 	if err != nil {
 		return err
 	}
-	return s.client.WithContext(ctx).Transaction(
+	return s.writer(ctx).Transaction(
 		func(tx *gorm.DB) error {
 			user := ports.UserModelFromUserType(userType)
 			if err := tx.WithContext(ctx).Where("id = ?", id).First(user).Error; err != nil {
@@ -275,7 +289,7 @@ func (s *Relational) UpdateUserPasswordById(ctx context.Context, id uuid.UUID, u
 			).Error; err != nil {
 				return err
 			}
-			return nil
+			return s.addDomainEvent(ctx, tx, user.GetId(), userType, ports.PasswordChanged{})
 		},
 	)
 }
@@ -286,7 +300,7 @@ func (s *Relational) UpdateUserPasswordByUsername(ctx context.Context, username
 	if err != nil {
 		return err
 	}
-	return s.client.WithContext(ctx).Transaction(
+	return s.writer(ctx).Transaction(
 		func(tx *gorm.DB) error {
 			user := ports.UserModelFromUserType(userType)
 			if err := tx.WithContext(ctx).Where("username = ?", username).First(user).Error; err != nil {
@@ -304,14 +318,14 @@ func (s *Relational) UpdateUserPasswordByUsername(ctx context.Context, username
 			).Error; err != nil {
 				return err
 			}
-			return nil
+			return s.addDomainEvent(ctx, tx, user.GetId(), userType, ports.PasswordChanged{})
 		},
 	)
 }
 
-func (s *Relational) UpdateUserProfileById(ctx context.Context, id uuid.UUID, username, name, avatar string, userType ports.UserType) (err error) {
+func (s *Relational) UpdateUserProfileById(ctx context.Context, id uuid.UUID, username, name, avatarHash string, locale ports.Locale, userType ports.UserType) (err error) {
 	defer func() { err = utils.FuncPipe(relationalCaller+".UpdateUserProfileById", err) }()
-	return s.client.WithContext(ctx).Transaction(
+	return s.writer(ctx).Transaction(
 		func(tx *gorm.DB) error {
 			user := ports.UserModelFromUserType(userType)
 			if err := tx.WithContext(ctx).Where("id = ?", id).First(user).Error; err != nil {
@@ -321,33 +335,112 @@ func (s *Relational) UpdateUserProfileById(ctx context.Context, id uuid.UUID, us
 				}
 				return err
 			}
+			if oldUsername := user.GetUsername(); oldUsername != username {
+				if err := s.changeUsername(ctx, tx, id, userType, oldUsername, username); err != nil {
+					return err
+				}
+				if err := s.addDomainEvent(ctx, tx, id, userType, ports.UsernameChanged{
+					OldUsername: oldUsername,
+					NewUsername: username,
+				}); err != nil {
+					return err
+				}
+			}
 			if err := tx.WithContext(ctx).Model(user).Updates(
 				map[string]any{
-					"username":   username,
-					"name":       name,
-					"has_avatar": avatar != "",
-					"updated_at": time.Now().UTC(),
+					"username":    username,
+					"name":        name,
+					"has_avatar":  avatarHash != "",
+					"avatar_hash": avatarHash,
+					"locale":      locale,
+					"updated_at":  time.Now().UTC(),
 				},
 			).Error; err != nil {
 				return err
 			}
-			return nil
+			return s.addDomainEvent(ctx, tx, id, userType, ports.ProfileUpdated{
+				Username:  username,
+				Name:      name,
+				HasAvatar: avatarHash != "",
+				Locale:    locale,
+			})
 		},
 	)
 }
 
+func (s *Relational) UpdateUserAvatarById(ctx context.Context, id uuid.UUID, userType ports.UserType, avatarHash string) (err error) {
+	defer func() { err = utils.FuncPipe(relationalCaller+".UpdateUserAvatarById", err) }()
+	return s.writer(ctx).Transaction(
+		func(tx *gorm.DB) error {
+			result := tx.WithContext(ctx).Model(ports.UserModelFromUserType(userType)).Where("id = ?", id).Updates(
+				map[string]any{
+					"has_avatar":  avatarHash != "",
+					"avatar_hash": avatarHash,
+					"updated_at":  time.Now().UTC(),
+				},
+			)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return utils.UserNotFoundResponse.Clone().
+					WithReason("id", id.String())
+			}
+			return s.addDomainEvent(ctx, tx, id, userType, ports.AvatarChanged{
+				HasAvatar:  avatarHash != "",
+				AvatarHash: avatarHash,
+			})
+		},
+	)
+}
+
+func (s *Relational) GetAvatarRecords(ctx context.Context, ids []uuid.UUID, userType ports.UserType) (records map[uuid.UUID]ports.AvatarRecord, err error) {
+	defer func() { err = utils.FuncPipe(relationalCaller+".GetAvatarRecords", err) }()
+	records = make(map[uuid.UUID]ports.AvatarRecord, len(ids))
+	if len(ids) == 0 {
+		return records, nil
+	}
+	var rows []ports.AvatarRecord
+	if err := s.client.WithContext(ctx).Model(ports.UserModelFromUserType(userType)).
+		Select("id", "is_deleted", "has_avatar", "avatar_hash", "updated_at").
+		Where("id IN ?", ids).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		records[row.Id] = row
+	}
+	return records, nil
+}
+
+func (s *Relational) GetAvatarRecordsWithAvatar(ctx context.Context, userType ports.UserType, afterId uuid.UUID, limit int) (records []ports.AvatarRecord, err error) {
+	defer func() { err = utils.FuncPipe(relationalCaller+".GetAvatarRecordsWithAvatar", err) }()
+	if err := s.client.WithContext(ctx).Model(ports.UserModelFromUserType(userType)).
+		Select("id", "is_deleted", "has_avatar", "avatar_hash", "updated_at").
+		Where("has_avatar = ? AND id > ?", true, afterId).
+		Order("id").
+		Limit(limit).
+		Scan(&records).Error; err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
 func (s *Relational) DeleteUserById(ctx context.Context, id uuid.UUID, userType ports.UserType) (err error) {
 	defer func() { err = utils.FuncPipe(relationalCaller+".DeleteUserById", err) }()
-	return s.client.WithContext(ctx).Transaction(
+	return s.writer(ctx).Transaction(
 		func(tx *gorm.DB) error {
-			return ports.UserModelFromUserType(userType).Delete(ctx, tx, id)
+			if err := ports.UserModelFromUserType(userType).Delete(ctx, tx, id); err != nil {
+				return err
+			}
+			return s.addDomainEvent(ctx, tx, id, userType, ports.UserDeleted{})
 		},
 	)
 }
 
 func (s *Relational) UpdateUserPhoneById(ctx context.Context, id uuid.UUID, userType ports.UserType, phoneNumber string) (err error) {
 	defer func() { err = utils.FuncPipe(relationalCaller+".UpdateUserPhoneById", err) }()
-	return s.client.WithContext(ctx).Transaction(
+	return s.writer(ctx).Transaction(
 		func(tx *gorm.DB) error {
 			user := ports.UserModelFromUserType(userType)
 			if err := tx.WithContext(ctx).Where("id = ?", id).First(user).Error; err != nil {
@@ -372,14 +465,14 @@ func (s *Relational) UpdateUserPhoneById(ctx context.Context, id uuid.UUID, user
 			).Error; err != nil {
 				return err
 			}
-			return nil
+			return s.addDomainEvent(ctx, tx, id, userType, ports.PhoneChanged{PhoneNumber: phoneNumber})
 		},
 	)
 }
 
 func (s *Relational) UpdateUserEmailById(ctx context.Context, id uuid.UUID, userType ports.UserType, email string) (err error) {
 	defer func() { err = utils.FuncPipe(relationalCaller+".UpdateUserEmailById", err) }()
-	return s.client.WithContext(ctx).Transaction(
+	return s.writer(ctx).Transaction(
 		func(tx *gorm.DB) error {
 			user := ports.UserModelFromUserType(userType)
 			if err := tx.WithContext(ctx).Where("id = ?", id).First(user).Error; err != nil {
@@ -404,7 +497,7 @@ func (s *Relational) UpdateUserEmailById(ctx context.Context, id uuid.UUID, user
 			).Error; err != nil {
 				return err
 			}
-			return nil
+			return s.addDomainEvent(ctx, tx, id, userType, ports.EmailChanged{Email: email})
 		},
 	)
 }
@@ -432,8 +525,239 @@ func (s *Relational) CheckUserPhoneLimit(ctx context.Context, phoneNumber string
 	return nil
 }
 
+func (s *Relational) GetUsernameRedirect(ctx context.Context, username string, userType ports.UserType) (user ports.UserModel, err error) {
+	defer func() { err = utils.FuncPipe(relationalCaller+".GetUsernameRedirect", err) }()
+	history := &ports.UsernameHistoryModel{}
+	if err := s.client.WithContext(ctx).
+		Where("old_username = ? AND user_type = ?", username, userType).
+		Order("created_at desc").
+		First(history).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	user, isDeleted, err := s.GetUserById(ctx, history.UserId, userType)
+	if err != nil {
+		return nil, err
+	}
+	if isDeleted {
+		return nil, nil
+	}
+	return user, nil
+}
+
+func (s *Relational) GetUsersByIds(ctx context.Context, ids []uuid.UUID, userType ports.UserType) (users []ports.UserModel, err error) {
+	defer func() { err = utils.FuncPipe(relationalCaller+".GetUsersByIds", err) }()
+	if len(ids) == 0 {
+		return []ports.UserModel{}, nil
+	}
+	byId := make(map[uuid.UUID]ports.UserModel, len(ids))
+	switch userType {
+	case ports.AdminUserType:
+		var models []ports.AdminUserModel
+		if err := s.client.WithContext(ctx).Where("id IN ? AND is_deleted = ?", ids, false).Find(&models).Error; err != nil {
+			return nil, err
+		}
+		for i := range models {
+			byId[models[i].Id] = &models[i]
+		}
+	case ports.ClientUserType:
+		var models []ports.ClientUserModel
+		if err := s.client.WithContext(ctx).Where("id IN ? AND is_deleted = ?", ids, false).Find(&models).Error; err != nil {
+			return nil, err
+		}
+		for i := range models {
+			byId[models[i].Id] = &models[i]
+		}
+	default:
+		return nil, utils.BadRequestResponse.Clone().
+			WithReason("user_type", userType)
+	}
+	users = make([]ports.UserModel, 0, len(byId))
+	for _, id := range ids {
+		if user, ok := byId[id]; ok {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (s *Relational) GetUsernameDenylist(ctx context.Context) (denylist []ports.UsernameDenylistModel, err error) {
+	defer func() { err = utils.FuncPipe(relationalCaller+".GetUsernameDenylist", err) }()
+	if err := s.client.WithContext(ctx).Order("username asc").Find(&denylist).Error; err != nil {
+		return nil, err
+	}
+	return denylist, nil
+}
+
+func (s *Relational) AddUsernameToDenylist(ctx context.Context, username, reason string, createdBy uuid.UUID) (err error) {
+	defer func() { err = utils.FuncPipe(relationalCaller+".AddUsernameToDenylist", err) }()
+	return s.writer(ctx).Save(&ports.UsernameDenylistModel{
+		Username:  strings.ToLower(username),
+		Reason:    reason,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UTC(),
+	}).Error
+}
+
+func (s *Relational) RemoveUsernameFromDenylist(ctx context.Context, username string) (err error) {
+	defer func() { err = utils.FuncPipe(relationalCaller+".RemoveUsernameFromDenylist", err) }()
+	result := s.writer(ctx).
+		Where("username = ?", strings.ToLower(username)).
+		Delete(&ports.UsernameDenylistModel{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return utils.NotFoundResponse.Clone().
+			WithReason("username", username)
+	}
+	return nil
+}
+
+// RelayDomainEvents hands up to limit unpublished events, oldest first, to
+// publish and marks them published once it returns nil. The rows stay locked
+// meanwhile, so concurrent relays skip them instead of publishing twice; if
+// publish fails nothing is marked and the batch is retried on the next call.
+func (s *Relational) RelayDomainEvents(ctx context.Context, limit int, publish func(events []*ports.DomainEvent) error) (relayed int, err error) {
+	defer func() { err = utils.FuncPipe(relationalCaller+".RelayDomainEvents", err) }()
+	err = s.writer(ctx).Transaction(
+		func(tx *gorm.DB) error {
+			var models []ports.DomainEventModel
+			if err := tx.WithContext(ctx).
+				Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("published_at IS NULL").
+				Order("created_at asc").
+				Limit(limit).
+				Find(&models).Error; err != nil {
+				return err
+			}
+			if len(models) == 0 {
+				return nil
+			}
+			events := make([]*ports.DomainEvent, len(models))
+			ids := make([]uuid.UUID, len(models))
+			for i, model := range models {
+				events[i] = model.ToDomainEvent()
+				ids[i] = model.Id
+			}
+			if err := publish(events); err != nil {
+				return err
+			}
+			if err := tx.WithContext(ctx).Model(&ports.DomainEventModel{}).
+				Where("id IN ?", ids).
+				Update("published_at", time.Now().UTC()).Error; err != nil {
+				return err
+			}
+			relayed = len(models)
+			return nil
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return relayed, nil
+}
+
+func (s *Relational) DeletePublishedDomainEvents(ctx context.Context, before time.Time) (deleted int64, err error) {
+	defer func() { err = utils.FuncPipe(relationalCaller+".DeletePublishedDomainEvents", err) }()
+	result := s.writer(ctx).
+		Where("published_at IS NOT NULL AND published_at < ?", before).
+		Delete(&ports.DomainEventModel{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// addDomainEvent writes the event to the outbox within tx, so it is only
+// published if the change it describes is committed.
+func (s *Relational) addDomainEvent(ctx context.Context, tx *gorm.DB, userId uuid.UUID, userType ports.UserType, payload ports.DomainEventPayload) (err error) {
+	defer func() { err = utils.FuncPipe(relationalCaller+".addDomainEvent", err) }()
+	event, err := ports.NewDomainEventModel(userId, userType, payload)
+	if err != nil {
+		return err
+	}
+	return tx.WithContext(ctx).Create(event).Error
+}
+
+func (s *Relational) changeUsername(ctx context.Context, tx *gorm.DB, id uuid.UUID, userType ports.UserType, oldUsername, newUsername string) (err error) {
+	defer func() { err = utils.FuncPipe(relationalCaller+".changeUsername", err) }()
+	last := &ports.UsernameHistoryModel{}
+	if err := tx.WithContext(ctx).
+		Where("user_id = ? AND user_type = ?", id, userType).
+		Order("created_at desc").
+		First(last).Error; err == nil {
+		if retryAfter := last.CreatedAt.Add(usernameChangeCooldown); time.Now().UTC().Before(retryAfter) {
+			return utils.UsernameChangeCooldownResponse.Clone().
+				WithReason("retry_after", retryAfter)
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	existsUser := ports.UserModelFromUserType(userType)
+	if err := tx.WithContext(ctx).Where("username = ?", newUsername).First(existsUser).Error; err == nil {
+		return utils.UsernameAlreadyExistsResponse.Clone().
+			WithReason("username", newUsername)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err := s.checkUsernameClaimable(ctx, tx, newUsername, userType, id); err != nil {
+		return err
+	}
+	if oldUsername == "" {
+		return nil
+	}
+	return tx.WithContext(ctx).Create(
+		ports.NewUsernameHistoryModel(id, userType, oldUsername, newUsername, usernameReservationPeriod),
+	).Error
+}
+
+// checkUsernameClaimable rejects denylisted usernames and usernames still
+// reserved for the user who released them. ownerId is allowed to take back its
+// own reserved usernames; pass uuid.Nil for new users.
+func (s *Relational) checkUsernameClaimable(ctx context.Context, tx *gorm.DB, username string, userType ports.UserType, ownerId uuid.UUID) (err error) {
+	defer func() { err = utils.FuncPipe(relationalCaller+".checkUsernameClaimable", err) }()
+	var count int64
+	if err := tx.WithContext(ctx).Model(&ports.UsernameDenylistModel{}).
+		Where("username = ?", strings.ToLower(username)).
+		Count(&count).Error; err != nil {
+		return err
+	} else if count > 0 {
+		return utils.UsernameDeniedResponse.Clone().
+			WithReason("username", username)
+	}
+	reserved, err := s.isUsernameReserved(ctx, tx, username, userType, ownerId)
+	if err != nil {
+		return err
+	}
+	if reserved {
+		return utils.UsernameIsReservedResponse.Clone().
+			WithReason("username", username)
+	}
+	return nil
+}
+
+func (s *Relational) isUsernameReserved(ctx context.Context, tx *gorm.DB, username string, userType ports.UserType, ownerId uuid.UUID) (reserved bool, err error) {
+	defer func() { err = utils.FuncPipe(relationalCaller+".isUsernameReserved", err) }()
+	var count int64
+	if err := tx.WithContext(ctx).Model(&ports.UsernameHistoryModel{}).
+		Where("old_username = ? AND user_type = ? AND user_id <> ? AND reserved_until > ?", username, userType, ownerId, time.Now().UTC()).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
 func (s *Relational) Close() error {
 	s.logger.Info(context.Background(), "Closing database connection")
+	close(s.closed)
+	for _, replica := range s.replicas {
+		if instance, err := replica.client.DB(); err == nil {
+			instance.Close()
+		}
+	}
 	instance, err := s.client.DB()
 	if err != nil {
 		return err
@@ -0,0 +1,302 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+// MigrationsDir is where the migrations live in the source tree, relative to
+// its root. They are embedded in the binaries from there.
+const MigrationsDir = "internal/repository/migrations"
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey is the Postgres advisory lock held while migrating, so
+// replicas migrating at once take turns.
+const migrationLockKey int64 = 0x6b67_6d69_6772_6174
+
+var (
+	migrationFileRegex = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+	migrationNameRegex = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// loadMigrations reads the migrations in fsys, ordered by version.
+func loadMigrations(fsys fs.FS) (migrations []*ports.Migration, err error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*ports.Migration{}
+	for _, entry := range entries {
+		match := migrationFileRegex.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file name '%s' is not {version}_{name}.up|down.sql", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &ports.Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both '%s' and '%s'", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(data)
+			sum := sha256.Sum256(data)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(data)
+		}
+	}
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, migration)
+	}
+	slices.SortFunc(migrations, func(a, b *ports.Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return migrations, nil
+}
+
+func embeddedMigrations() ([]*ports.Migration, error) {
+	fsys, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return loadMigrations(fsys)
+}
+
+// CreateMigration writes empty up and down scripts for a new migration to
+// dir, numbered after the last one there.
+func CreateMigration(dir, name string) (upPath, downPath string, err error) {
+	defer func() { err = utils.FuncPipe(packageCaller+".CreateMigration", err) }()
+	if !migrationNameRegex.MatchString(name) {
+		return "", "", fmt.Errorf("migration name '%s' may only have lowercase letters, digits and underscores", name)
+	}
+	migrations, err := loadMigrations(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+	version := int64(1)
+	if len(migrations) > 0 {
+		version = migrations[len(migrations)-1].Version + 1
+	}
+	base := filepath.Join(dir, fmt.Sprintf("%04d_%s", version, name))
+	upPath, downPath = base+".up.sql", base+".down.sql"
+	if err := os.WriteFile(upPath, []byte("-- "+name+"\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(downPath, []byte("-- revert "+name+"\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	return upPath, downPath, nil
+}
+
+func (s *Relational) MigrationStatus(ctx context.Context) (statuses []*ports.MigrationStatus, err error) {
+	defer func() { err = utils.FuncPipe(relationalCaller+".MigrationStatus", err) }()
+	migrations, err := embeddedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	statuses, _, err = s.migrationStatus(s.client.WithContext(ctx), migrations)
+	return statuses, err
+}
+
+func (s *Relational) MigrateUp(ctx context.Context, steps int) (applied []*ports.MigrationStatus, err error) {
+	defer func() { err = utils.FuncPipe(relationalCaller+".MigrateUp", err) }()
+	migrations, err := embeddedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	err = s.withMigrationLock(ctx, func(conn *gorm.DB) error {
+		statuses, byVersion, err := s.migrationStatus(conn, migrations)
+		if err != nil {
+			return err
+		}
+		if err := checkMigrationStatuses(statuses); err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			if status.State != ports.PendingMigrationState {
+				continue
+			}
+			if steps > 0 && len(applied) == steps {
+				break
+			}
+			migration := byVersion[status.Version]
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if _, err := tx.Statement.ConnPool.ExecContext(ctx, migration.Up); err != nil {
+					return err
+				}
+				return tx.Create(&ports.SchemaMigrationModel{
+					Version:   migration.Version,
+					Name:      migration.Name,
+					Checksum:  migration.Checksum,
+					AppliedAt: time.Now().UTC(),
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			status.State = ports.AppliedMigrationState
+			applied = append(applied, status)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+func (s *Relational) MigrateDown(ctx context.Context, steps int) (reverted []*ports.MigrationStatus, err error) {
+	defer func() { err = utils.FuncPipe(relationalCaller+".MigrateDown", err) }()
+	migrations, err := embeddedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	err = s.withMigrationLock(ctx, func(conn *gorm.DB) error {
+		statuses, byVersion, err := s.migrationStatus(conn, migrations)
+		if err != nil {
+			return err
+		}
+		if err := checkMigrationStatuses(statuses); err != nil {
+			return err
+		}
+		for _, status := range slices.Backward(statuses) {
+			if status.State != ports.AppliedMigrationState {
+				continue
+			}
+			if len(reverted) == steps {
+				break
+			}
+			migration := byVersion[status.Version]
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down script", migration.Version, migration.Name)
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if _, err := tx.Statement.ConnPool.ExecContext(ctx, migration.Down); err != nil {
+					return err
+				}
+				return tx.Delete(&ports.SchemaMigrationModel{}, "version = ?", migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			status.State = ports.PendingMigrationState
+			reverted = append(reverted, status)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// withMigrationLock runs fn on a single connection holding the migration
+// lock, creating schema_migrations first if needed.
+func (s *Relational) withMigrationLock(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	return s.client.WithContext(ctx).Connection(func(conn *gorm.DB) (err error) {
+		// Statements on conn would otherwise pile up each other's clauses.
+		conn = conn.Session(&gorm.Session{NewDB: true})
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+			return err
+		}
+		defer func() {
+			if unlockErr := conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockKey).Error; err == nil {
+				err = unlockErr
+			}
+		}()
+		if err := conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+	version bigint NOT NULL PRIMARY KEY,
+	name text NOT NULL,
+	checksum text NOT NULL,
+	applied_at timestamptz NOT NULL
+)`).Error; err != nil {
+			return err
+		}
+		return fn(conn)
+	})
+}
+
+// migrationStatus compares migrations with the ones applied. A database that
+// was never migrated has every migration pending.
+func (s *Relational) migrationStatus(db *gorm.DB, migrations []*ports.Migration) (statuses []*ports.MigrationStatus, byVersion map[int64]*ports.Migration, err error) {
+	var exists bool
+	if err := db.Raw("SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists).Error; err != nil {
+		return nil, nil, err
+	}
+	applied := []ports.SchemaMigrationModel{}
+	if exists {
+		if err := db.Order("version").Find(&applied).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	byVersion = make(map[int64]*ports.Migration, len(migrations))
+	for _, migration := range migrations {
+		byVersion[migration.Version] = migration
+	}
+	appliedVersions := make(map[int64]bool, len(applied))
+	for _, row := range applied {
+		appliedVersions[row.Version] = true
+		status := &ports.MigrationStatus{
+			Version:   row.Version,
+			Name:      row.Name,
+			State:     ports.AppliedMigrationState,
+			AppliedAt: row.AppliedAt,
+		}
+		if migration, ok := byVersion[row.Version]; !ok {
+			status.State = ports.MissingMigrationState
+		} else if migration.Checksum != row.Checksum {
+			status.State = ports.ModifiedMigrationState
+		}
+		statuses = append(statuses, status)
+	}
+	for _, migration := range migrations {
+		if !appliedVersions[migration.Version] {
+			statuses = append(statuses, &ports.MigrationStatus{
+				Version: migration.Version,
+				Name:    migration.Name,
+				State:   ports.PendingMigrationState,
+			})
+		}
+	}
+	slices.SortFunc(statuses, func(a, b *ports.MigrationStatus) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return statuses, byVersion, nil
+}
+
+// checkMigrationStatuses refuses to migrate a schema that no longer matches
+// the migrations shipped.
+func checkMigrationStatuses(statuses []*ports.MigrationStatus) error {
+	for _, status := range statuses {
+		switch status.State {
+		case ports.ModifiedMigrationState:
+			return fmt.Errorf("applied migration %d_%s was modified since", status.Version, status.Name)
+		case ports.MissingMigrationState:
+			return fmt.Errorf("applied migration %d_%s is missing", status.Version, status.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+// baselineUserModel is the user model as it was when the servers still
+// created their tables with AutoMigrate, before migrations existed.
+type baselineUserModel struct {
+	Id          uuid.UUID `gorm:"type:uuid;primary_key;"`
+	Username    string    `gorm:"unique"`
+	Name        string    `gorm:"not null"`
+	HasAvatar   bool      `gorm:"not null"`
+	PhoneNumber *string
+	Email       *string
+	Password    *string
+	UpdatedAt   time.Time `gorm:"not null"`
+	CreatedAt   time.Time `gorm:"not null"`
+	IsDeleted   bool      `gorm:"not null"`
+}
+
+type baselineAdminUserModel struct {
+	baselineUserModel `gorm:"embedded"`
+}
+
+func (baselineAdminUserModel) TableName() string { return "admin_user_models" }
+
+type baselineClientUserModel struct {
+	baselineUserModel `gorm:"embedded"`
+}
+
+func (baselineClientUserModel) TableName() string { return "client_user_models" }
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	migrations, err := embeddedMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, migration := range migrations {
+		if migration.Version != int64(i+1) {
+			t.Fatalf("migration %d_%s is out of sequence", migration.Version, migration.Name)
+		}
+		if migration.Down == "" {
+			t.Fatalf("migration %d_%s has no down script", migration.Version, migration.Name)
+		}
+	}
+}
+
+// TestMigrateUpAdoptsBaselineSchema builds the baseline AutoMigrate schema in
+// the database POSTGRES_DB_* point at, when MIGRATE_INTEGRATION is set, and
+// migrates it up. The database must be disposable: the test drops its tables
+// first.
+func TestMigrateUpAdoptsBaselineSchema(t *testing.T) {
+	if os.Getenv("MIGRATE_INTEGRATION") == "" {
+		t.Skip("MIGRATE_INTEGRATION is not set")
+	}
+	ctx := utils.WithPrimary(t.Context())
+	rel := NewRelationalRepo(utils.NewLogger()).(*Relational)
+	t.Cleanup(func() { _ = rel.Close() })
+	db := rel.client.WithContext(ctx)
+
+	for _, table := range []string{
+		"schema_migrations",
+		"domain_event_models",
+		"username_denylist_models",
+		"username_history_models",
+		"client_user_models",
+		"admin_user_models",
+	} {
+		if err := db.Exec("DROP TABLE IF EXISTS " + table).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.AutoMigrate(&baselineAdminUserModel{}, &baselineClientUserModel{}); err != nil {
+		t.Fatal(err)
+	}
+	id := uuid.New()
+	now := time.Now().UTC()
+	if err := db.Create(&baselineClientUserModel{baselineUserModel{
+		Id:        id,
+		Username:  "baseline",
+		Name:      "Baseline",
+		UpdatedAt: now,
+		CreatedAt: now,
+	}}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := rel.MigrateUp(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations, err := embeddedMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrations) {
+		t.Fatalf("applied %d migrations, want %d", len(applied), len(migrations))
+	}
+
+	for _, table := range []string{"admin_user_models", "client_user_models"} {
+		for _, column := range []string{"avatar_hash", "locale"} {
+			if !db.Migrator().HasColumn(table, column) {
+				t.Errorf("%s has no %s column", table, column)
+			}
+		}
+	}
+	for _, table := range []string{"username_history_models", "username_denylist_models", "domain_event_models"} {
+		if !db.Migrator().HasTable(table) {
+			t.Errorf("%s is missing", table)
+		}
+	}
+
+	// Users created before the migrations read back with the new columns
+	// at their defaults.
+	user, isDeleted, err := rel.GetUserByUsername(ctx, "baseline", ports.ClientUserType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user == nil || isDeleted || user.GetId() != id {
+		t.Fatalf("got %v, want the baseline user", user)
+	}
+	if user.GetAvatarHash() != "" || user.GetLocale() != "" {
+		t.Fatalf("baseline user has avatar hash %q and locale %q", user.GetAvatarHash(), user.GetLocale())
+	}
+
+	// The migrations revert back to the baseline schema and apply again.
+	if _, err := rel.MigrateDown(ctx, len(migrations)-1); err != nil {
+		t.Fatal(err)
+	}
+	if db.Migrator().HasColumn("client_user_models", "avatar_hash") || db.Migrator().HasTable("domain_event_models") {
+		t.Fatal("migrating down to 0001 left later changes behind")
+	}
+	if _, err := rel.MigrateUp(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+}
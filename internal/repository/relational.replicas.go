@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/kasragay/backend/internal/utils"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gLogger "gorm.io/gorm/logger"
+)
+
+// replicaLagQuery measures how far behind the primary a replica is. A replica
+// that replayed everything it received is not lagging, however old its last
+// transaction, but only while its WAL receiver runs: one cut off from the
+// primary has nothing left to replay either, so it reports NULL and is not
+// read from. The primary itself reports no lag.
+const replicaLagQuery = `SELECT CASE
+	WHEN NOT pg_is_in_recovery() THEN 0
+	WHEN NOT EXISTS (SELECT 1 FROM pg_stat_wal_receiver) THEN NULL
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END`
+
+// relationalReplica is a read replica of the primary database. Reads only go
+// to it while its last health check passed.
+type relationalReplica struct {
+	addr    string
+	client  *gorm.DB
+	healthy atomic.Bool
+}
+
+// openReplicas connects to the read replicas in POSTGRES_DB_REPLICA_HOSTS,
+// host[:port] entries that share the credentials and database of the primary.
+// Replicas may be down at boot; the health checks keep reads off them until
+// they are up.
+func openReplicas(logger *utils.Logger, port, username, password, database string) (replicas []*relationalReplica) {
+	hosts := os.Getenv("POSTGRES_DB_REPLICA_HOSTS")
+	if hosts == "" {
+		return nil
+	}
+	for _, addr := range strings.Split(hosts, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		host, replicaPort, err := net.SplitHostPort(addr)
+		if err != nil {
+			host, replicaPort = addr, port
+		}
+		db, err := gorm.Open(postgres.Open(fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable timezone=UTC", host, replicaPort, username, password, database)), &gorm.Config{
+			Logger:               gLogger.Default.LogMode(gLogger.Silent),
+			DisableAutomaticPing: true,
+		})
+		if err != nil {
+			logger.Fatalf(context.Background(), "Failed to open database replica %s: %v", addr, err)
+		}
+		replicas = append(replicas, &relationalReplica{addr: net.JoinHostPort(host, replicaPort), client: db})
+	}
+	return replicas
+}
+
+func getenvAsReplicaDuration(logger *utils.Logger, key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		logger.Fatalf(context.Background(), "%s is not a valid duration", key)
+	}
+	return d
+}
+
+// checkReplicas runs the health checks of the replicas every interval until
+// the repository is closed.
+func (s *Relational) checkReplicas(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+			s.checkReplicasOnce(interval)
+		}
+	}
+}
+
+func (s *Relational) checkReplicasOnce(timeout time.Duration) {
+	for _, replica := range s.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		var lag sql.NullFloat64
+		err := replica.client.WithContext(ctx).Raw(replicaLagQuery).Scan(&lag).Error
+		cancel()
+		lagging := time.Duration(lag.Float64 * float64(time.Second))
+		healthy := err == nil && lag.Valid && lagging <= s.replicaMaxLag
+		if healthy == replica.healthy.Swap(healthy) {
+			continue
+		}
+		switch {
+		case healthy:
+			s.logger.Infof(context.Background(), "Database replica %s is healthy, reading from it", replica.addr)
+		case err != nil:
+			s.logger.Warnf(context.Background(), "Database replica %s is unreachable, reading from the others: %v", replica.addr, err)
+		case !lag.Valid:
+			s.logger.Warnf(context.Background(), "Database replica %s is not receiving from the primary, reading from the others", replica.addr)
+		default:
+			s.logger.Warnf(context.Background(), "Database replica %s lags %s behind, reading from the others", replica.addr, lagging.Round(time.Millisecond))
+		}
+	}
+}
+
+// replica picks a healthy replica for the reads under ctx, round-robin. It
+// returns nil when the reads must see the primary, or no replica is healthy.
+func (s *Relational) replica(ctx context.Context) *relationalReplica {
+	if len(s.replicas) == 0 || utils.ReadsPrimary(ctx) {
+		return nil
+	}
+	start := s.nextReplica.Add(1)
+	for i := range uint64(len(s.replicas)) {
+		replica := s.replicas[(start+i)%uint64(len(s.replicas))]
+		if replica.healthy.Load() {
+			return replica
+		}
+	}
+	return nil
+}
+
+// read runs query on a replica when ctx allows it, or else on the primary. A
+// replica failing the query is left out until its next health check passes,
+// and the query is retried on the primary.
+func (s *Relational) read(ctx context.Context, query func(db *gorm.DB) error) error {
+	replica := s.replica(ctx)
+	if replica == nil {
+		return query(s.client.WithContext(ctx))
+	}
+	err := query(replica.client.WithContext(ctx))
+	if err == nil || errors.Is(err, gorm.ErrRecordNotFound) || ctx.Err() != nil {
+		return err
+	}
+	if replica.healthy.CompareAndSwap(true, false) {
+		s.logger.Warnf(ctx, "Database replica %s failed a read, reading from the others: %v", replica.addr, err)
+	}
+	return query(s.client.WithContext(ctx))
+}
+
+// writer is the primary, for the writes under ctx. Once a request writes, the
+// rest of its reads go to the primary too, so they see what it wrote.
+func (s *Relational) writer(ctx context.Context) *gorm.DB {
+	utils.PinPrimary(ctx)
+	return s.client.WithContext(ctx)
+}
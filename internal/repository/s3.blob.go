@@ -0,0 +1,341 @@
+package repository
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const blobS3Caller = packageCaller + ".BlobS3"
+
+const (
+	blobAvatarsBucket = "avatars"
+	blobUploadsBucket = "uploads"
+	blobMediaPrefix   = "media-"
+)
+
+// blobStore is the primitive object store the filesystem and in-memory
+// backends provide. Missing objects are reported as nil rather than errors
+// and removing one is not an error.
+type blobStore interface {
+	put(ctx context.Context, bucket, objectName, contentType string, data []byte, metadata map[string]string) (err error)
+	open(ctx context.Context, bucket, objectName string) (object ports.S3Object, err error)
+	remove(ctx context.Context, bucket, objectName string) (err error)
+	move(ctx context.Context, srcBucket, srcObjectName, dstBucket, dstObjectName, contentType string) (err error)
+	ensureBucket(ctx context.Context, bucket string) (err error)
+	list(ctx context.Context, bucket string, fn func(objectName string, info ports.S3ObjectInfo) error) (err error)
+}
+
+// BlobS3 implements ports.S3Repo on top of a blobStore. Since the store has no
+// server, presigned urls point at the gateway's /s3/objects route and are
+// authenticated with an HMAC instead of S3 signatures.
+type BlobS3 struct {
+	logger     *utils.Logger
+	store      blobStore
+	signingKey []byte
+	publicUrl  string
+}
+
+// newBlobS3 reads the settings shared by the blob backends. A missing signing
+// key is only tolerated when requireConfig is false, in which case urls are
+// signed with a random per-process key.
+func newBlobS3(logger *utils.Logger, store blobStore, requireConfig bool) *BlobS3 {
+	signingKey := []byte(os.Getenv("STORAGE_SIGNING_KEY"))
+	if len(signingKey) == 0 {
+		if requireConfig {
+			logger.Fatal(context.Background(), "STORAGE_SIGNING_KEY is not set")
+		}
+		signingKey = make([]byte, 32)
+		_, _ = rand.Read(signingKey)
+	}
+	publicUrl := strings.TrimSuffix(os.Getenv("STORAGE_PUBLIC_URL"), "/")
+	if publicUrl == "" {
+		if requireConfig {
+			logger.Fatal(context.Background(), "STORAGE_PUBLIC_URL is not set")
+		}
+		publicUrl = "http://localhost/" + string(ports.LatestVersion) + "/s3/objects"
+	}
+	if u, err := url.Parse(publicUrl); err != nil || u.Host == "" {
+		logger.Fatal(context.Background(), "STORAGE_PUBLIC_URL is not a valid url")
+	}
+	return &BlobS3{
+		logger:     logger,
+		store:      store,
+		signingKey: signingKey,
+		publicUrl:  publicUrl,
+	}
+}
+
+func (r *BlobS3) UploadAvatar(ctx context.Context, userId uuid.UUID, userType ports.UserType, img *image.Image) (hash string, err error) {
+	defer func() { err = utils.FuncPipe(blobS3Caller+".UploadAvatar", err) }()
+	variants, hash, err := encodeAvatarVariants(userId, userType, img)
+	if err != nil {
+		return "", err
+	}
+	for _, v := range variants {
+		if err = r.store.put(ctx, blobAvatarsBucket, v.objectName, v.contentType, v.data, map[string]string{ports.AvatarHashMetadataKey: hash}); err != nil {
+			return "", err
+		}
+	}
+	r.logger.Infof(ctx, "uploaded avatar variants of %s/%s to bucket %s", string(userType), userId.String(), blobAvatarsBucket)
+	return hash, nil
+}
+
+func (r *BlobS3) DeleteAvatar(ctx context.Context, userId uuid.UUID, userType ports.UserType) (err error) {
+	defer func() { err = utils.FuncPipe(blobS3Caller+".DeleteAvatar", err) }()
+	for _, objectName := range avatarObjectNames(userId, userType) {
+		if err = r.store.remove(ctx, blobAvatarsBucket, objectName); err != nil {
+			return err
+		}
+	}
+	r.logger.Infof(ctx, "deleted avatar variants of %s/%s from bucket %s", string(userType), userId.String(), blobAvatarsBucket)
+	return nil
+}
+
+func (r *BlobS3) DeleteAvatarObject(ctx context.Context, objectName string) (err error) {
+	defer func() { err = utils.FuncPipe(blobS3Caller+".DeleteAvatarObject", err) }()
+	if err = r.store.remove(ctx, blobAvatarsBucket, objectName); err != nil {
+		return err
+	}
+	r.logger.Infof(ctx, "deleted %s from bucket %s", objectName, blobAvatarsBucket)
+	return nil
+}
+
+func (r *BlobS3) IterateAvatarObjects(ctx context.Context, fn func(objectName string, info ports.S3ObjectInfo) error) (err error) {
+	defer func() { err = utils.FuncPipe(blobS3Caller+".IterateAvatarObjects", err) }()
+	return r.store.list(ctx, blobAvatarsBucket, fn)
+}
+
+func (r *BlobS3) GetAvatar(ctx context.Context, userId uuid.UUID, userType ports.UserType, size int, format ports.AvatarFormat) (avatar ports.S3Object, err error) {
+	defer func() { err = utils.FuncPipe(blobS3Caller+".GetAvatar", err) }()
+	avatar, err = r.store.open(ctx, blobAvatarsBucket, ports.AvatarObjectName(userId, userType, size, format))
+	if err != nil || avatar != nil {
+		return avatar, err
+	}
+	// As with S3, a legacy avatar is served until it is re-encoded.
+	return r.store.open(ctx, blobAvatarsBucket, ports.LegacyAvatarObjectName(userId, userType))
+}
+
+func (r *BlobS3) PresignUpload(ctx context.Context, objectName, contentType string, size int64, expire time.Duration) (uploadUrl string, headers map[string]string, err error) {
+	defer func() { err = utils.FuncPipe(blobS3Caller+".PresignUpload", err) }()
+	// As with S3, both headers are part of the signature.
+	headers = map[string]string{
+		"Content-Type":   contentType,
+		"Content-Length": strconv.FormatInt(size, 10),
+	}
+	return r.signedUrl("PUT", blobUploadsBucket, objectName, contentType, size, expire), headers, nil
+}
+
+func (r *BlobS3) GetUpload(ctx context.Context, objectName string, maxSize int64) (data []byte, contentType string, err error) {
+	defer func() { err = utils.FuncPipe(blobS3Caller+".GetUpload", err) }()
+	obj, err := r.store.open(ctx, blobUploadsBucket, objectName)
+	if err != nil || obj == nil {
+		return nil, "", err
+	}
+	defer func() {
+		_ = obj.Close()
+	}()
+	info := obj.Info()
+	if info.Size > maxSize {
+		return nil, "", utils.BadRequestResponse.Clone().
+			WithReason("size", info.Size).
+			WithReason("max_size", maxSize)
+	}
+	data, err = io.ReadAll(io.LimitReader(obj, maxSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	return data, info.ContentType, nil
+}
+
+func (r *BlobS3) DeleteUpload(ctx context.Context, objectName string) (err error) {
+	defer func() { err = utils.FuncPipe(blobS3Caller+".DeleteUpload", err) }()
+	return r.store.remove(ctx, blobUploadsBucket, objectName)
+}
+
+func (r *BlobS3) PeekUpload(ctx context.Context, objectName string, n int64) (head []byte, size int64, err error) {
+	defer func() { err = utils.FuncPipe(blobS3Caller+".PeekUpload", err) }()
+	obj, err := r.store.open(ctx, blobUploadsBucket, objectName)
+	if err != nil || obj == nil {
+		return nil, 0, err
+	}
+	defer func() {
+		_ = obj.Close()
+	}()
+	head, err = io.ReadAll(io.LimitReader(obj, n))
+	if err != nil {
+		return nil, 0, err
+	}
+	return head, obj.Info().Size, nil
+}
+
+func (r *BlobS3) IterateUploadObjects(ctx context.Context, fn func(objectName string, info ports.S3ObjectInfo) error) (err error) {
+	defer func() { err = utils.FuncPipe(blobS3Caller+".IterateUploadObjects", err) }()
+	return r.store.list(ctx, blobUploadsBucket, fn)
+}
+
+func (r *BlobS3) EnsureMediaBuckets(ctx context.Context) (err error) {
+	defer func() { err = utils.FuncPipe(blobS3Caller+".EnsureMediaBuckets", err) }()
+	for _, purpose := range ports.MediaPurposes() {
+		if err = r.store.ensureBucket(ctx, r.mediaBucket(purpose)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *BlobS3) PromoteUpload(ctx context.Context, objectName string, purpose ports.MediaPurpose, dstObjectName, contentType string) (err error) {
+	defer func() { err = utils.FuncPipe(blobS3Caller+".PromoteUpload", err) }()
+	if err = r.store.move(ctx, blobUploadsBucket, objectName, r.mediaBucket(purpose), dstObjectName, contentType); err != nil {
+		return err
+	}
+	r.logger.Infof(ctx, "promoted %s to bucket %s", objectName, r.mediaBucket(purpose))
+	return nil
+}
+
+func (r *BlobS3) PresignMediaDownload(ctx context.Context, purpose ports.MediaPurpose, objectName string, expire time.Duration) (downloadUrl string, err error) {
+	defer func() { err = utils.FuncPipe(blobS3Caller+".PresignMediaDownload", err) }()
+	return r.signedUrl("GET", r.mediaBucket(purpose), objectName, "", 0, expire), nil
+}
+
+func (r *BlobS3) DeleteMedia(ctx context.Context, purpose ports.MediaPurpose, objectName string) (err error) {
+	defer func() { err = utils.FuncPipe(blobS3Caller+".DeleteMedia", err) }()
+	if err = r.store.remove(ctx, r.mediaBucket(purpose), objectName); err != nil {
+		return err
+	}
+	r.logger.Infof(ctx, "deleted %s from bucket %s", objectName, r.mediaBucket(purpose))
+	return nil
+}
+
+func (r *BlobS3) IterateMediaObjects(ctx context.Context, purpose ports.MediaPurpose, fn func(objectName string, info ports.S3ObjectInfo) error) (err error) {
+	defer func() { err = utils.FuncPipe(blobS3Caller+".IterateMediaObjects", err) }()
+	return r.store.list(ctx, r.mediaBucket(purpose), fn)
+}
+
+func (r *BlobS3) PutSignedObject(ctx context.Context, bucket, objectName string, query url.Values, contentType string, data []byte) (err error) {
+	defer func() { err = utils.FuncPipe(blobS3Caller+".PutSignedObject", err) }()
+	if err = r.verifySignature("PUT", bucket, objectName, contentType, int64(len(data)), query); err != nil {
+		return err
+	}
+	if err = r.store.put(ctx, bucket, objectName, contentType, data, nil); err != nil {
+		return err
+	}
+	r.logger.Infof(ctx, "uploaded %s to bucket %s", objectName, bucket)
+	return nil
+}
+
+func (r *BlobS3) GetSignedObject(ctx context.Context, bucket, objectName string, query url.Values) (object ports.S3Object, err error) {
+	defer func() { err = utils.FuncPipe(blobS3Caller+".GetSignedObject", err) }()
+	if err = r.verifySignature("GET", bucket, objectName, "", 0, query); err != nil {
+		return nil, err
+	}
+	return r.store.open(ctx, bucket, objectName)
+}
+
+func (r *BlobS3) mediaBucket(purpose ports.MediaPurpose) string {
+	return blobMediaPrefix + string(purpose)
+}
+
+func (r *BlobS3) signedUrl(method, bucket, objectName, contentType string, size int64, expire time.Duration) string {
+	expires := time.Now().Add(expire).Unix()
+	segments := strings.Split(objectName, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", r.signature(method, bucket, objectName, contentType, size, expires))
+	return r.publicUrl + "/" + url.PathEscape(bucket) + "/" + strings.Join(segments, "/") + "?" + query.Encode()
+}
+
+func (r *BlobS3) signature(method, bucket, objectName, contentType string, size int64, expires int64) string {
+	mac := hmac.New(sha256.New, r.signingKey)
+	mac.Write([]byte(strings.Join([]string{
+		method, bucket, objectName, contentType, strconv.FormatInt(size, 10), strconv.FormatInt(expires, 10),
+	}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (r *BlobS3) verifySignature(method, bucket, objectName, contentType string, size int64, query url.Values) (err error) {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return utils.SignedUrlInvalidResponse.Clone().
+			WithReason("expires", query.Get("expires"))
+	}
+	expected := r.signature(method, bucket, objectName, contentType, size, expires)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return utils.SignedUrlInvalidResponse.Clone().
+			WithReason("signature", "signature does not match")
+	}
+	return nil
+}
+
+// blobObject serves an object held in memory or a file through the
+// ports.S3Object interface.
+type blobObject struct {
+	io.ReadSeeker
+	closer io.Closer
+	info   ports.S3ObjectInfo
+}
+
+func (o *blobObject) Info() ports.S3ObjectInfo {
+	return o.info
+}
+
+func (o *blobObject) Close() error {
+	if o.closer == nil {
+		return nil
+	}
+	return o.closer.Close()
+}
+
+func newBlobObjectInfo(contentType string, data []byte, metadata map[string]string) ports.S3ObjectInfo {
+	sum := md5.Sum(data)
+	info := ports.S3ObjectInfo{
+		Size:         int64(len(data)),
+		ContentType:  contentType,
+		ETag:         hex.EncodeToString(sum[:]),
+		LastModified: time.Now().UTC(),
+	}
+	if len(metadata) > 0 {
+		info.Metadata = make(map[string]string, len(metadata))
+		for k, v := range metadata {
+			info.Metadata[k] = v
+		}
+	}
+	return info
+}
+
+// validObjectPath rejects bucket and object names that could escape the
+// store's namespace once joined into a path.
+func validObjectPath(bucket, objectName string) (err error) {
+	if bucket == "" || strings.ContainsAny(bucket, "/\\") || strings.HasPrefix(bucket, ".") {
+		return utils.BadRequestResponse.Clone().
+			WithReason("bucket", bucket)
+	}
+	if objectName == "" || strings.HasPrefix(objectName, "/") || strings.Contains(objectName, "\\") {
+		return utils.BadRequestResponse.Clone().
+			WithReason("object_name", objectName)
+	}
+	for segment := range strings.SplitSeq(objectName, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return utils.BadRequestResponse.Clone().
+				WithReason("object_name", objectName)
+		}
+	}
+	return nil
+}
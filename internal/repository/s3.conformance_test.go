@@ -0,0 +1,528 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+// s3ConformanceChecks are the behaviours every ports.S3Repo implementation
+// must provide. Checks only touch objects they create themselves and remove
+// them again, so they can run against a shared MinIO.
+var s3ConformanceChecks = []struct {
+	name string
+	run  func(ctx context.Context, repo ports.S3Repo) error
+}{
+	{"missing avatar is nil", checkMissingAvatar},
+	{"avatar round trip", checkAvatarRoundTrip},
+	{"avatar hash is deterministic", checkAvatarHashDeterministic},
+	{"avatar delete is idempotent", checkAvatarDelete},
+	{"avatar objects are listed", checkAvatarListing},
+	{"missing upload is nil", checkMissingUpload},
+	{"presigned upload round trip", checkUploadRoundTrip},
+	{"upload size limit", checkUploadSizeLimit},
+	{"upload objects are listed", checkUploadListing},
+	{"media lifecycle", checkMediaLifecycle},
+}
+
+// TestS3Conformance runs the checks against the memory and fs backends, and
+// against MinIO when S3_CONFORMANCE_MINIO is set, with the MINIO_* variables
+// pointing at it.
+func TestS3Conformance(t *testing.T) {
+	backends := []struct {
+		name    string
+		newRepo func(t *testing.T) ports.S3Repo
+	}{
+		{"memory", func(t *testing.T) ports.S3Repo {
+			return NewMemoryS3Repo(utils.NewLogger())
+		}},
+		{"fs", func(t *testing.T) ports.S3Repo {
+			t.Setenv("STORAGE_FS_ROOT", t.TempDir())
+			t.Setenv("STORAGE_SIGNING_KEY", "conformance")
+			t.Setenv("STORAGE_PUBLIC_URL", "http://localhost/"+string(ports.LatestVersion)+"/s3/objects")
+			return NewFsS3Repo(utils.NewLogger())
+		}},
+		{"minio", func(t *testing.T) ports.S3Repo {
+			if os.Getenv("S3_CONFORMANCE_MINIO") == "" {
+				t.Skip("S3_CONFORMANCE_MINIO is not set")
+			}
+			return NewMinioS3Repo(utils.NewLogger())
+		}},
+	}
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			repo := backend.newRepo(t)
+			for _, check := range s3ConformanceChecks {
+				t.Run(check.name, func(t *testing.T) {
+					if err := check.run(t.Context(), repo); err != nil {
+						t.Fatal(err)
+					}
+				})
+			}
+		})
+	}
+}
+
+func checkMissingAvatar(ctx context.Context, repo ports.S3Repo) (err error) {
+	for _, format := range ports.AvatarFormats {
+		avatar, err := repo.GetAvatar(ctx, uuid.New(), ports.ClientUserType, ports.AvatarSizes[0], format)
+		if err != nil {
+			return err
+		}
+		if avatar != nil {
+			_ = avatar.Close()
+			return fmt.Errorf("got an avatar for an unknown user")
+		}
+	}
+	return nil
+}
+
+func checkAvatarRoundTrip(ctx context.Context, repo ports.S3Repo) (err error) {
+	id := uuid.New()
+	img := conformanceImage()
+	hash, err := repo.UploadAvatar(ctx, id, ports.ClientUserType, &img)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = repo.DeleteAvatar(ctx, id, ports.ClientUserType) }()
+	if len(hash) != ports.AvatarHashLength {
+		return fmt.Errorf("hash %q is not %d characters long", hash, ports.AvatarHashLength)
+	}
+	for _, size := range ports.AvatarSizes {
+		for _, format := range ports.AvatarFormats {
+			if err = checkAvatarVariant(ctx, repo, id, size, format, hash); err != nil {
+				return fmt.Errorf("%d.%s: %w", size, format, err)
+			}
+		}
+	}
+	return nil
+}
+
+func checkAvatarVariant(ctx context.Context, repo ports.S3Repo, id uuid.UUID, size int, format ports.AvatarFormat, hash string) (err error) {
+	avatar, err := repo.GetAvatar(ctx, id, ports.ClientUserType, size, format)
+	if err != nil {
+		return err
+	}
+	if avatar == nil {
+		return fmt.Errorf("variant is missing")
+	}
+	defer func() { _ = avatar.Close() }()
+	info := avatar.Info()
+	if info.ContentType != format.ContentType() {
+		return fmt.Errorf("content type is %q, want %q", info.ContentType, format.ContentType())
+	}
+	if info.ETag == "" {
+		return fmt.Errorf("etag is empty")
+	}
+	if info.LastModified.IsZero() {
+		return fmt.Errorf("last modified is not set")
+	}
+	if got := conformanceMetadata(info.Metadata, ports.AvatarHashMetadataKey); got != hash {
+		return fmt.Errorf("hash metadata is %q, want %q", got, hash)
+	}
+	data, err := io.ReadAll(avatar)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != info.Size {
+		return fmt.Errorf("read %d bytes, info says %d", len(data), info.Size)
+	}
+	if format == ports.PngAvatarFormat {
+		cfg, err := png.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		if cfg.Width != size || cfg.Height != size {
+			return fmt.Errorf("image is %dx%d", cfg.Width, cfg.Height)
+		}
+	}
+	offset := info.Size / 2
+	if _, err = avatar.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	tail, err := io.ReadAll(avatar)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(tail, data[offset:]) {
+		return fmt.Errorf("reading after a seek returned other bytes")
+	}
+	return nil
+}
+
+func checkAvatarHashDeterministic(ctx context.Context, repo ports.S3Repo) (err error) {
+	id := uuid.New()
+	img := conformanceImage()
+	defer func() { _ = repo.DeleteAvatar(ctx, id, ports.ClientUserType) }()
+	first, err := repo.UploadAvatar(ctx, id, ports.ClientUserType, &img)
+	if err != nil {
+		return err
+	}
+	second, err := repo.UploadAvatar(ctx, id, ports.ClientUserType, &img)
+	if err != nil {
+		return err
+	}
+	if first != second {
+		return fmt.Errorf("same image hashed to %q and %q", first, second)
+	}
+	return nil
+}
+
+func checkAvatarDelete(ctx context.Context, repo ports.S3Repo) (err error) {
+	id := uuid.New()
+	img := conformanceImage()
+	if _, err = repo.UploadAvatar(ctx, id, ports.ClientUserType, &img); err != nil {
+		return err
+	}
+	if err = repo.DeleteAvatar(ctx, id, ports.ClientUserType); err != nil {
+		return err
+	}
+	if err = repo.DeleteAvatar(ctx, id, ports.ClientUserType); err != nil {
+		return fmt.Errorf("deleting a deleted avatar: %w", err)
+	}
+	return checkMissingVariants(ctx, repo, id)
+}
+
+func checkMissingVariants(ctx context.Context, repo ports.S3Repo, id uuid.UUID) (err error) {
+	for _, size := range ports.AvatarSizes {
+		for _, format := range ports.AvatarFormats {
+			avatar, err := repo.GetAvatar(ctx, id, ports.ClientUserType, size, format)
+			if err != nil {
+				return err
+			}
+			if avatar != nil {
+				_ = avatar.Close()
+				return fmt.Errorf("%d.%s is still there", size, format)
+			}
+		}
+	}
+	return nil
+}
+
+func checkAvatarListing(ctx context.Context, repo ports.S3Repo) (err error) {
+	id := uuid.New()
+	img := conformanceImage()
+	if _, err = repo.UploadAvatar(ctx, id, ports.ClientUserType, &img); err != nil {
+		return err
+	}
+	defer func() { _ = repo.DeleteAvatar(ctx, id, ports.ClientUserType) }()
+	listed, err := conformanceListAvatars(ctx, repo, id)
+	if err != nil {
+		return err
+	}
+	for _, objectName := range avatarObjectNames(id, ports.ClientUserType)[1:] {
+		info, ok := listed[objectName]
+		if !ok {
+			return fmt.Errorf("%s is not listed", objectName)
+		}
+		if info.Size == 0 || info.LastModified.IsZero() {
+			return fmt.Errorf("%s is listed without size or modification time", objectName)
+		}
+	}
+	removed := ports.AvatarObjectName(id, ports.ClientUserType, ports.AvatarSizes[0], ports.PngAvatarFormat)
+	if err = repo.DeleteAvatarObject(ctx, removed); err != nil {
+		return err
+	}
+	if listed, err = conformanceListAvatars(ctx, repo, id); err != nil {
+		return err
+	}
+	if _, ok := listed[removed]; ok {
+		return fmt.Errorf("%s is listed after DeleteAvatarObject", removed)
+	}
+	if len(listed) != len(ports.AvatarSizes)*len(ports.AvatarFormats)-1 {
+		return fmt.Errorf("DeleteAvatarObject removed %d objects", len(ports.AvatarSizes)*len(ports.AvatarFormats)-len(listed))
+	}
+	return nil
+}
+
+func conformanceListAvatars(ctx context.Context, repo ports.S3Repo, id uuid.UUID) (listed map[string]ports.S3ObjectInfo, err error) {
+	listed = map[string]ports.S3ObjectInfo{}
+	err = repo.IterateAvatarObjects(ctx, func(objectName string, info ports.S3ObjectInfo) error {
+		if owner, _, ok := ports.ParseAvatarObjectPath(objectName); ok && owner == id {
+			listed[objectName] = info
+		}
+		return nil
+	})
+	return listed, err
+}
+
+func checkMissingUpload(ctx context.Context, repo ports.S3Repo) (err error) {
+	objectName := conformanceUploadName()
+	data, contentType, err := repo.GetUpload(ctx, objectName, 1024)
+	if err != nil {
+		return err
+	}
+	if data != nil || contentType != "" {
+		return fmt.Errorf("GetUpload returned an object")
+	}
+	head, size, err := repo.PeekUpload(ctx, objectName, 16)
+	if err != nil {
+		return err
+	}
+	if head != nil || size != 0 {
+		return fmt.Errorf("PeekUpload returned an object")
+	}
+	return repo.DeleteUpload(ctx, objectName)
+}
+
+func checkUploadRoundTrip(ctx context.Context, repo ports.S3Repo) (err error) {
+	objectName := conformanceUploadName()
+	data := conformancePayload()
+	if err = conformancePut(ctx, repo, objectName, "text/plain", data); err != nil {
+		return err
+	}
+	defer func() { _ = repo.DeleteUpload(ctx, objectName) }()
+	got, contentType, err := repo.GetUpload(ctx, objectName, int64(len(data)))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, data) {
+		return fmt.Errorf("GetUpload returned other bytes")
+	}
+	if contentType != "text/plain" {
+		return fmt.Errorf("content type is %q", contentType)
+	}
+	head, size, err := repo.PeekUpload(ctx, objectName, 8)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(head, data[:8]) || size != int64(len(data)) {
+		return fmt.Errorf("PeekUpload returned %d bytes of %d", len(head), size)
+	}
+	head, _, err = repo.PeekUpload(ctx, objectName, int64(len(data))+100)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(head, data) {
+		return fmt.Errorf("PeekUpload past the end returned %d bytes", len(head))
+	}
+	if err = repo.DeleteUpload(ctx, objectName); err != nil {
+		return err
+	}
+	if got, _, err = repo.GetUpload(ctx, objectName, int64(len(data))); err != nil || got != nil {
+		return fmt.Errorf("upload survived DeleteUpload (err: %v)", err)
+	}
+	return nil
+}
+
+func checkUploadSizeLimit(ctx context.Context, repo ports.S3Repo) (err error) {
+	objectName := conformanceUploadName()
+	data := conformancePayload()
+	if err = conformancePut(ctx, repo, objectName, "text/plain", data); err != nil {
+		return err
+	}
+	defer func() { _ = repo.DeleteUpload(ctx, objectName) }()
+	if _, _, err = repo.GetUpload(ctx, objectName, int64(len(data))-1); err == nil {
+		return fmt.Errorf("GetUpload ignored maxSize")
+	}
+	// A body that does not match the signed size must be refused.
+	mismatched := conformanceUploadName()
+	uploadUrl, headers, err := repo.PresignUpload(ctx, mismatched, "text/plain", int64(len(data)), time.Minute)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = repo.DeleteUpload(ctx, mismatched) }()
+	if err = conformanceSend(ctx, repo, uploadUrl, mismatched, headers["Content-Type"], data[1:]); err == nil {
+		return fmt.Errorf("presigned url accepted a body of another size")
+	}
+	return nil
+}
+
+func checkUploadListing(ctx context.Context, repo ports.S3Repo) (err error) {
+	objectName := conformanceUploadName()
+	if err = conformancePut(ctx, repo, objectName, "text/plain", conformancePayload()); err != nil {
+		return err
+	}
+	defer func() { _ = repo.DeleteUpload(ctx, objectName) }()
+	found := false
+	err = repo.IterateUploadObjects(ctx, func(name string, info ports.S3ObjectInfo) error {
+		if name == objectName {
+			found = true
+			if time.Since(info.LastModified) > time.Hour || time.Until(info.LastModified) > time.Hour {
+				return fmt.Errorf("%s was last modified at %s", name, info.LastModified)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%s is not listed", objectName)
+	}
+	return nil
+}
+
+func checkMediaLifecycle(ctx context.Context, repo ports.S3Repo) (err error) {
+	for range 2 {
+		if err = repo.EnsureMediaBuckets(ctx); err != nil {
+			return err
+		}
+	}
+	purpose := ports.MediaPurposes()[0]
+	objectName := conformanceUploadName()
+	dstObjectName := "conformance/" + uuid.NewString()
+	data := conformancePayload()
+	if err = conformancePut(ctx, repo, objectName, "application/octet-stream", data); err != nil {
+		return err
+	}
+	defer func() { _ = repo.DeleteUpload(ctx, objectName) }()
+	if err = repo.PromoteUpload(ctx, objectName, purpose, dstObjectName, "text/plain"); err != nil {
+		return err
+	}
+	defer func() { _ = repo.DeleteMedia(ctx, purpose, dstObjectName) }()
+	if got, _, err := repo.GetUpload(ctx, objectName, int64(len(data))); err != nil || got != nil {
+		return fmt.Errorf("upload survived PromoteUpload (err: %v)", err)
+	}
+	downloadUrl, err := repo.PresignMediaDownload(ctx, purpose, dstObjectName, time.Minute)
+	if err != nil {
+		return err
+	}
+	got, contentType, found, err := conformanceGet(ctx, repo, downloadUrl, dstObjectName)
+	if err != nil {
+		return err
+	}
+	if !found || !bytes.Equal(got, data) {
+		return fmt.Errorf("presigned download returned other bytes")
+	}
+	if contentType != "text/plain" {
+		return fmt.Errorf("promoted content type is %q", contentType)
+	}
+	if err = repo.DeleteMedia(ctx, purpose, dstObjectName); err != nil {
+		return err
+	}
+	if err = repo.DeleteMedia(ctx, purpose, dstObjectName); err != nil {
+		return fmt.Errorf("deleting deleted media: %w", err)
+	}
+	if _, _, found, err = conformanceGet(ctx, repo, downloadUrl, dstObjectName); err != nil || found {
+		return fmt.Errorf("media survived DeleteMedia (err: %v)", err)
+	}
+	return nil
+}
+
+// conformancePut uploads data the way a client would, through a presigned url.
+func conformancePut(ctx context.Context, repo ports.S3Repo, objectName, contentType string, data []byte) (err error) {
+	uploadUrl, headers, err := repo.PresignUpload(ctx, objectName, contentType, int64(len(data)), time.Minute)
+	if err != nil {
+		return err
+	}
+	if headers["Content-Type"] != contentType || headers["Content-Length"] != strconv.Itoa(len(data)) {
+		return fmt.Errorf("presigned headers are %v", headers)
+	}
+	return conformanceSend(ctx, repo, uploadUrl, objectName, contentType, data)
+}
+
+func conformanceSend(ctx context.Context, repo ports.S3Repo, rawUrl, objectName, contentType string, data []byte) (err error) {
+	if store, ok := repo.(ports.SignedObjectStore); ok {
+		bucket, query, err := splitSignedUrl(rawUrl, objectName)
+		if err != nil {
+			return err
+		}
+		return store.PutSignedObject(ctx, bucket, objectName, query, contentType, data)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, rawUrl, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("presigned upload returned %s", resp.Status)
+	}
+	return nil
+}
+
+func conformanceGet(ctx context.Context, repo ports.S3Repo, rawUrl, objectName string) (data []byte, contentType string, found bool, err error) {
+	if store, ok := repo.(ports.SignedObjectStore); ok {
+		bucket, query, err := splitSignedUrl(rawUrl, objectName)
+		if err != nil {
+			return nil, "", false, err
+		}
+		obj, err := store.GetSignedObject(ctx, bucket, objectName, query)
+		if err != nil || obj == nil {
+			return nil, "", false, err
+		}
+		defer func() { _ = obj.Close() }()
+		data, err = io.ReadAll(obj)
+		return data, obj.Info().ContentType, true, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return nil, "", false, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", false, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", false, nil
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, "", false, fmt.Errorf("presigned download returned %s", resp.Status)
+	}
+	data, err = io.ReadAll(resp.Body)
+	return data, resp.Header.Get("Content-Type"), true, err
+}
+
+// splitSignedUrl recovers the bucket and query a SignedObjectStore url was
+// made from; the bucket is the path segment right before the object name.
+func splitSignedUrl(rawUrl, objectName string) (bucket string, query url.Values, err error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", nil, err
+	}
+	prefix, found := strings.CutSuffix(u.Path, "/"+objectName)
+	if !found {
+		return "", nil, fmt.Errorf("url %s does not end with %s", rawUrl, objectName)
+	}
+	return path.Base(prefix), u.Query(), nil
+}
+
+func conformanceUploadName() string {
+	return "conformance/" + uuid.NewString()
+}
+
+func conformancePayload() []byte {
+	return []byte(strings.Repeat("kasragay s3 conformance\n", 64))
+}
+
+// conformanceImage is a non-square gradient, so variants exercise cropping.
+func conformanceImage() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 300, 200))
+	for y := range 200 {
+		for x := range 300 {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func conformanceMetadata(metadata map[string]string, key string) string {
+	for k, v := range metadata {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
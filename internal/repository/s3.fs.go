@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bytedance/sonic"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+// fsMetaDir holds the object metadata next to the buckets. Bucket names may
+// not start with a dot, so it can never collide with one.
+const fsMetaDir = ".meta"
+
+// fsBlobStore keeps every bucket as a directory under root and each object's
+// info as a JSON sidecar under root/.meta. Writes go through a temporary file
+// and a rename, so readers never see a partial object.
+type fsBlobStore struct {
+	root string
+}
+
+func NewFsS3Repo(logger *utils.Logger) ports.S3Repo {
+	root := os.Getenv("STORAGE_FS_ROOT")
+	if root == "" {
+		logger.Fatal(context.Background(), "STORAGE_FS_ROOT is not set")
+	}
+	if err := os.MkdirAll(filepath.Join(root, fsMetaDir), 0o750); err != nil {
+		logger.Fatalf(context.Background(), "Failed to create STORAGE_FS_ROOT: %v", err)
+	}
+	return newBlobS3(logger, &fsBlobStore{root: root}, true)
+}
+
+func (s *fsBlobStore) put(ctx context.Context, bucket, objectName, contentType string, data []byte, metadata map[string]string) (err error) {
+	if err = validObjectPath(bucket, objectName); err != nil {
+		return err
+	}
+	info, err := sonic.Marshal(newBlobObjectInfo(contentType, data, metadata))
+	if err != nil {
+		return err
+	}
+	if err = writeFileAtomic(s.metaPath(bucket, objectName), info); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.objectPath(bucket, objectName), data)
+}
+
+func (s *fsBlobStore) open(ctx context.Context, bucket, objectName string) (object ports.S3Object, err error) {
+	if validObjectPath(bucket, objectName) != nil {
+		return nil, nil
+	}
+	file, err := os.Open(s.objectPath(bucket, objectName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	info, err := s.readInfo(bucket, objectName)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &blobObject{ReadSeeker: file, closer: file, info: info}, nil
+}
+
+func (s *fsBlobStore) remove(ctx context.Context, bucket, objectName string) (err error) {
+	if validObjectPath(bucket, objectName) != nil {
+		return nil
+	}
+	for _, path := range []string{s.objectPath(bucket, objectName), s.metaPath(bucket, objectName)} {
+		if err = os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	s.prune(bucket, objectName)
+	return nil
+}
+
+func (s *fsBlobStore) move(ctx context.Context, srcBucket, srcObjectName, dstBucket, dstObjectName, contentType string) (err error) {
+	if err = validObjectPath(srcBucket, srcObjectName); err != nil {
+		return err
+	}
+	if err = validObjectPath(dstBucket, dstObjectName); err != nil {
+		return err
+	}
+	info, err := s.readInfo(srcBucket, srcObjectName)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return utils.NotFoundResponse.Clone().
+				WithReason("object_name", srcObjectName)
+		}
+		return err
+	}
+	info.ContentType = contentType
+	info.Metadata = nil
+	meta, err := sonic.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err = writeFileAtomic(s.metaPath(dstBucket, dstObjectName), meta); err != nil {
+		return err
+	}
+	dst := s.objectPath(dstBucket, dstObjectName)
+	if err = os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return err
+	}
+	if err = os.Rename(s.objectPath(srcBucket, srcObjectName), dst); err != nil {
+		return err
+	}
+	if err = os.Remove(s.metaPath(srcBucket, srcObjectName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	s.prune(srcBucket, srcObjectName)
+	return nil
+}
+
+func (s *fsBlobStore) ensureBucket(ctx context.Context, bucket string) (err error) {
+	if err = validObjectPath(bucket, "-"); err != nil {
+		return err
+	}
+	return os.MkdirAll(filepath.Join(s.root, bucket), 0o750)
+}
+
+func (s *fsBlobStore) list(ctx context.Context, bucket string, fn func(objectName string, info ports.S3ObjectInfo) error) (err error) {
+	root := filepath.Join(s.root, bucket)
+	if _, err = os.Stat(root); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Dot files are temporaries of writes still in progress.
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		objectName := filepath.ToSlash(rel)
+		info, err := s.readInfo(bucket, objectName)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		return fn(objectName, info)
+	})
+}
+
+// readInfo loads the sidecar of an object. Objects copied into the root by
+// hand have none, so their info is derived from the file instead.
+func (s *fsBlobStore) readInfo(bucket, objectName string) (info ports.S3ObjectInfo, err error) {
+	data, err := os.ReadFile(s.metaPath(bucket, objectName))
+	if err == nil {
+		err = sonic.Unmarshal(data, &info)
+		return info, err
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return info, err
+	}
+	stat, err := os.Stat(s.objectPath(bucket, objectName))
+	if err != nil {
+		return info, err
+	}
+	return ports.S3ObjectInfo{
+		Size:         stat.Size(),
+		ContentType:  "application/octet-stream",
+		LastModified: stat.ModTime().UTC(),
+	}, nil
+}
+
+// prune removes the directories left empty by deleting an object, stopping at
+// the bucket. Failures are ignored since another object may have just been
+// written next to it.
+func (s *fsBlobStore) prune(bucket, objectName string) {
+	for _, base := range []string{filepath.Join(s.root, bucket), filepath.Join(s.root, fsMetaDir, bucket)} {
+		dir := filepath.Dir(filepath.Join(base, filepath.FromSlash(objectName)))
+		for dir != base && strings.HasPrefix(dir, base) {
+			if os.Remove(dir) != nil {
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+	}
+}
+
+func (s *fsBlobStore) objectPath(bucket, objectName string) string {
+	return filepath.Join(s.root, bucket, filepath.FromSlash(objectName))
+}
+
+func (s *fsBlobStore) metaPath(bucket, objectName string) string {
+	return filepath.Join(s.root, fsMetaDir, bucket, filepath.FromSlash(objectName)+".json")
+}
+
+func writeFileAtomic(path string, data []byte) (err error) {
+	if err = os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
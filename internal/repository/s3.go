@@ -3,10 +3,15 @@ package repository
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"image"
-	"image/png"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/kasragay/backend/internal/ports"
@@ -20,10 +25,29 @@ const s3Caller = packageCaller + ".S3"
 type S3 struct {
 	logger        *utils.Logger
 	client        *minio.Client
+	presigner     *minio.Client
 	avatarsBucket string
+	uploadsBucket string
+	mediaPrefix   string
 }
 
+// NewS3Repo returns the object storage backend selected by STORAGE_BACKEND,
+// defaulting to MinIO.
 func NewS3Repo(logger *utils.Logger) ports.S3Repo {
+	switch backend := ports.StorageBackend(os.Getenv("STORAGE_BACKEND")); backend {
+	case "", ports.MinioStorageBackend:
+		return NewMinioS3Repo(logger)
+	case ports.FsStorageBackend:
+		return NewFsS3Repo(logger)
+	case ports.MemoryStorageBackend:
+		return NewMemoryS3Repo(logger)
+	default:
+		logger.Fatalf(context.Background(), "STORAGE_BACKEND %q is not one of %v", backend, ports.StorageBackends)
+		return nil
+	}
+}
+
+func NewMinioS3Repo(logger *utils.Logger) ports.S3Repo {
 	port := os.Getenv("MINIO_PORT")
 	if port == "" {
 		logger.Fatal(context.Background(), "MINIO_PORT is not set")
@@ -61,49 +85,95 @@ func NewS3Repo(logger *utils.Logger) ports.S3Repo {
 	if avatarsBucket == "" {
 		logger.Fatal(context.Background(), "MINIO_AVATAR_BUCKET is not set")
 	}
+	uploadsBucket := os.Getenv("MINIO_UPLOADS_BUCKET")
+	if uploadsBucket == "" {
+		logger.Fatal(context.Background(), "MINIO_UPLOADS_BUCKET is not set")
+	}
+	mediaPrefix := os.Getenv("MINIO_MEDIA_BUCKET_PREFIX")
+	if mediaPrefix == "" {
+		mediaPrefix = "media-"
+	}
+	region := os.Getenv("MINIO_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	// Presigned urls are handed to clients, so they must be signed for the
+	// publicly reachable host rather than the internal one.
+	presigner := minioClient
+	if publicEndpoint := os.Getenv("MINIO_PUBLIC_ENDPOINT"); publicEndpoint != "" {
+		publicUrl, err := url.Parse(publicEndpoint)
+		if err != nil || publicUrl.Host == "" {
+			logger.Fatal(context.Background(), "MINIO_PUBLIC_ENDPOINT is not a valid url")
+		}
+		presigner, err = minio.New(publicUrl.Host, &minio.Options{
+			Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+			Secure: publicUrl.Scheme == "https",
+			Region: region,
+		})
+		if err != nil {
+			logger.Fatalf(context.Background(), "Failed to create MinIO presigner: %v", err)
+		}
+	}
 	return &S3{
 		logger:        logger,
 		client:        minioClient,
+		presigner:     presigner,
 		avatarsBucket: avatarsBucket,
+		uploadsBucket: uploadsBucket,
+		mediaPrefix:   mediaPrefix,
 	}
 }
 
-func (r *S3) UploadAvatar(ctx context.Context, userId uuid.UUID, userType ports.UserType, img *image.Image) (err error) {
+func (r *S3) UploadAvatar(ctx context.Context, userId uuid.UUID, userType ports.UserType, img *image.Image) (hash string, err error) {
 	defer func() { err = utils.FuncPipe(s3Caller+".UploadAvatar", err) }()
-	return r.uploadImage(ctx, r.avatarsBucket, string(userType)+"/"+userId.String()+".png", img)
+	variants, hash, err := encodeAvatarVariants(userId, userType, img)
+	if err != nil {
+		return "", err
+	}
+	for _, v := range variants {
+		if err = r.uploadObject(ctx, r.avatarsBucket, v.objectName, v.contentType, v.data, map[string]string{ports.AvatarHashMetadataKey: hash}); err != nil {
+			return "", err
+		}
+	}
+	return hash, nil
 }
 
 func (r *S3) DeleteAvatar(ctx context.Context, userId uuid.UUID, userType ports.UserType) (err error) {
 	defer func() { err = utils.FuncPipe(s3Caller+".DeleteAvatar", err) }()
-	if err = r.client.RemoveObject(ctx, r.avatarsBucket, string(userType)+"/"+userId.String()+".png", minio.RemoveObjectOptions{}); err != nil {
-		return err
+	for _, objectName := range avatarObjectNames(userId, userType) {
+		if err = r.client.RemoveObject(ctx, r.avatarsBucket, objectName, minio.RemoveObjectOptions{}); err != nil {
+			return err
+		}
 	}
-	r.logger.Infof(ctx, "deleted %s from bucket %s", string(userType)+"/"+userId.String()+".png", r.avatarsBucket)
+	r.logger.Infof(ctx, "deleted avatar variants of %s/%s from bucket %s", string(userType), userId.String(), r.avatarsBucket)
 	return nil
 }
 
-func (r *S3) uploadImage(ctx context.Context, bucketName, objectName string, img *image.Image) (err error) {
-	defer func() { err = utils.FuncPipe(s3Caller+".uploadImage", err) }()
-	var buf bytes.Buffer
-	encoder := png.Encoder{
-		CompressionLevel: png.BestCompression,
-	}
-	if err = encoder.Encode(&buf, *img); err != nil {
-		return utils.BadRequestResponse.Clone().
-			WithReason("error", "error encoding image")
+func (r *S3) DeleteAvatarObject(ctx context.Context, objectName string) (err error) {
+	defer func() { err = utils.FuncPipe(s3Caller+".DeleteAvatarObject", err) }()
+	if err = r.client.RemoveObject(ctx, r.avatarsBucket, objectName, minio.RemoveObjectOptions{}); err != nil {
+		return err
 	}
-	size := int64(buf.Len())
-	reader := bytes.NewReader(buf.Bytes())
-	contentType := "image/png"
+	r.logger.Infof(ctx, "deleted %s from bucket %s", objectName, r.avatarsBucket)
+	return nil
+}
 
+func (r *S3) IterateAvatarObjects(ctx context.Context, fn func(objectName string, info ports.S3ObjectInfo) error) (err error) {
+	defer func() { err = utils.FuncPipe(s3Caller+".IterateAvatarObjects", err) }()
+	return r.iterateObjects(ctx, r.avatarsBucket, fn)
+}
+
+func (r *S3) uploadObject(ctx context.Context, bucketName, objectName, contentType string, data []byte, metadata map[string]string) (err error) {
+	defer func() { err = utils.FuncPipe(s3Caller+".uploadObject", err) }()
 	_, err = r.client.PutObject(
 		ctx,
 		bucketName,
 		objectName,
-		reader,
-		size,
+		bytes.NewReader(data),
+		int64(len(data)),
 		minio.PutObjectOptions{
-			ContentType: contentType,
+			ContentType:  contentType,
+			UserMetadata: metadata,
 		},
 	)
 	if err != nil {
@@ -112,14 +182,265 @@ func (r *S3) uploadImage(ctx context.Context, bucketName, objectName string, img
 	r.logger.Infof(ctx, "uploaded %s to bucket %s", objectName, bucketName)
 	return nil
 }
-func (r *S3) GetAvatar(ctx context.Context, userId uuid.UUID, userType ports.UserType) (avatar *minio.Object, err error) {
+
+// GetAvatar opens the variant of the avatar, or the legacy single object of
+// an avatar uploaded before variants, whatever the size and format asked.
+func (r *S3) GetAvatar(ctx context.Context, userId uuid.UUID, userType ports.UserType, size int, format ports.AvatarFormat) (avatar ports.S3Object, err error) {
 	defer func() { err = utils.FuncPipe(s3Caller+".GetAvatar", err) }()
-	avatar, err = r.client.GetObject(context.Background(), r.avatarsBucket, string(userType)+"/"+userId.String()+".png", minio.GetObjectOptions{})
+	avatar, err = r.getAvatarObject(ctx, ports.AvatarObjectName(userId, userType, size, format))
+	if err != nil || avatar != nil {
+		return avatar, err
+	}
+	return r.getAvatarObject(ctx, ports.LegacyAvatarObjectName(userId, userType))
+}
+
+func (r *S3) getAvatarObject(ctx context.Context, objectName string) (avatar ports.S3Object, err error) {
+	obj, err := r.client.GetObject(ctx, r.avatarsBucket, objectName, minio.GetObjectOptions{})
 	if err != nil {
 		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
 			return nil, nil
 		}
 		return nil, err
 	}
-	return
+	// GetObject is lazy, so a missing object only shows up once it is used.
+	info, err := obj.Stat()
+	if err != nil {
+		_ = obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &minioObject{
+		Object: obj,
+		info: ports.S3ObjectInfo{
+			Size:         info.Size,
+			ContentType:  info.ContentType,
+			ETag:         info.ETag,
+			LastModified: info.LastModified,
+			Metadata:     info.UserMetadata,
+		},
+	}, nil
+}
+
+func (r *S3) PresignUpload(ctx context.Context, objectName, contentType string, size int64, expire time.Duration) (uploadUrl string, headers map[string]string, err error) {
+	defer func() { err = utils.FuncPipe(s3Caller+".PresignUpload", err) }()
+	// Both headers are signed, so storage rejects a body of another length or type.
+	headers = map[string]string{
+		"Content-Type":   contentType,
+		"Content-Length": strconv.FormatInt(size, 10),
+	}
+	signed := http.Header{}
+	for k, v := range headers {
+		signed.Set(k, v)
+	}
+	u, err := r.presigner.PresignHeader(ctx, http.MethodPut, r.uploadsBucket, objectName, expire, nil, signed)
+	if err != nil {
+		return "", nil, err
+	}
+	return u.String(), headers, nil
+}
+
+func (r *S3) GetUpload(ctx context.Context, objectName string, maxSize int64) (data []byte, contentType string, err error) {
+	defer func() { err = utils.FuncPipe(s3Caller+".GetUpload", err) }()
+	info, err := r.client.StatObject(ctx, r.uploadsBucket, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	if info.Size > maxSize {
+		return nil, "", utils.BadRequestResponse.Clone().
+			WithReason("size", info.Size).
+			WithReason("max_size", maxSize)
+	}
+	obj, err := r.client.GetObject(ctx, r.uploadsBucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		_ = obj.Close()
+	}()
+	data, err = io.ReadAll(io.LimitReader(obj, maxSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	return data, info.ContentType, nil
+}
+
+func (r *S3) DeleteUpload(ctx context.Context, objectName string) (err error) {
+	defer func() { err = utils.FuncPipe(s3Caller+".DeleteUpload", err) }()
+	return r.client.RemoveObject(ctx, r.uploadsBucket, objectName, minio.RemoveObjectOptions{})
+}
+
+func (r *S3) PeekUpload(ctx context.Context, objectName string, n int64) (head []byte, size int64, err error) {
+	defer func() { err = utils.FuncPipe(s3Caller+".PeekUpload", err) }()
+	info, err := r.client.StatObject(ctx, r.uploadsBucket, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+	opts := minio.GetObjectOptions{}
+	if err = opts.SetRange(0, min(n, info.Size)-1); err != nil {
+		return nil, 0, err
+	}
+	obj, err := r.client.GetObject(ctx, r.uploadsBucket, objectName, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		_ = obj.Close()
+	}()
+	head, err = io.ReadAll(obj)
+	if err != nil {
+		return nil, 0, err
+	}
+	return head, info.Size, nil
+}
+
+func (r *S3) IterateUploadObjects(ctx context.Context, fn func(objectName string, info ports.S3ObjectInfo) error) (err error) {
+	defer func() { err = utils.FuncPipe(s3Caller+".IterateUploadObjects", err) }()
+	return r.iterateObjects(ctx, r.uploadsBucket, fn)
+}
+
+func (r *S3) EnsureMediaBuckets(ctx context.Context) (err error) {
+	defer func() { err = utils.FuncPipe(s3Caller+".EnsureMediaBuckets", err) }()
+	for _, purpose := range ports.MediaPurposes() {
+		bucket := r.mediaBucket(purpose)
+		exists, err := r.client.BucketExists(ctx, bucket)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if err = r.client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{}); err != nil {
+			return err
+		}
+		r.logger.Infof(ctx, "created bucket %s", bucket)
+	}
+	return nil
+}
+
+func (r *S3) PromoteUpload(ctx context.Context, objectName string, purpose ports.MediaPurpose, dstObjectName, contentType string) (err error) {
+	defer func() { err = utils.FuncPipe(s3Caller+".PromoteUpload", err) }()
+	_, err = r.client.CopyObject(
+		ctx,
+		minio.CopyDestOptions{
+			Bucket:          r.mediaBucket(purpose),
+			Object:          dstObjectName,
+			ReplaceMetadata: true,
+			UserMetadata:    map[string]string{"Content-Type": contentType},
+		},
+		minio.CopySrcOptions{
+			Bucket: r.uploadsBucket,
+			Object: objectName,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	r.logger.Infof(ctx, "promoted %s to bucket %s", objectName, r.mediaBucket(purpose))
+	return r.client.RemoveObject(ctx, r.uploadsBucket, objectName, minio.RemoveObjectOptions{})
+}
+
+func (r *S3) PresignMediaDownload(ctx context.Context, purpose ports.MediaPurpose, objectName string, expire time.Duration) (downloadUrl string, err error) {
+	defer func() { err = utils.FuncPipe(s3Caller+".PresignMediaDownload", err) }()
+	u, err := r.presigner.PresignedGetObject(ctx, r.mediaBucket(purpose), objectName, expire, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (r *S3) DeleteMedia(ctx context.Context, purpose ports.MediaPurpose, objectName string) (err error) {
+	defer func() { err = utils.FuncPipe(s3Caller+".DeleteMedia", err) }()
+	if err = r.client.RemoveObject(ctx, r.mediaBucket(purpose), objectName, minio.RemoveObjectOptions{}); err != nil {
+		return err
+	}
+	r.logger.Infof(ctx, "deleted %s from bucket %s", objectName, r.mediaBucket(purpose))
+	return nil
+}
+
+func (r *S3) IterateMediaObjects(ctx context.Context, purpose ports.MediaPurpose, fn func(objectName string, info ports.S3ObjectInfo) error) (err error) {
+	defer func() { err = utils.FuncPipe(s3Caller+".IterateMediaObjects", err) }()
+	return r.iterateObjects(ctx, r.mediaBucket(purpose), fn)
+}
+
+// iterateObjects calls fn for every object in bucket until fn fails. Listings
+// carry no metadata or content type.
+func (r *S3) iterateObjects(ctx context.Context, bucket string, fn func(objectName string, info ports.S3ObjectInfo) error) (err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for obj := range r.client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		err = fn(obj.Key, ports.S3ObjectInfo{
+			Size:         obj.Size,
+			ETag:         obj.ETag,
+			LastModified: obj.LastModified,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *S3) mediaBucket(purpose ports.MediaPurpose) string {
+	return r.mediaPrefix + string(purpose)
+}
+
+type minioObject struct {
+	*minio.Object
+	info ports.S3ObjectInfo
+}
+
+func (o *minioObject) Info() ports.S3ObjectInfo {
+	return o.info
+}
+
+type avatarVariant struct {
+	objectName  string
+	contentType string
+	data        []byte
+}
+
+// encodeAvatarVariants renders every size and format of an avatar and returns
+// them together with the content hash shared by all of them.
+func encodeAvatarVariants(userId uuid.UUID, userType ports.UserType, img *image.Image) (variants []avatarVariant, hash string, err error) {
+	variants = make([]avatarVariant, 0, len(ports.AvatarSizes)*len(ports.AvatarFormats))
+	hasher := sha256.New()
+	for _, size := range ports.AvatarSizes {
+		for _, format := range ports.AvatarFormats {
+			data, err := utils.EncodeImageVariant(*img, size, string(format))
+			if err != nil {
+				return nil, "", utils.BadRequestResponse.Clone().
+					WithReason("error", "error encoding image")
+			}
+			hasher.Write(data)
+			variants = append(variants, avatarVariant{
+				objectName:  ports.AvatarObjectName(userId, userType, size, format),
+				contentType: format.ContentType(),
+				data:        data,
+			})
+		}
+	}
+	return variants, hex.EncodeToString(hasher.Sum(nil))[:ports.AvatarHashLength], nil
+}
+
+// avatarObjectNames lists every object an avatar may occupy, including the
+// single-object layout that predates variants.
+func avatarObjectNames(userId uuid.UUID, userType ports.UserType) []string {
+	objectNames := []string{ports.LegacyAvatarObjectName(userId, userType)}
+	for _, size := range ports.AvatarSizes {
+		for _, format := range ports.AvatarFormats {
+			objectNames = append(objectNames, ports.AvatarObjectName(userId, userType, size, format))
+		}
+	}
+	return objectNames
 }
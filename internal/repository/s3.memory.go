@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+type memoryBlob struct {
+	data []byte
+	info ports.S3ObjectInfo
+}
+
+// memoryBlobStore keeps objects in process memory. It is meant for tests and
+// throwaway runs: nothing survives a restart and services do not share it.
+type memoryBlobStore struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string]*memoryBlob
+}
+
+func NewMemoryS3Repo(logger *utils.Logger) ports.S3Repo {
+	return newBlobS3(logger, &memoryBlobStore{buckets: map[string]map[string]*memoryBlob{}}, false)
+}
+
+func (s *memoryBlobStore) put(ctx context.Context, bucket, objectName, contentType string, data []byte, metadata map[string]string) (err error) {
+	if err = validObjectPath(bucket, objectName); err != nil {
+		return err
+	}
+	blob := &memoryBlob{
+		data: bytes.Clone(data),
+		info: newBlobObjectInfo(contentType, data, metadata),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buckets[bucket] == nil {
+		s.buckets[bucket] = map[string]*memoryBlob{}
+	}
+	s.buckets[bucket][objectName] = blob
+	return nil
+}
+
+func (s *memoryBlobStore) open(ctx context.Context, bucket, objectName string) (object ports.S3Object, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	blob, ok := s.buckets[bucket][objectName]
+	if !ok {
+		return nil, nil
+	}
+	// Blobs are replaced rather than mutated, so readers can share the data.
+	return &blobObject{ReadSeeker: bytes.NewReader(blob.data), info: blob.info}, nil
+}
+
+func (s *memoryBlobStore) remove(ctx context.Context, bucket, objectName string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.buckets[bucket], objectName)
+	return nil
+}
+
+func (s *memoryBlobStore) move(ctx context.Context, srcBucket, srcObjectName, dstBucket, dstObjectName, contentType string) (err error) {
+	if err = validObjectPath(dstBucket, dstObjectName); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	blob, ok := s.buckets[srcBucket][srcObjectName]
+	if !ok {
+		return utils.NotFoundResponse.Clone().
+			WithReason("object_name", srcObjectName)
+	}
+	moved := &memoryBlob{data: blob.data, info: blob.info}
+	moved.info.ContentType = contentType
+	if s.buckets[dstBucket] == nil {
+		s.buckets[dstBucket] = map[string]*memoryBlob{}
+	}
+	s.buckets[dstBucket][dstObjectName] = moved
+	delete(s.buckets[srcBucket], srcObjectName)
+	return nil
+}
+
+func (s *memoryBlobStore) ensureBucket(ctx context.Context, bucket string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buckets[bucket] == nil {
+		s.buckets[bucket] = map[string]*memoryBlob{}
+	}
+	return nil
+}
+
+func (s *memoryBlobStore) list(ctx context.Context, bucket string, fn func(objectName string, info ports.S3ObjectInfo) error) (err error) {
+	// fn may write to the store, so it runs on a snapshot taken under the lock.
+	s.mu.RLock()
+	objectNames := slices.Sorted(maps.Keys(s.buckets[bucket]))
+	infos := make([]ports.S3ObjectInfo, len(objectNames))
+	for i, objectName := range objectNames {
+		infos[i] = s.buckets[bucket][objectName].info
+	}
+	s.mu.RUnlock()
+	for i, objectName := range objectNames {
+		if err = fn(objectName, infos[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const (
+	// eventsPingInterval keeps idle streams from being cut by proxies, and
+	// finds the clients that went away.
+	eventsPingInterval = 25 * time.Second
+	eventsWriteTimeout = 10 * time.Second
+	// eventsTokenExpiredCloseCode tells WebSocket clients to refresh their
+	// token before reconnecting. Codes from 4000 are left to applications.
+	eventsTokenExpiredCloseCode = 4001
+)
+
+// eventsSession is what a stream needs from the request that opened it, as
+// the request is recycled once the stream takes over the connection.
+type eventsSession struct {
+	login   *ports.Login
+	events  <-chan *ports.Event
+	cancel  func()
+	expired <-chan time.Time
+	stop    func() bool
+}
+
+func (s *GatewayServer) openEventsSession(login *ports.Login) *eventsSession {
+	events, cancel := s.realtime.Subscribe(login.User.Id, login.User.UserType, ports.SessionKey(login.Jwt.AccessToken))
+	// A stream must not outlive the token it was opened with.
+	timer := time.NewTimer(time.Until(login.Jwt.ExpiresAt))
+	return &eventsSession{login: login, events: events, cancel: cancel, expired: timer.C, stop: timer.Stop}
+}
+
+func (e *eventsSession) close() {
+	e.stop()
+	e.cancel()
+}
+
+func (s *GatewayServer) eventsUpgradeMiddleware(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".eventsUpgradeMiddleware", err) }()
+	if !websocket.IsWebSocketUpgrade(c) {
+		return utils.BadRequestResponse.Clone().
+			WithReason("Upgrade", c.Get(fiber.HeaderUpgrade))
+	}
+	return c.Next()
+}
+
+// eventsWsHandler streams events as JSON text messages. The token travels
+// in the request rather than a cookie, so any origin may connect.
+func (s *GatewayServer) eventsWsHandler(conn *websocket.Conn) {
+	session := s.openEventsSession(conn.Locals("login").(*ports.Login))
+	defer session.close()
+
+	// Clients send nothing; reading only processes their pongs and close.
+	gone := make(chan struct{})
+	conn.SetReadLimit(512)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * eventsPingInterval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * eventsPingInterval))
+	})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	closeWith := func(code int, text string) {
+		_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(eventsWriteTimeout))
+	}
+	ping := time.NewTicker(eventsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-gone:
+			return
+		case <-session.expired:
+			closeWith(eventsTokenExpiredCloseCode, "token expired")
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventsWriteTimeout)); err != nil {
+				return
+			}
+		case event, ok := <-session.events:
+			if !ok {
+				closeWith(websocket.CloseTryAgainLater, "fell behind")
+				return
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+			if event.Type == ports.LogoutEventType {
+				closeWith(websocket.CloseNormalClosure, "logged out")
+				return
+			}
+		}
+	}
+}
+
+// eventsSseGetHandler streams events as Server-Sent Events named after their
+// type. The stream just ends on logout, token expiry or falling behind;
+// EventSource reconnects by itself and a revoked token is then refused.
+func (s *GatewayServer) eventsSseGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".eventsSseGetHandler", err) }()
+	session := s.openEventsSession(c.Locals("login").(*ports.Login))
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	// Stops nginx from buffering the stream.
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer session.close()
+		// The comment flushes the headers so the client knows it is connected.
+		if _, err := w.WriteString(": connected\n\n"); err != nil || w.Flush() != nil {
+			return
+		}
+		ping := time.NewTicker(eventsPingInterval)
+		defer ping.Stop()
+		for {
+			select {
+			case <-session.expired:
+				return
+			case <-ping.C:
+				// Writing is the only way to notice the client left.
+				if _, err := w.WriteString(": ping\n\n"); err != nil || w.Flush() != nil {
+					return
+				}
+			case event, ok := <-session.events:
+				if !ok {
+					return
+				}
+				data, err := sonic.Marshal(event)
+				if err != nil {
+					s.Logger().Error(context.Background(), err, "failed to encode event")
+					continue
+				}
+				if _, err := w.WriteString("event: " + string(event.Type) + "\ndata: " + string(data) + "\n\n"); err != nil || w.Flush() != nil {
+					return
+				}
+				if event.Type == ports.LogoutEventType {
+					return
+				}
+			}
+		}
+	})
+	return nil
+}
@@ -48,6 +48,42 @@ func (s *GatewayServer) AuthBearerMiddleware(jwtType ports.JwtType, onlyAdmin bo
 	}
 }
 
+// AuthBearerOrQueryMiddleware takes the token from the token query parameter
+// when the request has no Authorization header. The parameter is removed from
+// the request either way, so nothing after it, like the request log, sees it.
+func (s *GatewayServer) AuthBearerOrQueryMiddleware(jwtType ports.JwtType, onlyAdmin bool) fiber.Handler {
+	bearer := s.AuthBearerMiddleware(jwtType, onlyAdmin)
+	return func(c *fiber.Ctx) (err error) {
+		defer func() {
+			const caller = gatewayServerCaller + ".AuthBearerOrQueryMiddleware"
+			if err != nil {
+				var uErr *utils.Error
+				if errors.As(err, &uErr) {
+					err = uErr.WithCaller(caller)
+				} else {
+					err = utils.NewInternalError(err).WithCaller(caller)
+				}
+			}
+		}()
+		token := c.Query("token")
+		if token != "" {
+			stripQueryToken(c)
+		}
+		if c.Get(fiber.HeaderAuthorization) != "" {
+			return bearer(c)
+		}
+		return s.authMiddleware(token, jwtType, onlyAdmin)(c)
+	}
+}
+
+// stripQueryToken rewrites the request uri without the token query parameter.
+func stripQueryToken(c *fiber.Ctx) {
+	uri := c.Request().URI()
+	uri.QueryArgs().Del("token")
+	uri.SetQueryStringBytes(uri.QueryArgs().QueryString())
+	c.Request().SetRequestURIBytes(uri.RequestURI())
+}
+
 func (s *GatewayServer) authMiddleware(token string, jwtType ports.JwtType, onlyAdmin bool) fiber.Handler {
 	return func(c *fiber.Ctx) (err error) {
 		defer func() {
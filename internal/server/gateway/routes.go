@@ -4,17 +4,21 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"mime"
+	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/favicon"
 	"github.com/gofiber/fiber/v2/middleware/proxy"
 	"github.com/google/uuid"
 	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/server"
 	"github.com/kasragay/backend/internal/utils"
-	"github.com/minio/minio-go/v7"
 	"github.com/valyala/fasthttp"
 )
 
@@ -56,11 +60,45 @@ func (s *GatewayServer) RegisterV1() {
 		string(s.Version()), s.VersionRouter(), ports.GET, "/s3/avatars/:userType/:objectName", s.s3AvatarsGetHandler,
 		20, time.Minute, true, false, false,
 	)
+	// Storage backends without a server of their own hand out presigned urls
+	// that point here instead.
+	if _, ok := s.S3().(ports.SignedObjectStore); ok {
+		s.register(
+			string(s.Version()), s.VersionRouter(), ports.PUT, "/s3/objects/:bucket/*", s.s3ObjectsPutHandler,
+			10, time.Minute, true, false, false,
+		)
+		s.register(
+			string(s.Version()), s.VersionRouter(), ports.GET, "/s3/objects/:bucket/*", s.s3ObjectsGetHandler,
+			60, time.Minute, true, false, false,
+		)
+	}
+	// Delivery receipts are posted by providers, authenticated by signature.
+	webhooks := s.VersionRouter().Group("/webhooks")
+	s.register(
+		"webhooks", webhooks, ports.POST, "/twilio/status", s.webhooksTwilioStatusPostHandler,
+		600, time.Minute, true, false, false,
+		s.ContentTypeMiddleware(fiber.MIMEApplicationForm, fiber.MIMEApplicationForm+"; charset=utf-8"),
+	)
+	s.register(
+		"webhooks", webhooks, ports.POST, "/delivery", s.webhooksDeliveryPostHandler,
+		600, time.Minute, true, false, false,
+		s.ContentTypeMiddleware(fiber.MIMEApplicationJSON, fiber.MIMEApplicationJSONCharsetUTF8),
+	)
+	// Bounces are posted either parsed, as JSON, or as the raw report, so the
+	// handler checks the content type itself.
+	s.register(
+		"webhooks", webhooks, ports.POST, "/bounces", s.webhooksBouncesPostHandler,
+		600, time.Minute, true, false, false,
+	)
 	auth := s.VersionRouter().Group("/auth")
 	s.register(
 		"auth", auth, ports.GET, "/check", s.authCheckPostHandler,
 		10, time.Minute, true, false, false,
 	)
+	s.register(
+		"auth", auth, ports.GET, "/username/redirect", s.authUsernameRedirectGetHandler,
+		20, time.Minute, true, false, false,
+	)
 	s.register(
 		"auth", auth, ports.GET, "/tmp/signup/key", s.tmpAuthSignupKeyGetHandler,
 		3, time.Minute, false, true, true,
@@ -71,6 +109,10 @@ func (s *GatewayServer) RegisterV1() {
 		3, time.Minute, false, true, true,
 		s.AuthBearerMiddleware(ports.AccessJwtType, true),
 	)
+	s.register(
+		"auth", auth, ports.GET, "/messages/:id", s.authMessageGetHandler,
+		30, time.Minute, true, false, false,
+	)
 	s.register(
 		"auth", auth, ports.GET, "/tmp/:otpType/otp", s.tmpAuthMethodOtpGetHandler,
 		3, time.Minute, true, false, false,
@@ -138,9 +180,299 @@ func (s *GatewayServer) RegisterV1() {
 		10, time.Minute, false, true, true,
 		s.AuthBearerMiddleware(ports.AccessJwtType, false),
 	)
+	s.register(
+		"user", user, ports.GET, "/activity", s.userServiceProxyHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"user", user, ports.GET, "/notifications", s.userServiceProxyHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"user", user, ports.POST, "/notifications/read", s.userServiceProxyHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"user", user, ports.GET, "/notifications/preferences", s.userServiceProxyHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"user", user, ports.PUT, "/notifications/preferences", s.userServiceProxyHandler,
+		5, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"user", user, ports.POST, "/avatar/upload", s.userServiceProxyHandler,
+		5, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"user", user, ports.POST, "/avatar/upload/complete", s.userServiceProxyHandler,
+		5, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+
+	// Browsers cannot set headers on WebSocket and EventSource requests, so
+	// the token may also come in the query.
+	events := s.VersionRouter().Group("/events")
+	s.register(
+		"events", events, ports.GET, "/ws", websocket.New(s.eventsWsHandler),
+		10, time.Minute, false, true, true,
+		s.AuthBearerOrQueryMiddleware(ports.AccessJwtType, false),
+		s.eventsUpgradeMiddleware,
+	)
+	s.register(
+		"events", events, ports.GET, "/sse", s.eventsSseGetHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerOrQueryMiddleware(ports.AccessJwtType, false),
+	)
+
+	admin := s.VersionRouter().Group("/admin")
+	s.register(
+		"admin", admin, ports.GET, "/usernames/denylist", s.userServiceProxyHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.POST, "/usernames/denylist", s.userServiceProxyHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.DELETE, "/usernames/denylist", s.userServiceProxyHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.GET, "/users/:userType/:id/activity", s.userServiceProxyHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.GET, "/audit", s.userServiceProxyHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.GET, "/audit/export", s.userServiceProxyHandler,
+		2, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.GET, "/messages", s.adminMessagesGetHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.GET, "/messages/stats", s.adminMessageStatsGetHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.GET, "/messages/:id", s.adminMessageGetHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.POST, "/messages/:id/requeue", s.adminMessageRequeuePostHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.GET, "/mail/stats", s.adminMailStatsGetHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.GET, "/suppressions", s.adminSuppressionsGetHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.DELETE, "/suppressions/:email", s.adminSuppressionDeleteHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.GET, "/webhooks", s.adminWebhooksGetHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.POST, "/webhooks", s.adminWebhooksPostHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+		s.ContentTypeMiddleware(fiber.MIMEApplicationJSON, fiber.MIMEApplicationJSONCharsetUTF8),
+	)
+	s.register(
+		"admin", admin, ports.GET, "/webhooks/:id", s.adminWebhookGetHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.PUT, "/webhooks/:id", s.adminWebhookPutHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+		s.ContentTypeMiddleware(fiber.MIMEApplicationJSON, fiber.MIMEApplicationJSONCharsetUTF8),
+	)
+	s.register(
+		"admin", admin, ports.DELETE, "/webhooks/:id", s.adminWebhookDeleteHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.GET, "/webhooks/:id/deliveries", s.adminWebhookDeliveriesGetHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.GET, "/webhooks/:id/deliveries/:deliveryId", s.adminWebhookDeliveryGetHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.POST, "/webhooks/:id/deliveries/:deliveryId/replay", s.adminWebhookDeliveryReplayPostHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.GET, "/jobs", s.adminJobsGetHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.GET, "/jobs/:name/runs", s.adminJobRunsGetHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.POST, "/jobs/:name/trigger", s.adminJobTriggerPostHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.POST, "/jobs/:name/pause", s.adminJobPausePostHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.POST, "/jobs/:name/resume", s.adminJobResumePostHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.GET, "/templates", s.adminTemplatesGetHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+	)
+	s.register(
+		"admin", admin, ports.POST, "/templates/:name/render", s.adminTemplateRenderPostHandler,
+		60, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+		s.ContentTypeMiddleware(fiber.MIMEApplicationJSON, fiber.MIMEApplicationJSONCharsetUTF8),
+	)
+	s.register(
+		"admin", admin, ports.POST, "/templates/:name/test", s.adminTemplateTestPostHandler,
+		5, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, true),
+		s.ContentTypeMiddleware(fiber.MIMEApplicationJSON, fiber.MIMEApplicationJSONCharsetUTF8),
+	)
+	// Only environments running the sink provider have messages to show.
+	if s.telecom.Sink() != nil {
+		s.register(
+			"admin", admin, ports.GET, "/sms/sink", s.adminSmsSinkGetHandler,
+			30, time.Minute, false, true, true,
+			s.AuthBearerMiddleware(ports.AccessJwtType, true),
+		)
+	}
 
 	client := s.VersionRouter().Group("/client")
-	_ = client
+	s.register(
+		"client", client, ports.GET, "/blocks", s.userServiceProxyHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"client", client, ports.GET, "/users/:id", s.userServiceProxyHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"client", client, ports.GET, "/users/:id/relation", s.userServiceProxyHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"client", client, ports.GET, "/users/:id/followers", s.userServiceProxyHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"client", client, ports.GET, "/users/:id/following", s.userServiceProxyHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"client", client, ports.POST, "/users/:id/follow", s.userServiceProxyHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"client", client, ports.DELETE, "/users/:id/follow", s.userServiceProxyHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"client", client, ports.POST, "/users/:id/block", s.userServiceProxyHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"client", client, ports.DELETE, "/users/:id/block", s.userServiceProxyHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+
+	media := s.VersionRouter().Group("/media")
+	s.register(
+		"media", media, ports.GET, "/", s.mediaServiceProxyHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"media", media, ports.POST, "/upload", s.mediaServiceProxyHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"media", media, ports.POST, "/upload/complete", s.mediaServiceProxyHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"media", media, ports.GET, "/:id", s.mediaServiceProxyHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"media", media, ports.GET, "/:id/download", s.mediaServiceProxyHandler,
+		30, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"media", media, ports.PUT, "/:id/acl", s.mediaServiceProxyHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
+	s.register(
+		"media", media, ports.DELETE, "/:id", s.mediaServiceProxyHandler,
+		10, time.Minute, false, true, true,
+		s.AuthBearerMiddleware(ports.AccessJwtType, false),
+	)
 }
 
 func (s *GatewayServer) register(
@@ -211,16 +543,20 @@ func (s *GatewayServer) s3AvatarsGetHandler(c *fiber.Ctx) (err error) {
 	req := ports.S3AvatarsGetRequest{
 		UserType:   ports.UserType(c.Params("userType")),
 		ObjectName: c.Params("objectName"),
+		Size:       c.QueryInt("size", 0),
 	}
 	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
 		return err
 	}
-	id, err := uuid.Parse(strings.TrimSuffix(req.ObjectName, ".png"))
+	id, ext, err := ports.ParseAvatarObjectName(req.ObjectName)
 	if err != nil {
-		return utils.BadRequestResponse.Clone().
-			WithReason("object_name", req.ObjectName)
+		return err
 	}
-	avatar, err := s.S3().GetAvatar(c.Context(), id, req.UserType)
+	format := ports.NegotiateAvatarFormat(ext, c.Get(fiber.HeaderAccept))
+	if ext == "" {
+		c.Vary(fiber.HeaderAccept)
+	}
+	avatar, err := s.S3().GetAvatar(c.Context(), id, req.UserType, ports.BestAvatarSize(req.Size), format)
 	if err != nil {
 		return err
 	}
@@ -230,36 +566,78 @@ func (s *GatewayServer) s3AvatarsGetHandler(c *fiber.Ctx) (err error) {
 	defer func() {
 		_ = avatar.Close()
 	}()
-	objInfo, err := avatar.Stat()
-	if err != nil {
-		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
-			return utils.NotFoundResponse.Clone()
-		}
-		return err
-	}
+	objInfo := avatar.Info()
 	contentType := objInfo.ContentType
 	if contentType == "" {
 		contentType = "application/octet-stream"
 	}
+	etag := ""
+	if objInfo.ETag != "" {
+		etag = `"` + objInfo.ETag + `"`
+		c.Set(fiber.HeaderETag, etag)
+	}
+	if !objInfo.LastModified.IsZero() {
+		c.Set(fiber.HeaderLastModified, objInfo.LastModified.UTC().Format(http.TimeFormat))
+	}
+	// Versioned URLs carry the content hash, so they never change and can be
+	// cached forever; anything else must be revalidated.
+	if v := c.Query("v"); v != "" && v == avatarHash(objInfo.Metadata) {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+	} else {
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+	}
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	if ifNoneMatch := c.Get(fiber.HeaderIfNoneMatch); ifNoneMatch != "" {
+		if utils.ETagMatches(ifNoneMatch, etag) {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+	} else if utils.NotModifiedSince(c.Get(fiber.HeaderIfModifiedSince), objInfo.LastModified) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
 	c.Set(fiber.HeaderContentType, contentType)
-	c.Set(fiber.HeaderContentLength, strconv.FormatInt(objInfo.Size, 10))
-	c.Set(fiber.HeaderCacheControl, "private, max-age=0") // 1 year
-	buffer := make([]byte, 32*1024)
-	for {
-		n, err := avatar.Read(buffer)
-		if n > 0 {
-			if _, writeErr := c.Response().BodyWriter().Write(buffer[:n]); writeErr != nil {
-				return writeErr
-			}
+	start, end := int64(0), objInfo.Size-1
+	if rangeHeader := c.Get(fiber.HeaderRange); rangeHeader != "" && s.ifRangeMatches(c, etag, objInfo.LastModified) {
+		rStart, rEnd, ok, satisfiable := utils.ParseByteRange(rangeHeader, objInfo.Size)
+		if ok && !satisfiable {
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", objInfo.Size))
+			return c.SendStatus(fiber.StatusRequestedRangeNotSatisfiable)
 		}
-		if err != nil {
-			if err == io.EOF {
-				break
+		if ok {
+			if _, err = avatar.Seek(rStart, io.SeekStart); err != nil {
+				return err
 			}
-			return err
+			start, end = rStart, rEnd
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, end, objInfo.Size))
+			c.Status(fiber.StatusPartialContent)
+		}
+	}
+	c.Set(fiber.HeaderContentLength, strconv.FormatInt(end-start+1, 10))
+	_, err = io.Copy(c.Response().BodyWriter(), io.LimitReader(avatar, end-start+1))
+	return err
+}
+
+// ifRangeMatches reports whether a Range header should be honoured given the
+// request's If-Range validator, which may be either an ETag or an HTTP date.
+func (s *GatewayServer) ifRangeMatches(c *fiber.Ctx, etag string, lastModified time.Time) bool {
+	ifRange := c.Get(fiber.HeaderIfRange)
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		// If-Range requires the strong comparison.
+		return !strings.HasPrefix(ifRange, "W/") && ifRange == etag
+	}
+	since, err := http.ParseTime(ifRange)
+	return err == nil && lastModified.Truncate(time.Second).Equal(since)
+}
+
+func avatarHash(metadata map[string]string) string {
+	for key, value := range metadata {
+		if strings.EqualFold(key, ports.AvatarHashMetadataKey) {
+			return value
 		}
 	}
-	return
+	return ""
 }
 
 func (s *GatewayServer) authCheckPostHandler(c *fiber.Ctx) (err error) {
@@ -279,6 +657,22 @@ func (s *GatewayServer) authCheckPostHandler(c *fiber.Ctx) (err error) {
 
 }
 
+func (s *GatewayServer) authUsernameRedirectGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".authUsernameRedirectGetHandler", err) }()
+	req := ports.AuthUsernameRedirectGetRequest{
+		Username: c.Query("username"),
+		UserType: ports.UserType(c.Query("user_type")),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.auth.UsernameRedirectGet(c.Context(), &req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
 func (s *GatewayServer) tmpAuthSignupKeyGetHandler(c *fiber.Ctx) (err error) {
 	defer func() { err = utils.FuncPipe(gatewayServerCaller+".tmpAuthAdminSignupKeyGetHandler", err) }()
 	req := ports.AuthSignupKeyGetRequest{
@@ -289,7 +683,7 @@ func (s *GatewayServer) tmpAuthSignupKeyGetHandler(c *fiber.Ctx) (err error) {
 	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
 		return err
 	}
-	resp, err := s.auth.TmpSignupKeyGet(c.Context(), &req)
+	resp, err := s.auth.TmpSignupKeyGet(c.Context(), &req, c.Locals("id").(uuid.UUID))
 	if err != nil {
 		return err
 	}
@@ -306,7 +700,7 @@ func (s *GatewayServer) authSignupKeyGetHandler(c *fiber.Ctx) (err error) {
 	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
 		return err
 	}
-	return s.auth.SignupKeyGet(c.Context(), &req)
+	return s.auth.SignupKeyGet(c.Context(), &req, c.Locals("id").(uuid.UUID))
 }
 
 func (s *GatewayServer) tmpAuthMethodOtpGetHandler(c *fiber.Ctx) (err error) {
@@ -494,12 +888,562 @@ func (s *GatewayServer) authResetEmailPostHandler(c *fiber.Ctx) (err error) {
 	return s.auth.ResetEmailPost(c.Context(), &req)
 }
 
-func (s *GatewayServer) userServiceProxyHandler(c *fiber.Ctx) (err error) {
-	defer func() { err = utils.FuncPipe(gatewayServerCaller+".userServiceProxyHandler", err) }()
-	client := &fasthttp.Client{
-		MaxConnWaitTimeout: time.Second,
-		ReadTimeout:        2 * time.Second,
-		WriteTimeout:       2 * time.Second,
+func (s *GatewayServer) authMessageGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".authMessageGetHandler", err) }()
+	req := ports.MessageStatusGetRequest{
+		Id: c.Params("id"),
 	}
-	return proxy.Forward("http://user:8082"+c.OriginalURL(), client)(c)
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	message, err := s.outbox.Message(c.Context(), req.Id)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(message.ToMessageStatus())
+}
+
+func (s *GatewayServer) adminMessagesGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminMessagesGetHandler", err) }()
+	req := ports.AdminMessagesGetRequest{
+		MessageFilter: ports.MessageFilter{
+			Channel: ports.MessageChannel(c.Query("channel")),
+			Status:  ports.MessageStatus(c.Query("status")),
+		},
+		Pagination: server.ParsePagination(c),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	messages, total, err := s.outbox.Messages(c.Context(), &req.MessageFilter, &req.Pagination)
+	if err != nil {
+		return err
+	}
+	resp := &ports.AdminMessagesGetResponse{
+		Messages: make([]*ports.Message, 0, len(messages)),
+		Page:     req.Page,
+		Size:     req.Size,
+		Total:    total,
+	}
+	for _, message := range messages {
+		resp.Messages = append(resp.Messages, message.ToMessage())
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *GatewayServer) adminMessageGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminMessageGetHandler", err) }()
+	req := ports.AdminMessageGetRequest{
+		Id: c.Params("id"),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	message, err := s.outbox.Message(c.Context(), req.Id)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(message.ToMessage())
+}
+
+func (s *GatewayServer) adminMessageStatsGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminMessageStatsGetHandler", err) }()
+	req := ports.AdminMessageStatsGetRequest{
+		Channel: ports.MessageChannel(c.Query("channel")),
+	}
+	if from := c.Query("from"); from != "" {
+		if req.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return utils.BadRequestResponse.Clone().
+				WithReason("from", from)
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if req.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return utils.BadRequestResponse.Clone().
+				WithReason("to", to)
+		}
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.delivery.Stats(c.Context(), &req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *GatewayServer) webhooksTwilioStatusPostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".webhooksTwilioStatusPostHandler", err) }()
+	params := map[string]string{}
+	c.Request().PostArgs().VisitAll(func(key, value []byte) {
+		params[string(key)] = string(value)
+	})
+	if err = s.delivery.VerifyTwilioSignature(c.Get("X-Twilio-Signature"), params); err != nil {
+		return err
+	}
+	req := ports.TwilioStatusCallbackRequest{
+		MessageSid:    params["MessageSid"],
+		MessageStatus: params["MessageStatus"],
+		ErrorCode:     params["ErrorCode"],
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	if err = s.delivery.TwilioStatusCallback(c.Context(), &req); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (s *GatewayServer) webhooksDeliveryPostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".webhooksDeliveryPostHandler", err) }()
+	if err = s.delivery.VerifyWebhookSignature(c.Get("X-Webhook-Timestamp"), c.Get("X-Webhook-Signature"), c.Body()); err != nil {
+		return err
+	}
+	req := ports.DeliveryWebhookRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse.Clone()
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	if err = s.delivery.DeliveryWebhook(c.Context(), &req); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (s *GatewayServer) webhooksBouncesPostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".webhooksBouncesPostHandler", err) }()
+	if err = s.delivery.VerifyWebhookSignature(c.Get("X-Webhook-Timestamp"), c.Get("X-Webhook-Signature"), c.Body()); err != nil {
+		return err
+	}
+	contentType := c.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	var resp *ports.BounceWebhookResponse
+	switch mediaType {
+	case fiber.MIMEApplicationJSON:
+		req := ports.BounceWebhookRequest{}
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse.Clone()
+		}
+		if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+			return err
+		}
+		resp, err = s.suppression.BounceWebhook(c.Context(), &req)
+	case "message/rfc822":
+		resp, err = s.suppression.IngestReport(c.Context(), c.Body(), ports.WebhookSuppressionSource)
+	case "multipart/report":
+		// The report was posted as the body itself, so its content type,
+		// boundary included, is only in the request header.
+		raw := append([]byte("Content-Type: "+contentType+"\r\n\r\n"), c.Body()...)
+		resp, err = s.suppression.IngestReport(c.Context(), raw, ports.WebhookSuppressionSource)
+	default:
+		return utils.UnsupportedMediaTypeResponse.Clone().
+			WithReason("Content-Type", contentType)
+	}
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *GatewayServer) adminSuppressionsGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminSuppressionsGetHandler", err) }()
+	req := ports.AdminSuppressionsGetRequest{
+		SuppressionFilter: ports.SuppressionFilter{
+			Reason: ports.BounceType(c.Query("reason")),
+			Email:  c.Query("email"),
+		},
+		Pagination: server.ParsePagination(c),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.suppression.Suppressions(c.Context(), &req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *GatewayServer) adminSuppressionDeleteHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminSuppressionDeleteHandler", err) }()
+	email, err := url.PathUnescape(c.Params("email"))
+	if err != nil {
+		return utils.BadRequestResponse.Clone().
+			WithReason("email", c.Params("email"))
+	}
+	req := ports.AdminSuppressionDeleteRequest{Email: email}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	if err = s.suppression.Remove(c.Context(), req.Email, c.Locals("id").(uuid.UUID)); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (s *GatewayServer) adminMessageRequeuePostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminMessageRequeuePostHandler", err) }()
+	req := ports.AdminMessageRequeuePostRequest{
+		Id: c.Params("id"),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	if err = s.outbox.Requeue(c.Context(), req.Id, c.Locals("id").(uuid.UUID)); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (s *GatewayServer) adminSmsSinkGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminSmsSinkGetHandler", err) }()
+	req := ports.AdminSmsSinkGetRequest{
+		PhoneNumber: c.Query("phone_number"),
+		Pagination:  server.ParsePagination(c),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	messages, total, err := s.telecom.Sink().Messages(c.Context(), req.PhoneNumber, &req.Pagination)
+	if err != nil {
+		return err
+	}
+	resp := &ports.AdminSmsSinkGetResponse{
+		Messages: make([]*ports.SmsMessage, len(messages)),
+		Page:     req.Page,
+		Size:     req.Size,
+		Total:    total,
+	}
+	for i := range messages {
+		resp.Messages[i] = &messages[i]
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *GatewayServer) adminMailStatsGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminMailStatsGetHandler", err) }()
+	return c.Status(fiber.StatusOK).JSON(s.mailcom.Stats())
+}
+
+func (s *GatewayServer) adminTemplatesGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminTemplatesGetHandler", err) }()
+	return c.Status(fiber.StatusOK).JSON(&ports.AdminTemplatesGetResponse{
+		Templates:     s.templates.Templates(),
+		DefaultLocale: ports.DefaultLocale,
+	})
+}
+
+func (s *GatewayServer) adminTemplateRenderPostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminTemplateRenderPostHandler", err) }()
+	req := ports.AdminTemplateRenderPostRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse.Clone()
+	}
+	req.Name = ports.MessageTemplateName(c.Params("name"))
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.templates.Render(c.Context(), req.Name, req.Locale, ports.SampleMessageTemplateData(req.Name).Merge(req.Data))
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *GatewayServer) adminTemplateTestPostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminTemplateTestPostHandler", err) }()
+	req := ports.AdminTemplateTestPostRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse.Clone()
+	}
+	req.Name = ports.MessageTemplateName(c.Params("name"))
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.templates.SendTest(c.Context(), &req, c.Locals("id").(uuid.UUID))
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *GatewayServer) userServiceProxyHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".userServiceProxyHandler", err) }()
+	client := &fasthttp.Client{
+		MaxConnWaitTimeout: time.Second,
+		ReadTimeout:        2 * time.Second,
+		WriteTimeout:       2 * time.Second,
+	}
+	// The services trust the gateway, so they get the ip it resolved
+	// rather than whatever the client sent.
+	c.Request().Header.Set(fiber.HeaderXForwardedFor, c.IP())
+	return proxy.Forward("http://user:8082"+c.OriginalURL(), client)(c)
+}
+
+func (s *GatewayServer) mediaServiceProxyHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".mediaServiceProxyHandler", err) }()
+	client := &fasthttp.Client{
+		MaxConnWaitTimeout: time.Second,
+		ReadTimeout:        2 * time.Second,
+		WriteTimeout:       2 * time.Second,
+	}
+	// The services trust the gateway, so they get the ip it resolved
+	// rather than whatever the client sent.
+	c.Request().Header.Set(fiber.HeaderXForwardedFor, c.IP())
+	return proxy.Forward("http://media:8083"+c.OriginalURL(), client)(c)
+}
+
+func (s *GatewayServer) s3ObjectsPutHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".s3ObjectsPutHandler", err) }()
+	bucket, objectName, query, err := signedObjectParams(c)
+	if err != nil {
+		return err
+	}
+	store := s.S3().(ports.SignedObjectStore)
+	if err = store.PutSignedObject(c.Context(), bucket, objectName, query, c.Get(fiber.HeaderContentType), c.Body()); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (s *GatewayServer) s3ObjectsGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".s3ObjectsGetHandler", err) }()
+	bucket, objectName, query, err := signedObjectParams(c)
+	if err != nil {
+		return err
+	}
+	store := s.S3().(ports.SignedObjectStore)
+	object, err := store.GetSignedObject(c.Context(), bucket, objectName, query)
+	if err != nil {
+		return err
+	}
+	if object == nil {
+		return utils.NotFoundResponse.Clone()
+	}
+	defer func() {
+		_ = object.Close()
+	}()
+	info := object.Info()
+	if info.ContentType == "" {
+		info.ContentType = "application/octet-stream"
+	}
+	c.Set(fiber.HeaderContentType, info.ContentType)
+	c.Set(fiber.HeaderContentLength, strconv.FormatInt(info.Size, 10))
+	if info.ETag != "" {
+		c.Set(fiber.HeaderETag, `"`+info.ETag+`"`)
+	}
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	_, err = io.Copy(c.Response().BodyWriter(), object)
+	return err
+}
+
+func signedObjectParams(c *fiber.Ctx) (bucket, objectName string, query url.Values, err error) {
+	objectName, err = url.PathUnescape(c.Params("*"))
+	if err != nil {
+		return "", "", nil, utils.BadRequestResponse.Clone().
+			WithReason("object_name", c.Params("*"))
+	}
+	query, err = url.ParseQuery(string(c.Request().URI().QueryString()))
+	if err != nil {
+		return "", "", nil, utils.BadRequestResponse.Clone().
+			WithReason("query", err.Error())
+	}
+	return c.Params("bucket"), objectName, query, nil
+}
+
+func (s *GatewayServer) adminWebhooksGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminWebhooksGetHandler", err) }()
+	req := ports.AdminWebhooksGetRequest{
+		Pagination: server.ParsePagination(c),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.webhook.Webhooks(c.Context(), &req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *GatewayServer) adminWebhooksPostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminWebhooksPostHandler", err) }()
+	req := ports.AdminWebhooksPostRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse.Clone()
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.webhook.Create(c.Context(), &req, c.Locals("id").(uuid.UUID))
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
+
+func (s *GatewayServer) adminWebhookGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminWebhookGetHandler", err) }()
+	req := ports.AdminWebhookGetRequest{
+		Id: c.Params("id"),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.webhook.Webhook(c.Context(), req.Id)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *GatewayServer) adminWebhookPutHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminWebhookPutHandler", err) }()
+	req := ports.AdminWebhookPutRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse.Clone()
+	}
+	req.Id = c.Params("id")
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.webhook.Update(c.Context(), &req, c.Locals("id").(uuid.UUID))
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *GatewayServer) adminWebhookDeleteHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminWebhookDeleteHandler", err) }()
+	req := ports.AdminWebhookDeleteRequest{
+		Id: c.Params("id"),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	if err = s.webhook.Delete(c.Context(), req.Id, c.Locals("id").(uuid.UUID)); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (s *GatewayServer) adminWebhookDeliveriesGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminWebhookDeliveriesGetHandler", err) }()
+	req := ports.AdminWebhookDeliveriesGetRequest{
+		WebhookId:  c.Params("id"),
+		Status:     ports.WebhookDeliveryStatus(c.Query("status")),
+		Pagination: server.ParsePagination(c),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.webhook.Deliveries(c.Context(), &req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *GatewayServer) adminWebhookDeliveryGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminWebhookDeliveryGetHandler", err) }()
+	req := ports.AdminWebhookDeliveryGetRequest{
+		WebhookId: c.Params("id"),
+		Id:        c.Params("deliveryId"),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.webhook.Delivery(c.Context(), req.WebhookId, req.Id)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *GatewayServer) adminWebhookDeliveryReplayPostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminWebhookDeliveryReplayPostHandler", err) }()
+	req := ports.AdminWebhookDeliveryReplayPostRequest{
+		WebhookId: c.Params("id"),
+		Id:        c.Params("deliveryId"),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	if err = s.webhook.Replay(c.Context(), req.WebhookId, req.Id, c.Locals("id").(uuid.UUID)); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (s *GatewayServer) adminJobsGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminJobsGetHandler", err) }()
+	resp, err := s.Jobs().Jobs(c.Context())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *GatewayServer) adminJobRunsGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminJobRunsGetHandler", err) }()
+	req := ports.AdminJobRunsGetRequest{
+		Name:       ports.JobName(c.Params("name")),
+		Status:     ports.JobRunStatus(c.Query("status")),
+		Pagination: server.ParsePagination(c),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.Jobs().Runs(c.Context(), &req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *GatewayServer) adminJobTriggerPostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminJobTriggerPostHandler", err) }()
+	req := ports.AdminJobPostRequest{
+		Name: ports.JobName(c.Params("name")),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	if err = s.Jobs().Trigger(c.Context(), req.Name, c.Locals("id").(uuid.UUID)); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+func (s *GatewayServer) adminJobPausePostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminJobPausePostHandler", err) }()
+	req := ports.AdminJobPostRequest{
+		Name: ports.JobName(c.Params("name")),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	if err = s.Jobs().Pause(c.Context(), req.Name, c.Locals("id").(uuid.UUID)); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (s *GatewayServer) adminJobResumePostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(gatewayServerCaller+".adminJobResumePostHandler", err) }()
+	req := ports.AdminJobPostRequest{
+		Name: ports.JobName(c.Params("name")),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	if err = s.Jobs().Resume(c.Context(), req.Name, c.Locals("id").(uuid.UUID)); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusOK)
 }
@@ -11,11 +11,34 @@ const gatewayServerCaller = packageCaller + ".GatewayServer"
 type GatewayServer struct {
 	*server.AbstractServer
 	auth        ports.AuthService
+	telecom     ports.TelecomService
+	outbox      ports.OutboxService
+	templates   ports.TemplateService
+	mailcom     ports.MailcomService
+	suppression ports.SuppressionService
+	realtime    ports.RealtimeService
+	webhook     ports.WebhookService
+	delivery    ports.DeliveryService
 	ratelimiter ports.RatelimiterService
 }
 
 func New() ports.Server {
 	s := server.NewAbstractServer(ports.GatewayServiceName)
+	telecom := services.NewTelecomService(s.Logger())
+	suppression := services.NewSuppressionService(s.Logger(), s.Mongo(), s.Audit())
+	mailcom := services.NewMailcomService(s.Logger(), suppression)
+	outbox := services.NewOutboxService(s.Logger(), s.Mongo(), s.Audit(), map[ports.MessageChannel]ports.MessageSender{
+		ports.SmsMessageChannel:   telecom,
+		ports.EmailMessageChannel: mailcom,
+	})
+	templates := services.NewTemplateService(s.Logger(), mailcom, s.Audit())
+	realtime := services.NewRealtimeService(s.Logger(), s.Cache())
+	webhook := services.NewWebhookService(s.Logger(), s.Mongo(), s.Cache(), s.Audit())
+	go outbox.Run(s.Context())
+	go suppression.Run(s.Context())
+	go realtime.Run(s.Context())
+	go services.NewDomainEventRelayService(s.Logger(), s.Relational(), s.Cache()).Run(s.Context())
+	go webhook.Run(s.Context())
 	return &GatewayServer{
 		AbstractServer: s,
 		auth: services.NewAuthService(
@@ -24,9 +47,22 @@ func New() ports.Server {
 			s.Relational(),
 			s.S3(),
 			s.Mongo(),
-			services.NewTelecomService(s.Logger()),
-			services.NewMailcomService(s.Logger()),
+			outbox,
+			templates,
+			suppression,
+			services.NewNotificationService(s.Logger(), s.Relational(), s.Mongo(), outbox, templates, realtime),
+			realtime,
+			services.NewActivityService(s.Logger(), s.Mongo()),
+			s.Audit(),
 		),
+		telecom:     telecom,
+		outbox:      outbox,
+		templates:   templates,
+		mailcom:     mailcom,
+		suppression: suppression,
+		realtime:    realtime,
+		webhook:     webhook,
+		delivery:    services.NewDeliveryService(s.Logger(), s.Mongo()),
 		ratelimiter: services.NewRatelimiterService(s.Logger()),
 	}
 }
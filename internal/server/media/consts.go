@@ -0,0 +1,5 @@
+package media
+
+const (
+	packageCaller = "internal/server/media"
+)
@@ -0,0 +1,150 @@
+package media
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/server"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+func (s *MediaServer) RegisterRoutes() {
+	switch s.Version() {
+	case ports.V1Version:
+		s.RegisterV1()
+	}
+}
+
+func (s *MediaServer) RegisterV1() {
+	media := s.VersionRouter().Group("/media")
+	media.Get("/health", s.mediaHealthGetHandler)
+
+	media.Get("/", s.mediaListGetHandler)
+	media.Post("/upload", s.ContentTypeMiddleware(fiber.MIMEApplicationJSON), s.mediaUploadPostHandler)
+	media.Post("/upload/complete", s.ContentTypeMiddleware(fiber.MIMEApplicationJSON), s.mediaUploadCompletePostHandler)
+	media.Get("/:id", s.mediaGetHandler)
+	media.Get("/:id/download", s.mediaDownloadGetHandler)
+	media.Put("/:id/acl", s.ContentTypeMiddleware(fiber.MIMEApplicationJSON), s.mediaAclPutHandler)
+	media.Delete("/:id", s.mediaDeleteHandler)
+}
+
+func (s *MediaServer) mediaHealthGetHandler(c *fiber.Ctx) (err error) {
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (s *MediaServer) mediaListGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(mediaServerCaller+".mediaListGetHandler", err) }()
+	pagination := server.ParsePagination(c)
+	if err := ports.Validate(c.Context(), s.Logger(), pagination); err != nil {
+		return err
+	}
+	resp, err := s.media.MediaListGet(c.Context(), c.Locals("id").(uuid.UUID), c.Locals("userType").(ports.UserType), &pagination)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *MediaServer) mediaUploadPostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(mediaServerCaller+".mediaUploadPostHandler", err) }()
+	req := ports.MediaUploadPostRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse.Clone()
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.media.UploadPost(c.Context(), c.Locals("id").(uuid.UUID), c.Locals("userType").(ports.UserType), &req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
+
+func (s *MediaServer) mediaUploadCompletePostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(mediaServerCaller+".mediaUploadCompletePostHandler", err) }()
+	req := ports.MediaUploadCompletePostRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse.Clone()
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.media.UploadCompletePost(c.Context(), c.Locals("id").(uuid.UUID), c.Locals("userType").(ports.UserType), &req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
+
+func (s *MediaServer) mediaGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(mediaServerCaller+".mediaGetHandler", err) }()
+	req, err := s.mediaRequest(c)
+	if err != nil {
+		return err
+	}
+	resp, err := s.media.MediaGet(c.Context(), c.Locals("id").(uuid.UUID), c.Locals("userType").(ports.UserType), req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *MediaServer) mediaDownloadGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(mediaServerCaller+".mediaDownloadGetHandler", err) }()
+	req, err := s.mediaRequest(c)
+	if err != nil {
+		return err
+	}
+	resp, err := s.media.DownloadGet(c.Context(), c.Locals("id").(uuid.UUID), c.Locals("userType").(ports.UserType), req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *MediaServer) mediaAclPutHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(mediaServerCaller+".mediaAclPutHandler", err) }()
+	parsedId, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse.Clone().
+			WithReason("id", c.Params("id"))
+	}
+	req := ports.MediaAclPutRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse.Clone()
+	}
+	req.Id = parsedId
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	if err := s.media.AclPut(c.Context(), c.Locals("id").(uuid.UUID), c.Locals("userType").(ports.UserType), &req); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *MediaServer) mediaDeleteHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(mediaServerCaller+".mediaDeleteHandler", err) }()
+	req, err := s.mediaRequest(c)
+	if err != nil {
+		return err
+	}
+	if err := s.media.MediaDelete(c.Context(), c.Locals("id").(uuid.UUID), c.Locals("userType").(ports.UserType), req); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *MediaServer) mediaRequest(c *fiber.Ctx) (req *ports.MediaRequest, err error) {
+	parsedId, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, utils.BadRequestResponse.Clone().
+			WithReason("id", c.Params("id"))
+	}
+	req = &ports.MediaRequest{Id: parsedId}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
@@ -0,0 +1,33 @@
+package media
+
+import (
+	"context"
+
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/server"
+	"github.com/kasragay/backend/internal/services"
+)
+
+const mediaServerCaller = packageCaller + ".MediaServer"
+
+type MediaServer struct {
+	*server.AbstractServer
+	media ports.MediaService
+}
+
+func New() ports.Server {
+	s := server.NewAbstractServer(ports.MediaServiceName)
+	if err := s.S3().EnsureMediaBuckets(context.Background()); err != nil {
+		s.Logger().Fatalf(context.Background(), "Failed to create media buckets: %v", err)
+	}
+	return &MediaServer{
+		AbstractServer: s,
+		media: services.NewMediaService(
+			s.Logger(),
+			s.Cache(),
+			s.Mongo(),
+			s.S3(),
+			s.Audit(),
+		),
+	}
+}
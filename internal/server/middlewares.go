@@ -15,6 +15,8 @@ import (
 	"go.uber.org/zap"
 )
 
+// LoggerMiddleware logs every request but the health checks. It logs the path
+// alone, never the query, which may carry credentials.
 func (s *AbstractServer) LoggerMiddleware() fiber.Handler {
 	return func(c *fiber.Ctx) (err error) {
 		start := time.Now()
@@ -42,6 +44,26 @@ func (s *AbstractServer) LoggerMiddleware() fiber.Handler {
 	}
 }
 
+// primaryMiddleware keeps the relational reads of a request on the primary
+// once it writes. Requests other than GET, HEAD and OPTIONS are expected to
+// write, so they never read from replicas.
+func (s *AbstractServer) primaryMiddleware(c *fiber.Ctx) error {
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		utils.TrackPrimary(c.Context(), false)
+	default:
+		utils.TrackPrimary(c.Context(), true)
+	}
+	return c.Next()
+}
+
+// clientIpMiddleware records the client ip Fiber resolved for the request,
+// which the activity and audit logs read through utils.GetRequestMeta.
+func (s *AbstractServer) clientIpMiddleware(c *fiber.Ctx) error {
+	utils.SetRequestIp(c.Context(), c.IP())
+	return c.Next()
+}
+
 func (s *AbstractServer) allowedHostsMiddleware(allowedHosts ...string) fiber.Handler {
 	return func(c *fiber.Ctx) (err error) {
 		host := c.Get(fiber.HeaderHost)
@@ -3,6 +3,7 @@ package server
 import (
 	"fmt"
 
+	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/kasragay/backend/internal/ports"
 )
@@ -10,6 +11,8 @@ import (
 func (s *AbstractServer) registerBasicRoutes() {
 
 	s.App().Use(s.LoggerMiddleware())
+	s.App().Use(s.primaryMiddleware)
+	s.App().Use(s.clientIpMiddleware)
 	s.App().Use(cors.New(cors.Config{
 		AllowOrigins:     fmt.Sprintf("%s,%s", s.BackUrl(), s.FrontUrl()),
 		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS,PATCH",
@@ -26,3 +29,12 @@ func (s *AbstractServer) registerBasicRoutes() {
 	}
 	s.verRouter = s.App().Group("/" + string(s.Version()))
 }
+
+// ParsePagination reads the page and size query parameters shared by every
+// paginated listing.
+func ParsePagination(c *fiber.Ctx) ports.Pagination {
+	return ports.Pagination{
+		Page: int64(c.QueryInt("page", 1)),
+		Size: int64(c.QueryInt("size", 20)),
+	}
+}
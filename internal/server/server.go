@@ -6,6 +6,7 @@ import (
 	"os"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -14,6 +15,7 @@ import (
 	"github.com/bytedance/sonic"
 	"github.com/kasragay/backend/internal/ports"
 	"github.com/kasragay/backend/internal/repository"
+	"github.com/kasragay/backend/internal/services"
 	"github.com/kasragay/backend/internal/utils"
 )
 
@@ -27,11 +29,17 @@ type AbstractServer struct {
 	rel         ports.RelationalRepo
 	s3          ports.S3Repo
 	mongo       ports.MongoRepo
+	audit       ports.AuditService
+	jobs        ports.JobService
 	domain      string
 	version     ports.Version
 	fUrl        string
 	bUrl        string
 	serviceName ports.ServiceName
+	// ctx is cancelled on Shutdown, stopping the background work of the
+	// server.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func NewAbstractServer(serviceName ports.ServiceName) *AbstractServer {
@@ -69,23 +77,37 @@ func NewAbstractServer(serviceName ports.ServiceName) *AbstractServer {
 
 	cache := repository.NewCacheRepo(logger)
 	rel := repository.NewRelationalRepo(logger)
-	if serviceName == ports.GatewayServiceName {
-		if err := rel.DropTables(); err != nil { // TODO_DEL
-			logger.Fatalf(context.Background(), "Failed to drop tables: %v", err)
-		}
-		if err := rel.AutoMigrate(); err != nil {
-			logger.Fatalf(context.Background(), "Failed to migrate database: %v", err)
-		}
-		if err := rel.AddFirstUsers(); err != nil { // TODO_DEL
-			logger.Fatalf(context.Background(), "Failed to add first users: %v", err)
+	// Migrations only run with settings migrate, so a server started ahead
+	// of them says so instead of failing on the first query.
+	if statuses, err := rel.MigrationStatus(context.Background()); err != nil {
+		logger.Fatalf(context.Background(), "Failed to check database migrations: %v", err)
+	} else {
+		for _, status := range statuses {
+			if status.State != ports.AppliedMigrationState {
+				logger.Warnf(context.Background(), "migration %d_%s is %s; run settings migrate", status.Version, status.Name, status.State)
+			}
 		}
 	}
 	mongo := repository.NewMongoRepo(logger)
 	s3 := repository.NewS3Repo(logger)
+	bodyLimit := fiber.DefaultBodyLimit
+	if _, ok := s3.(ports.SignedObjectStore); ok && serviceName == ports.GatewayServiceName {
+		// Presigned uploads are received by the gateway itself.
+		bodyLimit = max(bodyLimit, int(ports.MaxUploadSize()))
+	}
+
+	audit := services.NewAuditService(logger, mongo)
+	trustedProxies := []string{}
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
 
 	fUrl := fmt.Sprintf("https://%s", domain)
 	bUrl := fmt.Sprintf("https://api.%s", domain)
 
+	ctx, cancel := context.WithCancel(context.Background())
 	s := &AbstractServer{
 		app: fiber.New(fiber.Config{
 			ServerHeader: fmt.Sprintf("%s - %s:%s", "Kasragay", serviceName, longVersion),
@@ -93,22 +115,77 @@ func NewAbstractServer(serviceName ports.ServiceName) *AbstractServer {
 			ErrorHandler: utils.ErrorHandlerFunc(logger),
 			JSONEncoder:  sonic.Marshal,
 			JSONDecoder:  sonic.Unmarshal,
+			BodyLimit:    bodyLimit,
+			// c.IP() only believes X-Forwarded-For from TRUSTED_PROXIES, and
+			// is the remote address otherwise.
+			EnableTrustedProxyCheck: true,
+			TrustedProxies:          trustedProxies,
+			ProxyHeader:             fiber.HeaderXForwardedFor,
+			EnableIPValidation:      true,
 		}),
 		logger:      logger,
 		cache:       cache,
 		rel:         rel,
 		s3:          s3,
 		mongo:       mongo,
+		audit:       audit,
+		jobs:        services.NewJobService(logger, cache, mongo, audit, services.NewJobs(logger, rel, mongo, s3, audit)),
 		domain:      domain,
 		version:     varsion,
 		fUrl:        fUrl,
 		bUrl:        bUrl,
 		serviceName: serviceName,
+		ctx:         ctx,
+		cancel:      cancel,
 	}
 	s.registerBasicRoutes()
+	go s.usernameDenylistRefresher(time.Minute)
+	// Every server schedules the jobs; the lease on each job lets one
+	// replica at a time run it.
+	go s.jobs.Run(s.ctx)
 	return s
 }
 
+// usernameDenylistRefresher keeps the in-memory denylist used by
+// claimableUsernameValidator in sync with the relational repository, so
+// entries added on another replica are picked up without a restart. It
+// returns once the server shuts down.
+func (s *AbstractServer) usernameDenylistRefresher(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(s.ctx, interval)
+		denylist, err := s.rel.GetUsernameDenylist(ctx)
+		cancel()
+		if err != nil {
+			s.logger.Error(context.Background(), err, "failed to refresh username denylist")
+		} else {
+			usernames := make([]string, 0, len(denylist))
+			for _, entry := range denylist {
+				usernames = append(usernames, entry.Username)
+			}
+			ports.SetDeniedUsernames(usernames...)
+		}
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Context is cancelled on Shutdown. Background work of the server is run
+// with it so that it stops then.
+func (s *AbstractServer) Context() context.Context {
+	return s.ctx
+}
+
+// Shutdown stops the background work of the server, then shuts the app down.
+func (s *AbstractServer) Shutdown(ctx context.Context) error {
+	s.cancel()
+	return s.app.ShutdownWithContext(ctx)
+}
+
 func (s *AbstractServer) Logger() *utils.Logger {
 	return s.logger
 }
@@ -137,6 +214,14 @@ func (s *AbstractServer) Mongo() ports.MongoRepo {
 	return s.mongo
 }
 
+func (s *AbstractServer) Audit() ports.AuditService {
+	return s.audit
+}
+
+func (s *AbstractServer) Jobs() ports.JobService {
+	return s.jobs
+}
+
 func (s *AbstractServer) Domain() string {
 	return s.domain
 }
@@ -153,6 +238,10 @@ func (s *AbstractServer) BackUrl() string {
 	return s.bUrl
 }
 
+// CanPass lets the user of c act on targetId, or on targetPhone when given.
+// Admins pass for anyone, but acting on someone else is an override that must
+// be in the audit log first: when it cannot be recorded the request fails
+// closed, as an internal error rather than an authorization failure.
 func (s *AbstractServer) CanPass(c *fiber.Ctx, targetId uuid.UUID, targetPhone ...string) (err error) {
 	defer func() { err = utils.FuncPipe(serverCaller+".CanPass", err) }()
 	sourceId := c.Locals("id").(uuid.UUID)
@@ -161,6 +250,16 @@ func (s *AbstractServer) CanPass(c *fiber.Ctx, targetId uuid.UUID, targetPhone .
 	var ok bool
 	switch {
 	case sourceUserType == ports.AdminUserType:
+		if sourceId != targetId {
+			if err := s.audit.Record(
+				c.Context(), sourceId, sourceUserType, ports.AdminOverrideAuditAction, targetId, "",
+				map[string]string{"method": c.Method(), "path": c.Path()},
+			); err != nil {
+				s.logger.Error(c.Context(), err, "failed to record admin override, refusing it")
+				return utils.InternalServerResponse.Clone().
+					WithReason("audit", "admin override could not be recorded")
+			}
+		}
 		ok = true
 	case targetPhone == nil:
 		ok = sourceId == targetId
@@ -1,9 +1,12 @@
 package user
 
 import (
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/server"
 	"github.com/kasragay/backend/internal/utils"
 )
 
@@ -21,9 +24,48 @@ func (s *UserServer) RegisterV1() {
 	user.Get("/", s.userGetHandler)
 	user.Put("/", s.ContentTypeMiddleware(fiber.MIMEApplicationJSON), s.userPutHandler)
 	user.Delete("/", s.ContentTypeMiddleware(fiber.MIMEApplicationJSON), s.userDeleteHandler)
+	user.Get("/activity", s.userActivityGetHandler)
+	user.Get("/notifications", s.userNotificationsGetHandler)
+	user.Post("/notifications/read", s.ContentTypeMiddleware(fiber.MIMEApplicationJSON), s.userNotificationsReadPostHandler)
+	user.Get("/notifications/preferences", s.userNotificationPreferencesGetHandler)
+	user.Put("/notifications/preferences", s.ContentTypeMiddleware(fiber.MIMEApplicationJSON), s.userNotificationPreferencesPutHandler)
+	user.Post("/avatar/upload", s.ContentTypeMiddleware(fiber.MIMEApplicationJSON), s.userAvatarUploadPostHandler)
+	user.Post("/avatar/upload/complete", s.ContentTypeMiddleware(fiber.MIMEApplicationJSON), s.userAvatarUploadCompletePostHandler)
+
+	admin := s.VersionRouter().Group("/admin", s.adminOnlyMiddleware)
+	admin.Get("/usernames/denylist", s.adminUsernameDenylistGetHandler)
+	admin.Post("/usernames/denylist", s.ContentTypeMiddleware(fiber.MIMEApplicationJSON), s.adminUsernameDenylistPostHandler)
+	admin.Delete("/usernames/denylist", s.ContentTypeMiddleware(fiber.MIMEApplicationJSON), s.adminUsernameDenylistDeleteHandler)
+	admin.Get("/users/:userType/:id/activity", s.adminUserActivityGetHandler)
+	admin.Get("/audit", s.adminAuditGetHandler)
+	admin.Get("/audit/export", s.adminAuditExportGetHandler)
+
+	client := s.VersionRouter().Group("/client", s.clientOnlyMiddleware)
+	client.Get("/blocks", s.clientBlocksGetHandler)
+	client.Get("/users/:id", s.clientProfileGetHandler)
+	client.Get("/users/:id/relation", s.clientRelationGetHandler)
+	client.Get("/users/:id/followers", s.clientFollowersGetHandler)
+	client.Get("/users/:id/following", s.clientFollowingGetHandler)
+	client.Post("/users/:id/follow", s.clientFollowPostHandler)
+	client.Delete("/users/:id/follow", s.clientFollowDeleteHandler)
+	client.Post("/users/:id/block", s.clientBlockPostHandler)
+	client.Delete("/users/:id/block", s.clientBlockDeleteHandler)
+}
 
-	client := s.VersionRouter().Group("/client")
-	_ = client
+func (s *UserServer) adminOnlyMiddleware(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".adminOnlyMiddleware", err) }()
+	if c.Locals("userType").(ports.UserType) != ports.AdminUserType {
+		return utils.JwtUnauthorizedResponse.Clone()
+	}
+	return c.Next()
+}
+
+func (s *UserServer) clientOnlyMiddleware(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".clientOnlyMiddleware", err) }()
+	if c.Locals("userType").(ports.UserType) != ports.ClientUserType {
+		return utils.JwtUnauthorizedResponse.Clone()
+	}
+	return c.Next()
 }
 
 func (s *UserServer) userHealthGetHandler(c *fiber.Ctx) (err error) {
@@ -98,7 +140,378 @@ func (s *UserServer) userDeleteHandler(c *fiber.Ctx) (err error) {
 			return utils.BadRequestResponse.Clone().
 				WithReason("token", req.Token)
 		}
-		return s.user.UserDelete(c.Context(), &req, true)
+		return s.user.UserDelete(c.Context(), &req, true, c.Locals("id").(uuid.UUID))
+	}
+	return s.user.UserDelete(c.Context(), &req, false, c.Locals("id").(uuid.UUID))
+}
+
+func (s *UserServer) userAvatarUploadPostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".userAvatarUploadPostHandler", err) }()
+	req := ports.UserAvatarUploadPostRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse.Clone()
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	if err := s.CanPass(c, req.Id); err != nil {
+		return err
+	}
+	resp, err := s.user.AvatarUploadPost(c.Context(), &req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
+
+func (s *UserServer) userAvatarUploadCompletePostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".userAvatarUploadCompletePostHandler", err) }()
+	req := ports.UserAvatarUploadCompletePostRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse.Clone()
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	if err := s.CanPass(c, req.Id); err != nil {
+		return err
+	}
+	resp, err := s.user.AvatarUploadCompletePost(c.Context(), &req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *UserServer) userActivityGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".userActivityGetHandler", err) }()
+	req := ports.UserActivityGetRequest{
+		Id:         c.Locals("id").(uuid.UUID),
+		UserType:   c.Locals("userType").(ports.UserType),
+		Pagination: server.ParsePagination(c),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.activity.ActivitiesGet(c.Context(), &req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *UserServer) userNotificationsGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".userNotificationsGetHandler", err) }()
+	req := ports.UserNotificationsGetRequest{
+		Id:         c.Locals("id").(uuid.UUID),
+		UserType:   c.Locals("userType").(ports.UserType),
+		Unread:     c.QueryBool("unread"),
+		Pagination: server.ParsePagination(c),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.notification.NotificationsGet(c.Context(), &req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *UserServer) userNotificationsReadPostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".userNotificationsReadPostHandler", err) }()
+	req := ports.UserNotificationsReadPostRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse.Clone()
+	}
+	req.Id = c.Locals("id").(uuid.UUID)
+	req.UserType = c.Locals("userType").(ports.UserType)
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.notification.NotificationsReadPost(c.Context(), &req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *UserServer) userNotificationPreferencesGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".userNotificationPreferencesGetHandler", err) }()
+	req := ports.UserNotificationPreferencesGetRequest{
+		Id:       c.Locals("id").(uuid.UUID),
+		UserType: c.Locals("userType").(ports.UserType),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.notification.PreferencesGet(c.Context(), &req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *UserServer) userNotificationPreferencesPutHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".userNotificationPreferencesPutHandler", err) }()
+	req := ports.UserNotificationPreferencesPutRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse.Clone()
+	}
+	req.Id = c.Locals("id").(uuid.UUID)
+	req.UserType = c.Locals("userType").(ports.UserType)
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.notification.PreferencesPut(c.Context(), &req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *UserServer) adminUserActivityGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".adminUserActivityGetHandler", err) }()
+	parsedId, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.BadRequestResponse.Clone().
+			WithReason("id", c.Params("id"))
+	}
+	req := ports.UserActivityGetRequest{
+		Id:         parsedId,
+		UserType:   ports.UserType(c.Params("userType")),
+		Pagination: server.ParsePagination(c),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.activity.ActivitiesGet(c.Context(), &req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *UserServer) adminUsernameDenylistGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".adminUsernameDenylistGetHandler", err) }()
+	resp, err := s.user.UsernameDenylistGet(c.Context())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *UserServer) adminUsernameDenylistPostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".adminUsernameDenylistPostHandler", err) }()
+	req := ports.AdminUsernameDenylistPostRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse.Clone()
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	return s.user.UsernameDenylistPost(c.Context(), &req, c.Locals("id").(uuid.UUID))
+}
+
+func (s *UserServer) adminUsernameDenylistDeleteHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".adminUsernameDenylistDeleteHandler", err) }()
+	req := ports.AdminUsernameDenylistDeleteRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse.Clone()
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	return s.user.UsernameDenylistDelete(c.Context(), &req, c.Locals("id").(uuid.UUID))
+}
+
+func (s *UserServer) clientProfileGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".clientProfileGetHandler", err) }()
+	req, err := s.parseClientUserRequest(c)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.ProfileGet(c.Context(), c.Locals("id").(uuid.UUID), req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *UserServer) clientRelationGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".clientRelationGetHandler", err) }()
+	req, err := s.parseClientUserRequest(c)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.RelationGet(c.Context(), c.Locals("id").(uuid.UUID), req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *UserServer) clientFollowersGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".clientFollowersGetHandler", err) }()
+	req, err := s.parseClientUserListGetRequest(c)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.FollowersGet(c.Context(), c.Locals("id").(uuid.UUID), req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *UserServer) clientFollowingGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".clientFollowingGetHandler", err) }()
+	req, err := s.parseClientUserListGetRequest(c)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.FollowingGet(c.Context(), c.Locals("id").(uuid.UUID), req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *UserServer) clientFollowPostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".clientFollowPostHandler", err) }()
+	req, err := s.parseClientUserRequest(c)
+	if err != nil {
+		return err
+	}
+	return s.client.FollowPost(c.Context(), c.Locals("id").(uuid.UUID), req)
+}
+
+func (s *UserServer) clientFollowDeleteHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".clientFollowDeleteHandler", err) }()
+	req, err := s.parseClientUserRequest(c)
+	if err != nil {
+		return err
+	}
+	return s.client.FollowDelete(c.Context(), c.Locals("id").(uuid.UUID), req)
+}
+
+func (s *UserServer) clientBlockPostHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".clientBlockPostHandler", err) }()
+	req, err := s.parseClientUserRequest(c)
+	if err != nil {
+		return err
+	}
+	return s.client.BlockPost(c.Context(), c.Locals("id").(uuid.UUID), req)
+}
+
+func (s *UserServer) clientBlockDeleteHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".clientBlockDeleteHandler", err) }()
+	req, err := s.parseClientUserRequest(c)
+	if err != nil {
+		return err
+	}
+	return s.client.BlockDelete(c.Context(), c.Locals("id").(uuid.UUID), req)
+}
+
+func (s *UserServer) clientBlocksGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".clientBlocksGetHandler", err) }()
+	pagination := server.ParsePagination(c)
+	if err := ports.Validate(c.Context(), s.Logger(), pagination); err != nil {
+		return err
+	}
+	resp, err := s.client.BlocksGet(c.Context(), c.Locals("id").(uuid.UUID), &pagination)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *UserServer) adminAuditGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".adminAuditGetHandler", err) }()
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		return err
+	}
+	req := ports.AdminAuditGetRequest{
+		AuditFilter: *filter,
+		Pagination:  server.ParsePagination(c),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), req); err != nil {
+		return err
+	}
+	resp, err := s.Audit().AuditsGet(c.Context(), &req)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (s *UserServer) adminAuditExportGetHandler(c *fiber.Ctx) (err error) {
+	defer func() { err = utils.FuncPipe(userServerCaller+".adminAuditExportGetHandler", err) }()
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		return err
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), *filter); err != nil {
+		return err
+	}
+	adminId := c.Locals("id").(uuid.UUID)
+	if err := s.Audit().Record(
+		c.Context(), adminId, ports.AdminUserType, ports.AuditExportedAuditAction, uuid.Nil, "",
+		map[string]string{"query": string(c.Request().URI().QueryString())},
+	); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="audit.ndjson"`)
+	return s.Audit().Export(c.Context(), filter, c.Response().BodyWriter())
+}
+
+func (s *UserServer) parseClientUserRequest(c *fiber.Ctx) (req *ports.ClientUserRequest, err error) {
+	parsedId, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, utils.BadRequestResponse.Clone().
+			WithReason("id", c.Params("id"))
+	}
+	req = &ports.ClientUserRequest{Id: parsedId}
+	if err := ports.Validate(c.Context(), s.Logger(), *req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (s *UserServer) parseClientUserListGetRequest(c *fiber.Ctx) (req *ports.ClientUserListGetRequest, err error) {
+	parsedId, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, utils.BadRequestResponse.Clone().
+			WithReason("id", c.Params("id"))
+	}
+	req = &ports.ClientUserListGetRequest{
+		Id:         parsedId,
+		Pagination: server.ParsePagination(c),
+	}
+	if err := ports.Validate(c.Context(), s.Logger(), *req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func parseAuditFilter(c *fiber.Ctx) (filter *ports.AuditFilter, err error) {
+	filter = &ports.AuditFilter{
+		ActorId: c.Query("actor_id"),
+		Action:  ports.AuditAction(c.Query("action")),
+	}
+	if from := c.Query("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return nil, utils.BadRequestResponse.Clone().
+				WithReason("from", from)
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return nil, utils.BadRequestResponse.Clone().
+				WithReason("to", to)
+		}
 	}
-	return s.user.UserDelete(c.Context(), &req, false)
+	return filter, nil
 }
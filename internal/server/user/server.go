@@ -10,11 +10,17 @@ const userServerCaller = packageCaller + ".UserServer"
 
 type UserServer struct {
 	*server.AbstractServer
-	user ports.UserService
+	user         ports.UserService
+	client       ports.ClientService
+	activity     ports.ActivityService
+	notification ports.NotificationService
 }
 
 func New() ports.Server {
 	s := server.NewAbstractServer(ports.UserServiceName)
+	activity := services.NewActivityService(s.Logger(), s.Mongo())
+	// Events are only published here; the gateway delivers them.
+	realtime := services.NewRealtimeService(s.Logger(), s.Cache())
 	return &UserServer{
 		AbstractServer: s,
 		user: services.NewUserService(
@@ -23,6 +29,18 @@ func New() ports.Server {
 			s.Relational(),
 			s.Mongo(),
 			s.S3(),
+			realtime,
+			activity,
+			s.Audit(),
 		),
+		client: services.NewClientService(
+			s.Logger(),
+			s.Relational(),
+			s.Mongo(),
+		),
+		activity: activity,
+		// Notifications are sent by the gateway, this server only serves the
+		// inbox and preferences.
+		notification: services.NewNotificationService(s.Logger(), s.Relational(), s.Mongo(), nil, nil, realtime),
 	}
 }
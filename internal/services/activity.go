@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const activityCaller = packageCaller + ".Activity"
+
+type Activity struct {
+	logger *utils.Logger
+	mongo  ports.MongoRepo
+}
+
+func NewActivityService(
+	logger *utils.Logger,
+	mongo ports.MongoRepo,
+) ports.ActivityService {
+	return &Activity{
+		logger: logger,
+		mongo:  mongo,
+	}
+}
+
+// Record stores a security event for the user. A nil cause marks the event as
+// successful; otherwise its message is kept as the failure reason. Failing to
+// record is logged and never fails the request that triggered the event.
+func (s *Activity) Record(ctx context.Context, userId uuid.UUID, userType ports.UserType, activityType ports.ActivityType, method ports.ActivityMethod, cause error) {
+	var reason string
+	if cause != nil {
+		var uErr *utils.Error
+		if errors.As(cause, &uErr) && !uErr.IsInternal() {
+			reason = uErr.GetMessage()
+		} else {
+			reason = utils.InternalServerResponse.GetMessage()
+		}
+	}
+	meta := utils.GetRequestMeta(ctx)
+	activity := ports.NewActivityModel(userId, userType, activityType, method, cause == nil, reason, meta.Ip, meta.UserAgent)
+	if err := s.mongo.AddActivity(ctx, activity); err != nil {
+		s.logger.Error(ctx, utils.FuncPipe(activityCaller+".Record", err), "failed to record activity")
+	}
+}
+
+func (s *Activity) ActivitiesGet(ctx context.Context, req *ports.UserActivityGetRequest) (resp *ports.UserActivityGetResponse, err error) {
+	defer func() { err = utils.FuncPipe(activityCaller+".ActivitiesGet", err) }()
+	activities, total, err := s.mongo.GetActivities(ctx, req.Id, req.UserType, &req.Pagination)
+	if err != nil {
+		return nil, err
+	}
+	resp = &ports.UserActivityGetResponse{
+		Activities: make([]*ports.Activity, 0, len(activities)),
+		Page:       req.Page,
+		Size:       req.Size,
+		Total:      total,
+	}
+	for _, activity := range activities {
+		resp.Activities = append(resp.Activities, activity.ToActivity())
+	}
+	return resp, nil
+}
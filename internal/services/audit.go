@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const auditCaller = packageCaller + ".Audit"
+
+type Audit struct {
+	logger *utils.Logger
+	mongo  ports.MongoRepo
+}
+
+func NewAuditService(
+	logger *utils.Logger,
+	mongo ports.MongoRepo,
+) ports.AuditService {
+	return &Audit{
+		logger: logger,
+		mongo:  mongo,
+	}
+}
+
+func (s *Audit) Record(ctx context.Context, actorId uuid.UUID, actorType ports.UserType, action ports.AuditAction, targetId uuid.UUID, targetType ports.UserType, data map[string]string) (err error) {
+	defer func() { err = utils.FuncPipe(auditCaller+".Record", err) }()
+	meta := utils.GetRequestMeta(ctx)
+	return s.mongo.AppendAudit(ctx, ports.NewAuditModel(actorId, actorType, action, targetId, targetType, data, meta.Ip, meta.UserAgent))
+}
+
+func (s *Audit) AuditsGet(ctx context.Context, req *ports.AdminAuditGetRequest) (resp *ports.AdminAuditGetResponse, err error) {
+	defer func() { err = utils.FuncPipe(auditCaller+".AuditsGet", err) }()
+	entries, total, err := s.mongo.GetAudits(ctx, &req.AuditFilter, &req.Pagination)
+	if err != nil {
+		return nil, err
+	}
+	resp = &ports.AdminAuditGetResponse{
+		Entries: make([]*ports.AuditEntry, 0, len(entries)),
+		Page:    req.Page,
+		Size:    req.Size,
+		Total:   total,
+	}
+	for _, entry := range entries {
+		resp.Entries = append(resp.Entries, entry.ToAuditEntry())
+	}
+	return resp, nil
+}
+
+// Export writes the matching entries to w as newline delimited JSON in chain
+// order, so the output can be verified offline.
+func (s *Audit) Export(ctx context.Context, filter *ports.AuditFilter, w io.Writer) (err error) {
+	defer func() { err = utils.FuncPipe(auditCaller+".Export", err) }()
+	encoder := json.NewEncoder(w)
+	return s.mongo.IterateAudits(ctx, filter, func(entry *ports.AuditModel) error {
+		return encoder.Encode(entry.ToAuditEntry())
+	})
+}
+
+// Verify walks the whole chain and reports the first entry whose sequence,
+// link to the previous entry, or own hash does not match.
+func (s *Audit) Verify(ctx context.Context) (resp *ports.AuditVerifyResponse, err error) {
+	defer func() { err = utils.FuncPipe(auditCaller+".Verify", err) }()
+	resp = &ports.AuditVerifyResponse{Valid: true}
+	prevHash := ports.AuditGenesisHash
+	err = s.mongo.IterateAudits(ctx, nil, func(entry *ports.AuditModel) error {
+		if !resp.Valid {
+			return nil
+		}
+		resp.Checked++
+		switch {
+		case entry.Sequence != resp.Checked:
+			resp.Reason = fmt.Sprintf("expected sequence %d, found %d", resp.Checked, entry.Sequence)
+		case entry.PrevHash != prevHash:
+			resp.Reason = "previous hash does not match"
+		case entry.Hash != entry.ComputeHash():
+			resp.Reason = "entry hash does not match its content"
+		default:
+			prevHash = entry.Hash
+			return nil
+		}
+		resp.Valid = false
+		resp.BrokenAt = resp.Checked
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
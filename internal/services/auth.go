@@ -2,6 +2,8 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"math/rand"
 
 	"os"
@@ -23,8 +25,13 @@ type Auth struct {
 	rel           ports.RelationalRepo
 	mongo         ports.MongoRepo
 	s3            ports.S3Repo
-	telecom       ports.TelecomService
-	mailcom       ports.MailcomService
+	outbox        ports.OutboxService
+	templates     ports.TemplateService
+	suppression   ports.SuppressionService
+	notification  ports.NotificationService
+	realtime      ports.RealtimeService
+	activity      ports.ActivityService
+	audit         ports.AuditService
 	jwtSK         []byte
 	jwtAccessExp  time.Duration
 	jwtRefreshExp time.Duration
@@ -39,8 +46,13 @@ func NewAuthService(
 	rel ports.RelationalRepo,
 	s3 ports.S3Repo,
 	mongo ports.MongoRepo,
-	telecom ports.TelecomService,
-	mailcom ports.MailcomService,
+	outbox ports.OutboxService,
+	templates ports.TemplateService,
+	suppression ports.SuppressionService,
+	notification ports.NotificationService,
+	realtime ports.RealtimeService,
+	activity ports.ActivityService,
+	audit ports.AuditService,
 ) ports.AuthService {
 	jwtSK := os.Getenv("JWT_SECRET_KEY")
 	if jwtSK == "" {
@@ -75,8 +87,13 @@ func NewAuthService(
 		rel:           rel,
 		mongo:         mongo,
 		s3:            s3,
-		telecom:       telecom,
-		mailcom:       mailcom,
+		outbox:        outbox,
+		templates:     templates,
+		suppression:   suppression,
+		notification:  notification,
+		realtime:      realtime,
+		activity:      activity,
+		audit:         audit,
 		jwtSK:         []byte(jwtSK),
 		jwtAccessExp:  jwtAE,
 		jwtRefreshExp: jwtRE,
@@ -97,7 +114,36 @@ func (s *Auth) CheckById(ctx context.Context, id uuid.UUID, userType ports.UserT
 	return s.rel.UserExistsById(ctx, id, userType)
 }
 
-func (s *Auth) TmpSignupKeyGet(ctx context.Context, req *ports.AuthSignupKeyGetRequest) (resp *ports.TmpAuthSignupKeyGetResponse, err error) {
+func (s *Auth) UsernameRedirectGet(ctx context.Context, req *ports.AuthUsernameRedirectGetRequest) (resp *ports.AuthUsernameRedirectGetResponse, err error) {
+	defer func() { err = utils.FuncPipe(authCaller+".UsernameRedirectGet", err) }()
+	user, isDeleted, err := s.rel.GetUserByUsername(ctx, req.Username, req.UserType)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		return &ports.AuthUsernameRedirectGetResponse{
+			Username:   user.GetUsername(),
+			Redirected: false,
+		}, nil
+	}
+	if isDeleted {
+		return nil, utils.UserDeletedResponse.Clone()
+	}
+	user, err = s.rel.GetUsernameRedirect(ctx, req.Username, req.UserType)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, utils.UsernameNotFoundResponse.Clone().
+			WithReason("username", req.Username)
+	}
+	return &ports.AuthUsernameRedirectGetResponse{
+		Username:   user.GetUsername(),
+		Redirected: true,
+	}, nil
+}
+
+func (s *Auth) TmpSignupKeyGet(ctx context.Context, req *ports.AuthSignupKeyGetRequest, adminId uuid.UUID) (resp *ports.TmpAuthSignupKeyGetResponse, err error) {
 	defer func() { err = utils.FuncPipe(authCaller+".TmpSignupKeyGet", err) }()
 	var identity string
 	if req.Email != "" {
@@ -109,12 +155,25 @@ func (s *Auth) TmpSignupKeyGet(ctx context.Context, req *ports.AuthSignupKeyGetR
 	if err != nil {
 		return nil, err
 	}
+	if err = s.audit.Record(ctx, adminId, ports.AdminUserType, ports.SignupKeyViewedAuditAction, uuid.Nil, req.UserType, signupKeyAuditData(req)); err != nil {
+		return nil, err
+	}
 	return &ports.TmpAuthSignupKeyGetResponse{Key: key}, nil
 }
 
-func (s *Auth) SignupKeyGet(ctx context.Context, req *ports.AuthSignupKeyGetRequest) (err error) {
+func (s *Auth) SignupKeyGet(ctx context.Context, req *ports.AuthSignupKeyGetRequest, adminId uuid.UUID) (err error) {
 	defer func() { err = utils.FuncPipe(authCaller+".SignupKeyGet", err) }()
-	return s.SendKey(ctx, req)
+	if err = s.SendKey(ctx, req); err != nil {
+		return err
+	}
+	return s.audit.Record(ctx, adminId, ports.AdminUserType, ports.SignupKeyIssuedAuditAction, uuid.Nil, req.UserType, signupKeyAuditData(req))
+}
+
+func signupKeyAuditData(req *ports.AuthSignupKeyGetRequest) map[string]string {
+	if req.Email != "" {
+		return map[string]string{"email": req.Email}
+	}
+	return map[string]string{"phone_number": req.PhoneNumber}
 }
 
 func (s *Auth) TmpMethodOtpGet(ctx context.Context, req *ports.AuthMethodOtpGetRequest) (resp *ports.TmpAuthMethodOtpGetResponse, err error) {
@@ -193,10 +252,17 @@ func (s *Auth) SignupPost(ctx context.Context, req *ports.AuthSignupPostRequest)
 	if err != nil {
 		return nil, err
 	}
+	s.activity.Record(ctx, resp.User.Id, req.UserType, ports.SignupActivityType, ports.OtpActivityMethod(req.Email != ""), nil)
 	if hasAvatar {
-		if err = s.s3.UploadAvatar(ctx, resp.User.Id, req.UserType, img); err != nil {
+		avatarHash, err := s.s3.UploadAvatar(ctx, resp.User.Id, req.UserType, img)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.rel.UpdateUserAvatarById(ctx, resp.User.Id, req.UserType, avatarHash); err != nil {
 			return nil, err
 		}
+		resp.User.Avatar = ports.GetAvatarUrl(resp.User.Id, req.UserType, avatarHash)
+		resp.User.Avatars = ports.GetAvatarVariants(resp.User.Id, req.UserType, avatarHash)
 	}
 	err = s.GenerateToken(ctx, resp)
 	if err != nil {
@@ -218,6 +284,9 @@ func (s *Auth) SigninPost(ctx context.Context, req *ports.AuthSigninPostRequest)
 	if isDeleted {
 		return nil, utils.UserDeletedResponse.Clone()
 	}
+	defer func() {
+		s.activity.Record(ctx, usrModel.GetId(), req.UserType, ports.SigninActivityType, ports.OtpActivityMethod(req.SentToEmail), err)
+	}()
 	var identity string
 	if req.SentToEmail {
 		identity = usrModel.GetEmail()
@@ -243,6 +312,7 @@ func (s *Auth) SigninPost(ctx context.Context, req *ports.AuthSigninPostRequest)
 	if err != nil {
 		return nil, err
 	}
+	s.notify(ctx, usrModel.GetId(), req.UserType, ports.NewSigninNotificationType, nil)
 	return resp, nil
 }
 
@@ -256,6 +326,9 @@ func (s *Auth) SigninPasswordPost(ctx context.Context, req *ports.AuthSigninPass
 		return nil, utils.UsernameNotFoundResponse.Clone().
 			WithReason("username", req.Username)
 	}
+	defer func() {
+		s.activity.Record(ctx, user.GetId(), req.UserType, ports.SigninActivityType, ports.PasswordActivityMethod, err)
+	}()
 	ok := utils.VerifyPassword(user.GetPassword(), req.Password)
 	if !ok {
 		return nil, utils.PasswordIncorrectResponse.Clone()
@@ -267,22 +340,33 @@ func (s *Auth) SigninPasswordPost(ctx context.Context, req *ports.AuthSigninPass
 	if err != nil {
 		return nil, err
 	}
+	s.notify(ctx, user.GetId(), req.UserType, ports.NewSigninNotificationType, nil)
 	return resp, nil
 }
 
 func (s *Auth) LogoutPost(ctx context.Context, login *ports.Login) (err error) {
 	defer func() { err = utils.FuncPipe(authCaller+".LogoutPost", err) }()
+	defer func() {
+		s.activity.Record(ctx, login.User.Id, login.User.UserType, ports.LogoutActivityType, ports.AccessTokenActivityMethod, err)
+	}()
 	if err := s.cache.AddJwtToBlacklist(ctx, login.Jwt.AccessToken, s.jwtAccessExp); err != nil {
 		return err
 	}
 	if err := s.cache.AddJwtToBlacklist(ctx, login.Jwt.RefreshToken, s.jwtRefreshExp); err != nil {
 		return err
 	}
+	// Sessions streaming events with the token would otherwise outlive it.
+	event := ports.NewUserEvent(login.User.Id, login.User.UserType, ports.LogoutEventType, nil)
+	event.Session = ports.SessionKey(login.Jwt.AccessToken)
+	s.realtime.Publish(ctx, event)
 	return
 }
 
 func (s *Auth) RefreshPost(ctx context.Context, login *ports.Login) (resp *ports.Jwt, err error) {
 	defer func() { err = utils.FuncPipe(authCaller+".RefreshPost", err) }()
+	defer func() {
+		s.activity.Record(ctx, login.User.Id, login.User.UserType, ports.TokenRefreshActivityType, ports.RefreshTokenActivityMethod, err)
+	}()
 	if err = s.GenerateToken(ctx, login); err != nil {
 		return nil, err
 	}
@@ -308,6 +392,9 @@ func (s *Auth) ResetPasswordPost(ctx context.Context, req *ports.AuthResetPasswo
 		return nil, utils.UsernameNotFoundResponse.Clone().
 			WithReason("username", req.Username)
 	}
+	defer func() {
+		s.activity.Record(ctx, user.GetId(), req.UserType, ports.PasswordChangedActivityType, ports.OtpActivityMethod(req.SentToEmail), err)
+	}()
 
 	var identity string
 	if req.SentToEmail {
@@ -329,6 +416,7 @@ func (s *Auth) ResetPasswordPost(ctx context.Context, req *ports.AuthResetPasswo
 	if err = s.rel.UpdateUserPasswordByUsername(ctx, req.Username, req.UserType, req.Password); err != nil {
 		return nil, err
 	}
+	s.notify(ctx, user.GetId(), req.UserType, ports.PasswordChangedNotificationType, nil)
 
 	resp = &ports.Login{
 		User: user.ToUser(),
@@ -354,6 +442,9 @@ func (s *Auth) ResetPhonePost(ctx context.Context, req *ports.AuthResetPhonePost
 		return utils.UserNotFoundResponse.Clone().
 			WithReason("id", req.Id)
 	}
+	defer func() {
+		s.activity.Record(ctx, req.Id, req.UserType, ports.PhoneChangedActivityType, ports.OtpSmsActivityMethod, err)
+	}()
 	prevPhone := user.GetPhoneNumber()
 	cToken, err := s.cache.GetOtpToken(ctx, prevPhone, ports.ChangePhoneOtpType, req.UserType)
 	if err != nil {
@@ -384,6 +475,9 @@ func (s *Auth) ResetEmailPost(ctx context.Context, req *ports.AuthResetEmailPost
 		return utils.UserNotFoundResponse.Clone().
 			WithReason("id", req.Id)
 	}
+	defer func() {
+		s.activity.Record(ctx, req.Id, req.UserType, ports.EmailChangedActivityType, ports.OtpEmailActivityMethod, err)
+	}()
 	prevEmail := user.GetEmail()
 	cToken, err := s.cache.GetOtpToken(ctx, prevEmail, ports.ChangeEmailOtpType, req.UserType)
 	if err != nil {
@@ -398,6 +492,9 @@ func (s *Auth) ResetEmailPost(ctx context.Context, req *ports.AuthResetEmailPost
 	if err = s.rel.UpdateUserEmailById(ctx, req.Id, req.UserType, req.Email); err != nil {
 		return err
 	}
+	s.notify(ctx, req.Id, req.UserType, ports.EmailChangedNotificationType, map[string]string{
+		"email": utils.MaskEmail(req.Email),
+	})
 	return nil
 }
 
@@ -416,6 +513,13 @@ func generateRandomKey() string {
 	return string(result)
 }
 
+// otpIdempotencyKey identifies one issued code, so that a retried request
+// does not send it twice. The code is hashed since the key is stored as is.
+func otpIdempotencyKey(otpType ports.OtpType, userType ports.UserType, identity, code string) string {
+	sum := sha256.Sum256([]byte(string(otpType) + "\x00" + string(userType) + "\x00" + identity + "\x00" + code))
+	return "otp:" + hex.EncodeToString(sum[:])
+}
+
 func (s *Auth) SendOtp(ctx context.Context, req *ports.AuthMethodOtpGetRequest) (resp *ports.AuthMethodOtpGetResponse, err error) {
 	user, isDeleted, err := s.rel.GetUserByUsername(ctx, req.Username, req.UserType)
 	if err != nil {
@@ -432,6 +536,11 @@ func (s *Auth) SendOtp(ctx context.Context, req *ports.AuthMethodOtpGetRequest)
 		return nil, utils.UsernameAlreadyExistsResponse.Clone().
 			WithReason("username", req.Username)
 	}
+	if user != nil {
+		defer func() {
+			s.activity.Record(ctx, user.GetId(), req.UserType, ports.OtpSentActivityType, ports.OtpActivityMethod(req.SendToEmail), err)
+		}()
+	}
 
 	var identity string
 	if req.OtpType == ports.SignupOtpType {
@@ -454,15 +563,29 @@ func (s *Auth) SendOtp(ctx context.Context, req *ports.AuthMethodOtpGetRequest)
 			identity = user.GetPhoneNumber()
 		}
 	}
-	if req.SendToEmail && identity == "" {
-		return nil, utils.UserHasNotSetEmailResponse.Clone()
-	}
 	if !req.SendToEmail && identity == "" {
 		return nil, utils.UserHasNotSetPhoneNumberResponse.Clone()
 	}
+	// The code is emailed to the address signed up with, or else to the one
+	// on the profile, whatever identity it is stored under.
+	var email string
+	if req.SendToEmail {
+		if user != nil {
+			email = user.GetEmail()
+		} else {
+			email = req.Email
+		}
+		if email == "" {
+			return nil, utils.UserHasNotSetEmailResponse.Clone()
+		}
+		// Telling the user now beats an OTP that never arrives.
+		if err = s.suppression.Check(ctx, email); err != nil {
+			return nil, err
+		}
+	}
 
 	if req.SendToEmail {
-		resp = &ports.AuthMethodOtpGetResponse{MaskedEmail: utils.MaskEmail(identity)}
+		resp = &ports.AuthMethodOtpGetResponse{MaskedEmail: utils.MaskEmail(email)}
 	} else {
 		resp = &ports.AuthMethodOtpGetResponse{MaskedPhone: utils.MaskPhone(identity)}
 	}
@@ -478,49 +601,71 @@ func (s *Auth) SendOtp(ctx context.Context, req *ports.AuthMethodOtpGetRequest)
 	if err != nil {
 		return nil, err
 	}
-	if !req.SendToEmail {
-		message := fmt.Sprintf(otpMessages[req.OtpType], token)
-		_, err = s.telecom.NoReplySend(ctx, []string{req.PhoneNumber}, message)
-		return nil, err
+	idempotencyKey := otpIdempotencyKey(req.OtpType, req.UserType, identity, token)
+	var locale ports.Locale
+	if user != nil {
+		locale = user.GetLocale()
 	}
-	subject := otpSubjects[req.OtpType]
-	message, err := otpMails[req.OtpType](emailStruct{
-		Domain:       s.domain,
-		Version:      s.version,
-		Token:        token,
-		SupportEmail: s.supportEmail,
-	})
+	rendered, err := s.render(ctx, ports.OtpMessageTemplateName, locale, req.OtpType, token)
 	if err != nil {
 		return nil, err
 	}
-	_, err = s.mailcom.NoReplySend(ctx, []string{user.GetEmail()}, subject, message)
+	if !req.SendToEmail {
+		message, err := s.outbox.Enqueue(ctx, &ports.OutboundMessage{
+			Channel:        ports.SmsMessageChannel,
+			To:             req.PhoneNumber,
+			Body:           rendered.Sms,
+			IdempotencyKey: idempotencyKey,
+			Ttl:            2 * time.Minute,
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp.MessageId = message.Id
+		return resp, nil
+	}
+	outbound, err := s.outbox.Enqueue(ctx, &ports.OutboundMessage{
+		Channel:        ports.EmailMessageChannel,
+		To:             email,
+		Subject:        rendered.Subject,
+		Body:           rendered.Text,
+		Html:           rendered.Html,
+		IdempotencyKey: idempotencyKey,
+		Ttl:            2 * time.Minute,
+	})
 	if err != nil {
 		return nil, err
 	}
+	resp.MessageId = outbound.Id
 	return resp, nil
 }
 
 func (s *Auth) SendKey(ctx context.Context, req *ports.AuthSignupKeyGetRequest) (err error) {
 	key := generateRandomKey()
+	// The invitee has no profile yet, so the admin's language is used.
+	rendered, err := s.render(ctx, ports.SignupKeyMessageTemplateName, "", ports.AdminSignupKeyOtpType, key)
+	if err != nil {
+		return err
+	}
 	if req.Email != "" {
 		if err = s.rel.CheckUserEmailLimit(ctx, req.Email); err != nil {
 			return err
 		}
-		if err = s.cache.SetOtpKey(ctx, req.Email, key, 48*time.Hour, req.UserType); err != nil {
+		if err = s.suppression.Check(ctx, req.Email); err != nil {
 			return err
 		}
-		subject := otpSubjects[ports.AdminSignupKeyOtpType]
-		var message string
-		message, err = otpMails[ports.AdminSignupKeyOtpType](emailStruct{
-			Domain:       s.domain,
-			Version:      s.version,
-			Token:        key,
-			SupportEmail: s.supportEmail,
-		})
-		if err != nil {
+		if err = s.cache.SetOtpKey(ctx, req.Email, key, 48*time.Hour, req.UserType); err != nil {
 			return err
 		}
-		_, err = s.mailcom.NoReplySend(ctx, []string{req.Email}, subject, message)
+		_, err = s.outbox.Enqueue(ctx, &ports.OutboundMessage{
+			Channel:        ports.EmailMessageChannel,
+			To:             req.Email,
+			Subject:        rendered.Subject,
+			Body:           rendered.Text,
+			Html:           rendered.Html,
+			IdempotencyKey: otpIdempotencyKey(ports.AdminSignupKeyOtpType, req.UserType, req.Email, key),
+			Ttl:            48 * time.Hour,
+		})
 
 	} else {
 		if err = s.rel.CheckUserPhoneLimit(ctx, req.PhoneNumber); err != nil {
@@ -529,12 +674,44 @@ func (s *Auth) SendKey(ctx context.Context, req *ports.AuthSignupKeyGetRequest)
 		if err = s.cache.SetOtpKey(ctx, req.PhoneNumber, key, 48*time.Hour, req.UserType); err != nil {
 			return err
 		}
-		message := otpMessages[ports.AdminSignupKeyOtpType]
-		_, err = s.telecom.NoReplySend(ctx, []string{req.PhoneNumber}, message)
+		_, err = s.outbox.Enqueue(ctx, &ports.OutboundMessage{
+			Channel:        ports.SmsMessageChannel,
+			To:             req.PhoneNumber,
+			Body:           rendered.Sms,
+			IdempotencyKey: otpIdempotencyKey(ports.AdminSignupKeyOtpType, req.UserType, req.PhoneNumber, key),
+			Ttl:            48 * time.Hour,
+		})
 	}
 	return
 }
 
+// notify tells the user about a change to their account. Like recording an
+// activity, it never fails the request that made the change.
+func (s *Auth) notify(ctx context.Context, userId uuid.UUID, userType ports.UserType, notificationType ports.NotificationType, data map[string]string) {
+	if err := s.notification.Notify(ctx, userId, userType, notificationType, data); err != nil {
+		s.logger.Error(ctx, utils.FuncPipe(authCaller+".notify", err), "failed to notify user of "+string(notificationType))
+	}
+}
+
+// render renders a message in the recipient's locale. Without one on their
+// profile, the language of the request that triggered the message is used.
+func (s *Auth) render(ctx context.Context, name ports.MessageTemplateName, locale ports.Locale, otpType ports.OtpType, token string) (message *ports.RenderedMessage, err error) {
+	defer func() { err = utils.FuncPipe(authCaller+".render", err) }()
+	if locale == "" {
+		locale = ports.NegotiateLocale(utils.GetRequestMeta(ctx).AcceptLanguage)
+	}
+	if locale == "" {
+		locale = ports.DefaultLocale
+	}
+	return s.templates.Render(ctx, name, locale, &ports.MessageTemplateData{
+		Token:        token,
+		OtpType:      otpType,
+		Domain:       s.domain,
+		Version:      s.version,
+		SupportEmail: s.supportEmail,
+	})
+}
+
 func (s *Auth) GenerateToken(ctx context.Context, user *ports.Login) (err error) {
 	defer func() { err = utils.FuncPipe(authCaller+".GenerateToken", err) }()
 	now := time.Now()
@@ -600,6 +777,9 @@ func (s *Auth) ParseToken(token string, jwtType ports.JwtType) (login *ports.Log
 		},
 		Jwt: &ports.Jwt{},
 	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		login.Jwt.ExpiresAt = exp.Time
+	}
 	if jwtType == ports.AccessJwtType {
 		login.Jwt.AccessToken = token
 		login.Jwt.RefreshToken = claims["refresh_token"].(string)
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const clientCaller = packageCaller + ".Client"
+
+type Client struct {
+	logger *utils.Logger
+	rel    ports.RelationalRepo
+	mongo  ports.MongoRepo
+}
+
+func NewClientService(
+	logger *utils.Logger,
+	rel ports.RelationalRepo,
+	mongo ports.MongoRepo,
+) ports.ClientService {
+	return &Client{
+		logger: logger,
+		rel:    rel,
+		mongo:  mongo,
+	}
+}
+
+func (s *Client) ProfileGet(ctx context.Context, sourceId uuid.UUID, req *ports.ClientUserRequest) (resp *ports.ClientProfileGetResponse, err error) {
+	defer func() { err = utils.FuncPipe(clientCaller+".ProfileGet", err) }()
+	user, err := s.getVisibleUser(ctx, sourceId, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	relation, err := s.relation(ctx, sourceId, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	following, followers, err := s.mongo.CountRelations(ctx, req.Id, ports.FollowRelationType)
+	if err != nil {
+		return nil, err
+	}
+	return &ports.ClientProfileGetResponse{
+		User:      user.ToUser(),
+		Followers: followers,
+		Following: following,
+		Relation:  relation,
+	}, nil
+}
+
+func (s *Client) RelationGet(ctx context.Context, sourceId uuid.UUID, req *ports.ClientUserRequest) (resp *ports.ClientRelation, err error) {
+	defer func() { err = utils.FuncPipe(clientCaller+".RelationGet", err) }()
+	if _, err := s.getVisibleUser(ctx, sourceId, req.Id); err != nil {
+		return nil, err
+	}
+	return s.relation(ctx, sourceId, req.Id)
+}
+
+func (s *Client) FollowersGet(ctx context.Context, sourceId uuid.UUID, req *ports.ClientUserListGetRequest) (resp *ports.ClientUserListGetResponse, err error) {
+	defer func() { err = utils.FuncPipe(clientCaller+".FollowersGet", err) }()
+	if _, err := s.getVisibleUser(ctx, sourceId, req.Id); err != nil {
+		return nil, err
+	}
+	ids, total, err := s.mongo.GetRelationSources(ctx, req.Id, ports.FollowRelationType, &req.Pagination)
+	if err != nil {
+		return nil, err
+	}
+	return s.userList(ctx, ids, total, &req.Pagination)
+}
+
+func (s *Client) FollowingGet(ctx context.Context, sourceId uuid.UUID, req *ports.ClientUserListGetRequest) (resp *ports.ClientUserListGetResponse, err error) {
+	defer func() { err = utils.FuncPipe(clientCaller+".FollowingGet", err) }()
+	if _, err := s.getVisibleUser(ctx, sourceId, req.Id); err != nil {
+		return nil, err
+	}
+	ids, total, err := s.mongo.GetRelationTargets(ctx, req.Id, ports.FollowRelationType, &req.Pagination)
+	if err != nil {
+		return nil, err
+	}
+	return s.userList(ctx, ids, total, &req.Pagination)
+}
+
+func (s *Client) FollowPost(ctx context.Context, sourceId uuid.UUID, req *ports.ClientUserRequest) (err error) {
+	defer func() { err = utils.FuncPipe(clientCaller+".FollowPost", err) }()
+	if err := s.checkTarget(ctx, sourceId, req.Id); err != nil {
+		return err
+	}
+	if blocked, err := s.isBlockedEitherWay(ctx, sourceId, req.Id); err != nil {
+		return err
+	} else if blocked {
+		return utils.UserIsBlockedResponse.Clone().
+			WithReason("id", req.Id.String())
+	}
+	return s.mongo.AddRelation(ctx, sourceId, req.Id, ports.FollowRelationType)
+}
+
+func (s *Client) FollowDelete(ctx context.Context, sourceId uuid.UUID, req *ports.ClientUserRequest) (err error) {
+	defer func() { err = utils.FuncPipe(clientCaller+".FollowDelete", err) }()
+	return s.mongo.RemoveRelation(ctx, sourceId, req.Id, ports.FollowRelationType)
+}
+
+func (s *Client) BlockPost(ctx context.Context, sourceId uuid.UUID, req *ports.ClientUserRequest) (err error) {
+	defer func() { err = utils.FuncPipe(clientCaller+".BlockPost", err) }()
+	if err := s.checkTarget(ctx, sourceId, req.Id); err != nil {
+		return err
+	}
+	return s.mongo.BlockUser(ctx, sourceId, req.Id)
+}
+
+func (s *Client) BlockDelete(ctx context.Context, sourceId uuid.UUID, req *ports.ClientUserRequest) (err error) {
+	defer func() { err = utils.FuncPipe(clientCaller+".BlockDelete", err) }()
+	return s.mongo.RemoveRelation(ctx, sourceId, req.Id, ports.BlockRelationType)
+}
+
+func (s *Client) BlocksGet(ctx context.Context, sourceId uuid.UUID, pagination *ports.Pagination) (resp *ports.ClientUserListGetResponse, err error) {
+	defer func() { err = utils.FuncPipe(clientCaller+".BlocksGet", err) }()
+	ids, total, err := s.mongo.GetRelationTargets(ctx, sourceId, ports.BlockRelationType, pagination)
+	if err != nil {
+		return nil, err
+	}
+	return s.userList(ctx, ids, total, pagination)
+}
+
+func (s *Client) checkTarget(ctx context.Context, sourceId, targetId uuid.UUID) (err error) {
+	if sourceId == targetId {
+		return utils.BadRequestResponse.Clone().
+			WithReason("id", targetId.String())
+	}
+	_, err = s.getUser(ctx, targetId)
+	return err
+}
+
+// getVisibleUser returns the target user unless the target has blocked the
+// source, in which case the target is reported as not found.
+func (s *Client) getVisibleUser(ctx context.Context, sourceId, targetId uuid.UUID) (user ports.UserModel, err error) {
+	if sourceId != targetId {
+		blocked, err := s.mongo.HasRelation(ctx, targetId, sourceId, ports.BlockRelationType)
+		if err != nil {
+			return nil, err
+		}
+		if blocked {
+			return nil, utils.UserNotFoundResponse.Clone().
+				WithReason("id", targetId.String())
+		}
+	}
+	return s.getUser(ctx, targetId)
+}
+
+func (s *Client) getUser(ctx context.Context, id uuid.UUID) (user ports.UserModel, err error) {
+	user, isDeleted, err := s.rel.GetUserById(ctx, id, ports.ClientUserType)
+	if err != nil {
+		return nil, err
+	}
+	if isDeleted {
+		return nil, utils.UserDeletedResponse.Clone()
+	}
+	if user == nil {
+		return nil, utils.UserNotFoundResponse.Clone().
+			WithReason("id", id.String())
+	}
+	return user, nil
+}
+
+func (s *Client) isBlockedEitherWay(ctx context.Context, sourceId, targetId uuid.UUID) (blocked bool, err error) {
+	if blocked, err = s.mongo.HasRelation(ctx, sourceId, targetId, ports.BlockRelationType); err != nil || blocked {
+		return blocked, err
+	}
+	return s.mongo.HasRelation(ctx, targetId, sourceId, ports.BlockRelationType)
+}
+
+func (s *Client) relation(ctx context.Context, sourceId, targetId uuid.UUID) (relation *ports.ClientRelation, err error) {
+	relation = &ports.ClientRelation{}
+	if sourceId == targetId {
+		return relation, nil
+	}
+	if relation.Following, err = s.mongo.HasRelation(ctx, sourceId, targetId, ports.FollowRelationType); err != nil {
+		return nil, err
+	}
+	if relation.FollowedBy, err = s.mongo.HasRelation(ctx, targetId, sourceId, ports.FollowRelationType); err != nil {
+		return nil, err
+	}
+	if relation.Blocking, err = s.mongo.HasRelation(ctx, sourceId, targetId, ports.BlockRelationType); err != nil {
+		return nil, err
+	}
+	relation.Mutual = relation.Following && relation.FollowedBy
+	return relation, nil
+}
+
+func (s *Client) userList(ctx context.Context, ids []uuid.UUID, total int64, pagination *ports.Pagination) (resp *ports.ClientUserListGetResponse, err error) {
+	users, err := s.rel.GetUsersByIds(ctx, ids, ports.ClientUserType)
+	if err != nil {
+		return nil, err
+	}
+	resp = &ports.ClientUserListGetResponse{
+		Users: make([]*ports.User, 0, len(users)),
+		Page:  pagination.Page,
+		Size:  pagination.Size,
+		Total: total,
+	}
+	for _, user := range users {
+		resp.Users = append(resp.Users, user.ToUser())
+	}
+	return resp, nil
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const deliveryCaller = packageCaller + ".Delivery"
+
+// deliveryWebhookTolerance bounds the age of a signed generic receipt, so a
+// captured request cannot be replayed later.
+const deliveryWebhookTolerance = 5 * time.Minute
+
+type Delivery struct {
+	logger            *utils.Logger
+	mongo             ports.MongoRepo
+	twilioAuthToken   []byte
+	twilioCallbackUrl string
+	webhookSecret     []byte
+}
+
+// NewDeliveryService reads the secrets receipts are signed with. Either may be
+// unset, in which case every receipt of that kind is rejected.
+func NewDeliveryService(logger *utils.Logger, mongo ports.MongoRepo) ports.DeliveryService {
+	return &Delivery{
+		logger:            logger,
+		mongo:             mongo,
+		twilioAuthToken:   []byte(os.Getenv("TWILIO_AUTH_TOKEN")),
+		twilioCallbackUrl: os.Getenv("TWILIO_STATUS_CALLBACK_URL"),
+		webhookSecret:     []byte(os.Getenv("DELIVERY_WEBHOOK_SECRET")),
+	}
+}
+
+// VerifyTwilioSignature checks X-Twilio-Signature, the base64 HMAC-SHA1 of the
+// callback url followed by every posted field and value, sorted by field.
+// Twilio signs the url it was given, so the configured one is used rather
+// than whatever the request looks like behind the proxy.
+func (s *Delivery) VerifyTwilioSignature(signature string, params map[string]string) (err error) {
+	defer func() { err = utils.FuncPipe(deliveryCaller+".VerifyTwilioSignature", err) }()
+	if len(s.twilioAuthToken) == 0 || s.twilioCallbackUrl == "" || signature == "" {
+		return utils.WebhookSignatureInvalidResponse.Clone()
+	}
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	mac := hmac.New(sha1.New, s.twilioAuthToken)
+	mac.Write([]byte(s.twilioCallbackUrl))
+	for _, key := range keys {
+		mac.Write([]byte(key + params[key]))
+	}
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return utils.WebhookSignatureInvalidResponse.Clone()
+	}
+	return nil
+}
+
+// VerifyWebhookSignature checks a generic receipt, signed as the hex
+// HMAC-SHA256 of "<timestamp>.<body>" with DELIVERY_WEBHOOK_SECRET.
+func (s *Delivery) VerifyWebhookSignature(timestamp, signature string, body []byte) (err error) {
+	defer func() { err = utils.FuncPipe(deliveryCaller+".VerifyWebhookSignature", err) }()
+	if len(s.webhookSecret) == 0 || signature == "" {
+		return utils.WebhookSignatureInvalidResponse.Clone()
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return utils.WebhookSignatureInvalidResponse.Clone().
+			WithReason("timestamp", timestamp)
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > deliveryWebhookTolerance || age < -deliveryWebhookTolerance {
+		return utils.WebhookSignatureInvalidResponse.Clone().
+			WithReason("timestamp", timestamp)
+	}
+	mac := hmac.New(sha256.New, s.webhookSecret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return utils.WebhookSignatureInvalidResponse.Clone()
+	}
+	return nil
+}
+
+func (s *Delivery) TwilioStatusCallback(ctx context.Context, req *ports.TwilioStatusCallbackRequest) (err error) {
+	defer func() { err = utils.FuncPipe(deliveryCaller+".TwilioStatusCallback", err) }()
+	receipt := &ports.DeliveryReceipt{
+		Provider:          string(ports.TwilioSmsProviderName),
+		ProviderMessageId: req.MessageSid,
+		ProviderStatus:    req.MessageStatus,
+		ErrorCode:         req.ErrorCode,
+	}
+	switch req.MessageStatus {
+	case "delivered", "read":
+		receipt.Status = ports.DeliveredMessageStatus
+	case "undelivered", "failed", "canceled":
+		receipt.Status = ports.UndeliveredMessageStatus
+	}
+	return s.record(ctx, receipt)
+}
+
+func (s *Delivery) DeliveryWebhook(ctx context.Context, req *ports.DeliveryWebhookRequest) (err error) {
+	defer func() { err = utils.FuncPipe(deliveryCaller+".DeliveryWebhook", err) }()
+	receipt := &ports.DeliveryReceipt{
+		Provider:          req.Provider,
+		ProviderMessageId: req.ProviderMessageId,
+		ProviderStatus:    req.Status,
+		ErrorCode:         req.ErrorCode,
+		ErrorMessage:      req.ErrorMessage,
+		OccurredAt:        req.OccurredAt,
+	}
+	switch req.Status {
+	case "delivered":
+		receipt.Status = ports.DeliveredMessageStatus
+	case "undelivered", "failed", "bounced":
+		receipt.Status = ports.UndeliveredMessageStatus
+	}
+	return s.record(ctx, receipt)
+}
+
+// record answers unknown messages with MessageNotFound so providers retry; a
+// receipt can beat the worker that is still recording the send.
+func (s *Delivery) record(ctx context.Context, receipt *ports.DeliveryReceipt) (err error) {
+	found, err := s.mongo.RecordMessageReceipt(ctx, receipt)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return utils.MessageNotFoundResponse.Clone().
+			WithReason("provider", receipt.Provider).
+			WithReason("provider_message_id", receipt.ProviderMessageId)
+	}
+	return nil
+}
+
+func (s *Delivery) Stats(ctx context.Context, req *ports.AdminMessageStatsGetRequest) (resp *ports.AdminMessageStatsGetResponse, err error) {
+	defer func() { err = utils.FuncPipe(deliveryCaller+".Stats", err) }()
+	buckets, err := s.mongo.GetMessageStats(ctx, req.Channel, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	resp = &ports.AdminMessageStatsGetResponse{
+		ByStatus:  make(map[ports.MessageStatus]int64, len(ports.MessageStatuses())),
+		Providers: []*ports.MessageProviderStats{},
+	}
+	for _, status := range ports.MessageStatuses() {
+		resp.ByStatus[status] = 0
+	}
+	deliverySeconds := map[*ports.MessageProviderStats]float64{}
+	var current *ports.MessageProviderStats
+	for _, bucket := range buckets {
+		resp.Total += bucket.Count
+		resp.ByStatus[bucket.Status] += bucket.Count
+		if bucket.Provider == "" {
+			// Never accepted by anyone: still queued, dead or expired.
+			continue
+		}
+		// Buckets come sorted by channel and provider.
+		if current == nil || current.Channel != bucket.Channel || current.Provider != bucket.Provider {
+			current = &ports.MessageProviderStats{Channel: bucket.Channel, Provider: bucket.Provider}
+			resp.Providers = append(resp.Providers, current)
+		}
+		switch bucket.Status {
+		case ports.SentMessageStatus:
+			current.Accepted += bucket.Count
+		case ports.DeliveredMessageStatus:
+			current.Accepted += bucket.Count
+			current.Delivered += bucket.Count
+			deliverySeconds[current] += bucket.DeliverySeconds
+		case ports.UndeliveredMessageStatus:
+			current.Accepted += bucket.Count
+			current.Undelivered += bucket.Count
+		}
+	}
+	for _, stats := range resp.Providers {
+		if final := stats.Delivered + stats.Undelivered; final > 0 {
+			stats.DeliveryRate = float64(stats.Delivered) / float64(final)
+		}
+		if stats.Delivered > 0 {
+			stats.AvgDeliverySeconds = deliverySeconds[stats] / float64(stats.Delivered)
+		}
+	}
+	return resp, nil
+}
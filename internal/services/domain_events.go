@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const domainEventRelayCaller = packageCaller + ".DomainEventRelay"
+
+type DomainEventRelay struct {
+	logger   *utils.Logger
+	rel      ports.RelationalRepo
+	cache    ports.CacheRepo
+	interval time.Duration
+	batch    int
+}
+
+func NewDomainEventRelayService(logger *utils.Logger, rel ports.RelationalRepo, cache ports.CacheRepo) ports.DomainEventRelayService {
+	return &DomainEventRelay{
+		logger:   logger,
+		rel:      rel,
+		cache:    cache,
+		interval: getenvAsDuration(logger, "DOMAIN_EVENTS_RELAY_INTERVAL", time.Second),
+		batch:    getenvAsPositiveInt(logger, "DOMAIN_EVENTS_RELAY_BATCH", 100),
+	}
+}
+
+func (s *DomainEventRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		relayed, err := s.rel.RelayDomainEvents(ctx, s.batch, func(events []*ports.DomainEvent) error {
+			return s.cache.AppendDomainEvents(ctx, events)
+		})
+		if err != nil {
+			s.logger.Error(ctx, utils.FuncPipe(domainEventRelayCaller+".Run", err), "failed to relay domain events")
+		}
+		// A full batch means more are likely waiting, so the next one is
+		// relayed right away.
+		if relayed == s.batch {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const jobsCaller = packageCaller + ".Jobs"
+
+// jobLeaseTtl is how long the lease on a running job outlives a replica that
+// stops renewing it. It is renewed every third of that while the job runs.
+const jobLeaseTtl = time.Minute
+
+type scheduledJob struct {
+	ports.Job
+	schedule *utils.CronSchedule
+}
+
+type Jobs struct {
+	logger  *utils.Logger
+	cache   ports.CacheRepo
+	mongo   ports.MongoRepo
+	audit   ports.AuditService
+	jobs    []*scheduledJob
+	byName  map[ports.JobName]*scheduledJob
+	owner   string
+	poll    time.Duration
+	wake    chan struct{}
+	mu      sync.Mutex
+	running map[ports.JobName]bool
+}
+
+func NewJobService(logger *utils.Logger, cache ports.CacheRepo, mongo ports.MongoRepo, audit ports.AuditService, jobs []ports.Job) ports.JobService {
+	hostname, _ := os.Hostname()
+	s := &Jobs{
+		logger:  logger,
+		cache:   cache,
+		mongo:   mongo,
+		audit:   audit,
+		byName:  make(map[ports.JobName]*scheduledJob, len(jobs)),
+		owner:   hostname + "/" + uuid.NewString()[:8],
+		poll:    getenvAsDuration(logger, "JOBS_POLL_INTERVAL", 15*time.Second),
+		wake:    make(chan struct{}, 1),
+		running: map[ports.JobName]bool{},
+	}
+	for _, job := range jobs {
+		key := "JOB_" + strings.ToUpper(string(job.Name)) + "_SCHEDULE"
+		spec := job.Schedule
+		if value := os.Getenv(key); value != "" {
+			spec = value
+		}
+		schedule, err := utils.ParseCron(spec)
+		if err != nil {
+			logger.Fatalf(context.Background(), "%s is not valid: %v", key, err)
+		}
+		scheduled := &scheduledJob{Job: job, schedule: schedule}
+		s.jobs = append(s.jobs, scheduled)
+		s.byName[job.Name] = scheduled
+	}
+	return s
+}
+
+func (s *Jobs) Jobs(ctx context.Context) (resp *ports.AdminJobsGetResponse, err error) {
+	defer func() { err = utils.FuncPipe(jobsCaller+".Jobs", err) }()
+	states, err := s.mongo.GetJobStates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[ports.JobName]ports.JobStateModel, len(states))
+	for _, state := range states {
+		byName[state.Name] = state
+	}
+	resp = &ports.AdminJobsGetResponse{Jobs: make([]*ports.JobInfo, 0, len(s.jobs))}
+	for _, job := range s.jobs {
+		// A job no scheduler has seen yet has no state.
+		state, ok := byName[job.Name]
+		if !ok {
+			state = ports.JobStateModel{Name: job.Name}
+		}
+		resp.Jobs = append(resp.Jobs, state.ToJobInfo(job.Description, job.schedule.String(), job.Timeout))
+	}
+	return resp, nil
+}
+
+func (s *Jobs) Runs(ctx context.Context, req *ports.AdminJobRunsGetRequest) (resp *ports.AdminJobRunsGetResponse, err error) {
+	defer func() { err = utils.FuncPipe(jobsCaller+".Runs", err) }()
+	if _, ok := s.byName[req.Name]; !ok {
+		return nil, utils.JobNotFoundResponse.Clone().
+			WithReason("name", string(req.Name))
+	}
+	runs, total, err := s.mongo.GetJobRuns(ctx, req.Name, req.Status, &req.Pagination)
+	if err != nil {
+		return nil, err
+	}
+	resp = &ports.AdminJobRunsGetResponse{
+		Runs:  make([]*ports.JobRun, 0, len(runs)),
+		Page:  req.Page,
+		Size:  req.Size,
+		Total: total,
+	}
+	for _, run := range runs {
+		resp.Runs = append(resp.Runs, run.ToJobRun())
+	}
+	return resp, nil
+}
+
+func (s *Jobs) Trigger(ctx context.Context, name ports.JobName, actorId uuid.UUID) (err error) {
+	defer func() { err = utils.FuncPipe(jobsCaller+".Trigger", err) }()
+	if err = s.initState(ctx, name); err != nil {
+		return err
+	}
+	if _, err = s.mongo.TriggerJob(ctx, name); err != nil {
+		return err
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return s.record(ctx, actorId, ports.JobTriggeredAuditAction, name)
+}
+
+func (s *Jobs) Pause(ctx context.Context, name ports.JobName, actorId uuid.UUID) (err error) {
+	defer func() { err = utils.FuncPipe(jobsCaller+".Pause", err) }()
+	if err = s.initState(ctx, name); err != nil {
+		return err
+	}
+	if _, err = s.mongo.SetJobPaused(ctx, name, true); err != nil {
+		return err
+	}
+	return s.record(ctx, actorId, ports.JobPausedAuditAction, name)
+}
+
+func (s *Jobs) Resume(ctx context.Context, name ports.JobName, actorId uuid.UUID) (err error) {
+	defer func() { err = utils.FuncPipe(jobsCaller+".Resume", err) }()
+	if err = s.initState(ctx, name); err != nil {
+		return err
+	}
+	if _, err = s.mongo.SetJobPaused(ctx, name, false); err != nil {
+		return err
+	}
+	return s.record(ctx, actorId, ports.JobResumedAuditAction, name)
+}
+
+// initState makes sure the job has a state to change, as the admin API may
+// be called before any scheduler created it.
+func (s *Jobs) initState(ctx context.Context, name ports.JobName) (err error) {
+	job, ok := s.byName[name]
+	if !ok {
+		return utils.JobNotFoundResponse.Clone().
+			WithReason("name", string(name))
+	}
+	return s.mongo.InitJobState(ctx, name, job.schedule.Next(time.Now()))
+}
+
+// record audits a change made by an admin. Changes made with the settings
+// command have no actor and are recorded by the command itself.
+func (s *Jobs) record(ctx context.Context, actorId uuid.UUID, action ports.AuditAction, name ports.JobName) (err error) {
+	if actorId == uuid.Nil {
+		return nil
+	}
+	return s.audit.Record(ctx, actorId, ports.AdminUserType, action, uuid.Nil, "", map[string]string{"job": string(name)})
+}
+
+func (s *Jobs) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.poll)
+	defer ticker.Stop()
+	initialized := false
+	for ctx.Err() == nil {
+		if !initialized {
+			initialized = true
+			for _, job := range s.jobs {
+				if err := s.mongo.InitJobState(ctx, job.Name, job.schedule.Next(time.Now())); err != nil {
+					s.logger.Error(ctx, utils.FuncPipe(jobsCaller+".Run", err), "failed to initialize job state")
+					initialized = false
+				}
+			}
+		}
+		if initialized {
+			s.runDue(ctx)
+		}
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+func (s *Jobs) runDue(ctx context.Context) {
+	states, err := s.mongo.GetJobStates(ctx)
+	if err != nil {
+		s.logger.Error(ctx, utils.FuncPipe(jobsCaller+".runDue", err), "failed to get job states")
+		return
+	}
+	now := time.Now()
+	for _, state := range states {
+		job, ok := s.byName[state.Name]
+		if !ok {
+			continue
+		}
+		// A zero NextRunAt is a schedule that never fires, not one long due.
+		due := !state.TriggeredAt.IsZero() || (!state.Paused && !state.NextRunAt.IsZero() && !now.Before(state.NextRunAt))
+		if !due {
+			continue
+		}
+		s.mu.Lock()
+		running := s.running[job.Name]
+		s.running[job.Name] = true
+		s.mu.Unlock()
+		if running {
+			continue
+		}
+		go func(state ports.JobStateModel) {
+			defer func() {
+				s.mu.Lock()
+				delete(s.running, job.Name)
+				s.mu.Unlock()
+			}()
+			if err := s.execute(ctx, job, &state); err != nil {
+				s.logger.Errorf(ctx, utils.FuncPipe(jobsCaller+".runDue", err), "failed to run job %s", job.Name)
+			}
+		}(state)
+	}
+}
+
+// execute runs the job if this replica gets its lease and the state it was
+// found due in is still current.
+func (s *Jobs) execute(ctx context.Context, job *scheduledJob, state *ports.JobStateModel) (err error) {
+	acquired, err := s.cache.AcquireJobLease(ctx, job.Name, s.owner, jobLeaseTtl)
+	if err != nil || !acquired {
+		return err
+	}
+	defer func() {
+		if err := s.cache.ReleaseJobLease(context.WithoutCancel(ctx), job.Name, s.owner); err != nil {
+			s.logger.Error(ctx, utils.FuncPipe(jobsCaller+".execute", err), "failed to release job lease")
+		}
+	}()
+
+	now := time.Now()
+	trigger := ports.ScheduleJobTrigger
+	if !state.TriggeredAt.IsZero() {
+		trigger = ports.ManualJobTrigger
+	}
+	// A manual run before the job is due leaves its schedule as it is.
+	nextRunAt := state.NextRunAt
+	if !now.Before(nextRunAt) {
+		nextRunAt = job.schedule.Next(now)
+	}
+	run := ports.NewJobRunModel(job.Name, trigger, s.owner)
+	started, err := s.mongo.StartJobRun(ctx, state, run, nextRunAt)
+	if err != nil || !started {
+		return err
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, job.Timeout)
+	defer cancel()
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		ticker := time.NewTicker(jobLeaseTtl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-runCtx.Done():
+				return
+			case <-ticker.C:
+				ok, err := s.cache.RenewJobLease(runCtx, job.Name, s.owner, jobLeaseTtl)
+				if err != nil && runCtx.Err() != nil {
+					return
+				}
+				// Another replica may take the job over once the lease is
+				// gone, so this run stops rather than race it.
+				if err != nil || !ok {
+					s.logger.Errorf(ctx, utils.FuncPipe(jobsCaller+".execute", err), "lost the lease on job %s", job.Name)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	s.logger.Infof(ctx, "running job %s (%s)", job.Name, trigger)
+	summary, runErr := s.runJob(runCtx, job)
+	cancel()
+	<-renewed
+
+	run.FinishedAt = time.Now().UTC()
+	run.Summary = summary
+	run.Status = ports.SucceededJobRunStatus
+	if runErr != nil {
+		run.Status = ports.FailedJobRunStatus
+		run.Error = runErr.Error()
+		s.logger.Errorf(ctx, utils.FuncPipe(jobsCaller+".execute", runErr), "job %s failed", job.Name)
+	} else {
+		s.logger.Infof(ctx, "job %s succeeded in %s: %s", job.Name, run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond), summary)
+	}
+	return s.mongo.FinishJobRun(context.WithoutCancel(ctx), run)
+}
+
+func (s *Jobs) runJob(ctx context.Context, job *scheduledJob) (summary string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+// NewJobs returns the periodic jobs every server schedules.
+func NewJobs(
+	logger *utils.Logger,
+	rel ports.RelationalRepo,
+	mongo ports.MongoRepo,
+	s3 ports.S3Repo,
+	audit ports.AuditService,
+) []ports.Job {
+	gc := NewStorageGcService(logger, rel, mongo, s3)
+	retention := getenvAsDuration(logger, "DOMAIN_EVENTS_RETENTION", 7*24*time.Hour)
+	return []ports.Job{
+		{
+			Name:        ports.StorageGcJobName,
+			Description: "Removes stored objects nothing references and fixes flags pointing at missing ones.",
+			Schedule:    "0 3 * * *",
+			Timeout:     time.Hour,
+			Run: func(ctx context.Context) (summary string, err error) {
+				report, err := gc.Run(ctx, &ports.StorageGcOptions{
+					MinAge:       time.Hour,
+					UploadMaxAge: 24 * time.Hour,
+				})
+				if err != nil {
+					return "", err
+				}
+				summary = fmt.Sprintf("%d objects scanned, %d skipped, %d actions, %d failed", report.Scanned, report.Skipped, len(report.Actions), report.Failed())
+				if report.Failed() > 0 {
+					return summary, fmt.Errorf("%d storage gc actions failed", report.Failed())
+				}
+				return summary, nil
+			},
+		},
+		{
+			Name:        ports.DomainEventsPruneJobName,
+			Description: "Deletes published domain events older than DOMAIN_EVENTS_RETENTION from the outbox.",
+			Schedule:    "@hourly",
+			Timeout:     10 * time.Minute,
+			Run: func(ctx context.Context) (summary string, err error) {
+				deleted, err := rel.DeletePublishedDomainEvents(ctx, time.Now().UTC().Add(-retention))
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("%d published domain events deleted", deleted), nil
+			},
+		},
+		{
+			Name:        ports.AuditLogVerifyJobName,
+			Description: "Checks the hash chain of the audit log.",
+			Schedule:    "30 4 * * *",
+			Timeout:     30 * time.Minute,
+			Run: func(ctx context.Context) (summary string, err error) {
+				resp, err := audit.Verify(ctx)
+				if err != nil {
+					return "", err
+				}
+				summary = fmt.Sprintf("%d entries checked", resp.Checked)
+				if !resp.Valid {
+					return summary, fmt.Errorf("audit log is broken at entry %d: %s", resp.BrokenAt, resp.Reason)
+				}
+				return summary, nil
+			},
+		},
+	}
+}
@@ -3,12 +3,16 @@ package services
 import (
 	"bytes"
 	"context"
-	"fmt"
-	"html/template"
 	"os"
+	"slices"
 	"strconv"
-	"sync"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/emersion/go-msgauth/dkim"
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/clients"
 	"github.com/kasragay/backend/internal/ports"
 	"github.com/kasragay/backend/internal/utils"
 
@@ -23,15 +27,21 @@ const (
 	noReplyEmailType emailType = "no-reply"
 )
 
+const smtpMailProvider = "smtp"
+
 type Mailcom struct {
-	logger    *utils.Logger
-	host      string
-	port      int
-	emails    map[emailType][2]string
-	revEmails map[string]emailType
+	logger      *utils.Logger
+	suppression ports.SuppressionService
+	smtp        ports.SmtpClient
+	dkim        *dkim.SignOptions
+	dkimDomain  string
+	selector    string
+	dkimSigned  atomic.Int64
+	emails      map[emailType][2]string
+	revEmails   map[string]emailType
 }
 
-func NewMailcomService(logger *utils.Logger) ports.MailcomService {
+func NewMailcomService(logger *utils.Logger, suppression ports.SuppressionService) ports.MailcomService {
 	host := os.Getenv("SMTP_HOST")
 	if host == "" {
 		logger.Fatal(context.Background(), "SMTP_HOST is not set")
@@ -44,6 +54,7 @@ func NewMailcomService(logger *utils.Logger) ports.MailcomService {
 	if err != nil {
 		logger.Fatal(context.Background(), "SMTP_PORT is not valid")
 	}
+	tlsMode := getenvAsMailTlsMode(logger, "SMTP_TLS", clients.StartTlsMailTlsMode)
 	noReplyEmail := os.Getenv("NOREPLY_EMAIL")
 	if noReplyEmail == "" {
 		logger.Fatal(context.Background(), "NOREPLY_EMAIL is not set")
@@ -52,13 +63,23 @@ func NewMailcomService(logger *utils.Logger) ports.MailcomService {
 		logger.Fatal(context.Background(), "NOREPLY_EMAIL is not valid")
 	}
 	noReplyPassword := os.Getenv("NOREPLY_EMAIL_PASSWORD")
-	if noReplyPassword == "" {
+	if noReplyPassword == "" && tlsMode != clients.NoneMailTlsMode {
 		logger.Fatal(context.Background(), "NOREPLY_EMAIL_PASSWORD is not set")
 	}
-	return &Mailcom{
-		logger: logger,
-		host:   host,
-		port:   port_,
+	s := &Mailcom{
+		logger:      logger,
+		suppression: suppression,
+		smtp: clients.NewSmtpPool(logger, clients.SmtpPoolOptions{
+			Host:        host,
+			Port:        port_,
+			Username:    noReplyEmail,
+			Password:    noReplyPassword,
+			Tls:         tlsMode,
+			Size:        getenvAsPositiveInt(logger, "SMTP_POOL_SIZE", 4),
+			Timeout:     getenvAsDuration(logger, "SMTP_TIMEOUT", 30*time.Second),
+			HealthCheck: getenvAsDuration(logger, "SMTP_HEALTH_CHECK", 30*time.Second),
+			IdleTimeout: getenvAsDuration(logger, "SMTP_IDLE_TIMEOUT", 5*time.Minute),
+		}),
 		emails: map[emailType][2]string{
 			noReplyEmailType: {noReplyEmail, noReplyPassword},
 		},
@@ -66,131 +87,102 @@ func NewMailcomService(logger *utils.Logger) ports.MailcomService {
 			noReplyEmail: noReplyEmailType,
 		},
 	}
+	s.loadDkim(noReplyEmail)
+	return s
 }
 
-func (s *Mailcom) NoReplySend(ctx context.Context, dst []string, subject, message string) (success []string, err error) {
-	defer func() { err = utils.FuncPipe(mailcomCaller+".NoReplySend", err) }()
-	type resp struct {
-		addr string
-		err  error
-	}
-	respChan := make(chan *resp) // Unbuffered channel
-	var wg sync.WaitGroup
+// loadDkim sets up signing when a selector is configured. The key is read
+// from DKIM_PRIVATE_KEY, or from the file DKIM_PRIVATE_KEY_FILE points at.
+func (s *Mailcom) loadDkim(noReplyEmail string) {
+	selector := os.Getenv("DKIM_SELECTOR")
+	if selector == "" {
+		s.logger.Infof(context.Background(), "DKIM_SELECTOR is not set, emails are sent unsigned")
+		return
+	}
+	key := []byte(os.Getenv("DKIM_PRIVATE_KEY"))
+	if file := os.Getenv("DKIM_PRIVATE_KEY_FILE"); len(key) == 0 && file != "" {
+		var err error
+		if key, err = os.ReadFile(file); err != nil {
+			s.logger.Fatalf(context.Background(), "Failed to read DKIM_PRIVATE_KEY_FILE: %v", err)
+		}
+	}
+	if len(key) == 0 {
+		s.logger.Fatal(context.Background(), "DKIM_PRIVATE_KEY or DKIM_PRIVATE_KEY_FILE is not set")
+	}
+	domain := os.Getenv("DKIM_DOMAIN")
+	if domain == "" {
+		_, domain, _ = strings.Cut(noReplyEmail, "@")
+	}
+	options, err := utils.NewDkimSignOptions(domain, selector, key)
+	if err != nil {
+		s.logger.Fatalf(context.Background(), "DKIM private key is not valid: %v", err)
+	}
+	s.dkim, s.dkimDomain, s.selector = options, domain, selector
+}
 
-	for _, d := range dst {
-		wg.Add(1)
-		go func(d string) {
-			defer wg.Done()
-			respChan <- &resp{
-				addr: d,
-				err:  s.send(ctx, s.emails[noReplyEmailType], d, subject, message),
-			}
-		}(d)
+func (s *Mailcom) Stats() *ports.AdminMailStatsGetResponse {
+	return &ports.AdminMailStatsGetResponse{
+		Smtp:         s.smtp.Stats(),
+		DkimDomain:   s.dkimDomain,
+		DkimSelector: s.selector,
+		DkimSigned:   s.dkimSigned.Load(),
 	}
+}
 
-	go func() {
-		wg.Wait()
-		close(respChan)
-	}()
-	for resp_ := range respChan {
-		if resp_.err != nil {
-			err = resp_.err // Consider collecting all errors
-		} else {
-			success = append(success, resp_.addr)
-		}
+// Deliver sends the text and html bodies as alternatives of one message from
+// the no-reply address, unless dst is suppressed. SMTP assigns no id of its
+// own, so the Message-ID header doubles as the provider message id that bounce
+// and DSN receipts refer to.
+func (s *Mailcom) Deliver(ctx context.Context, dst, subject, text, html string) (provider, providerMessageId string, err error) {
+	defer func() { err = utils.FuncPipe(mailcomCaller+".Deliver", err) }()
+	if err = s.suppression.Check(ctx, dst); err != nil {
+		return "", "", err
 	}
-	return
+	src := s.emails[noReplyEmailType]
+	_, domain, _ := strings.Cut(src[0], "@")
+	messageId := "<" + uuid.NewString() + "@" + domain + ">"
+	if err = s.send(ctx, src, dst, subject, text, html, messageId); err != nil {
+		return "", "", err
+	}
+	return smtpMailProvider, messageId, nil
 }
 
-func (s *Mailcom) send(ctx context.Context, src [2]string, dst, subject, htmlBody string) (err error) {
+func (s *Mailcom) send(ctx context.Context, src [2]string, dst, subject, text, html, messageId string) (err error) {
 	defer func() { err = utils.FuncPipe(mailcomCaller+".send", err) }()
-	// TODO_DEL
-	if true {
-		return nil
-	}
 	m := gomail.NewMessage()
 	m.SetHeader("From", src[0])
 	m.SetHeader("To", dst)
 	m.SetHeader("Subject", subject)
-	m.SetBody("text/html", htmlBody)
-	d := gomail.NewDialer(s.host, s.port, src[0], src[1])
-	result := make(chan error, 1)
-	go func() {
-		defer close(result)
-		if err := d.DialAndSend(m); err != nil {
-			result <- fmt.Errorf("failed to send email: %w", err)
-		}
-	}()
-
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case err := <-result:
+	m.SetHeader("Message-ID", messageId)
+	m.SetDateHeader("Date", time.Now())
+	// Clients show the last alternative they can render, so html goes last.
+	m.SetBody("text/plain", text)
+	if html != "" {
+		m.AddAlternative("text/html", html)
+	}
+	var buf bytes.Buffer
+	if _, err = m.WriteTo(&buf); err != nil {
 		return err
 	}
-}
-
-type emailStruct struct {
-	Domain       string
-	Version      string
-	OtpType_     string
-	Token        string
-	SupportEmail string
-}
-
-func emailBody(otpType ports.OtpType) func(input emailStruct) (string, error) {
-	// Parse the template once during initialization.
-	t, err := template.ParseFiles("./templates/otp_email.html")
-	if err != nil {
-		// Panic during initialization if template file is missing or invalid.
-		// In a production system, you might want to log this and handle it gracefully.
-		panic(fmt.Sprintf("failed to parse template file: %v", err))
-	}
-	return func(input emailStruct) (string, error) {
-		// Validate input fields to prevent rendering issues.
-		if input.Domain == "" || input.Version == "" || input.Token == "" || input.SupportEmail == "" {
-			return "", fmt.Errorf("missing required emailStruct fields")
+	msg := buf.Bytes()
+	if s.dkim != nil {
+		var signed bytes.Buffer
+		if err = dkim.Sign(&signed, bytes.NewReader(msg), s.dkim); err != nil {
+			return err
 		}
-
-		switch otpType {
-		case ports.AdminSignupKeyOtpType:
-			input.OtpType_ = "Admin Signup Key"
-		case ports.SignupOtpType:
-			input.OtpType_ = "Signup"
-		case ports.SigninOtpType:
-			input.OtpType_ = "Signin"
-		case ports.ChangePasswordOtpType:
-			input.OtpType_ = "Change Password"
-		case ports.ChangePhoneOtpType:
-			input.OtpType_ = "Change Phone"
-		case ports.DeleteAccountOtpType:
-			input.OtpType_ = "Delete Account"
-		}
-		var buf bytes.Buffer
-		err = t.Execute(&buf, input)
-		if err != nil {
-			return "", fmt.Errorf("failed to execute template: %w", err)
-		}
-		return buf.String(), nil
+		msg = signed.Bytes()
+		s.dkimSigned.Add(1)
 	}
+	return s.smtp.Send(ctx, src[0], []string{dst}, msg)
 }
 
-// otpSubjects maps OTP types to email subject lines.
-var otpSubjects = map[ports.OtpType]string{
-	ports.AdminSignupKeyOtpType: "Admin Signup Key - Kasragay",
-	ports.SignupOtpType:         "Signup Otp - Kasragay",
-	ports.SigninOtpType:         "Signin Otp - Kasragay",
-	ports.ChangePhoneOtpType:    "Change Phone Otp - Kasragay",
-	ports.ChangePasswordOtpType: "Change Password Otp - Kasragay",
-	ports.DeleteAccountOtpType:  "Delete Account Otp - Kasragay",
-}
-
-// otpMails maps OTP types to email body generator functions.
-var otpMails = map[ports.OtpType]func(input emailStruct) (string, error){
-	ports.AdminSignupKeyOtpType: emailBody(ports.AdminSignupKeyOtpType),
-	ports.SignupOtpType:         emailBody(ports.SignupOtpType),
-	ports.SigninOtpType:         emailBody(ports.SigninOtpType),
-	ports.ChangePhoneOtpType:    emailBody(ports.ChangePhoneOtpType),
-	ports.ChangePasswordOtpType: emailBody(ports.ChangePasswordOtpType),
-	ports.DeleteAccountOtpType:  emailBody(ports.DeleteAccountOtpType),
+func getenvAsMailTlsMode(logger *utils.Logger, key string, defaultValue clients.MailTlsMode) clients.MailTlsMode {
+	value := clients.MailTlsMode(os.Getenv(key))
+	if value == "" {
+		return defaultValue
+	}
+	if !slices.Contains(clients.MailTlsModes(), value) {
+		logger.Fatalf(context.Background(), "%s must be starttls, tls or none", key)
+	}
+	return value
 }
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const mediaCaller = packageCaller + ".Media"
+
+// sniffLength is the amount of bytes http.DetectContentType looks at.
+const sniffLength = 512
+
+type Media struct {
+	logger           *utils.Logger
+	cache            ports.CacheRepo
+	mongo            ports.MongoRepo
+	s3               ports.S3Repo
+	audit            ports.AuditService
+	quota            int64
+	uploadSessionExp time.Duration
+	downloadUrlExp   time.Duration
+}
+
+func NewMediaService(
+	logger *utils.Logger,
+	cache ports.CacheRepo,
+	mongo ports.MongoRepo,
+	s3 ports.S3Repo,
+	audit ports.AuditService,
+) ports.MediaService {
+	quota := int64(1024)
+	if quota_ := os.Getenv("MEDIA_USER_QUOTA_MB"); quota_ != "" {
+		var err error
+		quota, err = strconv.ParseInt(quota_, 10, 64)
+		if err != nil || quota <= 0 {
+			logger.Fatal(context.Background(), "MEDIA_USER_QUOTA_MB must be a positive integer")
+		}
+	}
+	uploadSessionExp, err := utils.GetenvAsMinuteDuration("UPLOAD_SESSION_EXP", 15*time.Minute, false)
+	if err != nil {
+		logger.Fatal(context.Background(), err.Error())
+	}
+	downloadUrlExp, err := utils.GetenvAsMinuteDuration("MEDIA_DOWNLOAD_URL_EXP", 10*time.Minute, false)
+	if err != nil {
+		logger.Fatal(context.Background(), err.Error())
+	}
+	return &Media{
+		logger:           logger,
+		cache:            cache,
+		mongo:            mongo,
+		s3:               s3,
+		audit:            audit,
+		quota:            quota * 1024 * 1024,
+		uploadSessionExp: uploadSessionExp,
+		downloadUrlExp:   downloadUrlExp,
+	}
+}
+
+func (s *Media) UploadPost(ctx context.Context, ownerId uuid.UUID, ownerType ports.UserType, req *ports.MediaUploadPostRequest) (resp *ports.UploadSession, err error) {
+	defer func() { err = utils.FuncPipe(mediaCaller+".UploadPost", err) }()
+	spec := ports.MediaPurposeSpecs[req.Purpose]
+	if !slices.Contains(spec.ContentTypes, utils.BaseContentType(req.ContentType)) {
+		return nil, utils.UnsupportedMediaTypeResponse.Clone().
+			WithReason("content_type", req.ContentType).
+			WithReason("valid_content_types", spec.ContentTypes)
+	}
+	if req.Size > spec.MaxSize {
+		return nil, utils.BadRequestResponse.Clone().
+			WithReason("size", req.Size).
+			WithReason("max_size", spec.MaxSize)
+	}
+	if err = s.checkQuota(ctx, ownerId, ownerType, req.Size); err != nil {
+		return nil, err
+	}
+	session := ports.NewUploadSessionModel(ownerId, ownerType, ports.MediaUploadPurpose, req.ContentType, req.Size, s.uploadSessionExp)
+	session.MediaPurpose = req.Purpose
+	session.MediaAcl = req.Acl
+	url, headers, err := s.s3.PresignUpload(ctx, session.ObjectName, session.ContentType, session.Size, s.uploadSessionExp)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.cache.SetUploadSession(ctx, session, s.uploadSessionExp); err != nil {
+		return nil, err
+	}
+	return &ports.UploadSession{
+		SessionId: session.Id,
+		Method:    http.MethodPut,
+		Url:       url,
+		Headers:   headers,
+		ExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+func (s *Media) UploadCompletePost(ctx context.Context, ownerId uuid.UUID, ownerType ports.UserType, req *ports.MediaUploadCompletePostRequest) (resp *ports.Media, err error) {
+	defer func() { err = utils.FuncPipe(mediaCaller+".UploadCompletePost", err) }()
+	session, err := s.cache.GetUploadSession(ctx, req.SessionId)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.Purpose != ports.MediaUploadPurpose || !session.IsOwnedBy(ownerId, ownerType) {
+		return nil, utils.UploadSessionNotFoundResponse.Clone().
+			WithReason("session_id", req.SessionId.String())
+	}
+	head, size, err := s.s3.PeekUpload(ctx, session.ObjectName, sniffLength)
+	if err != nil {
+		return nil, err
+	}
+	if head == nil {
+		return nil, utils.UploadNotReceivedResponse.Clone().
+			WithReason("session_id", req.SessionId.String())
+	}
+	promoted := false
+	defer func() {
+		if !promoted {
+			if err := s.s3.DeleteUpload(ctx, session.ObjectName); err != nil {
+				s.logger.Error(ctx, err, "failed to delete upload "+session.ObjectName)
+			}
+		}
+		if err := s.cache.DeleteUploadSession(ctx, session.Id); err != nil {
+			s.logger.Error(ctx, err, "failed to delete upload session "+session.Id.String())
+		}
+	}()
+	if size != session.Size {
+		return nil, utils.BadRequestResponse.Clone().
+			WithReason("size", size).
+			WithReason("expected_size", session.Size)
+	}
+	sniffed := utils.SniffContentType(head)
+	if sniffed != utils.BaseContentType(session.ContentType) {
+		return nil, utils.MediaTypeMismatchResponse.Clone().
+			WithReason("content_type", session.ContentType).
+			WithReason("detected_content_type", sniffed)
+	}
+	// Another upload may have completed since the session was opened.
+	if err = s.checkQuota(ctx, ownerId, ownerType, size); err != nil {
+		return nil, err
+	}
+	media := ports.NewMediaModel(session.Id, ownerId, ownerType, session.MediaPurpose, session.MediaAcl, session.ContentType, size)
+	if err = s.s3.PromoteUpload(ctx, session.ObjectName, media.Purpose, media.ObjectName, media.ContentType); err != nil {
+		return nil, err
+	}
+	promoted = true
+	if err = s.mongo.AddMedia(ctx, media); err != nil {
+		if err := s.s3.DeleteMedia(ctx, media.Purpose, media.ObjectName); err != nil {
+			s.logger.Error(ctx, err, "failed to delete orphaned media "+media.ObjectName)
+		}
+		return nil, err
+	}
+	return media.ToMedia(), nil
+}
+
+func (s *Media) MediaListGet(ctx context.Context, ownerId uuid.UUID, ownerType ports.UserType, pagination *ports.Pagination) (resp *ports.MediaListGetResponse, err error) {
+	defer func() { err = utils.FuncPipe(mediaCaller+".MediaListGet", err) }()
+	media, total, err := s.mongo.GetMediaByOwner(ctx, ownerId, ownerType, pagination)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := s.mongo.GetMediaUsage(ctx, ownerId, ownerType)
+	if err != nil {
+		return nil, err
+	}
+	resp = &ports.MediaListGetResponse{
+		Media: make([]*ports.Media, 0, len(media)),
+		Page:  pagination.Page,
+		Size:  pagination.Size,
+		Total: total,
+		Usage: usage,
+		Quota: s.quota,
+	}
+	for _, m := range media {
+		resp.Media = append(resp.Media, m.ToMedia())
+	}
+	return resp, nil
+}
+
+func (s *Media) MediaGet(ctx context.Context, userId uuid.UUID, userType ports.UserType, req *ports.MediaRequest) (resp *ports.Media, err error) {
+	defer func() { err = utils.FuncPipe(mediaCaller+".MediaGet", err) }()
+	media, err := s.getReadable(ctx, userId, userType, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return media.ToMedia(), nil
+}
+
+func (s *Media) DownloadGet(ctx context.Context, userId uuid.UUID, userType ports.UserType, req *ports.MediaRequest) (resp *ports.MediaDownloadGetResponse, err error) {
+	defer func() { err = utils.FuncPipe(mediaCaller+".DownloadGet", err) }()
+	media, err := s.getReadable(ctx, userId, userType, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	url, err := s.s3.PresignMediaDownload(ctx, media.Purpose, media.ObjectName, s.downloadUrlExp)
+	if err != nil {
+		return nil, err
+	}
+	return &ports.MediaDownloadGetResponse{
+		Url:       url,
+		ExpiresAt: time.Now().UTC().Add(s.downloadUrlExp),
+	}, nil
+}
+
+func (s *Media) AclPut(ctx context.Context, userId uuid.UUID, userType ports.UserType, req *ports.MediaAclPutRequest) (err error) {
+	defer func() { err = utils.FuncPipe(mediaCaller+".AclPut", err) }()
+	media, err := s.getManageable(ctx, userId, userType, req.Id)
+	if err != nil {
+		return err
+	}
+	if err = s.mongo.UpdateMediaAcl(ctx, req.Id, req.Acl); err != nil {
+		return err
+	}
+	if media.IsOwnedBy(userId, userType) {
+		return nil
+	}
+	return s.audit.Record(
+		ctx, userId, userType, ports.MediaAclChangedAuditAction, uuid.MustParse(media.OwnerId), media.OwnerType,
+		map[string]string{"media_id": media.Id, "purpose": string(media.Purpose), "from": string(media.Acl), "to": string(req.Acl)},
+	)
+}
+
+func (s *Media) MediaDelete(ctx context.Context, userId uuid.UUID, userType ports.UserType, req *ports.MediaRequest) (err error) {
+	defer func() { err = utils.FuncPipe(mediaCaller+".MediaDelete", err) }()
+	media, err := s.getManageable(ctx, userId, userType, req.Id)
+	if err != nil {
+		return err
+	}
+	if err = s.s3.DeleteMedia(ctx, media.Purpose, media.ObjectName); err != nil {
+		return err
+	}
+	if err = s.mongo.DeleteMedia(ctx, req.Id); err != nil {
+		return err
+	}
+	if media.IsOwnedBy(userId, userType) {
+		return nil
+	}
+	return s.audit.Record(
+		ctx, userId, userType, ports.MediaDeletedAuditAction, uuid.MustParse(media.OwnerId), media.OwnerType,
+		map[string]string{"media_id": media.Id, "purpose": string(media.Purpose)},
+	)
+}
+
+// getReadable hides media the user may not read behind MediaNotFound, so ids
+// of private objects cannot be probed.
+func (s *Media) getReadable(ctx context.Context, userId uuid.UUID, userType ports.UserType, id uuid.UUID) (media *ports.MediaModel, err error) {
+	media, err = s.mongo.GetMedia(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if media == nil || !media.CanRead(userId, userType) {
+		return nil, utils.MediaNotFoundResponse.Clone().
+			WithReason("id", id.String())
+	}
+	return media, nil
+}
+
+func (s *Media) getManageable(ctx context.Context, userId uuid.UUID, userType ports.UserType, id uuid.UUID) (media *ports.MediaModel, err error) {
+	media, err = s.getReadable(ctx, userId, userType, id)
+	if err != nil {
+		return nil, err
+	}
+	if !media.CanManage(userId, userType) {
+		return nil, utils.JwtUnauthorizedResponse.Clone()
+	}
+	return media, nil
+}
+
+func (s *Media) checkQuota(ctx context.Context, ownerId uuid.UUID, ownerType ports.UserType, size int64) (err error) {
+	usage, err := s.mongo.GetMediaUsage(ctx, ownerId, ownerType)
+	if err != nil {
+		return err
+	}
+	if usage+size > s.quota {
+		return utils.MediaQuotaExceededResponse.Clone().
+			WithReason("usage", usage).
+			WithReason("size", size).
+			WithReason("quota", s.quota)
+	}
+	return nil
+}
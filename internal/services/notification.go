@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const notificationCaller = packageCaller + ".Notification"
+
+// notificationTimeLayout is how notifications show when the event happened.
+// It is always UTC, as the recipient's time zone is unknown.
+const notificationTimeLayout = "2006-01-02 15:04 UTC"
+
+type Notification struct {
+	logger       *utils.Logger
+	rel          ports.RelationalRepo
+	mongo        ports.MongoRepo
+	outbox       ports.OutboxService
+	templates    ports.TemplateService
+	realtime     ports.RealtimeService
+	domain       string
+	version      string
+	supportEmail string
+}
+
+// NewNotificationService returns a service that only serves the inbox and
+// preferences when outbox and templates are nil; Notify then fails.
+func NewNotificationService(
+	logger *utils.Logger,
+	rel ports.RelationalRepo,
+	mongo ports.MongoRepo,
+	outbox ports.OutboxService,
+	templates ports.TemplateService,
+	realtime ports.RealtimeService,
+) ports.NotificationService {
+	s := &Notification{
+		logger:    logger,
+		rel:       rel,
+		mongo:     mongo,
+		outbox:    outbox,
+		templates: templates,
+		realtime:  realtime,
+	}
+	if templates == nil {
+		return s
+	}
+	if s.domain = os.Getenv("DOMAIN"); s.domain == "" {
+		logger.Fatal(context.Background(), "DOMAIN is not set")
+	}
+	if s.version = os.Getenv("VERSION"); s.version == "" {
+		logger.Fatal(context.Background(), "VERSION is not set")
+	}
+	if s.supportEmail = os.Getenv("SUPPORT_EMAIL"); s.supportEmail == "" {
+		logger.Fatal(context.Background(), "SUPPORT_EMAIL is not set")
+	}
+	return s
+}
+
+// Notify renders the notification once, in the user's locale, and hands it
+// to every channel the user wants it on. Channels the user has no contact
+// for are skipped. A failing channel does not stop the others; their errors
+// are returned together.
+func (s *Notification) Notify(ctx context.Context, userId uuid.UUID, userType ports.UserType, notificationType ports.NotificationType, data map[string]string) (err error) {
+	defer func() { err = utils.FuncPipe(notificationCaller+".Notify", err) }()
+	if s.templates == nil || s.outbox == nil {
+		return errors.New("notification service was created without an outbox")
+	}
+	preferences, err := s.mongo.GetNotificationPreferences(ctx, userId, userType)
+	if err != nil {
+		return err
+	}
+	channels := preferences.ChannelsFor(notificationType)
+	if len(channels) == 0 {
+		return nil
+	}
+	// Notifications often follow a write to the user, as on signup, and may
+	// be sent from a context that does not track it.
+	user, isDeleted, err := s.rel.GetUserById(utils.WithPrimary(ctx), userId, userType)
+	if err != nil {
+		return err
+	}
+	if user == nil || isDeleted {
+		return nil
+	}
+	locale := user.GetLocale()
+	if locale == "" {
+		locale = ports.DefaultLocale
+	}
+	// Templates refer to every field, so the ones the caller left out are
+	// filled from the request.
+	meta := utils.GetRequestMeta(ctx)
+	now := time.Now().UTC()
+	fields := map[string]string{
+		"time":       now.Format(notificationTimeLayout),
+		"ip":         meta.Ip,
+		"user_agent": meta.UserAgent,
+	}
+	maps.Copy(fields, data)
+	templateData := &ports.MessageTemplateData{
+		Domain:       s.domain,
+		Version:      s.version,
+		SupportEmail: s.supportEmail,
+		Data:         fields,
+	}
+	// Every channel renders only the parts it sends, so one that cannot be
+	// rendered, like an SMS over smsMaxSegments, leaves the others be.
+	render := func(parts ...ports.MessageTemplatePart) (*ports.RenderedMessage, error) {
+		return s.templates.Render(ctx, notificationType.Template(), locale, templateData, parts...)
+	}
+
+	var errs []error
+	for _, channel := range channels {
+		switch channel {
+		case ports.InAppNotificationChannel:
+			rendered, err := render(ports.SubjectMessageTemplatePart, ports.TextMessageTemplatePart)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			notification := ports.NewNotificationModel(userId, userType, notificationType, rendered.Subject, rendered.Text, fields)
+			if err := s.mongo.AddNotification(ctx, notification); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			s.realtime.Publish(ctx, ports.NewUserEvent(userId, userType, ports.NotificationEventType, notification.ToNotification()))
+		case ports.EmailNotificationChannel:
+			if email := user.GetEmail(); email != "" {
+				rendered, err := render(ports.SubjectMessageTemplatePart, ports.TextMessageTemplatePart, ports.HtmlMessageTemplatePart)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				_, err = s.outbox.Enqueue(ctx, &ports.OutboundMessage{
+					Channel: ports.EmailMessageChannel,
+					To:      email,
+					Subject: rendered.Subject,
+					Body:    rendered.Text,
+					Html:    rendered.Html,
+				})
+				errs = append(errs, err)
+			}
+		case ports.SmsNotificationChannel:
+			if phone := user.GetPhoneNumber(); phone != "" {
+				rendered, err := render(ports.SmsMessageTemplatePart)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				_, err = s.outbox.Enqueue(ctx, &ports.OutboundMessage{
+					Channel: ports.SmsMessageChannel,
+					To:      phone,
+					Body:    rendered.Sms,
+				})
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Notification) NotificationsGet(ctx context.Context, req *ports.UserNotificationsGetRequest) (resp *ports.UserNotificationsGetResponse, err error) {
+	defer func() { err = utils.FuncPipe(notificationCaller+".NotificationsGet", err) }()
+	notifications, total, err := s.mongo.GetNotifications(ctx, req.Id, req.UserType, req.Unread, &req.Pagination)
+	if err != nil {
+		return nil, err
+	}
+	unread := total
+	if !req.Unread {
+		if unread, err = s.mongo.CountUnreadNotifications(ctx, req.Id, req.UserType); err != nil {
+			return nil, err
+		}
+	}
+	resp = &ports.UserNotificationsGetResponse{
+		Notifications: make([]*ports.Notification, 0, len(notifications)),
+		Unread:        unread,
+		Page:          req.Page,
+		Size:          req.Size,
+		Total:         total,
+	}
+	for _, notification := range notifications {
+		resp.Notifications = append(resp.Notifications, notification.ToNotification())
+	}
+	return resp, nil
+}
+
+func (s *Notification) NotificationsReadPost(ctx context.Context, req *ports.UserNotificationsReadPostRequest) (resp *ports.UserNotificationsReadPostResponse, err error) {
+	defer func() { err = utils.FuncPipe(notificationCaller+".NotificationsReadPost", err) }()
+	updated, err := s.mongo.MarkNotificationsRead(ctx, req.Id, req.UserType, req.Ids)
+	if err != nil {
+		return nil, err
+	}
+	unread, err := s.mongo.CountUnreadNotifications(ctx, req.Id, req.UserType)
+	if err != nil {
+		return nil, err
+	}
+	return &ports.UserNotificationsReadPostResponse{Updated: updated, Unread: unread}, nil
+}
+
+func (s *Notification) PreferencesGet(ctx context.Context, req *ports.UserNotificationPreferencesGetRequest) (resp *ports.UserNotificationPreferencesGetResponse, err error) {
+	defer func() { err = utils.FuncPipe(notificationCaller+".PreferencesGet", err) }()
+	preferences, err := s.mongo.GetNotificationPreferences(ctx, req.Id, req.UserType)
+	if err != nil {
+		return nil, err
+	}
+	return &ports.UserNotificationPreferencesGetResponse{Preferences: preferences.ToNotificationPreferences()}, nil
+}
+
+func (s *Notification) PreferencesPut(ctx context.Context, req *ports.UserNotificationPreferencesPutRequest) (resp *ports.UserNotificationPreferencesGetResponse, err error) {
+	defer func() { err = utils.FuncPipe(notificationCaller+".PreferencesPut", err) }()
+	channels := make(map[ports.NotificationType][]ports.NotificationChannel, len(req.Preferences))
+	for _, preference := range req.Preferences {
+		if _, ok := channels[preference.Type]; ok {
+			return nil, utils.BadRequestResponse.Clone().
+				WithReason("type", "listed more than once: "+string(preference.Type))
+		}
+		channels[preference.Type] = slices.Clone(preference.Channels)
+	}
+	if err = s.mongo.SetNotificationPreferences(ctx, req.Id, req.UserType, channels); err != nil {
+		return nil, err
+	}
+	return s.PreferencesGet(ctx, &ports.UserNotificationPreferencesGetRequest{Id: req.Id, UserType: req.UserType})
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const outboxCaller = packageCaller + ".Outbox"
+
+// outboxPollInterval is how often idle workers look for due retries. New
+// messages wake a worker right away.
+const outboxPollInterval = time.Second
+
+type Outbox struct {
+	logger      *utils.Logger
+	mongo       ports.MongoRepo
+	audit       ports.AuditService
+	senders     map[ports.MessageChannel]ports.MessageSender
+	workers     int
+	maxAttempts int
+	retryBase   time.Duration
+	retryMax    time.Duration
+	lease       time.Duration
+	wake        chan struct{}
+}
+
+func NewOutboxService(
+	logger *utils.Logger,
+	mongo ports.MongoRepo,
+	audit ports.AuditService,
+	senders map[ports.MessageChannel]ports.MessageSender,
+) ports.OutboxService {
+	return &Outbox{
+		logger:      logger,
+		mongo:       mongo,
+		audit:       audit,
+		senders:     senders,
+		workers:     getenvAsPositiveInt(logger, "OUTBOX_WORKERS", 4),
+		maxAttempts: getenvAsAttempts(logger, "OUTBOX_MAX_ATTEMPTS", 8),
+		retryBase:   getenvAsDuration(logger, "OUTBOX_RETRY_BASE", 5*time.Second),
+		retryMax:    getenvAsDuration(logger, "OUTBOX_RETRY_MAX", 10*time.Minute),
+		lease:       getenvAsDuration(logger, "OUTBOX_LEASE", 30*time.Second),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+func (s *Outbox) Enqueue(ctx context.Context, msg *ports.OutboundMessage) (message *ports.MessageModel, err error) {
+	defer func() { err = utils.FuncPipe(outboxCaller+".Enqueue", err) }()
+	message, err = s.mongo.EnqueueMessage(ctx, ports.NewMessageModel(msg))
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return message, nil
+}
+
+func (s *Outbox) Message(ctx context.Context, id string) (message *ports.MessageModel, err error) {
+	defer func() { err = utils.FuncPipe(outboxCaller+".Message", err) }()
+	message, err = s.mongo.GetMessage(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if message == nil {
+		return nil, utils.MessageNotFoundResponse.Clone().
+			WithReason("id", id)
+	}
+	return message, nil
+}
+
+func (s *Outbox) Messages(ctx context.Context, filter *ports.MessageFilter, pagination *ports.Pagination) (messages []ports.MessageModel, total int64, err error) {
+	defer func() { err = utils.FuncPipe(outboxCaller+".Messages", err) }()
+	return s.mongo.GetMessages(ctx, filter, pagination)
+}
+
+func (s *Outbox) Requeue(ctx context.Context, id string, actorId uuid.UUID) (err error) {
+	defer func() { err = utils.FuncPipe(outboxCaller+".Requeue", err) }()
+	if err = s.mongo.RequeueMessage(ctx, id); err != nil {
+		return err
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return s.audit.Record(
+		ctx, actorId, ports.AdminUserType, ports.MessageRequeuedAuditAction, uuid.Nil, "",
+		map[string]string{"message_id": id},
+	)
+}
+
+func (s *Outbox) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range s.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Outbox) work(ctx context.Context) {
+	pollClaims(ctx, s.wake, outboxPollInterval, func() bool {
+		message, err := s.mongo.ClaimMessage(ctx, s.lease)
+		if err != nil {
+			s.logger.Error(ctx, err, "outbox failed to claim a message")
+		}
+		if message == nil {
+			return false
+		}
+		s.attempt(ctx, message)
+		return true
+	})
+}
+
+// pollClaims calls claim for as long as it reports that it found work, then
+// waits for a wake up or the next poll, until ctx is done.
+func pollClaims(ctx context.Context, wake <-chan struct{}, interval time.Duration, claim func() bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		if claim() {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// attempt delivers a claimed message once and records the outcome. The send
+// is bounded by the lease so that no other worker claims the message while it
+// is still in flight.
+func (s *Outbox) attempt(ctx context.Context, message *ports.MessageModel) {
+	now := time.Now().UTC()
+	message.UpdatedAt = now
+	sender, ok := s.senders[message.Channel]
+	switch {
+	case message.IsExpired(now):
+		message.Status = ports.ExpiredMessageStatus
+		message.LastError = "expired before it could be sent"
+	case !ok:
+		message.Status = ports.DeadMessageStatus
+		message.LastError = "no sender for channel " + string(message.Channel)
+	default:
+		sendCtx, cancel := context.WithTimeout(ctx, s.lease)
+		provider, providerMessageId, err := sender.Deliver(sendCtx, message.To, message.Subject, message.Body, message.Html)
+		cancel()
+		message.Provider = provider
+		message.ProviderMessageId = providerMessageId
+		message.UpdatedAt = time.Now().UTC()
+		if err == nil {
+			message.Status = ports.SentMessageStatus
+			message.LastError = ""
+			message.SentAt = message.UpdatedAt
+			break
+		}
+		message.LastError = err.Error()
+		// A sender answering with an app error refused the message itself, as
+		// for a suppressed address, so no retry would get it through.
+		var appErr *utils.Error
+		if message.Attempts >= s.maxAttempts || errors.As(err, &appErr) && !appErr.IsInternal() {
+			message.Status = ports.DeadMessageStatus
+			s.logger.Error(ctx, err, "outbox dead-lettered message "+message.Id)
+			break
+		}
+		message.Status = ports.QueuedMessageStatus
+		message.NextAttemptAt = message.UpdatedAt.Add(backoff(message.Attempts, s.retryBase, s.retryMax))
+	}
+	// The outcome is recorded even when ctx is done, otherwise the message
+	// would be sent again once its lease runs out.
+	if err := s.mongo.CompleteMessageAttempt(context.WithoutCancel(ctx), message); err != nil {
+		s.logger.Error(ctx, err, "outbox failed to record an attempt of message "+message.Id)
+	}
+}
+
+// backoff doubles the delay with every attempt, capped at retryMax, and
+// spreads it over its upper half so that retries of a burst do not align.
+func backoff(attempt int, retryBase, retryMax time.Duration) time.Duration {
+	delay := retryMax
+	// Comparing before shifting keeps a large attempt from overflowing.
+	if shift := max(attempt-1, 0); shift < 63 && retryBase <= retryMax>>shift {
+		delay = retryBase << shift
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// maxRetryAttempts bounds the attempts OUTBOX_MAX_ATTEMPTS and
+// WEBHOOK_MAX_ATTEMPTS may ask for.
+const maxRetryAttempts = 100
+
+// getenvAsAttempts reads a number of attempts, between 1 and
+// maxRetryAttempts.
+func getenvAsAttempts(logger *utils.Logger, key string, defaultValue int) int {
+	n := getenvAsPositiveInt(logger, key, defaultValue)
+	if n > maxRetryAttempts {
+		logger.Fatalf(context.Background(), "%s must be at most %d", key, maxRetryAttempts)
+	}
+	return n
+}
+
+func getenvAsPositiveInt(logger *utils.Logger, key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		logger.Fatalf(context.Background(), "%s is not a valid positive int", key)
+	}
+	return n
+}
+
+func getenvAsDuration(logger *utils.Logger, key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		logger.Fatalf(context.Background(), "%s is not a valid duration", key)
+	}
+	return d
+}
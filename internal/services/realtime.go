@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const realtimeCaller = packageCaller + ".Realtime"
+
+// realtimeBuffer is how many events a session may fall behind by before it
+// is disconnected.
+const realtimeBuffer = 16
+
+type realtimeSubscriber struct {
+	session string
+	events  chan *ports.Event
+}
+
+type Realtime struct {
+	logger *utils.Logger
+	cache  ports.CacheRepo
+
+	mu          sync.Mutex
+	subscribers map[string]map[*realtimeSubscriber]struct{}
+}
+
+// NewRealtimeService returns a service that can publish from any server, but
+// only delivers to sessions on servers that call Run.
+func NewRealtimeService(logger *utils.Logger, cache ports.CacheRepo) ports.RealtimeService {
+	return &Realtime{
+		logger:      logger,
+		cache:       cache,
+		subscribers: make(map[string]map[*realtimeSubscriber]struct{}),
+	}
+}
+
+func realtimeKey(userId uuid.UUID, userType ports.UserType) string {
+	return string(userType) + ":" + userId.String()
+}
+
+// Publish never fails the request that triggered the event; a failure is
+// logged and the event lost, as sessions are expected to catch up by polling
+// when they reconnect.
+func (s *Realtime) Publish(ctx context.Context, event *ports.UserEvent) {
+	if err := s.cache.PublishEvent(ctx, event); err != nil {
+		s.logger.Error(ctx, utils.FuncPipe(realtimeCaller+".Publish", err), "failed to publish "+string(event.Event.Type)+" event")
+	}
+}
+
+func (s *Realtime) Subscribe(userId uuid.UUID, userType ports.UserType, session string) (events <-chan *ports.Event, cancel func()) {
+	sub := &realtimeSubscriber{session: session, events: make(chan *ports.Event, realtimeBuffer)}
+	key := realtimeKey(userId, userType)
+	s.mu.Lock()
+	if s.subscribers[key] == nil {
+		s.subscribers[key] = make(map[*realtimeSubscriber]struct{})
+	}
+	s.subscribers[key][sub] = struct{}{}
+	s.mu.Unlock()
+	return sub.events, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.unsubscribe(key, sub)
+	}
+}
+
+// unsubscribe must be called with mu held. It is a no-op for subscribers
+// already gone, so the channel is only closed once.
+func (s *Realtime) unsubscribe(key string, sub *realtimeSubscriber) {
+	subs, ok := s.subscribers[key]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(s.subscribers, key)
+	}
+	close(sub.events)
+}
+
+func (s *Realtime) Run(ctx context.Context) {
+	for {
+		err := s.cache.SubscribeEvents(ctx, s.dispatch)
+		if ctx.Err() != nil {
+			return
+		}
+		s.logger.Error(ctx, utils.FuncPipe(realtimeCaller+".Run", err), "events subscription broke off, resubscribing")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// dispatch hands the event to the matching sessions connected here. A
+// session whose buffer is full is dropped rather than allowed to hold up the
+// others; its channel is closed and the client has to reconnect.
+func (s *Realtime) dispatch(event *ports.UserEvent) {
+	key := realtimeKey(event.UserId, event.UserType)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subscribers[key] {
+		if event.Session != "" && sub.session != event.Session {
+			continue
+		}
+		select {
+		case sub.events <- &event.Event:
+		default:
+			s.logger.Warnf(context.Background(), "dropped a realtime session of %s that fell behind", key)
+			s.unsubscribe(key, sub)
+		}
+	}
+}
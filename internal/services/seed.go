@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const seedCaller = packageCaller + ".Seed"
+
+// SeedFile is the name of the seed in its directory, next to the avatars it
+// refers to.
+const SeedFile = "seed.json"
+
+type Seeder struct {
+	logger *utils.Logger
+	rel    ports.RelationalRepo
+	mongo  ports.MongoRepo
+	s3     ports.S3Repo
+}
+
+func NewSeedService(logger *utils.Logger, rel ports.RelationalRepo, mongo ports.MongoRepo, s3 ports.S3Repo) ports.SeedService {
+	return &Seeder{
+		logger: logger,
+		rel:    rel,
+		mongo:  mongo,
+		s3:     s3,
+	}
+}
+
+// ReadSeed reads and validates the seed in fsys.
+func ReadSeed(ctx context.Context, logger *utils.Logger, fsys fs.FS) (seed *ports.Seed, err error) {
+	defer func() { err = utils.FuncPipe(seedCaller+".ReadSeed", err) }()
+	data, err := fs.ReadFile(fsys, SeedFile)
+	if err != nil {
+		return nil, err
+	}
+	seed = &ports.Seed{}
+	if err := sonic.Unmarshal(data, seed); err != nil {
+		return nil, err
+	}
+	if err := ports.Validate(ctx, logger, seed); err != nil {
+		return nil, err
+	}
+	return seed, nil
+}
+
+func (s *Seeder) Load(ctx context.Context, fsys fs.FS) (report *ports.SeedReport, err error) {
+	defer func() { err = utils.FuncPipe(seedCaller+".Load", err) }()
+	// Users are read back right after they are created or updated.
+	ctx = utils.WithPrimary(ctx)
+	seed, err := ReadSeed(ctx, s.logger, fsys)
+	if err != nil {
+		return nil, err
+	}
+	report = &ports.SeedReport{}
+	clients := map[string]uuid.UUID{}
+	for _, group := range []struct {
+		userType ports.UserType
+		users    []*ports.SeedUser
+	}{
+		{ports.AdminUserType, seed.Admins},
+		{ports.ClientUserType, seed.Clients},
+	} {
+		userType := group.userType
+		for _, user := range group.users {
+			id, created, updated, err := s.upsertUser(ctx, fsys, user, userType)
+			if err != nil {
+				return report, fmt.Errorf("seeding %s %s: %w", userType, user.Username, err)
+			}
+			name := string(userType) + "/" + user.Username
+			switch {
+			case created:
+				report.Created = append(report.Created, name)
+			case updated:
+				report.Updated = append(report.Updated, name)
+			default:
+				report.Unchanged = append(report.Unchanged, name)
+			}
+			if userType == ports.ClientUserType {
+				clients[user.Username] = id
+			}
+		}
+	}
+	for _, relation := range seed.Relations {
+		fromId, err := s.clientId(ctx, clients, relation.From)
+		if err != nil {
+			return report, err
+		}
+		toId, err := s.clientId(ctx, clients, relation.To)
+		if err != nil {
+			return report, err
+		}
+		if relation.Type == ports.BlockRelationType {
+			err = s.mongo.BlockUser(ctx, fromId, toId)
+		} else {
+			err = s.mongo.AddRelation(ctx, fromId, toId, relation.Type)
+		}
+		if err != nil {
+			return report, err
+		}
+		report.Relations++
+	}
+	return report, nil
+}
+
+// upsertUser brings the user named like seed to it through the same
+// repository methods the API uses, so the changes emit domain events as
+// usual. Fields the seed leaves empty are left as they are.
+func (s *Seeder) upsertUser(ctx context.Context, fsys fs.FS, seed *ports.SeedUser, userType ports.UserType) (id uuid.UUID, created, updated bool, err error) {
+	user, isDeleted, err := s.rel.GetUserByUsername(ctx, seed.Username, userType)
+	if err != nil {
+		return uuid.Nil, false, false, err
+	}
+	if isDeleted {
+		return uuid.Nil, false, false, utils.UserDeletedResponse.Clone().
+			WithReason("username", seed.Username)
+	}
+	if user == nil {
+		id = seed.Id
+		if id == uuid.Nil {
+			id = uuid.New()
+		}
+		if _, err = s.rel.CreateUser(ctx, &ports.AuthSignupPostRequest{
+			Username:    seed.Username,
+			Name:        seed.Name,
+			PhoneNumber: seed.PhoneNumber,
+			Email:       seed.Email,
+			UserType:    userType,
+			Password:    seed.Password,
+		}, id); err != nil {
+			return uuid.Nil, false, false, err
+		}
+		if user, _, err = s.rel.GetUserById(ctx, id, userType); err != nil {
+			return uuid.Nil, false, false, err
+		}
+		created = true
+	}
+	id = user.GetId()
+
+	if user.GetName() != seed.Name || (seed.Locale != "" && user.GetLocale() != seed.Locale) {
+		locale := user.GetLocale()
+		if seed.Locale != "" {
+			locale = seed.Locale
+		}
+		if err = s.rel.UpdateUserProfileById(ctx, id, seed.Username, seed.Name, user.GetAvatarHash(), locale, userType); err != nil {
+			return id, created, updated, err
+		}
+		updated = true
+	}
+	if seed.PhoneNumber != "" && user.GetPhoneNumber() != seed.PhoneNumber {
+		if err = s.rel.UpdateUserPhoneById(ctx, id, userType, seed.PhoneNumber); err != nil {
+			return id, created, updated, err
+		}
+		updated = true
+	}
+	if seed.Email != "" && user.GetEmail() != seed.Email {
+		if err = s.rel.UpdateUserEmailById(ctx, id, userType, seed.Email); err != nil {
+			return id, created, updated, err
+		}
+		updated = true
+	}
+	if seed.Password != "" && !utils.VerifyPassword(user.GetPassword(), seed.Password) {
+		if err = s.rel.UpdateUserPasswordById(ctx, id, userType, seed.Password); err != nil {
+			return id, created, updated, err
+		}
+		updated = true
+	}
+	if seed.Avatar != "" {
+		data, err := fs.ReadFile(fsys, seed.Avatar)
+		if err != nil {
+			return id, created, updated, err
+		}
+		img, err := ports.AvatarImageReader(data)
+		if err != nil {
+			return id, created, updated, err
+		}
+		// The variants are named by user and hashed by content, so uploading
+		// the same image again rewrites the same objects.
+		hash, err := s.s3.UploadAvatar(ctx, id, userType, img)
+		if err != nil {
+			return id, created, updated, err
+		}
+		if hash != user.GetAvatarHash() {
+			if err = s.rel.UpdateUserAvatarById(ctx, id, userType, hash); err != nil {
+				return id, created, updated, err
+			}
+			updated = true
+		}
+	}
+	return id, created, updated, nil
+}
+
+// clientId resolves a client named in a relation, first among the seeded
+// ones and then among those already in the database.
+func (s *Seeder) clientId(ctx context.Context, clients map[string]uuid.UUID, username string) (id uuid.UUID, err error) {
+	if id, ok := clients[username]; ok {
+		return id, nil
+	}
+	user, _, err := s.rel.GetUserByUsername(ctx, username, ports.ClientUserType)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if user == nil {
+		return uuid.Nil, utils.UsernameNotFoundResponse.Clone().
+			WithReason("username", username)
+	}
+	return user.GetId(), nil
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/repository"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+// TestSeedLoadsDev loads seeds/dev into the databases POSTGRES_DB_* and
+// MONGO_* point at, when SEED_INTEGRATION is set. They must be disposable:
+// the test migrates them and leaves the seeded users behind. Avatars go to
+// the memory S3 backend.
+func TestSeedLoadsDev(t *testing.T) {
+	if os.Getenv("SEED_INTEGRATION") == "" {
+		t.Skip("SEED_INTEGRATION is not set")
+	}
+	ctx := t.Context()
+	logger := utils.NewLogger()
+	rel := repository.NewRelationalRepo(logger)
+	t.Cleanup(func() { _ = rel.Close() })
+	if _, err := rel.MigrateUp(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	mongo := repository.NewMongoRepo(logger)
+	t.Cleanup(func() { _ = mongo.Close() })
+	s3 := repository.NewMemoryS3Repo(logger)
+	seeder := NewSeedService(logger, rel, mongo, s3)
+
+	fsys := os.DirFS("../../seeds/dev")
+	seed, err := ReadSeed(ctx, logger, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, user := range seed.Admins {
+		names = append(names, string(ports.AdminUserType)+"/"+user.Username)
+	}
+	for _, user := range seed.Clients {
+		names = append(names, string(ports.ClientUserType)+"/"+user.Username)
+	}
+
+	report, err := seeder.Load(ctx, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The databases may hold an earlier load, so the users can be found in
+	// any state the first time.
+	reported := slices.Concat(report.Created, report.Updated, report.Unchanged)
+	slices.Sort(reported)
+	if !slices.Equal(reported, slices.Sorted(slices.Values(names))) {
+		t.Fatalf("first load reported %v, want %v", reported, names)
+	}
+	if report.Relations != len(seed.Relations) {
+		t.Fatalf("first load seeded %d relations, want %d", report.Relations, len(seed.Relations))
+	}
+	checkSeeded(t, rel, mongo, s3, seed)
+
+	report, err = seeder.Load(ctx, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Created) != 0 || len(report.Updated) != 0 || len(report.Unchanged) != len(names) {
+		t.Fatalf("second load created %v and updated %v, want every user unchanged", report.Created, report.Updated)
+	}
+	if report.Relations != len(seed.Relations) {
+		t.Fatalf("second load seeded %d relations, want %d", report.Relations, len(seed.Relations))
+	}
+	checkSeeded(t, rel, mongo, s3, seed)
+}
+
+// checkSeeded compares the users, their avatars and the relations in the
+// repositories with seed.
+func checkSeeded(t *testing.T, rel ports.RelationalRepo, mongo ports.MongoRepo, s3 ports.S3Repo, seed *ports.Seed) {
+	t.Helper()
+	ctx := utils.WithPrimary(t.Context())
+	clients := map[string]uuid.UUID{}
+	for _, group := range []struct {
+		userType ports.UserType
+		users    []*ports.SeedUser
+	}{
+		{ports.AdminUserType, seed.Admins},
+		{ports.ClientUserType, seed.Clients},
+	} {
+		for _, want := range group.users {
+			user, isDeleted, err := rel.GetUserByUsername(ctx, want.Username, group.userType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user == nil || isDeleted {
+				t.Fatalf("%s %s is missing", group.userType, want.Username)
+			}
+			switch {
+			case user.GetId() != want.Id:
+				t.Errorf("%s %s has id %s, want %s", group.userType, want.Username, user.GetId(), want.Id)
+			case user.GetName() != want.Name:
+				t.Errorf("%s %s is named %q, want %q", group.userType, want.Username, user.GetName(), want.Name)
+			case want.PhoneNumber != "" && user.GetPhoneNumber() != want.PhoneNumber:
+				t.Errorf("%s %s has phone number %q, want %q", group.userType, want.Username, user.GetPhoneNumber(), want.PhoneNumber)
+			case want.Email != "" && user.GetEmail() != want.Email:
+				t.Errorf("%s %s has email %q, want %q", group.userType, want.Username, user.GetEmail(), want.Email)
+			case want.Locale != "" && user.GetLocale() != want.Locale:
+				t.Errorf("%s %s has locale %q, want %q", group.userType, want.Username, user.GetLocale(), want.Locale)
+			case !utils.VerifyPassword(user.GetPassword(), want.Password):
+				t.Errorf("%s %s does not have the seeded password", group.userType, want.Username)
+			}
+			if want.Avatar != "" {
+				checkSeededAvatar(t, ctx, s3, user, group.userType)
+			}
+			if group.userType == ports.ClientUserType {
+				clients[want.Username] = user.GetId()
+			}
+		}
+	}
+	for _, relation := range seed.Relations {
+		has, err := mongo.HasRelation(ctx, clients[relation.From], clients[relation.To], relation.Type)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !has {
+			t.Errorf("%s does not %s %s", relation.From, relation.Type, relation.To)
+		}
+	}
+	// A second load must not duplicate relations either.
+	follows := map[string]int64{}
+	for _, relation := range seed.Relations {
+		if relation.Type == ports.FollowRelationType {
+			follows[relation.From]++
+		}
+	}
+	for username, want := range follows {
+		_, total, err := mongo.GetRelationTargets(ctx, clients[username], ports.FollowRelationType, &ports.Pagination{Page: 1, Size: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != want {
+			t.Errorf("%s follows %d users, want %d", username, total, want)
+		}
+	}
+}
+
+func checkSeededAvatar(t *testing.T, ctx context.Context, s3 ports.S3Repo, user ports.UserModel, userType ports.UserType) {
+	t.Helper()
+	if len(user.GetAvatarHash()) != ports.AvatarHashLength {
+		t.Errorf("%s has avatar hash %q", user.GetUsername(), user.GetAvatarHash())
+		return
+	}
+	for _, size := range ports.AvatarSizes {
+		for _, format := range ports.AvatarFormats {
+			avatar, err := s3.GetAvatar(ctx, user.GetId(), userType, size, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if avatar == nil {
+				t.Errorf("%s has no %d.%s avatar", user.GetUsername(), size, format)
+				continue
+			}
+			_ = avatar.Close()
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package services
+
+import (
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const storageGcCaller = packageCaller + ".StorageGc"
+
+// storageGcBatchSize bounds the ids sent to Postgres in one query.
+const storageGcBatchSize = 500
+
+// StorageGc reconciles object storage with the databases. Avatar and media
+// writes touch storage and the database separately, so a failure between the
+// two leaves objects nobody references or flags that point at nothing.
+type StorageGc struct {
+	logger *utils.Logger
+	rel    ports.RelationalRepo
+	mongo  ports.MongoRepo
+	s3     ports.S3Repo
+}
+
+func NewStorageGcService(
+	logger *utils.Logger,
+	rel ports.RelationalRepo,
+	mongo ports.MongoRepo,
+	s3 ports.S3Repo,
+) ports.StorageGcService {
+	return &StorageGc{
+		logger: logger,
+		rel:    rel,
+		mongo:  mongo,
+		s3:     s3,
+	}
+}
+
+type avatarObject struct {
+	objectName string
+	info       ports.S3ObjectInfo
+}
+
+func (s *StorageGc) Run(ctx context.Context, opts *ports.StorageGcOptions) (report *ports.StorageGcReport, err error) {
+	defer func() { err = utils.FuncPipe(storageGcCaller+".Run", err) }()
+	report = &ports.StorageGcReport{DryRun: opts.DryRun}
+	now := time.Now()
+
+	avatars := make(map[ports.UserType]map[uuid.UUID][]avatarObject, len(ports.AllUserTypes))
+	for _, userType := range ports.AllUserTypes {
+		avatars[userType] = map[uuid.UUID][]avatarObject{}
+	}
+	err = s.s3.IterateAvatarObjects(ctx, func(objectName string, info ports.S3ObjectInfo) error {
+		report.Scanned++
+		id, userType, ok := ports.ParseAvatarObjectPath(objectName)
+		if !ok {
+			report.Skipped++
+			return nil
+		}
+		avatars[userType][id] = append(avatars[userType][id], avatarObject{objectName: objectName, info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, userType := range ports.AllUserTypes {
+		if err = s.reconcileAvatarObjects(ctx, opts, now, userType, avatars[userType], report); err != nil {
+			return nil, err
+		}
+		if err = s.reconcileAvatarFlags(ctx, opts, now, userType, avatars[userType], report); err != nil {
+			return nil, err
+		}
+	}
+	if err = s.collectUploads(ctx, opts, now, report); err != nil {
+		return nil, err
+	}
+	for _, purpose := range ports.MediaPurposes() {
+		if err = s.collectMedia(ctx, opts, now, purpose, report); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// reconcileAvatarObjects removes the avatar objects of users that are gone or
+// have no avatar, and adopts the hash of objects whose database write failed.
+func (s *StorageGc) reconcileAvatarObjects(ctx context.Context, opts *ports.StorageGcOptions, now time.Time, userType ports.UserType, objects map[uuid.UUID][]avatarObject, report *ports.StorageGcReport) (err error) {
+	ids := make([]uuid.UUID, 0, len(objects))
+	for id := range objects {
+		ids = append(ids, id)
+	}
+	for start := 0; start < len(ids); start += storageGcBatchSize {
+		batch := ids[start:min(start+storageGcBatchSize, len(ids))]
+		records, err := s.rel.GetAvatarRecords(ctx, batch, userType)
+		if err != nil {
+			return err
+		}
+		for _, id := range batch {
+			userObjects := objects[id]
+			if isRecent(userObjects, now, opts.MinAge) {
+				report.Skipped += int64(len(userObjects))
+				continue
+			}
+			record, exists := records[id]
+			reason := ""
+			switch {
+			case !exists:
+				reason = "user does not exist"
+			case record.IsDeleted:
+				reason = "user is deleted"
+			case !record.HasAvatar:
+				reason = "user has no avatar"
+			}
+			if reason != "" {
+				for _, obj := range userObjects {
+					s.apply(ctx, opts, report, ports.StorageGcAction{
+						Kind: ports.DeleteAvatarStorageGcAction, UserId: id, UserType: userType, Target: obj.objectName, Reason: reason,
+					}, func() error {
+						return s.s3.DeleteAvatarObject(ctx, obj.objectName)
+					})
+				}
+				continue
+			}
+			if err = s.reconcileAvatarHash(ctx, opts, userType, record, userObjects, report); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reconcileAvatarHash checks the stored hash against the served variant. The
+// objects always hold the latest upload, so a mismatch means the database
+// missed an update. A legacy avatar is re-encoded into variants instead.
+func (s *StorageGc) reconcileAvatarHash(ctx context.Context, opts *ports.StorageGcOptions, userType ports.UserType, record ports.AvatarRecord, objects []avatarObject, report *ports.StorageGcReport) (err error) {
+	size := ports.AvatarSizes[len(ports.AvatarSizes)-1]
+	avatar, err := s.s3.GetAvatar(ctx, record.Id, userType, size, ports.AvatarFormats[0])
+	if err != nil {
+		return err
+	}
+	if avatar == nil {
+		// Neither the default variant nor a legacy object exists, so the
+		// avatar cannot be served anyway.
+		reason := "only partial avatar objects exist"
+		s.apply(ctx, opts, report, ports.StorageGcAction{
+			Kind: ports.ClearAvatarFlagStorageGcAction, UserId: record.Id, UserType: userType, Target: record.Id.String(), Reason: reason,
+		}, func() error {
+			return s.rel.UpdateUserAvatarById(ctx, record.Id, userType, "")
+		})
+		for _, obj := range objects {
+			s.apply(ctx, opts, report, ports.StorageGcAction{
+				Kind: ports.DeleteAvatarStorageGcAction, UserId: record.Id, UserType: userType, Target: obj.objectName, Reason: reason,
+			}, func() error {
+				return s.s3.DeleteAvatarObject(ctx, obj.objectName)
+			})
+		}
+		return nil
+	}
+	defer func() {
+		_ = avatar.Close()
+	}()
+	hash := ""
+	for key, value := range avatar.Info().Metadata {
+		if strings.EqualFold(key, ports.AvatarHashMetadataKey) {
+			hash = value
+		}
+	}
+	if hash == "" {
+		// Only the legacy object has no hash. It is deleted once its
+		// variants are stored, so the avatar always has a copy.
+		legacy := ports.LegacyAvatarObjectName(record.Id, userType)
+		s.apply(ctx, opts, report, ports.StorageGcAction{
+			Kind: ports.MigrateAvatarStorageGcAction, UserId: record.Id, UserType: userType, Target: legacy, Reason: "avatar predates variants",
+		}, func() error {
+			data, err := io.ReadAll(avatar)
+			if err != nil {
+				return err
+			}
+			img, err := ports.AvatarImageReader(data)
+			if err != nil {
+				return err
+			}
+			hash, err := s.s3.UploadAvatar(ctx, record.Id, userType, img)
+			if err != nil {
+				return err
+			}
+			if err := s.rel.UpdateUserAvatarById(ctx, record.Id, userType, hash); err != nil {
+				return err
+			}
+			return s.s3.DeleteAvatarObject(ctx, legacy)
+		})
+		return nil
+	}
+	if hash == record.AvatarHash {
+		return nil
+	}
+	s.apply(ctx, opts, report, ports.StorageGcAction{
+		Kind: ports.UpdateAvatarHashStorageGcAction, UserId: record.Id, UserType: userType, Target: record.Id.String(),
+		Reason: "avatar hash " + record.AvatarHash + " is stale, objects have " + hash,
+	}, func() error {
+		return s.rel.UpdateUserAvatarById(ctx, record.Id, userType, hash)
+	})
+	return nil
+}
+
+// reconcileAvatarFlags clears HasAvatar for users that have no objects at all.
+func (s *StorageGc) reconcileAvatarFlags(ctx context.Context, opts *ports.StorageGcOptions, now time.Time, userType ports.UserType, objects map[uuid.UUID][]avatarObject, report *ports.StorageGcReport) (err error) {
+	afterId := uuid.Nil
+	for {
+		records, err := s.rel.GetAvatarRecordsWithAvatar(ctx, userType, afterId, storageGcBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if _, ok := objects[record.Id]; ok {
+				continue
+			}
+			// The objects may have been written after the bucket was listed.
+			if now.Sub(record.UpdatedAt) < opts.MinAge {
+				report.Skipped++
+				continue
+			}
+			reason := "avatar objects are missing"
+			if record.IsDeleted {
+				reason = "user is deleted"
+			}
+			s.apply(ctx, opts, report, ports.StorageGcAction{
+				Kind: ports.ClearAvatarFlagStorageGcAction, UserId: record.Id, UserType: userType, Target: record.Id.String(), Reason: reason,
+			}, func() error {
+				return s.rel.UpdateUserAvatarById(ctx, record.Id, userType, "")
+			})
+		}
+		if len(records) < storageGcBatchSize {
+			return nil
+		}
+		afterId = records[len(records)-1].Id
+	}
+}
+
+// collectUploads removes uploads whose session expired long ago. MinIO
+// expires them with a lifecycle rule too, but the other backends do not.
+func (s *StorageGc) collectUploads(ctx context.Context, opts *ports.StorageGcOptions, now time.Time, report *ports.StorageGcReport) (err error) {
+	var stale []string
+	err = s.s3.IterateUploadObjects(ctx, func(objectName string, info ports.S3ObjectInfo) error {
+		report.Scanned++
+		if now.Sub(info.LastModified) < opts.UploadMaxAge {
+			report.Skipped++
+			return nil
+		}
+		stale = append(stale, objectName)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, objectName := range stale {
+		s.apply(ctx, opts, report, ports.StorageGcAction{
+			Kind: ports.DeleteUploadStorageGcAction, Target: objectName, Reason: "upload was never completed",
+		}, func() error {
+			return s.s3.DeleteUpload(ctx, objectName)
+		})
+	}
+	return nil
+}
+
+// collectMedia removes media objects without a record, and media whose owner
+// is gone together with its record.
+func (s *StorageGc) collectMedia(ctx context.Context, opts *ports.StorageGcOptions, now time.Time, purpose ports.MediaPurpose, report *ports.StorageGcReport) (err error) {
+	var candidates []string
+	err = s.s3.IterateMediaObjects(ctx, purpose, func(objectName string, info ports.S3ObjectInfo) error {
+		report.Scanned++
+		if now.Sub(info.LastModified) < opts.MinAge {
+			report.Skipped++
+			return nil
+		}
+		candidates = append(candidates, objectName)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, objectName := range candidates {
+		ownerId, ownerType, mediaId, ok := parseMediaObjectName(objectName)
+		if !ok {
+			report.Skipped++
+			continue
+		}
+		media, err := s.mongo.GetMedia(ctx, mediaId)
+		if err != nil {
+			return err
+		}
+		if media == nil {
+			s.apply(ctx, opts, report, ports.StorageGcAction{
+				Kind: ports.DeleteMediaStorageGcAction, UserId: ownerId, UserType: ownerType, Target: objectName, Reason: "media record does not exist",
+			}, func() error {
+				return s.s3.DeleteMedia(ctx, purpose, objectName)
+			})
+			continue
+		}
+		// A replica may not have the owner yet, and the media would be
+		// deleted for it.
+		exists, isDeleted, err := s.rel.UserExistsById(utils.WithPrimary(ctx), ownerId, ownerType)
+		if err != nil {
+			return err
+		}
+		if exists && !isDeleted {
+			continue
+		}
+		s.apply(ctx, opts, report, ports.StorageGcAction{
+			Kind: ports.DeleteMediaStorageGcAction, UserId: ownerId, UserType: ownerType, Target: objectName, Reason: "owner is deleted",
+		}, func() error {
+			if err := s.mongo.DeleteMedia(ctx, mediaId); err != nil {
+				return err
+			}
+			return s.s3.DeleteMedia(ctx, purpose, objectName)
+		})
+	}
+	return nil
+}
+
+// apply records action in the report and, outside a dry run, performs it.
+// A failed repair is reported rather than aborting the whole run.
+func (s *StorageGc) apply(ctx context.Context, opts *ports.StorageGcOptions, report *ports.StorageGcReport, action ports.StorageGcAction, fn func() error) {
+	if !opts.DryRun {
+		if action.Err = fn(); action.Err != nil {
+			s.logger.Error(ctx, action.Err, "storage gc failed to "+string(action.Kind)+" "+action.Target)
+		}
+	}
+	report.Actions = append(report.Actions, action)
+}
+
+func isRecent(objects []avatarObject, now time.Time, minAge time.Duration) bool {
+	for _, obj := range objects {
+		if now.Sub(obj.info.LastModified) < minAge {
+			return true
+		}
+	}
+	return false
+}
+
+// parseMediaObjectName is the inverse of the object name built by
+// ports.NewMediaModel.
+func parseMediaObjectName(objectName string) (ownerId uuid.UUID, ownerType ports.UserType, mediaId uuid.UUID, ok bool) {
+	parts := strings.Split(objectName, "/")
+	if len(parts) != 3 || !slices.Contains(ports.AllUserTypes, ports.UserType(parts[0])) {
+		return uuid.Nil, "", uuid.Nil, false
+	}
+	ownerId, err := uuid.Parse(parts[1])
+	if err != nil {
+		return uuid.Nil, "", uuid.Nil, false
+	}
+	mediaId, err = uuid.Parse(parts[2])
+	if err != nil {
+		return uuid.Nil, "", uuid.Nil, false
+	}
+	return ownerId, ports.UserType(parts[0]), mediaId, true
+}
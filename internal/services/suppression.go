@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/clients"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const suppressionCaller = packageCaller + ".Suppression"
+
+type Suppression struct {
+	logger       *utils.Logger
+	mongo        ports.MongoRepo
+	audit        ports.AuditService
+	mailbox      ports.Mailbox
+	pollInterval time.Duration
+}
+
+// NewSuppressionService connects to the bounce mailbox when BOUNCE_POP3_HOST
+// is set. Without one, bounces only arrive through the webhook.
+func NewSuppressionService(logger *utils.Logger, mongo ports.MongoRepo, audit ports.AuditService) ports.SuppressionService {
+	s := &Suppression{
+		logger:       logger,
+		mongo:        mongo,
+		audit:        audit,
+		pollInterval: getenvAsDuration(logger, "BOUNCE_POLL_INTERVAL", time.Minute),
+	}
+	host := os.Getenv("BOUNCE_POP3_HOST")
+	if host == "" {
+		logger.Infof(context.Background(), "BOUNCE_POP3_HOST is not set, bounces are only taken from the webhook")
+		return s
+	}
+	tlsMode := getenvAsMailTlsMode(logger, "BOUNCE_POP3_TLS", clients.ImplicitMailTlsMode)
+	port := 995
+	if tlsMode != clients.ImplicitMailTlsMode {
+		port = 110
+	}
+	if value := os.Getenv("BOUNCE_POP3_PORT"); value != "" {
+		var err error
+		if port, err = strconv.Atoi(value); err != nil {
+			logger.Fatal(context.Background(), "BOUNCE_POP3_PORT is not valid")
+		}
+	}
+	username := os.Getenv("BOUNCE_POP3_USERNAME")
+	if username == "" {
+		logger.Fatal(context.Background(), "BOUNCE_POP3_USERNAME is not set")
+	}
+	password := os.Getenv("BOUNCE_POP3_PASSWORD")
+	if password == "" {
+		logger.Fatal(context.Background(), "BOUNCE_POP3_PASSWORD is not set")
+	}
+	s.mailbox = clients.NewPop3Mailbox(logger, clients.Pop3Options{
+		Host:     host,
+		Port:     port,
+		Username: username,
+		Password: password,
+		Tls:      tlsMode,
+		Timeout:  getenvAsDuration(logger, "BOUNCE_POP3_TIMEOUT", 30*time.Second),
+	})
+	return s
+}
+
+func (s *Suppression) Check(ctx context.Context, email string) (err error) {
+	defer func() { err = utils.FuncPipe(suppressionCaller+".Check", err) }()
+	suppression, err := s.mongo.GetSuppression(ctx, email)
+	if err != nil {
+		return err
+	}
+	if suppression != nil {
+		return utils.EmailSuppressedResponse.Clone().
+			WithReason("email", utils.MaskEmail(email)).
+			WithReason("reason", suppression.Reason)
+	}
+	return nil
+}
+
+// Record lists the address of a hard bounce or complaint. Every bounce is
+// also recorded on the message it is about, if that is known; a hard bounce
+// marks it undelivered.
+func (s *Suppression) Record(ctx context.Context, bounce *ports.EmailBounce) (suppressed bool, err error) {
+	defer func() { err = utils.FuncPipe(suppressionCaller+".Record", err) }()
+	if bounce.ProviderMessageId != "" {
+		receipt := &ports.DeliveryReceipt{
+			Provider:          bounce.Provider,
+			ProviderMessageId: bounce.ProviderMessageId,
+			ProviderStatus:    string(bounce.Type),
+			ErrorCode:         bounce.Status,
+			ErrorMessage:      bounce.Diagnostic,
+			OccurredAt:        bounce.OccurredAt,
+		}
+		if bounce.Type == ports.HardBounceType {
+			receipt.Status = ports.UndeliveredMessageStatus
+		}
+		// Reports about messages the outbox no longer keeps still count.
+		if _, err = s.mongo.RecordMessageReceipt(ctx, receipt); err != nil {
+			return false, err
+		}
+	}
+	if bounce.Type == ports.SoftBounceType {
+		return false, nil
+	}
+	if err = s.mongo.AddSuppression(ctx, bounce); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Suppression) IngestReport(ctx context.Context, raw []byte, source ports.SuppressionSource) (resp *ports.BounceWebhookResponse, err error) {
+	defer func() { err = utils.FuncPipe(suppressionCaller+".IngestReport", err) }()
+	report, err := utils.ParseBounceReport(raw)
+	if err != nil {
+		return nil, utils.BadRequestResponse.Clone().
+			WithReason("report", err.Error())
+	}
+	resp = &ports.BounceWebhookResponse{}
+	for _, recipient := range report.Recipients {
+		bounce := &ports.EmailBounce{
+			Email:      recipient.Email,
+			Source:     source,
+			Status:     recipient.Status,
+			Diagnostic: recipient.Diagnostic,
+		}
+		// Mailcom sets the Message-ID, and it doubles as the provider id.
+		if report.MessageId != "" {
+			bounce.Provider, bounce.ProviderMessageId = smtpMailProvider, report.MessageId
+		}
+		switch {
+		case report.Feedback:
+			bounce.Type = ports.ComplaintBounceType
+			bounce.Diagnostic = report.FeedbackType
+		case recipient.Permanent():
+			bounce.Type = ports.HardBounceType
+		case recipient.Action == "failed" || recipient.Action == "delayed":
+			bounce.Type = ports.SoftBounceType
+		default:
+			// Delivered, relayed or expanded: not a bounce at all.
+			resp.Ignored++
+			continue
+		}
+		suppressed, err := s.Record(ctx, bounce)
+		if err != nil {
+			return nil, err
+		}
+		if suppressed {
+			resp.Suppressed++
+		} else {
+			resp.Ignored++
+		}
+	}
+	return resp, nil
+}
+
+func (s *Suppression) BounceWebhook(ctx context.Context, req *ports.BounceWebhookRequest) (resp *ports.BounceWebhookResponse, err error) {
+	defer func() { err = utils.FuncPipe(suppressionCaller+".BounceWebhook", err) }()
+	bounce := &ports.EmailBounce{
+		Email:             req.Email,
+		Type:              req.Type,
+		Source:            ports.WebhookSuppressionSource,
+		Status:            req.Status,
+		Diagnostic:        req.Diagnostic,
+		Provider:          req.Provider,
+		ProviderMessageId: req.ProviderMessageId,
+		OccurredAt:        req.OccurredAt,
+	}
+	if bounce.Provider == "" && bounce.ProviderMessageId != "" {
+		bounce.Provider = smtpMailProvider
+	}
+	suppressed, err := s.Record(ctx, bounce)
+	if err != nil {
+		return nil, err
+	}
+	if suppressed {
+		return &ports.BounceWebhookResponse{Suppressed: 1}, nil
+	}
+	return &ports.BounceWebhookResponse{Ignored: 1}, nil
+}
+
+func (s *Suppression) Suppressions(ctx context.Context, req *ports.AdminSuppressionsGetRequest) (resp *ports.AdminSuppressionsGetResponse, err error) {
+	defer func() { err = utils.FuncPipe(suppressionCaller+".Suppressions", err) }()
+	suppressions, total, err := s.mongo.GetSuppressions(ctx, &req.SuppressionFilter, &req.Pagination)
+	if err != nil {
+		return nil, err
+	}
+	resp = &ports.AdminSuppressionsGetResponse{
+		Suppressions: make([]*ports.Suppression, 0, len(suppressions)),
+		Page:         req.Page,
+		Size:         req.Size,
+		Total:        total,
+	}
+	for _, suppression := range suppressions {
+		resp.Suppressions = append(resp.Suppressions, suppression.ToSuppression())
+	}
+	return resp, nil
+}
+
+// Remove takes an address off the list, once its owner fixed the mailbox or
+// asked to be emailed again.
+func (s *Suppression) Remove(ctx context.Context, email string, actorId uuid.UUID) (err error) {
+	defer func() { err = utils.FuncPipe(suppressionCaller+".Remove", err) }()
+	deleted, err := s.mongo.DeleteSuppression(ctx, email)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return utils.NotFoundResponse.Clone().
+			WithReason("email", email)
+	}
+	return s.audit.Record(
+		ctx, actorId, ports.AdminUserType, ports.SuppressionRemovedAuditAction, uuid.Nil, "",
+		map[string]string{"email": ports.NormalizeSuppressedEmail(email)},
+	)
+}
+
+func (s *Suppression) Run(ctx context.Context) {
+	if s.mailbox == nil {
+		return
+	}
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		// POP3 servers lock a mailbox per session, so when several gateways
+		// poll at once the others fail until the next tick.
+		if err := s.mailbox.Drain(ctx, func(msg []byte) error { return s.ingestMailboxMessage(ctx, msg) }); err != nil {
+			s.logger.Error(ctx, err, "failed to drain the bounce mailbox")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ingestMailboxMessage only keeps a message in the mailbox when it could not
+// be recorded. The mailbox receives nothing but bounces, so whatever else
+// lands there, such as auto-replies, is dropped.
+func (s *Suppression) ingestMailboxMessage(ctx context.Context, msg []byte) error {
+	resp, err := s.IngestReport(ctx, msg, ports.MailboxSuppressionSource)
+	var appErr *utils.Error
+	if errors.As(err, &appErr) && !appErr.IsInternal() {
+		s.logger.Warnf(ctx, "dropped a bounce mailbox message that is not a report: %v", appErr.GetReasons()["report"])
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if resp.Suppressed > 0 {
+		s.logger.Infof(ctx, "bounce mailbox report suppressed %d addresses", resp.Suppressed)
+	}
+	return nil
+}
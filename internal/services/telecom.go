@@ -2,24 +2,43 @@ package services
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"math/rand/v2"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/kasragay/backend/internal/clients"
 	"github.com/kasragay/backend/internal/ports"
 	"github.com/kasragay/backend/internal/utils"
-	"github.com/twilio/twilio-go"
-	twilioApi "github.com/twilio/twilio-go/rest/api/v2010"
 )
 
 const telecomCaller = packageCaller + ".Telecom"
 
 type Telecom struct {
-	logger  *utils.Logger
-	noReply string
-	client  *twilio.RestClient
+	logger    *utils.Logger
+	noReply   string
+	providers []*smsRoute
+	sink      ports.SmsSink
+	cooldown  time.Duration
 }
 
+// smsRoute is a provider with its routing weight and health. A provider that
+// errors is considered unhealthy until cooldown passes and is only tried
+// after the healthy ones.
+type smsRoute struct {
+	provider ports.SmsProvider
+	weight   int
+	mu       sync.Mutex
+	downAt   time.Time
+}
+
+// NewTelecomService builds the providers listed in SMS_PROVIDERS, a comma
+// separated list of name:weight pairs such as "twilio:3,http:1". The weight
+// defaults to 1 and the list defaults to "twilio".
 func NewTelecomService(logger *utils.Logger) ports.TelecomService {
 	noReplyPhone := os.Getenv("NOREPLY_PHONE")
 	if noReplyPhone == "" {
@@ -28,109 +47,138 @@ func NewTelecomService(logger *utils.Logger) ports.TelecomService {
 	if !ports.PhoneValidator(noReplyPhone) {
 		logger.Fatal(context.Background(), "NOREPLY_PHONE is not valid")
 	}
-	twilioAccountSID := os.Getenv("TWILIO_ACCOUNT_SID")
-	if twilioAccountSID == "" {
-		logger.Fatal(context.Background(), "TWILIO_ACCOUNT_SID is not set")
+	providers := os.Getenv("SMS_PROVIDERS")
+	if providers == "" {
+		providers = string(ports.TwilioSmsProviderName)
 	}
-	twilioAuthToken := os.Getenv("TWILIO_AUTH_TOKEN")
-	if twilioAuthToken == "" {
-		logger.Fatal(context.Background(), "TWILIO_AUTH_TOKEN is not set")
-	}
-	client := twilio.NewRestClientWithParams(twilio.ClientParams{
-		Username: twilioAccountSID,
-		Password: twilioAuthToken,
-	})
-	return &Telecom{
-		logger:  logger,
-		noReply: noReplyPhone,
-		client:  client,
+	cooldown := time.Minute
+	if cooldown_ := os.Getenv("SMS_PROVIDER_COOLDOWN"); cooldown_ != "" {
+		var err error
+		if cooldown, err = time.ParseDuration(cooldown_); err != nil {
+			logger.Fatal(context.Background(), "SMS_PROVIDER_COOLDOWN is not a valid duration")
+		}
 	}
-}
-
-func (s *Telecom) NoReplySend(ctx context.Context, dst []string, message string) (success []string, err error) {
-	defer func() { err = utils.FuncPipe(telecomCaller+".NoReplySend", err) }()
-	type resp struct {
-		addr string
-		err  error
+	s := &Telecom{
+		logger:   logger,
+		noReply:  noReplyPhone,
+		cooldown: cooldown,
 	}
-	respChan := make(chan *resp)
-	var wg sync.WaitGroup
-
-	for _, d := range dst {
-		wg.Add(1)
-		go func(d string) {
-			defer wg.Done()
-			respChan <- &resp{
-				addr: d,
-				err:  s.send(ctx, s.noReply, d, message),
+	for _, entry := range strings.Split(providers, ",") {
+		name, weight_, hasWeight := strings.Cut(strings.TrimSpace(entry), ":")
+		weight := 1
+		if hasWeight {
+			var err error
+			if weight, err = strconv.Atoi(weight_); err != nil || weight < 1 {
+				logger.Fatalf(context.Background(), "SMS_PROVIDERS has an invalid weight for %s", name)
 			}
-		}(d)
+		}
+		if slices.ContainsFunc(s.providers, func(r *smsRoute) bool { return string(r.provider.Name()) == name }) {
+			logger.Fatalf(context.Background(), "SMS_PROVIDERS lists %s more than once", name)
+		}
+		var provider ports.SmsProvider
+		switch ports.SmsProviderName(name) {
+		case ports.TwilioSmsProviderName:
+			provider = clients.NewTwilioSmsProvider(logger)
+		case ports.HttpSmsProviderName:
+			provider = clients.NewHttpSmsProvider(logger)
+		case ports.SinkSmsProviderName:
+			s.sink = clients.NewSinkSmsProvider(logger)
+			provider = s.sink
+		default:
+			logger.Fatalf(context.Background(), "SMS_PROVIDERS has an unknown provider %q", name)
+		}
+		s.providers = append(s.providers, &smsRoute{provider: provider, weight: weight})
 	}
+	return s
+}
 
-	go func() {
-		wg.Wait()
-		close(respChan)
-	}()
+func (s *Telecom) Sink() ports.SmsSink {
+	return s.sink
+}
 
-	for resp_ := range respChan {
-		if resp_.err != nil {
-			err = resp_.err
-		} else {
-			success = append(success, resp_.addr)
-		}
-	}
-	return
+// Deliver sends text from the no-reply number. SMS has no subject or html,
+// so they are ignored.
+func (s *Telecom) Deliver(ctx context.Context, dst, subject, text, html string) (provider, providerMessageId string, err error) {
+	defer func() { err = utils.FuncPipe(telecomCaller+".Deliver", err) }()
+	return s.send(ctx, s.noReply, dst, text)
 }
 
-func (s *Telecom) send(ctx context.Context, src, dst, message string) (err error) {
+func (s *Telecom) send(ctx context.Context, src, dst, message string) (provider, providerMessageId string, err error) {
 	defer func() { err = utils.FuncPipe(telecomCaller+".send", err) }()
 	// TODO_DEL
 	if dst[:11] == "+98920240012" {
-		return
+		return "", "", nil
 	}
-	params := &twilioApi.CreateMessageParams{}
-	params.SetTo(dst)
-	params.SetFrom(src)
-	params.SetBody(message)
-
-	result := make(chan error, 1)
-	go func() {
-		defer close(result)
-		_, err := s.client.Api.CreateMessage(params)
-		if err != nil {
-			result <- fmt.Errorf("failed to send message: %v", err)
-			return
+	var errs []error
+	for _, route := range s.order() {
+		if providerMessageId, err = route.provider.Send(ctx, src, dst, message); err == nil {
+			route.up()
+			return string(route.provider.Name()), providerMessageId, nil
 		}
-		result <- nil
-	}()
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case err := <-result:
-		return err
+		if ctx.Err() != nil {
+			return "", "", ctx.Err()
+		}
+		route.down()
+		s.logger.Error(ctx, err, "sms provider "+string(route.provider.Name())+" failed, trying the next one")
+		errs = append(errs, err)
 	}
+	return "", "", errors.Join(errs...)
 }
 
-const otpMessageHeader string = `Kasragay
+// order returns the healthy providers shuffled by weight, followed by the
+// unhealthy ones, longest down first.
+func (s *Telecom) order() []*smsRoute {
+	now := time.Now()
+	healthy := make([]*smsRoute, 0, len(s.providers))
+	var unhealthy []*smsRoute
+	total := 0
+	for _, route := range s.providers {
+		if route.healthy(now, s.cooldown) {
+			healthy = append(healthy, route)
+			total += route.weight
+		} else {
+			unhealthy = append(unhealthy, route)
+		}
+	}
+	ordered := make([]*smsRoute, 0, len(s.providers))
+	for len(healthy) > 0 {
+		pick := rand.IntN(total)
+		for i, route := range healthy {
+			if pick < route.weight {
+				ordered = append(ordered, route)
+				total -= route.weight
+				healthy = slices.Delete(healthy, i, i+1)
+				break
+			}
+			pick -= route.weight
+		}
+	}
+	slices.SortStableFunc(unhealthy, func(a, b *smsRoute) int {
+		return a.since().Compare(b.since())
+	})
+	return append(ordered, unhealthy...)
+}
 
-This message contains sensitive information.
+func (r *smsRoute) healthy(now time.Time, cooldown time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.downAt.IsZero() || now.Sub(r.downAt) >= cooldown
+}
 
-`
+func (r *smsRoute) since() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.downAt
+}
 
-const (
-	otpAdminSignupKeyMessage     string = otpMessageHeader + "Admin Signup key: %s"
-	otpSignupMessage             string = otpMessageHeader + "Signup code:\n%s"
-	otpSigninMessage             string = otpMessageHeader + "Signin code:\n%s"
-	otpChangePasswordMessage     string = otpMessageHeader + "Change password code:\n%s"
-	otpChangePhoneMessage        string = otpMessageHeader + "Change phone code:\n%s"
-	otpDeleteAccountPhoneMessage string = otpMessageHeader + "Delete account code:\n%s"
-)
+func (r *smsRoute) down() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.downAt = time.Now()
+}
 
-var otpMessages = map[ports.OtpType]string{
-	ports.AdminSignupKeyOtpType: otpAdminSignupKeyMessage,
-	ports.SignupOtpType:         otpSignupMessage,
-	ports.SigninOtpType:         otpSigninMessage,
-	ports.ChangePasswordOtpType: otpChangePasswordMessage,
-	ports.ChangePhoneOtpType:    otpChangePhoneMessage,
-	ports.DeleteAccountOtpType:  otpDeleteAccountPhoneMessage,
+func (r *smsRoute) up() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.downAt = time.Time{}
 }
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+)
+
+const templatesCaller = packageCaller + ".Templates"
+
+// messageTemplatesDir holds one directory per locale, each with the parts of
+// every message template, next to the html layout they share:
+//
+//	_layout.html
+//	{locale}/_labels.tmpl
+//	{locale}/{name}.subject.txt
+//	{locale}/{name}.txt
+//	{locale}/{name}.html
+//	{locale}/{name}.sms.txt
+const messageTemplatesDir = "./templates/messages"
+
+// smsMaxSegments caps how many parts a rendered SMS may take. Providers bill
+// every part, and some carriers drop long concatenated messages.
+const smsMaxSegments = 3
+
+type messageTemplate struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+	sms     *texttemplate.Template
+}
+
+type Templates struct {
+	logger    *utils.Logger
+	mailcom   ports.MailcomService
+	audit     ports.AuditService
+	templates map[ports.MessageTemplateName]map[ports.Locale]*messageTemplate
+}
+
+// NewTemplateService parses every template at startup and renders each one
+// with sample data, so that a broken template or an SMS that does not fit
+// fails the boot instead of a user's request. mailcom and audit are only
+// needed by SendTest and may be nil when it is never called.
+func NewTemplateService(logger *utils.Logger, mailcom ports.MailcomService, audit ports.AuditService) ports.TemplateService {
+	s := &Templates{
+		logger:    logger,
+		mailcom:   mailcom,
+		audit:     audit,
+		templates: make(map[ports.MessageTemplateName]map[ports.Locale]*messageTemplate, len(ports.MessageTemplateNames())),
+	}
+	for _, name := range ports.MessageTemplateNames() {
+		s.templates[name] = make(map[ports.Locale]*messageTemplate, len(ports.Locales()))
+		for _, locale := range ports.Locales() {
+			tmpl, err := loadMessageTemplate(name, locale)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) && locale != ports.DefaultLocale {
+					continue
+				}
+				logger.Fatalf(context.Background(), "Failed to load %s template for %s: %v", name, locale, err)
+			}
+			s.templates[name][locale] = tmpl
+		}
+	}
+	otpTypes := append([]ports.OtpType{ports.AdminSignupKeyOtpType}, ports.OtpTypes...)
+	for _, name := range ports.MessageTemplateNames() {
+		for locale := range s.templates[name] {
+			for _, otpType := range otpTypes {
+				_, err := s.Render(context.Background(), name, locale, ports.SampleMessageTemplateData(name).Merge(&ports.MessageTemplateData{
+					Token:   strings.Repeat("X", 8),
+					OtpType: otpType,
+				}))
+				if err != nil {
+					logger.Fatalf(context.Background(), "Failed to render %s template for %s: %v", name, locale, err)
+				}
+			}
+		}
+	}
+	return s
+}
+
+func (s *Templates) Templates() []*ports.MessageTemplate {
+	templates := make([]*ports.MessageTemplate, 0, len(s.templates))
+	for _, name := range ports.MessageTemplateNames() {
+		template := &ports.MessageTemplate{Name: name}
+		for _, locale := range ports.Locales() {
+			if _, ok := s.templates[name][locale]; ok {
+				template.Locales = append(template.Locales, locale)
+			}
+		}
+		templates = append(templates, template)
+	}
+	return templates
+}
+
+func (s *Templates) Render(ctx context.Context, name ports.MessageTemplateName, locale ports.Locale, data *ports.MessageTemplateData, parts ...ports.MessageTemplatePart) (message *ports.RenderedMessage, err error) {
+	defer func() { err = utils.FuncPipe(templatesCaller+".Render", err) }()
+	locales, ok := s.templates[name]
+	if !ok {
+		return nil, utils.NewInternalError(errors.New("unknown message template " + string(name)))
+	}
+	tmpl, ok := locales[locale]
+	if !ok {
+		locale = ports.DefaultLocale
+		tmpl = locales[locale]
+	}
+	input := *data
+	input.Locale = locale
+	input.Dir = locale.Dir()
+	input.Align = "left"
+	if locale.IsRtl() {
+		input.Align = "right"
+	}
+	if len(parts) == 0 {
+		parts = ports.MessageTemplateParts()
+	}
+
+	message = &ports.RenderedMessage{Template: name, Locale: locale}
+	for _, part := range parts {
+		switch part {
+		case ports.SubjectMessageTemplatePart:
+			if message.Subject, err = executeText(tmpl.subject, &input); err != nil {
+				return nil, err
+			}
+			// A line break in a subject would end the header early.
+			message.Subject = strings.Join(strings.Fields(message.Subject), " ")
+		case ports.TextMessageTemplatePart:
+			if message.Text, err = executeText(tmpl.text, &input); err != nil {
+				return nil, err
+			}
+		case ports.HtmlMessageTemplatePart:
+			var html bytes.Buffer
+			if err = tmpl.html.ExecuteTemplate(&html, "layout", &input); err != nil {
+				return nil, err
+			}
+			message.Html = html.String()
+		case ports.SmsMessageTemplatePart:
+			if message.Sms, err = executeText(tmpl.sms, &input); err != nil {
+				return nil, err
+			}
+			encoding, _, segments := utils.SmsSegments(message.Sms)
+			message.SmsEncoding = string(encoding)
+			message.SmsSegments = segments
+			if segments > smsMaxSegments {
+				return nil, utils.NewInternalError(errors.New(
+					"sms of " + string(name) + " in " + string(locale) + " takes " + strconv.Itoa(segments) +
+						" " + string(encoding) + " segments, more than " + strconv.Itoa(smsMaxSegments),
+				))
+			}
+		default:
+			return nil, utils.NewInternalError(errors.New("unknown message template part " + string(part)))
+		}
+	}
+	return message, nil
+}
+
+func (s *Templates) SendTest(ctx context.Context, req *ports.AdminTemplateTestPostRequest, actorId uuid.UUID) (resp *ports.AdminTemplateTestPostResponse, err error) {
+	defer func() { err = utils.FuncPipe(templatesCaller+".SendTest", err) }()
+	message, err := s.Render(ctx, req.Name, req.Locale, ports.SampleMessageTemplateData(req.Name).Merge(req.Data))
+	if err != nil {
+		return nil, err
+	}
+	resp = &ports.AdminTemplateTestPostResponse{Subject: "[Test] " + message.Subject}
+	_, resp.MessageId, err = s.mailcom.Deliver(ctx, req.Email, resp.Subject, message.Text, message.Html)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.audit.Record(
+		ctx, actorId, ports.AdminUserType, ports.TemplateTestSentAuditAction, uuid.Nil, "",
+		map[string]string{"template": string(req.Name), "locale": string(message.Locale), "email": req.Email},
+	); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// loadMessageTemplate parses the parts of one template in one locale. The
+// labels file is parsed into every part so they can share its definitions.
+func loadMessageTemplate(name ports.MessageTemplateName, locale ports.Locale) (tmpl *messageTemplate, err error) {
+	dir := filepath.Join(messageTemplatesDir, string(locale))
+	labels := filepath.Join(dir, "_labels.tmpl")
+	base := filepath.Join(dir, string(name))
+	if _, err = os.Stat(base + ".html"); err != nil {
+		return nil, err
+	}
+	tmpl = &messageTemplate{}
+	if tmpl.subject, err = parseText(labels, base+".subject.txt"); err != nil {
+		return nil, err
+	}
+	if tmpl.text, err = parseText(labels, base+".txt"); err != nil {
+		return nil, err
+	}
+	if tmpl.sms, err = parseText(labels, base+".sms.txt"); err != nil {
+		return nil, err
+	}
+	tmpl.html, err = htmltemplate.New(filepath.Base(base+".html")).Option("missingkey=error").ParseFiles(
+		filepath.Join(messageTemplatesDir, "_layout.html"), labels, base+".html",
+	)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func parseText(labels, path string) (*texttemplate.Template, error) {
+	return texttemplate.New(filepath.Base(path)).Option("missingkey=error").ParseFiles(labels, path)
+}
+
+func executeText(tmpl *texttemplate.Template, data *ports.MessageTemplateData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
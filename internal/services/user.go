@@ -2,7 +2,10 @@ package services
 
 import (
 	"context"
+	"net/http"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/kasragay/backend/internal/ports"
 	"github.com/kasragay/backend/internal/utils"
 )
@@ -10,11 +13,16 @@ import (
 const userCaller = packageCaller + ".User"
 
 type User struct {
-	logger *utils.Logger
-	cache  ports.CacheRepo
-	rel    ports.RelationalRepo
-	mongo  ports.MongoRepo
-	s3     ports.S3Repo
+	logger   *utils.Logger
+	cache    ports.CacheRepo
+	rel      ports.RelationalRepo
+	mongo    ports.MongoRepo
+	s3       ports.S3Repo
+	realtime ports.RealtimeService
+	activity ports.ActivityService
+	audit    ports.AuditService
+
+	uploadSessionExp time.Duration
 }
 
 func NewUserService(
@@ -23,13 +31,24 @@ func NewUserService(
 	rel ports.RelationalRepo,
 	mongo ports.MongoRepo,
 	s3 ports.S3Repo,
+	realtime ports.RealtimeService,
+	activity ports.ActivityService,
+	audit ports.AuditService,
 ) ports.UserService {
+	uploadSessionExp, err := utils.GetenvAsMinuteDuration("UPLOAD_SESSION_EXP", 15*time.Minute, false)
+	if err != nil {
+		logger.Fatal(context.Background(), err.Error())
+	}
 	return &User{
-		logger: logger,
-		cache:  cache,
-		rel:    rel,
-		mongo:  mongo,
-		s3:     s3,
+		logger:           logger,
+		cache:            cache,
+		rel:              rel,
+		mongo:            mongo,
+		s3:               s3,
+		realtime:         realtime,
+		activity:         activity,
+		audit:            audit,
+		uploadSessionExp: uploadSessionExp,
 	}
 }
 
@@ -52,25 +71,103 @@ func (s *User) UserPut(ctx context.Context, req *ports.UserUserPutRequest) (resp
 	if err != nil {
 		return nil, err
 	}
+	var avatarHash string
 	if img == nil {
 		if err := s.s3.DeleteAvatar(ctx, req.Id, req.UserType); err != nil {
 			return nil, err
 		}
 	} else {
-		if err := s.s3.UploadAvatar(ctx, req.Id, req.UserType, img); err != nil {
+		if avatarHash, err = s.s3.UploadAvatar(ctx, req.Id, req.UserType, img); err != nil {
 			return nil, err
 		}
 	}
-	err = s.rel.UpdateUserProfileById(ctx, req.Id, req.Username, req.Name, req.Avatar, req.UserType)
+	err = s.rel.UpdateUserProfileById(ctx, req.Id, req.Username, req.Name, avatarHash, req.Locale, req.UserType)
+	if err != nil {
+		return nil, err
+	}
+	s.publishProfile(ctx, req.Id, req.UserType)
+	return &ports.UserUserPutResponse{
+		Avatar:  ports.GetAvatarUrl(req.Id, req.UserType, avatarHash),
+		Avatars: ports.GetAvatarVariants(req.Id, req.UserType, avatarHash),
+	}, nil
+}
+
+func (s *User) AvatarUploadPost(ctx context.Context, req *ports.UserAvatarUploadPostRequest) (resp *ports.UploadSession, err error) {
+	defer func() { err = utils.FuncPipe(userCaller+".AvatarUploadPost", err) }()
+	_, isDeleted, err := s.rel.GetUserById(ctx, req.Id, req.UserType)
+	if err != nil {
+		return nil, err
+	}
+	if isDeleted {
+		return nil, utils.UserDeletedResponse.Clone()
+	}
+	session := ports.NewUploadSessionModel(req.Id, req.UserType, ports.AvatarUploadPurpose, req.ContentType, req.Size, s.uploadSessionExp)
+	url, headers, err := s.s3.PresignUpload(ctx, session.ObjectName, session.ContentType, session.Size, s.uploadSessionExp)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.cache.SetUploadSession(ctx, session, s.uploadSessionExp); err != nil {
+		return nil, err
+	}
+	return &ports.UploadSession{
+		SessionId: session.Id,
+		Method:    http.MethodPut,
+		Url:       url,
+		Headers:   headers,
+		ExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+func (s *User) AvatarUploadCompletePost(ctx context.Context, req *ports.UserAvatarUploadCompletePostRequest) (resp *ports.UserUserPutResponse, err error) {
+	defer func() { err = utils.FuncPipe(userCaller+".AvatarUploadCompletePost", err) }()
+	session, err := s.cache.GetUploadSession(ctx, req.SessionId)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.Purpose != ports.AvatarUploadPurpose || !session.IsOwnedBy(req.Id, req.UserType) {
+		return nil, utils.UploadSessionNotFoundResponse.Clone().
+			WithReason("session_id", req.SessionId.String())
+	}
+	data, contentType, err := s.s3.GetUpload(ctx, session.ObjectName, session.Size)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, utils.UploadNotReceivedResponse.Clone().
+			WithReason("session_id", req.SessionId.String())
+	}
+	defer func() {
+		if err := s.s3.DeleteUpload(ctx, session.ObjectName); err != nil {
+			s.logger.Error(ctx, err, "failed to delete upload "+session.ObjectName)
+		}
+		if err := s.cache.DeleteUploadSession(ctx, session.Id); err != nil {
+			s.logger.Error(ctx, err, "failed to delete upload session "+session.Id.String())
+		}
+	}()
+	if contentType != session.ContentType || int64(len(data)) != session.Size {
+		return nil, utils.BadAvatarResponse.Clone().
+			WithReason("content_type", contentType).
+			WithReason("size", len(data))
+	}
+	img, err := ports.AvatarImageReader(data)
 	if err != nil {
 		return nil, err
 	}
+	avatarHash, err := s.s3.UploadAvatar(ctx, req.Id, req.UserType, img)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.rel.UpdateUserAvatarById(ctx, req.Id, req.UserType, avatarHash); err != nil {
+		return nil, err
+	}
+	s.publishProfile(ctx, req.Id, req.UserType)
 	return &ports.UserUserPutResponse{
-		Avatar: ports.GetAvatarUrl(req.Id, req.UserType),
+		Avatar:  ports.GetAvatarUrl(req.Id, req.UserType, avatarHash),
+		Avatars: ports.GetAvatarVariants(req.Id, req.UserType, avatarHash),
 	}, nil
 }
 
-func (s *User) UserDelete(ctx context.Context, req *ports.UserUserDeleteRequest, tokenCheck bool) (err error) {
+func (s *User) UserDelete(ctx context.Context, req *ports.UserUserDeleteRequest, tokenCheck bool, actorId uuid.UUID) (err error) {
 	defer func() { err = utils.FuncPipe(userCaller+".UserDelete", err) }()
 	user, isDeleted, err := s.rel.GetUserById(ctx, req.Id, req.UserType)
 	if err != nil {
@@ -79,13 +176,26 @@ func (s *User) UserDelete(ctx context.Context, req *ports.UserUserDeleteRequest,
 	if isDeleted {
 		return utils.UserDeletedResponse.Clone()
 	}
+	method := ports.AdminActivityMethod
+	if tokenCheck {
+		method = ports.OtpSmsActivityMethod
+	}
+	defer func() {
+		s.activity.Record(ctx, req.Id, req.UserType, ports.AccountDeletedActivityType, method, err)
+	}()
+	// An admin deletion that cannot be audited is not made at all.
+	if !tokenCheck {
+		if err = s.audit.Record(ctx, actorId, ports.AdminUserType, ports.UserDeletedAuditAction, req.Id, req.UserType, nil); err != nil {
+			return err
+		}
+	}
 	if user.GetHasAvatar() {
 		if err = s.s3.DeleteAvatar(ctx, req.Id, req.UserType); err != nil {
 			return err
 		}
 	}
 	if !tokenCheck {
-		return s.rel.DeleteUserById(ctx, req.Id, req.UserType)
+		return s.deleteUser(ctx, req.Id, req.UserType)
 	}
 	cToken, err := s.cache.GetOtpToken(ctx, user.GetPhoneNumber(), ports.DeleteAccountOtpType, req.UserType)
 	if err != nil {
@@ -97,5 +207,66 @@ func (s *User) UserDelete(ctx context.Context, req *ports.UserUserDeleteRequest,
 	if err = s.cache.DeleteOtpToken(ctx, user.GetPhoneNumber(), ports.DeleteAccountOtpType, req.UserType); err != nil {
 		return err
 	}
-	return s.rel.DeleteUserById(ctx, req.Id, req.UserType)
+	return s.deleteUser(ctx, req.Id, req.UserType)
+}
+
+func (s *User) deleteUser(ctx context.Context, id uuid.UUID, userType ports.UserType) (err error) {
+	if err = s.rel.DeleteUserById(ctx, id, userType); err != nil {
+		return err
+	}
+	s.realtime.Publish(ctx, ports.NewUserEvent(id, userType, ports.LogoutEventType, nil))
+	if userType == ports.ClientUserType {
+		return s.mongo.DeleteRelationsOf(ctx, id)
+	}
+	return nil
+}
+
+// publishProfile pushes the profile as it is now to the user's sessions, so
+// that other devices show the change. Like Publish, it only logs failures.
+func (s *User) publishProfile(ctx context.Context, id uuid.UUID, userType ports.UserType) {
+	user, _, err := s.rel.GetUserById(ctx, id, userType)
+	if err != nil || user == nil {
+		if err != nil {
+			s.logger.Error(ctx, utils.FuncPipe(userCaller+".publishProfile", err), "failed to load the profile to publish")
+		}
+		return
+	}
+	s.realtime.Publish(ctx, ports.NewUserEvent(id, userType, ports.ProfileUpdatedEventType, user.ToUser()))
+}
+
+func (s *User) UsernameDenylistGet(ctx context.Context) (resp []*ports.UsernameDenylistEntry, err error) {
+	defer func() { err = utils.FuncPipe(userCaller+".UsernameDenylistGet", err) }()
+	denylist, err := s.rel.GetUsernameDenylist(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp = make([]*ports.UsernameDenylistEntry, 0, len(denylist))
+	for _, entry := range denylist {
+		resp = append(resp, entry.ToUsernameDenylistEntry())
+	}
+	return resp, nil
+}
+
+func (s *User) UsernameDenylistPost(ctx context.Context, req *ports.AdminUsernameDenylistPostRequest, adminId uuid.UUID) (err error) {
+	defer func() { err = utils.FuncPipe(userCaller+".UsernameDenylistPost", err) }()
+	if err = s.rel.AddUsernameToDenylist(ctx, req.Username, req.Reason, adminId); err != nil {
+		return err
+	}
+	ports.AddDeniedUsername(req.Username)
+	return s.audit.Record(
+		ctx, adminId, ports.AdminUserType, ports.UsernameDeniedAuditAction, uuid.Nil, "",
+		map[string]string{"username": req.Username, "reason": req.Reason},
+	)
+}
+
+func (s *User) UsernameDenylistDelete(ctx context.Context, req *ports.AdminUsernameDenylistDeleteRequest, adminId uuid.UUID) (err error) {
+	defer func() { err = utils.FuncPipe(userCaller+".UsernameDenylistDelete", err) }()
+	if err = s.rel.RemoveUsernameFromDenylist(ctx, req.Username); err != nil {
+		return err
+	}
+	ports.RemoveDeniedUsername(req.Username)
+	return s.audit.Record(
+		ctx, adminId, ports.AdminUserType, ports.UsernameAllowedAuditAction, uuid.Nil, "",
+		map[string]string{"username": req.Username},
+	)
 }
@@ -0,0 +1,408 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/kasragay/backend/internal/ports"
+	"github.com/kasragay/backend/internal/utils"
+	"github.com/valyala/fasthttp"
+)
+
+const webhookCaller = packageCaller + ".Webhook"
+
+// webhookConsumerGroup is the domain events consumer group shared by every
+// gateway, so each event is fanned out by one of them.
+const webhookConsumerGroup = "webhooks"
+
+// webhookPollInterval is how often idle workers look for due retries. New
+// deliveries and replays wake a worker right away, and a retry waits at
+// least half of WEBHOOK_RETRY_BASE, so a few seconds late is close enough.
+const webhookPollInterval = 5 * time.Second
+
+// webhookErrorBodyLimit caps how much of a failed response is kept in the
+// delivery log.
+const webhookErrorBodyLimit = 256
+
+type Webhook struct {
+	logger      *utils.Logger
+	mongo       ports.MongoRepo
+	cache       ports.CacheRepo
+	audit       ports.AuditService
+	client      *fasthttp.Client
+	workers     int
+	maxAttempts int
+	retryBase   time.Duration
+	retryMax    time.Duration
+	timeout     time.Duration
+	wake        chan struct{}
+}
+
+func NewWebhookService(logger *utils.Logger, mongo ports.MongoRepo, cache ports.CacheRepo, audit ports.AuditService) ports.WebhookService {
+	return &Webhook{
+		logger:      logger,
+		mongo:       mongo,
+		cache:       cache,
+		audit:       audit,
+		client:      &fasthttp.Client{},
+		workers:     getenvAsPositiveInt(logger, "WEBHOOK_WORKERS", 4),
+		maxAttempts: getenvAsAttempts(logger, "WEBHOOK_MAX_ATTEMPTS", 10),
+		retryBase:   getenvAsDuration(logger, "WEBHOOK_RETRY_BASE", 10*time.Second),
+		retryMax:    getenvAsDuration(logger, "WEBHOOK_RETRY_MAX", time.Hour),
+		timeout:     getenvAsDuration(logger, "WEBHOOK_TIMEOUT", 10*time.Second),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+func (s *Webhook) Webhooks(ctx context.Context, req *ports.AdminWebhooksGetRequest) (resp *ports.AdminWebhooksGetResponse, err error) {
+	defer func() { err = utils.FuncPipe(webhookCaller+".Webhooks", err) }()
+	webhooks, total, err := s.mongo.GetWebhooks(ctx, &req.Pagination)
+	if err != nil {
+		return nil, err
+	}
+	resp = &ports.AdminWebhooksGetResponse{
+		Webhooks: make([]*ports.Webhook, 0, len(webhooks)),
+		Page:     req.Page,
+		Size:     req.Size,
+		Total:    total,
+	}
+	for _, webhook := range webhooks {
+		resp.Webhooks = append(resp.Webhooks, webhook.ToWebhook())
+	}
+	return resp, nil
+}
+
+func (s *Webhook) Create(ctx context.Context, req *ports.AdminWebhooksPostRequest, actorId uuid.UUID) (resp *ports.AdminWebhooksPostResponse, err error) {
+	defer func() { err = utils.FuncPipe(webhookCaller+".Create", err) }()
+	if err = checkWebhookUrl(req.Url); err != nil {
+		return nil, err
+	}
+	secret := req.Secret
+	if secret == "" {
+		key := make([]byte, 32)
+		if _, err = rand.Read(key); err != nil {
+			return nil, err
+		}
+		secret = hex.EncodeToString(key)
+	}
+	webhook := ports.NewWebhookModel(req.Url, req.Events, secret, req.Description, actorId)
+	if err = s.mongo.AddWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+	if err = s.audit.Record(
+		ctx, actorId, ports.AdminUserType, ports.WebhookCreatedAuditAction, uuid.Nil, "",
+		map[string]string{"webhook_id": webhook.Id, "url": webhook.Url},
+	); err != nil {
+		return nil, err
+	}
+	return &ports.AdminWebhooksPostResponse{Webhook: *webhook.ToWebhook(), Secret: secret}, nil
+}
+
+func (s *Webhook) Webhook(ctx context.Context, id string) (webhook *ports.Webhook, err error) {
+	defer func() { err = utils.FuncPipe(webhookCaller+".Webhook", err) }()
+	model, err := s.mongo.GetWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, utils.WebhookNotFoundResponse.Clone().
+			WithReason("id", id)
+	}
+	return model.ToWebhook(), nil
+}
+
+func (s *Webhook) Update(ctx context.Context, req *ports.AdminWebhookPutRequest, actorId uuid.UUID) (webhook *ports.Webhook, err error) {
+	defer func() { err = utils.FuncPipe(webhookCaller+".Update", err) }()
+	if err = checkWebhookUrl(req.Url); err != nil {
+		return nil, err
+	}
+	model, err := s.mongo.GetWebhook(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, utils.WebhookNotFoundResponse.Clone().
+			WithReason("id", req.Id)
+	}
+	model.Url = req.Url
+	model.Events = req.Events
+	model.Description = req.Description
+	model.Active = req.Active
+	if req.Secret != "" {
+		model.Secret = req.Secret
+	}
+	model.UpdatedAt = time.Now().UTC()
+	found, err := s.mongo.UpdateWebhook(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, utils.WebhookNotFoundResponse.Clone().
+			WithReason("id", req.Id)
+	}
+	data := map[string]string{"webhook_id": model.Id, "url": model.Url, "active": strconv.FormatBool(model.Active)}
+	if req.Secret != "" {
+		data["secret_rotated"] = "true"
+	}
+	if err = s.audit.Record(ctx, actorId, ports.AdminUserType, ports.WebhookUpdatedAuditAction, uuid.Nil, "", data); err != nil {
+		return nil, err
+	}
+	return model.ToWebhook(), nil
+}
+
+func (s *Webhook) Delete(ctx context.Context, id string, actorId uuid.UUID) (err error) {
+	defer func() { err = utils.FuncPipe(webhookCaller+".Delete", err) }()
+	deleted, err := s.mongo.DeleteWebhook(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return utils.WebhookNotFoundResponse.Clone().
+			WithReason("id", id)
+	}
+	return s.audit.Record(
+		ctx, actorId, ports.AdminUserType, ports.WebhookDeletedAuditAction, uuid.Nil, "",
+		map[string]string{"webhook_id": id},
+	)
+}
+
+func (s *Webhook) Deliveries(ctx context.Context, req *ports.AdminWebhookDeliveriesGetRequest) (resp *ports.AdminWebhookDeliveriesGetResponse, err error) {
+	defer func() { err = utils.FuncPipe(webhookCaller+".Deliveries", err) }()
+	if _, err = s.Webhook(ctx, req.WebhookId); err != nil {
+		return nil, err
+	}
+	deliveries, total, err := s.mongo.GetWebhookDeliveries(ctx, req.WebhookId, req.Status, &req.Pagination)
+	if err != nil {
+		return nil, err
+	}
+	resp = &ports.AdminWebhookDeliveriesGetResponse{
+		Deliveries: make([]*ports.WebhookDelivery, 0, len(deliveries)),
+		Page:       req.Page,
+		Size:       req.Size,
+		Total:      total,
+	}
+	for _, delivery := range deliveries {
+		resp.Deliveries = append(resp.Deliveries, delivery.ToWebhookDelivery())
+	}
+	return resp, nil
+}
+
+func (s *Webhook) Delivery(ctx context.Context, webhookId, id string) (delivery *ports.WebhookDelivery, err error) {
+	defer func() { err = utils.FuncPipe(webhookCaller+".Delivery", err) }()
+	model, err := s.mongo.GetWebhookDelivery(ctx, webhookId, id)
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, utils.WebhookDeliveryNotFoundResponse.Clone().
+			WithReason("id", id)
+	}
+	return model.ToWebhookDelivery(), nil
+}
+
+func (s *Webhook) Replay(ctx context.Context, webhookId, id string, actorId uuid.UUID) (err error) {
+	defer func() { err = utils.FuncPipe(webhookCaller+".Replay", err) }()
+	if err = s.mongo.ReplayWebhookDelivery(ctx, webhookId, id); err != nil {
+		return err
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return s.audit.Record(
+		ctx, actorId, ports.AdminUserType, ports.WebhookReplayedAuditAction, uuid.Nil, "",
+		map[string]string{"webhook_id": webhookId, "delivery_id": id},
+	)
+}
+
+func (s *Webhook) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.consume(ctx)
+	}()
+	for range s.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// consume turns every domain event into a delivery per subscribed webhook.
+// An event is only acked once all of its deliveries are stored, and storing
+// one twice is a no-op, so a crash in between loses nothing.
+func (s *Webhook) consume(ctx context.Context) {
+	consumer, err := os.Hostname()
+	if err != nil || consumer == "" {
+		consumer = uuid.NewString()
+	}
+	for {
+		err := s.cache.ConsumeDomainEvents(ctx, webhookConsumerGroup, consumer, func(event *ports.DomainEvent) error {
+			return s.fanOut(ctx, event)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		s.logger.Error(ctx, utils.FuncPipe(webhookCaller+".consume", err), "webhooks stopped consuming domain events, resuming")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (s *Webhook) fanOut(ctx context.Context, event *ports.DomainEvent) (err error) {
+	defer func() { err = utils.FuncPipe(webhookCaller+".fanOut", err) }()
+	webhooks, err := s.mongo.GetWebhooksForEvent(ctx, event.Type)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+	body, err := sonic.MarshalString(event)
+	if err != nil {
+		return err
+	}
+	for _, webhook := range webhooks {
+		if _, err = s.mongo.AddWebhookDelivery(ctx, ports.NewWebhookDeliveryModel(webhook.Id, event, body)); err != nil {
+			return err
+		}
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *Webhook) work(ctx context.Context) {
+	pollClaims(ctx, s.wake, webhookPollInterval, func() bool {
+		// The lease outlasts the request, so nobody else claims the
+		// delivery while it is in flight.
+		delivery, err := s.mongo.ClaimWebhookDelivery(ctx, 2*s.timeout)
+		if err != nil {
+			s.logger.Error(ctx, err, "webhooks failed to claim a delivery")
+		}
+		if delivery == nil {
+			return false
+		}
+		s.attempt(ctx, delivery)
+		return true
+	})
+}
+
+// attempt posts a claimed delivery once and records the outcome. Deliveries
+// of a webhook that was deactivated or deleted in the meantime go dead; a
+// replay sends them once it is active again.
+func (s *Webhook) attempt(ctx context.Context, delivery *ports.WebhookDeliveryModel) {
+	started := time.Now().UTC()
+	attempt := &ports.WebhookAttemptModel{AttemptedAt: started}
+	retryable := true
+	webhook, err := s.mongo.GetWebhook(ctx, delivery.WebhookId)
+	switch {
+	case err != nil:
+	case webhook == nil || !webhook.Active:
+		err = errors.New("webhook is deleted or inactive")
+		retryable = false
+	default:
+		attempt.StatusCode, err = s.post(ctx, webhook, delivery)
+	}
+	attempt.DurationMs = time.Since(started).Milliseconds()
+	delivery.UpdatedAt = time.Now().UTC()
+	switch {
+	case err == nil:
+		delivery.Status = ports.SucceededWebhookDeliveryStatus
+		delivery.LastError = ""
+		delivery.SucceededAt = delivery.UpdatedAt
+	case retryable && delivery.Attempts < s.maxAttempts:
+		attempt.Error = err.Error()
+		delivery.LastError = attempt.Error
+		delivery.Status = ports.QueuedWebhookDeliveryStatus
+		delivery.NextAttemptAt = delivery.UpdatedAt.Add(backoff(delivery.Attempts, s.retryBase, s.retryMax))
+	default:
+		attempt.Error = err.Error()
+		delivery.LastError = attempt.Error
+		delivery.Status = ports.DeadWebhookDeliveryStatus
+		s.logger.Warnf(ctx, "webhook delivery %s went dead: %s", delivery.Id, delivery.LastError)
+	}
+	// A gateway shutting down still records the attempt it made. Left
+	// claimed, a delivery the endpoint already accepted would be posted to
+	// it again by whichever gateway claims it next.
+	if err := s.mongo.CompleteWebhookDeliveryAttempt(context.WithoutCancel(ctx), delivery, attempt); err != nil {
+		s.logger.Error(ctx, err, "webhooks failed to record an attempt of delivery "+delivery.Id)
+	}
+}
+
+// post sends the delivery signed as the hex HMAC-SHA256 of
+// "<timestamp>.<body>" with the webhook secret, the same scheme the delivery
+// webhooks we receive are checked with. Only a 2xx response counts, and
+// redirects are not followed.
+func (s *Webhook) post(ctx context.Context, webhook *ports.WebhookModel, delivery *ports.WebhookDeliveryModel) (statusCode int, err error) {
+	defer func() { err = utils.FuncPipe(webhookCaller+".post", err) }()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write([]byte(delivery.Body))
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer func() {
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(resp)
+	}()
+	req.SetRequestURI(webhook.Url)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetContentType("application/json")
+	req.Header.SetUserAgent("Kasragay-Webhooks/1.0")
+	req.Header.Set("X-Webhook-Id", delivery.Id)
+	req.Header.Set("X-Webhook-Event", string(delivery.EventType))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", hex.EncodeToString(mac.Sum(nil)))
+	req.SetBodyString(delivery.Body)
+
+	timeout := s.timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+	if err = s.client.DoTimeout(req, resp, timeout); err != nil {
+		return 0, err
+	}
+	statusCode = resp.StatusCode()
+	if statusCode/100 != 2 {
+		body := resp.Body()
+		if len(body) > webhookErrorBodyLimit {
+			body = body[:webhookErrorBodyLimit]
+		}
+		return statusCode, fmt.Errorf("webhook returned %d: %s", statusCode, string(body))
+	}
+	return statusCode, nil
+}
+
+// checkWebhookUrl only lets plain http through in debug, so that payloads
+// and signatures are not sent in the clear.
+func checkWebhookUrl(rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && (u.Scheme != "http" || !utils.Debug)) {
+		return utils.BadRequestResponse.Clone().
+			WithReason("url", rawUrl)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a parsed schedule in the usual five fields, "minute hour
+// day-of-month month day-of-week", each a "*", a number, a range "a-b" or a
+// comma separated list of those, optionally stepped with "/n". Day of week
+// runs from 0 (Sunday) to 6, and when both day fields are restricted either
+// one matching is enough, as in cron. The shorthands @hourly, @daily,
+// @weekly and @monthly are accepted, and so is "@every <duration>" for fixed
+// intervals. Schedules are evaluated in UTC.
+type CronSchedule struct {
+	spec    string
+	every   time.Duration
+	minutes uint64
+	hours   uint64
+	days    uint64
+	months  uint64
+	weekday uint64
+	anyDay  bool
+	anyWday bool
+}
+
+var cronShorthands = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+func ParseCron(spec string) (*CronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || every < time.Second {
+			return nil, fmt.Errorf("invalid cron interval '%s'", rest)
+		}
+		return &CronSchedule{spec: spec, every: every}, nil
+	}
+	expanded := spec
+	if shorthand, ok := cronShorthands[spec]; ok {
+		expanded = shorthand
+	}
+	fields := strings.Fields(expanded)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron schedule '%s' must have 5 fields", spec)
+	}
+	s := &CronSchedule{spec: spec}
+	var err error
+	if s.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if s.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if s.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if s.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if s.weekday, err = parseCronField(fields[4], 0, 6); err != nil {
+		return nil, err
+	}
+	s.anyDay = fields[2] == "*"
+	s.anyWday = fields[4] == "*"
+	// Fields can be valid one by one yet never meet, as on February 30th.
+	if s.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron schedule '%s' never fires", spec)
+	}
+	return s, nil
+}
+
+func parseCronField(field string, low, high int) (bits uint64, err error) {
+	for part := range strings.SplitSeq(field, ",") {
+		rng, stepStr, stepped := strings.Cut(part, "/")
+		step := 1
+		if stepped {
+			if step, err = strconv.Atoi(stepStr); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid cron step '%s'", part)
+			}
+		}
+		from, to := low, high
+		if rng != "*" {
+			fromStr, toStr, isRange := strings.Cut(rng, "-")
+			if from, err = strconv.Atoi(fromStr); err != nil {
+				return 0, fmt.Errorf("invalid cron value '%s'", part)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(toStr); err != nil {
+					return 0, fmt.Errorf("invalid cron value '%s'", part)
+				}
+			} else if stepped {
+				to = high
+			}
+		}
+		if from < low || to > high || from > to {
+			return 0, fmt.Errorf("cron value '%s' is out of %d-%d", part, low, high)
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (s *CronSchedule) String() string {
+	return s.spec
+}
+
+// Next returns the first time after t the schedule fires, to the minute.
+// Intervals count from t itself.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	// A schedule that fires at all does so within 8 years, the longest gap
+	// between two February 29th; a zero time means it never fires.
+	limit := t.AddDate(9, 0, 0)
+	for t.Before(limit) {
+		if s.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if s.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	wday := s.weekday&(1<<uint(t.Weekday())) != 0
+	if s.anyDay || s.anyWday {
+		return day && wday
+	}
+	return day || wday
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	// A Monday.
+	monday := time.Date(2026, 10, 19, 10, 30, 0, 0, time.UTC)
+	for _, test := range []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		// Steps and ranges.
+		{"*/15 * * * *", monday, time.Date(2026, 10, 19, 10, 45, 0, 0, time.UTC)},
+		{"*/15 * * * *", monday.Add(20 * time.Second), time.Date(2026, 10, 19, 10, 45, 0, 0, time.UTC)},
+		{"0,30 * * * *", monday, time.Date(2026, 10, 19, 11, 0, 0, 0, time.UTC)},
+		{"5-10 * * * *", monday, time.Date(2026, 10, 19, 11, 5, 0, 0, time.UTC)},
+		{"5-10/2 * * * *", time.Date(2026, 10, 19, 11, 6, 0, 0, time.UTC), time.Date(2026, 10, 19, 11, 7, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", monday, time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC)},
+		{"0 20/2 * * *", monday, time.Date(2026, 10, 19, 20, 0, 0, 0, time.UTC)},
+
+		// Either day field matching is enough once both are restricted.
+		{"0 0 1 * 5", monday, time.Date(2026, 10, 23, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * 5", time.Date(2026, 10, 30, 10, 30, 0, 0, time.UTC), time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 */10 * 1", monday, time.Date(2026, 10, 21, 0, 0, 0, 0, time.UTC)},
+		// February 30th never comes, but Mondays in February do.
+		{"0 0 30 2 1", monday, time.Date(2027, 2, 1, 0, 0, 0, 0, time.UTC)},
+		// Both must match while one of them is unrestricted.
+		{"0 0 13 * *", monday, time.Date(2026, 11, 13, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 5", monday, time.Date(2026, 10, 23, 0, 0, 0, 0, time.UTC)},
+
+		// Month and year rollover.
+		{"0 0 31 * *", time.Date(2026, 10, 31, 10, 30, 0, 0, time.UTC), time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", monday, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 23 * 12 *", time.Date(2026, 12, 31, 23, 30, 0, 0, time.UTC), time.Date(2027, 12, 1, 23, 30, 0, 0, time.UTC)},
+		{"0 0 29 2 *", monday, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+
+		// Shorthands.
+		{"@hourly", monday, time.Date(2026, 10, 19, 11, 0, 0, 0, time.UTC)},
+		{"@daily", monday, time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", monday, time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", monday, time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", monday.Add(20 * time.Second), monday.Add(110 * time.Second)},
+		{"@every 36h", monday, monday.Add(36 * time.Hour)},
+
+		// Other zones are evaluated in UTC.
+		{"0 12 * * *", time.Date(2026, 10, 19, 14, 0, 0, 0, time.FixedZone("IRST", 3*3600+1800)), time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)},
+	} {
+		schedule, err := ParseCron(test.spec)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", test.spec, err)
+			continue
+		}
+		if got := schedule.Next(test.from); !got.Equal(test.want) {
+			t.Errorf("%q after %s fires at %s, want %s", test.spec, test.from, got, test.want)
+		}
+	}
+}
+
+func TestParseCronRejects(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 7",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-a * * * *",
+		"@yearly",
+		"@every 500ms",
+		"@every soon",
+		// Every field is valid, but the days never come.
+		"0 0 30 2 *",
+		"0 0 31 4,6,9,11 *",
+	} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("ParseCron(%q) accepted it", spec)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// dkimSignedHeaders are signed when present. From is required by RFC 6376;
+// the rest keep the parts a spammer would want to change under the signature.
+var dkimSignedHeaders = []string{"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type"}
+
+// NewDkimSignOptions returns the options dkim.Sign signs messages with, using
+// relaxed header and body canonicalization, with rsa-sha256 or, for Ed25519
+// keys, ed25519-sha256 (RFC 8463). pemKey is a PEM encoded PKCS#1 or PKCS#8
+// private key, whose public key must be published at
+// {selector}._domainkey.{domain}.
+func NewDkimSignOptions(domain, selector string, pemKey []byte) (*dkim.SignOptions, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("dkim private key is not PEM encoded")
+	}
+	var key any
+	var err error
+	if block.Type == "RSA PRIVATE KEY" {
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	options := &dkim.SignOptions{
+		Domain:                 domain,
+		Selector:               selector,
+		HeaderCanonicalization: dkim.CanonicalizationRelaxed,
+		BodyCanonicalization:   dkim.CanonicalizationRelaxed,
+		HeaderKeys:             dkimSignedHeaders,
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 1024 {
+			return nil, errors.New("dkim rsa key must have at least 1024 bits")
+		}
+		options.Signer = key
+	case ed25519.PrivateKey:
+		options.Signer = key
+	default:
+		return nil, errors.New("dkim private key must be rsa or ed25519")
+	}
+	return options, nil
+}
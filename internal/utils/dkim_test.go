@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+const dkimTestMessage = "From: Kasragay <no-reply@example.com>\r\n" +
+	"To: user@example.org\r\n" +
+	"Subject: Verify your\r\n" +
+	"\temail address\r\n" +
+	"Date: Mon, 19 Oct 2026 10:00:00 +0000\r\n" +
+	"Message-ID: <1@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: text/plain; charset=UTF-8\r\n" +
+	"\r\n" +
+	"Your code is 123456.  \r\n" +
+	"\r\n" +
+	"It expires\tin 10 minutes.\r\n" +
+	"\r\n" +
+	"\r\n"
+
+// dkimTestKey is a signing key with the DNS record that publishes its public
+// half.
+type dkimTestKey struct {
+	name   string
+	pem    []byte
+	record string
+}
+
+func dkimTestKeys(t *testing.T) []dkimTestKey {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPublic, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPkcs8, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []dkimTestKey{
+		{
+			name:   "rsa",
+			pem:    pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+			record: "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(rsaPublic),
+		},
+		{
+			name:   "ed25519",
+			pem:    pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edPkcs8}),
+			record: "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(edPublic),
+		},
+	}
+}
+
+// verifyDkim checks the signatures of msg with an independent verifier that
+// resolves only record, at mail._domainkey.example.com.
+func verifyDkim(t *testing.T, msg []byte, record string) error {
+	t.Helper()
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(msg), &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			if domain != "mail._domainkey.example.com" {
+				t.Fatalf("looked up %s", domain)
+			}
+			return []string{record}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifications) != 1 {
+		t.Fatalf("got %d signatures, want 1", len(verifications))
+	}
+	if verifications[0].Domain != "example.com" {
+		t.Fatalf("signed for %s, want example.com", verifications[0].Domain)
+	}
+	return verifications[0].Err
+}
+
+// dkimSign signs msg with the options NewDkimSignOptions builds for key.
+func dkimSign(t *testing.T, key dkimTestKey, msg string) []byte {
+	t.Helper()
+	options, err := NewDkimSignOptions("example.com", "mail", key.pem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signed bytes.Buffer
+	if err = dkim.Sign(&signed, strings.NewReader(msg), options); err != nil {
+		t.Fatal(err)
+	}
+	return signed.Bytes()
+}
+
+func TestDkimSignOptionsSignaturesVerify(t *testing.T) {
+	for _, key := range dkimTestKeys(t) {
+		t.Run(key.name, func(t *testing.T) {
+			signed := dkimSign(t, key, dkimTestMessage)
+			if err := verifyDkim(t, signed, key.record); err != nil {
+				t.Fatalf("signature does not verify: %v", err)
+			}
+
+			// Relaxed canonicalization survives relays that refold headers
+			// and touch whitespace.
+			relayed := bytes.Replace(signed, []byte("Subject: Verify your\r\n\temail address"), []byte("Subject:  Verify your email\r\n  address"), 1)
+			relayed = bytes.Replace(relayed, []byte("It expires\tin"), []byte("It expires  in"), 1)
+			relayed = append(relayed, "\r\n"...)
+			if err := verifyDkim(t, relayed, key.record); err != nil {
+				t.Fatalf("signature does not survive whitespace changes: %v", err)
+			}
+
+			tampered := bytes.Replace(signed, []byte("123456"), []byte("654321"), 1)
+			if verifyDkim(t, tampered, key.record) == nil {
+				t.Fatal("signature verifies a changed body")
+			}
+			tampered = bytes.Replace(signed, []byte("To: user@example.org"), []byte("To: attacker@example.org"), 1)
+			if verifyDkim(t, tampered, key.record) == nil {
+				t.Fatal("signature verifies a changed header")
+			}
+		})
+	}
+}
+
+func TestDkimSignOptionsSignLastInstance(t *testing.T) {
+	key := dkimTestKeys(t)[1]
+	msg := strings.Replace(dkimTestMessage, "To: user@example.org\r\n", "To: first@example.org\r\nTo: user@example.org\r\n", 1)
+	signed := dkimSign(t, key, msg)
+	if err := verifyDkim(t, signed, key.record); err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+	tampered := bytes.Replace(signed, []byte("To: user@example.org"), []byte("To: attacker@example.org"), 1)
+	if verifyDkim(t, tampered, key.record) == nil {
+		t.Fatal("signature verifies a changed last instance")
+	}
+}
+
+func TestNewDkimSignOptionsRejectsBadKeys(t *testing.T) {
+	if _, err := NewDkimSignOptions("example.com", "mail", []byte("not a key")); err == nil {
+		t.Fatal("accepted a key that is not PEM encoded")
+	}
+	if _, err := NewDkimSignOptions("example.com", "mail", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("garbage")})); err == nil {
+		t.Fatal("accepted a malformed key")
+	}
+}
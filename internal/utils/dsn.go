@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// ErrNotBounceReport is returned for messages that are neither a delivery
+// status notification nor a feedback report, such as auto-replies.
+var ErrNotBounceReport = errors.New("message is not a multipart/report")
+
+// BounceReport is what a delivery status notification (RFC 3464) or an abuse
+// feedback report (RFC 5965) says about a message sent earlier.
+type BounceReport struct {
+	// Feedback is set for feedback reports, which are complaints rather than
+	// bounces. FeedbackType is their type, usually "abuse".
+	Feedback     bool
+	FeedbackType string
+	// MessageId is the Message-ID of the original message, when the report
+	// quotes its headers.
+	MessageId  string
+	Recipients []BounceRecipient
+}
+
+// BounceRecipient is the outcome for one recipient of the original message.
+// Action and Status are empty in feedback reports.
+type BounceRecipient struct {
+	Email      string
+	Action     string
+	Status     string
+	Diagnostic string
+}
+
+// Permanent reports a failure that a retry cannot fix. A failed action with a
+// 4.x.x status only means the server gave up retrying.
+func (r BounceRecipient) Permanent() bool {
+	return r.Action == "failed" && strings.HasPrefix(r.Status, "5.")
+}
+
+// ParseBounceReport reads a multipart/report message. Only the parts it needs
+// are read; the human readable one is ignored.
+func ParseBounceReport(msg []byte) (report *BounceReport, err error) {
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" || params["boundary"] == "" {
+		return nil, ErrNotBounceReport
+	}
+	report = &BounceReport{}
+	var originalTo string
+	parts := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch partType {
+		case "message/delivery-status", "message/global-delivery-status":
+			groups, err := readHeaderGroups(part)
+			if err != nil {
+				return nil, err
+			}
+			// The first group is about the message and names no recipient,
+			// the rest are one per recipient.
+			for _, group := range groups {
+				email := reportAddress(group.Get("Final-Recipient"))
+				if email == "" {
+					email = reportAddress(group.Get("Original-Recipient"))
+				}
+				if email == "" {
+					continue
+				}
+				status, _, _ := strings.Cut(strings.TrimSpace(group.Get("Status")), " ")
+				report.Recipients = append(report.Recipients, BounceRecipient{
+					Email:      email,
+					Action:     strings.ToLower(strings.TrimSpace(group.Get("Action"))),
+					Status:     status,
+					Diagnostic: reportDiagnostic(group.Get("Diagnostic-Code")),
+				})
+			}
+		case "message/feedback-report":
+			groups, err := readHeaderGroups(part)
+			if err != nil {
+				return nil, err
+			}
+			report.Feedback = true
+			for _, group := range groups {
+				if feedbackType := group.Get("Feedback-Type"); feedbackType != "" {
+					report.FeedbackType = strings.ToLower(strings.TrimSpace(feedbackType))
+				}
+				for _, rcpt := range group.Values("Original-Rcpt-To") {
+					if email := reportAddress(rcpt); email != "" {
+						report.Recipients = append(report.Recipients, BounceRecipient{Email: email})
+					}
+				}
+			}
+		case "message/rfc822", "message/global", "text/rfc822-headers", "message/global-headers":
+			header, err := textproto.NewReader(bufio.NewReader(part)).ReadMIMEHeader()
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			report.MessageId = strings.TrimSpace(header.Get("Message-Id"))
+			originalTo = header.Get("To")
+		}
+	}
+	// Feedback reports may leave out who received the message, which is then
+	// only in the quoted headers.
+	if report.Feedback && len(report.Recipients) == 0 && originalTo != "" {
+		addresses, err := mail.ParseAddressList(originalTo)
+		if err == nil {
+			for _, address := range addresses {
+				report.Recipients = append(report.Recipients, BounceRecipient{Email: strings.ToLower(address.Address)})
+			}
+		}
+	}
+	if len(report.Recipients) == 0 {
+		return nil, errors.New("report names no recipient")
+	}
+	return report, nil
+}
+
+// readHeaderGroups reads blocks of header fields separated by blank lines,
+// the layout of delivery status and feedback report parts.
+func readHeaderGroups(r io.Reader) (groups []textproto.MIMEHeader, err error) {
+	reader := textproto.NewReader(bufio.NewReader(r))
+	for {
+		header, err := reader.ReadMIMEHeader()
+		if len(header) > 0 {
+			groups = append(groups, header)
+		}
+		if errors.Is(err, io.EOF) {
+			return groups, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// reportAddress takes the address out of a typed field such as
+// "rfc822; user@example.com". Types other than internet mail are skipped.
+func reportAddress(value string) string {
+	if addressType, address, ok := strings.Cut(value, ";"); ok {
+		addressType = strings.ToLower(strings.TrimSpace(addressType))
+		if addressType != "rfc822" && addressType != "utf-8" {
+			return ""
+		}
+		value = address
+	}
+	value = strings.Trim(strings.TrimSpace(value), "<>")
+	if !strings.Contains(value, "@") {
+		return ""
+	}
+	return strings.ToLower(value)
+}
+
+// reportDiagnostic drops the type of a field such as
+// "smtp; 550 5.1.1 user unknown" and unfolds it.
+func reportDiagnostic(value string) string {
+	if _, diagnostic, ok := strings.Cut(value, ";"); ok {
+		value = diagnostic
+	}
+	return strings.Join(strings.Fields(value), " ")
+}
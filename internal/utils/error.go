@@ -53,6 +53,24 @@ const (
 	UserHasNotSetPhoneNumberAppCode
 	EmailIsTakenByMultipleAppCode
 	PhoneNumberIsTakenByMultipleAppCode
+	UsernameIsReservedAppCode
+	UsernameChangeCooldownAppCode
+	UsernameDeniedAppCode
+	UserIsBlockedAppCode
+	UploadSessionNotFoundAppCode
+	UploadNotReceivedAppCode
+	MediaNotFoundAppCode
+	MediaQuotaExceededAppCode
+	MediaTypeMismatchAppCode
+	SignedUrlInvalidAppCode
+	MessageNotFoundAppCode
+	MessageNotDeadAppCode
+	WebhookSignatureInvalidAppCode
+	EmailSuppressedAppCode
+	WebhookNotFoundAppCode
+	WebhookDeliveryNotFoundAppCode
+	WebhookDeliveryPendingAppCode
+	JobNotFoundAppCode
 )
 
 var (
@@ -78,6 +96,24 @@ var (
 	UserHasNotSetPhoneNumberResponse     = NewError(http.StatusBadRequest, "user has not set phone number").WithAppCode(UserHasNotSetPhoneNumberAppCode)
 	EmailIsTakenByMultipleResponse       = NewError(http.StatusConflict, "email is taken by multiple users").WithAppCode(EmailIsTakenByMultipleAppCode)
 	PhoneNumberIsTakenByMultipleResponse = NewError(http.StatusConflict, "phone number is taken by multiple users").WithAppCode(PhoneNumberIsTakenByMultipleAppCode)
+	UsernameIsReservedResponse           = NewError(http.StatusConflict, "username is reserved").WithAppCode(UsernameIsReservedAppCode)
+	UsernameChangeCooldownResponse       = NewError(http.StatusTooManyRequests, "username was changed too recently").WithAppCode(UsernameChangeCooldownAppCode)
+	UsernameDeniedResponse               = NewError(http.StatusForbidden, "username is not allowed").WithAppCode(UsernameDeniedAppCode)
+	UserIsBlockedResponse                = NewError(http.StatusForbidden, "user is blocked").WithAppCode(UserIsBlockedAppCode)
+	UploadSessionNotFoundResponse        = NewError(http.StatusNotFound, "upload session not found").WithAppCode(UploadSessionNotFoundAppCode)
+	UploadNotReceivedResponse            = NewError(http.StatusConflict, "uploaded object not received").WithAppCode(UploadNotReceivedAppCode)
+	MediaNotFoundResponse                = NewError(http.StatusNotFound, "media not found").WithAppCode(MediaNotFoundAppCode)
+	MediaQuotaExceededResponse           = NewError(http.StatusRequestEntityTooLarge, "media quota exceeded").WithAppCode(MediaQuotaExceededAppCode)
+	MediaTypeMismatchResponse            = NewError(http.StatusUnsupportedMediaType, "media content does not match its type").WithAppCode(MediaTypeMismatchAppCode)
+	SignedUrlInvalidResponse             = NewError(http.StatusForbidden, "signed url is invalid or expired").WithAppCode(SignedUrlInvalidAppCode)
+	MessageNotFoundResponse              = NewError(http.StatusNotFound, "message not found").WithAppCode(MessageNotFoundAppCode)
+	MessageNotDeadResponse               = NewError(http.StatusConflict, "message is not dead-lettered").WithAppCode(MessageNotDeadAppCode)
+	WebhookSignatureInvalidResponse      = NewError(http.StatusUnauthorized, "webhook signature is invalid").WithAppCode(WebhookSignatureInvalidAppCode)
+	EmailSuppressedResponse              = NewError(http.StatusUnprocessableEntity, "email address is suppressed after bounces or complaints").WithAppCode(EmailSuppressedAppCode)
+	WebhookNotFoundResponse              = NewError(http.StatusNotFound, "webhook not found").WithAppCode(WebhookNotFoundAppCode)
+	WebhookDeliveryNotFoundResponse      = NewError(http.StatusNotFound, "webhook delivery not found").WithAppCode(WebhookDeliveryNotFoundAppCode)
+	WebhookDeliveryPendingResponse       = NewError(http.StatusConflict, "webhook delivery is still pending").WithAppCode(WebhookDeliveryPendingAppCode)
+	JobNotFoundResponse                  = NewError(http.StatusNotFound, "job not found").WithAppCode(JobNotFoundAppCode)
 )
 
 type Error struct {
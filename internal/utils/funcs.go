@@ -8,6 +8,8 @@ import (
 	"image/jpeg"
 	"image/png"
 	"math/rand"
+	"mime"
+	"net/http"
 	"os"
 	"reflect"
 	"slices"
@@ -116,9 +118,22 @@ func ImageReader(imgData []byte, convertTo string, size [2]int, validFormats []s
 		return nil, BadAvatarResponse.Clone().
 			WithReason("error", "error decoding image")
 	}
-	if size[0] != 0 && size[1] != 0 && (cfg.Width != size[0] || cfg.Height != size[1]) {
-		img = resize.Resize(uint(size[0]), uint(size[1]), img, resize.Lanczos3)
+	// Re-encoding below drops EXIF, so the orientation is baked into the pixels.
+	// Resizing happens first on the pre-rotation axes to keep the rotation cheap.
+	orientation := 1
+	if format == "jpeg" {
+		orientation = ExifOrientation(imgData)
 	}
+	if size[0] != 0 && size[1] != 0 {
+		width, height := size[0], size[1]
+		if orientation >= 5 {
+			width, height = height, width
+		}
+		if cfg.Width != width || cfg.Height != height {
+			img = resize.Resize(uint(width), uint(height), CropToAspect(img, width, height), resize.Lanczos3)
+		}
+	}
+	img = ApplyOrientation(img, orientation)
 	var buf bytes.Buffer
 	switch convertTo {
 	case "jpg":
@@ -214,3 +229,18 @@ func StringSetNullIfEmpty(str string) *string {
 	}
 	return &str
 }
+
+// BaseContentType strips parameters such as charset from a content type.
+func BaseContentType(contentType string) string {
+	base, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return base
+}
+
+// SniffContentType detects the content type of head, which should hold at
+// least the first 512 bytes of the content, ignoring any parameters.
+func SniffContentType(head []byte) string {
+	return BaseContentType(http.DetectContentType(head))
+}
@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/nfnt/resize"
+)
+
+// ExifOrientation returns the EXIF orientation tag (1-8) of a JPEG image, or 1
+// when the image has no EXIF segment or the tag is missing or malformed.
+func ExifOrientation(imgData []byte) int {
+	if len(imgData) < 4 || imgData[0] != 0xFF || imgData[1] != 0xD8 {
+		return 1
+	}
+	i := 2
+	for i+4 <= len(imgData) {
+		if imgData[i] != 0xFF {
+			return 1
+		}
+		marker := imgData[i+1]
+		if marker == 0xD8 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 {
+			i += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		segLen := int(binary.BigEndian.Uint16(imgData[i+2 : i+4]))
+		if segLen < 2 || i+2+segLen > len(imgData) {
+			return 1
+		}
+		seg := imgData[i+4 : i+2+segLen]
+		if marker == 0xE1 && len(seg) > 6 && string(seg[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(seg[6:])
+		}
+		i += 2 + segLen
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	if order.Uint16(tiff[2:4]) != 42 {
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd : ifd+2]))
+	for n := range entries {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:entry+2]) != 0x0112 {
+			continue
+		}
+		// SHORT (3) with a count of 1 stores the value in the first two bytes.
+		if order.Uint16(tiff[entry+2:entry+4]) != 3 {
+			return 1
+		}
+		orientation := int(order.Uint16(tiff[entry+8 : entry+10]))
+		if orientation < 1 || orientation > 8 {
+			return 1
+		}
+		return orientation
+	}
+	return 1
+}
+
+// ApplyOrientation transforms img so that it displays upright for the given
+// EXIF orientation. Orientations 5-8 swap width and height.
+func ApplyOrientation(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := range h {
+		for x := range w {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// CropToAspect center-crops img to the aspect ratio of width:height.
+func CropToAspect(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	cw, ch := w, h
+	if w*height > h*width {
+		cw = h * width / height
+	} else {
+		ch = w * height / width
+	}
+	if cw == w && ch == h {
+		return img
+	}
+	x0 := b.Min.X + (w-cw)/2
+	y0 := b.Min.Y + (h-ch)/2
+	dst := image.NewNRGBA(image.Rect(0, 0, cw, ch))
+	draw.Draw(dst, dst.Bounds(), img, image.Pt(x0, y0), draw.Src)
+	return dst
+}
+
+// EncodeImageVariant resizes img to a size x size square and encodes it as
+// png or webp. The output never carries metadata from the source image.
+func EncodeImageVariant(img image.Image, size int, format string) (data []byte, err error) {
+	b := img.Bounds()
+	if b.Dx() != size || b.Dy() != size {
+		img = resize.Resize(uint(size), uint(size), CropToAspect(img, 1, 1), resize.Lanczos3)
+	}
+	var buf bytes.Buffer
+	switch format {
+	case "png":
+		encoder := png.Encoder{
+			CompressionLevel: png.BestCompression,
+		}
+		err = encoder.Encode(&buf, img)
+	case "webp":
+		err = nativewebp.Encode(&buf, img, nil)
+	default:
+		return nil, fmt.Errorf("invalid format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
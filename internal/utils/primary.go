@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// primaryKey holds the *primaryPin of a context.
+type primaryKey struct{}
+
+// primaryPin tells whether the relational reads under a context must go to
+// the primary rather than a read replica, which may not have caught up yet.
+type primaryPin struct {
+	pinned atomic.Bool
+}
+
+// UserValueSetter is a request context whose values are set in place, like
+// fasthttp's, so what one handler sets is seen by everything after it.
+type UserValueSetter interface {
+	SetUserValue(key, value any)
+}
+
+// TrackPrimary lets the request behind ctx be pinned to the primary, which
+// PinPrimary does on its first write so that it reads its own writes. A
+// request that is pinned already, like one expected to write, never reads
+// from replicas.
+func TrackPrimary(ctx UserValueSetter, pinned bool) {
+	pin := &primaryPin{}
+	pin.pinned.Store(pinned)
+	ctx.SetUserValue(primaryKey{}, pin)
+}
+
+// WithPrimary sends every relational read under the returned context to the
+// primary. It suits background work that reads what it has just written.
+func WithPrimary(ctx context.Context) context.Context {
+	pin := &primaryPin{}
+	pin.pinned.Store(true)
+	return context.WithValue(ctx, primaryKey{}, pin)
+}
+
+// PinPrimary sends the rest of the reads under ctx to the primary, if ctx is
+// tracked by TrackPrimary or WithPrimary.
+func PinPrimary(ctx context.Context) {
+	if pin, ok := ctx.Value(primaryKey{}).(*primaryPin); ok {
+		pin.pinned.Store(true)
+	}
+}
+
+// ReadsPrimary tells whether the relational reads under ctx must go to the
+// primary.
+func ReadsPrimary(ctx context.Context) bool {
+	pin, ok := ctx.Value(primaryKey{}).(*primaryPin)
+	return ok && pin.pinned.Load()
+}
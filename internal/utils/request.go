@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+type RequestMeta struct {
+	Ip             string
+	UserAgent      string
+	AcceptLanguage string
+}
+
+// clientIpKey holds the client ip resolved by the server for a request.
+type clientIpKey struct{}
+
+// SetRequestIp records the client ip of a request, as resolved by Fiber from
+// the remote address or, behind a trusted proxy, its proxy header.
+func SetRequestIp(ctx UserValueSetter, ip string) {
+	ctx.SetUserValue(clientIpKey{}, ip)
+}
+
+// GetRequestMeta extracts the client metadata from a request context. Handlers
+// pass c.Context() down to the services, so the fasthttp request is available
+// here; any other context yields an empty RequestMeta. Headers sent by the
+// client are never trusted for the ip, only what SetRequestIp recorded.
+func GetRequestMeta(ctx context.Context) RequestMeta {
+	reqCtx, ok := ctx.(*fasthttp.RequestCtx)
+	if !ok {
+		return RequestMeta{}
+	}
+	ip, _ := reqCtx.UserValue(clientIpKey{}).(string)
+	if ip == "" {
+		ip = reqCtx.RemoteIP().String()
+	}
+	return RequestMeta{
+		Ip:             ip,
+		UserAgent:      string(reqCtx.UserAgent()),
+		AcceptLanguage: string(reqCtx.Request.Header.Peek("Accept-Language")),
+	}
+}
+
+// ETagMatches reports whether an If-None-Match header value matches etag,
+// using the weak comparison RFC 9110 requires for conditional GETs.
+func ETagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for candidate := range strings.SplitSeq(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// NotModifiedSince reports whether a resource last modified at lastModified is
+// unchanged according to an If-Modified-Since header value.
+func NotModifiedSince(ifModifiedSince string, lastModified time.Time) bool {
+	if ifModifiedSince == "" || lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// ParseByteRange parses a single-range Range header value against a resource
+// of the given size and returns the inclusive [start, end] offsets. ok is false
+// when the header is absent, malformed or asks for several ranges, in which
+// case the whole resource should be served; satisfiable is false when the
+// range lies outside the resource and a 416 should be returned.
+func ParseByteRange(header string, size int64) (start, end int64, ok, satisfiable bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, false
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found || (first == "" && last == "") {
+		return 0, 0, false, false
+	}
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix < 0 {
+			return 0, 0, false, false
+		}
+		if suffix == 0 || size == 0 {
+			return 0, 0, true, false
+		}
+		return max(size-suffix, 0), size - 1, true, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, false
+	}
+	end = size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false, false
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return 0, 0, true, false
+	}
+	return start, end, true, true
+}
@@ -0,0 +1,58 @@
+package utils
+
+import "unicode/utf16"
+
+type SmsEncoding string
+
+const (
+	Gsm7SmsEncoding SmsEncoding = "gsm-7"
+	Ucs2SmsEncoding SmsEncoding = "ucs-2"
+)
+
+// gsm7Basic is the GSM 03.38 default alphabet; each of these costs one septet.
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsm7Extension characters are sent as an escape plus a septet.
+const gsm7Extension = "\f^{}\\[~]|€"
+
+var gsm7Septets = func() map[rune]int {
+	septets := make(map[rune]int, len(gsm7Basic)+len(gsm7Extension))
+	for _, r := range gsm7Basic {
+		septets[r] = 1
+	}
+	for _, r := range gsm7Extension {
+		septets[r] = 2
+	}
+	return septets
+}()
+
+// SmsSegments reports how text is encoded on the wire and how many message
+// parts it takes. A single GSM-7 part holds 160 septets and a UCS-2 one 70
+// code units; concatenated parts lose room to their header, leaving 153 and
+// 67. Any character outside GSM-7, such as Persian, turns the whole text into
+// UCS-2.
+func SmsSegments(text string) (encoding SmsEncoding, units, segments int) {
+	encoding = Gsm7SmsEncoding
+	for _, r := range text {
+		septets, ok := gsm7Septets[r]
+		if !ok {
+			encoding = Ucs2SmsEncoding
+			break
+		}
+		units += septets
+	}
+	single, multi := 160, 153
+	if encoding == Ucs2SmsEncoding {
+		units = len(utf16.Encode([]rune(text)))
+		single, multi = 70, 67
+	}
+	switch {
+	case units == 0:
+		return encoding, 0, 0
+	case units <= single:
+		return encoding, units, 1
+	default:
+		return encoding, units, (units + multi - 1) / multi
+	}
+}